@@ -1,6 +1,7 @@
 package es
 
 import (
+	"context"
 	"time"
 
 	"github.com/kucjac/cleango/codec"
@@ -28,6 +29,11 @@ type AggregateBase struct {
 	committedEvents   []*Event
 	revision          int64
 	version           int64
+	snapshotRevision  int64
+	snapshotTimestamp int64
+	hashChain         bool
+	lastHash          []byte
+	hashRevision      int64
 }
 
 // SetID sets aggregate id.
@@ -61,7 +67,17 @@ func (a *AggregateBase) Version() int64 {
 }
 
 // SetEvent sets new event message into given aggregate.
+// The event is created with the empty context, thus its correlation id, causation id, actor and metadata are not set
+// until the aggregate is committed with the context carrying them. Use SetEventCtx to have them set on the event,
+// i.e. to check them before the commit.
 func (a *AggregateBase) SetEvent(eventMsg EventMessage) error {
+	return a.SetEventCtx(context.Background(), eventMsg)
+}
+
+// SetEventCtx sets new event message into given aggregate.
+// The event metadata - correlation id, causation id, actor and key-value metadata are taken from the context.
+// See Event.SetContextMetadata for more details.
+func (a *AggregateBase) SetEventCtx(ctx context.Context, eventMsg EventMessage) error {
 	eventData, err := a.eventCodec.Marshal(eventMsg)
 	if err != nil {
 		return err
@@ -76,11 +92,14 @@ func (a *AggregateBase) SetEvent(eventMsg EventMessage) error {
 		EventData:     eventData,
 		Timestamp:     time.Now().UTC().UnixNano(),
 		Revision:      revision + 1,
+		EventVersion:  MessageVersion(eventMsg),
 	}
+	e.SetContextMetadata(ctx)
 
 	if err = a.agg.Apply(e); err != nil {
 		return err
 	}
+	a.chainEvent(e)
 	a.revision++
 	a.timestamp = e.Timestamp
 	a.uncommittedEvents = append(a.uncommittedEvents, e)
@@ -111,7 +130,9 @@ func (a *AggregateBase) NewEvent(id string, msg EventMessage, timestamp time.Tim
 		EventData:     eventData,
 		Timestamp:     timestamp.UnixNano(),
 		Revision:      revision + 1,
+		EventVersion:  MessageVersion(msg),
 	}
+	a.chainEvent(e)
 
 	a.revision++
 	a.timestamp = e.Timestamp
@@ -157,7 +178,17 @@ func (a *AggregateBase) DecodeEventAs(eventData []byte, eventMsg interface{}) er
 	return a.eventCodec.Unmarshal(eventData, eventMsg)
 }
 
+// restoredFrom checks if the stream loaded from the revision of the restored aggregate state starts with its last event.
+// It doesn't if the aggregate events were purged or replaced since the state was taken.
+func (a *AggregateBase) restoredFrom(stream []*Event) bool {
+	return len(stream) > 0 && stream[0].Revision == a.revision && stream[0].Timestamp == a.timestamp
+}
+
 func (a *AggregateBase) reset() {
 	a.revision = 0
 	a.timestamp = 0
+	a.snapshotRevision = 0
+	a.snapshotTimestamp = 0
+	a.lastHash = nil
+	a.hashRevision = 0
 }
@@ -0,0 +1,105 @@
+package es
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/xservice/xquery"
+)
+
+// AggregateRecord is the entry of the storage aggregate catalog.
+type AggregateRecord struct {
+	// ID is the aggregate identifier.
+	ID string
+	// Type is the aggregate type.
+	Type string
+	// InsertedAt is the timestamp (unix nano) of the first aggregate event.
+	InsertedAt int64
+	// Position is the position of the aggregate in the catalog. The aggregates are listed in the order of their positions.
+	Position int64
+}
+
+// ListAggregatesResult is a page of the listed aggregates along with the cursors of the following pages.
+type ListAggregatesResult struct {
+	Aggregates []*AggregateRecord
+	Cursors    xquery.Cursors
+}
+
+// AggregateExists checks if the aggregate with given id and type is stored.
+func (e *Store) AggregateExists(ctx context.Context, aggId, aggType string) (bool, error) {
+	exists, err := e.storage.AggregateExists(ctx, aggId, aggType)
+	if err != nil {
+		return false, e.err("checking aggregate existence failed", err)
+	}
+	return exists, nil
+}
+
+// CountAggregates counts the stored aggregates of given type.
+func (e *Store) CountAggregates(ctx context.Context, aggType string) (int64, error) {
+	count, err := e.storage.CountAggregates(ctx, aggType)
+	if err != nil {
+		return 0, e.err("counting aggregates failed", err)
+	}
+	return count, nil
+}
+
+// ListAggregates gets the page of the aggregates of given type, in the order they were stored.
+// The cursor is one of the xquery.Cursors returned by the previous call for the same aggregate type.
+// If the cursor is empty, the first page is returned.
+func (e *Store) ListAggregates(ctx context.Context, aggType, cursor string, limit int) (*ListAggregatesResult, error) {
+	if limit <= 0 {
+		return nil, cgerrors.ErrInvalidArgument("list aggregates limit needs to be greater than 0")
+	}
+	entry := xquery.CursorEntry{Type: xquery.CursorTypeFirst}
+	if cursor != "" {
+		if err := xquery.DecodeCursor(cursor, &entry); err != nil {
+			return nil, err
+		}
+	}
+	var after int64
+	switch entry.Type {
+	case xquery.CursorTypeFirst:
+	case xquery.CursorTypeThis, xquery.CursorTypeNext:
+		position, err := strconv.ParseInt(entry.Value, 10, 64)
+		if err != nil || position <= 0 {
+			return nil, cgerrors.ErrInvalidArgument("invalid cursor")
+		}
+		after = position
+		if entry.Type == xquery.CursorTypeThis {
+			// The page starts with the aggregate at given position.
+			after--
+		}
+	default:
+		return nil, cgerrors.ErrInvalidArgument("aggregates can only be listed with the first, this and next cursors")
+	}
+
+	// Take one more aggregate than the limit, to check if there is a following page.
+	aggregates, err := e.storage.ListAggregates(ctx, aggType, after, limit+1)
+	if err != nil {
+		return nil, e.err("listing aggregates failed", err)
+	}
+	hasNext := len(aggregates) > limit
+	if hasNext {
+		aggregates = aggregates[:limit]
+	}
+
+	res := &ListAggregatesResult{Aggregates: aggregates}
+	if res.Cursors.First, err = xquery.EncodeCursor(xquery.CursorEntry{Type: xquery.CursorTypeFirst}); err != nil {
+		return nil, err
+	}
+	if len(aggregates) == 0 {
+		return res, nil
+	}
+	first := strconv.FormatInt(aggregates[0].Position, 10)
+	if res.Cursors.This, err = xquery.EncodeCursor(xquery.CursorEntry{Type: xquery.CursorTypeThis, Value: first}); err != nil {
+		return nil, err
+	}
+	if hasNext {
+		last := strconv.FormatInt(aggregates[len(aggregates)-1].Position, 10)
+		if res.Cursors.Next, err = xquery.EncodeCursor(xquery.CursorEntry{Type: xquery.CursorTypeNext, Value: last}); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,91 @@
+package es_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/codec"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esmem"
+)
+
+func TestStoreAggregateCatalog(t *testing.T) {
+	ctx := context.Background()
+	store, err := es.New(es.DefaultConfig(), codec.JSON(), codec.JSON(), esmem.New())
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+
+	aggIds := make([]string, 3)
+	for i := range aggIds {
+		aggIds[i] = fmt.Sprintf("7d1c3e5a-9b2f-4a6c-8e0d-1f3a5c7e9b2%d", i)
+		agg := getTestAggregate(store, aggIds[i])
+		if err = agg.Base.SetEvent(&aggregateCreated{}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		if err = agg.Base.SetEvent(&aggregateNameChanged{Name: "name"}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		if err = store.Commit(ctx, agg); err != nil {
+			t.Fatalf("committing aggregate failed: %v", err)
+		}
+	}
+
+	t.Run("Exists", func(t *testing.T) {
+		exists, err := store.AggregateExists(ctx, aggIds[1], aggregateType)
+		if err != nil {
+			t.Fatalf("checking aggregate existence failed: %v", err)
+		}
+		if !exists {
+			t.Error("expected aggregate to exist")
+		}
+		if exists, err = store.AggregateExists(ctx, aggIds[1], "other"); err != nil || exists {
+			t.Errorf("expected aggregate to not exist, exists: %v, err: %v", exists, err)
+		}
+	})
+
+	t.Run("Count", func(t *testing.T) {
+		count, err := store.CountAggregates(ctx, aggregateType)
+		if err != nil {
+			t.Fatalf("counting aggregates failed: %v", err)
+		}
+		if count != 3 {
+			t.Errorf("expected 3 aggregates but got: %d", count)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		res, err := store.ListAggregates(ctx, aggregateType, "", 2)
+		if err != nil {
+			t.Fatalf("listing aggregates failed: %v", err)
+		}
+		if len(res.Aggregates) != 2 || res.Aggregates[0].ID != aggIds[0] || res.Aggregates[1].ID != aggIds[1] {
+			t.Fatalf("unexpected first page: %v", res.Aggregates)
+		}
+		if res.Cursors.Next == "" {
+			t.Fatal("expected next page cursor")
+		}
+
+		next, err := store.ListAggregates(ctx, aggregateType, res.Cursors.Next, 2)
+		if err != nil {
+			t.Fatalf("listing next aggregates failed: %v", err)
+		}
+		if len(next.Aggregates) != 1 || next.Aggregates[0].ID != aggIds[2] || next.Cursors.Next != "" {
+			t.Errorf("unexpected next page: %v, cursors: %+v", next.Aggregates, next.Cursors)
+		}
+
+		this, err := store.ListAggregates(ctx, aggregateType, res.Cursors.This, 2)
+		if err != nil {
+			t.Fatalf("listing this page failed: %v", err)
+		}
+		if len(this.Aggregates) != 2 || this.Aggregates[0].ID != aggIds[0] {
+			t.Errorf("unexpected this page: %v", this.Aggregates)
+		}
+
+		if _, err = store.ListAggregates(ctx, aggregateType, res.Cursors.First, 0); !cgerrors.IsInvalidArgument(err) {
+			t.Errorf("expected invalid argument error on no limit but got: %v", err)
+		}
+	})
+}
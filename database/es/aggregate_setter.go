@@ -17,6 +17,7 @@ func NewAggregateBaseSetter(eventCodec, snapCodec codec.Codec, idGen IdGenerator
 type AggregateBaseSetter struct {
 	eventCodec, snapCodec codec.Codec
 	idGen                 IdGenerator
+	hashChain             bool
 }
 
 // SetAggregateBase implements AggregateBaseSetter interface.
@@ -29,6 +30,7 @@ func (a *AggregateBaseSetter) SetAggregateBase(agg Aggregate, aggId, aggType str
 		snapCodec:  a.snapCodec,
 		idGen:      a.idGen,
 		version:    version,
+		hashChain:  a.hashChain,
 	}
 	agg.SetBase(base)
 }
@@ -0,0 +1,372 @@
+package es
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kucjac/cleango/cgerrors"
+)
+
+// CacheConfig is the configuration of the CachingStore.
+type CacheConfig struct {
+	// Size is the maximum number of the cached aggregates. The least recently used aggregate is evicted
+	// when the cache is full.
+	Size int
+	// TTL is the time after which the cached aggregate expires. If zero, the aggregates don't expire.
+	TTL time.Duration
+}
+
+// DefaultCacheConfig creates the default aggregate cache config.
+func DefaultCacheConfig() *CacheConfig {
+	return &CacheConfig{Size: 1000}
+}
+
+// Validate checks if the config is valid to use.
+func (c *CacheConfig) Validate() error {
+	if c.Size <= 0 {
+		return cgerrors.ErrInternal("aggregate cache size needs to be greater than 0")
+	}
+	if c.TTL < 0 {
+		return cgerrors.ErrInternal("aggregate cache ttl cannot be negative")
+	}
+	return nil
+}
+
+// CacheStats are the counters of the aggregate cache.
+type CacheStats struct {
+	// Hits is the number of the loads served from the cache, with no newer events stored.
+	Hits int64
+	// Misses is the number of the loads of the aggregates not found in the cache or expired.
+	Misses int64
+	// Stale is the number of the loads of the cached aggregates, which had newer events stored
+	// - i.e. committed by another process.
+	Stale int64
+	// Evictions is the number of the aggregates removed from the cache, due to its size, expiration, failed commit or deletion.
+	Evictions int64
+}
+
+// Compile time check if CachingStore implements EventStore interface.
+var _ EventStore = (*CachingStore)(nil)
+
+// CachingStore is the EventStore decorator, which keeps the snapshots of the recently loaded and committed aggregates
+// in the bounded LRU cache, keyed by the aggregate id, type and version. The aggregate found in the cache is restored
+// from its cached snapshot, and only the events stored from its revision are loaded with ListEventsAfterRevision.
+// The last cached event is loaded to verify the cached state, thus the aggregates purged or re-created since are
+// evicted and loaded from the storage. The cached snapshots are encoded with the store snapshot codec, thus the state
+// of the shredded subjects is redacted when restored, as it is when loaded from the stored snapshot.
+// The cache is updated after each successful commit, and the aggregate is evicted when its commit fails.
+// The cache is local to the process - the aggregates committed by other processes are caught up on load.
+type CachingStore struct {
+	EventStore
+	base  *Store
+	cache *aggregateCache
+	stats struct {
+		hits, misses, stale, evictions int64
+	}
+}
+
+// storeBased is the event store based on the *Store, which exposes it to the CachingStore.
+// It is implemented by the *Store and the stores embedding it - i.e. esstate.Store.
+type storeBased interface {
+	baseStore() *Store
+}
+
+func (e *Store) baseStore() *Store {
+	return e
+}
+
+// NewCachingStore creates a new caching decorator of given event store. The store needs to be the *Store,
+// or embed it - i.e. esstate.Store.
+func NewCachingStore(store EventStore, cfg *CacheConfig) (*CachingStore, error) {
+	if cfg == nil {
+		cfg = DefaultCacheConfig()
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	sb, ok := store.(storeBased)
+	if !ok {
+		return nil, cgerrors.ErrInternalf("caching store requires the event store based on the *es.Store, got: %T", store)
+	}
+	c := &CachingStore{EventStore: store, base: sb.baseStore()}
+	c.cache = newAggregateCache(cfg.Size, cfg.TTL, func() { atomic.AddInt64(&c.stats.evictions, 1) })
+	return c, nil
+}
+
+// Stats gets the current counters of the cache.
+func (c *CachingStore) Stats() CacheStats {
+	return CacheStats{
+		Hits:      atomic.LoadInt64(&c.stats.hits),
+		Misses:    atomic.LoadInt64(&c.stats.misses),
+		Stale:     atomic.LoadInt64(&c.stats.stale),
+		Evictions: atomic.LoadInt64(&c.stats.evictions),
+	}
+}
+
+// LoadEvents loads the aggregate from the cache, along with the events stored after the cached revision.
+// If the aggregate is not cached, all its events are loaded.
+func (c *CachingStore) LoadEvents(ctx context.Context, agg Aggregate) error {
+	return c.load(ctx, agg, c.EventStore.LoadEvents)
+}
+
+// LoadEventsWithSnapshot loads the aggregate from the cache, along with the events stored after the cached revision.
+// If the aggregate is not cached, it is loaded from the latest stored snapshot.
+func (c *CachingStore) LoadEventsWithSnapshot(ctx context.Context, agg Aggregate) error {
+	return c.load(ctx, agg, c.EventStore.LoadEventsWithSnapshot)
+}
+
+// LoadMany loads given aggregates in batches. The cached aggregates are restored from the cache,
+// and the events following their cached revisions are fetched along with the events of the other aggregates.
+func (c *CachingStore) LoadMany(ctx context.Context, aggs ...Aggregate) error {
+	cached := map[*AggregateBase]int64{}
+	restore := func(agg Aggregate) (bool, error) {
+		b := agg.AggBase()
+		key := cacheKeyOf(b)
+		entry, ok := c.cache.get(key)
+		if !ok {
+			atomic.AddInt64(&c.stats.misses, 1)
+			return false, nil
+		}
+		if err := c.restoreEntry(agg, entry); err != nil {
+			c.cache.remove(key)
+			return false, err
+		}
+		cached[b] = entry.revision
+		return true, nil
+	}
+	if err := c.base.loadMany(ctx, aggs, restore); err != nil {
+		for _, agg := range aggs {
+			c.cache.remove(cacheKeyOf(agg.AggBase()))
+		}
+		return err
+	}
+	for _, agg := range aggs {
+		b := agg.AggBase()
+		if revision, ok := cached[b]; ok {
+			if b.revision == revision {
+				atomic.AddInt64(&c.stats.hits, 1)
+				continue
+			}
+			atomic.AddInt64(&c.stats.stale, 1)
+		}
+		c.put(agg)
+	}
+	return nil
+}
+
+// Commit commits the aggregate and updates its cached snapshot. If the commit fails, the aggregate is evicted.
+func (c *CachingStore) Commit(ctx context.Context, agg Aggregate) error {
+	if err := c.EventStore.Commit(ctx, agg); err != nil {
+		c.cache.remove(cacheKeyOf(agg.AggBase()))
+		return err
+	}
+	c.put(agg)
+	return nil
+}
+
+// CommitAll commits all the aggregates and updates their cached snapshots. If the commit fails, the aggregates are evicted.
+func (c *CachingStore) CommitAll(ctx context.Context, aggs ...Aggregate) error {
+	if err := c.EventStore.CommitAll(ctx, aggs...); err != nil {
+		for _, agg := range aggs {
+			c.cache.remove(cacheKeyOf(agg.AggBase()))
+		}
+		return err
+	}
+	for _, agg := range aggs {
+		c.put(agg)
+	}
+	return nil
+}
+
+// Delete marks given aggregate as deleted and evicts it from the cache.
+func (c *CachingStore) Delete(ctx context.Context, agg Aggregate) error {
+	defer c.cache.remove(cacheKeyOf(agg.AggBase()))
+	return c.EventStore.Delete(ctx, agg)
+}
+
+// SaveSnapshot saves the snapshot of given aggregate and updates its cached snapshot.
+func (c *CachingStore) SaveSnapshot(ctx context.Context, agg Aggregate) error {
+	if err := c.EventStore.SaveSnapshot(ctx, agg); err != nil {
+		return err
+	}
+	c.put(agg)
+	return nil
+}
+
+// Evict removes the aggregate with given id, type and version from the cache.
+func (c *CachingStore) Evict(aggId, aggType string, version int64) {
+	c.cache.remove(cacheKey{id: aggId, aggType: aggType, version: version})
+}
+
+func (c *CachingStore) load(ctx context.Context, agg Aggregate, fallback func(ctx context.Context, agg Aggregate) error) error {
+	b := agg.AggBase()
+	key := cacheKeyOf(b)
+	entry, ok := c.cache.get(key)
+	if !ok {
+		atomic.AddInt64(&c.stats.misses, 1)
+		return c.loadMissed(ctx, agg, fallback)
+	}
+
+	if err := c.restoreEntry(agg, entry); err != nil {
+		c.cache.remove(key)
+		return err
+	}
+
+	events, err := c.base.storage.ListEventsAfterRevision(ctx, b.id, b.aggType, b.revision-1)
+	if err != nil {
+		return c.base.err("listing events after revision failed", err)
+	}
+	if !b.restoredFrom(events) {
+		// The aggregate was purged or re-created since it was cached.
+		c.cache.remove(key)
+		resetAggregate(agg)
+		atomic.AddInt64(&c.stats.misses, 1)
+		return c.loadMissed(ctx, agg, fallback)
+	}
+	events = events[1:]
+	if len(events) == 0 {
+		atomic.AddInt64(&c.stats.hits, 1)
+		return nil
+	}
+	atomic.AddInt64(&c.stats.stale, 1)
+	if err = c.base.applyStream(agg, events); err != nil {
+		c.cache.remove(key)
+		return err
+	}
+	c.put(agg)
+	return nil
+}
+
+// loadMissed loads the aggregate not found in the cache with the fallback function, and caches it.
+func (c *CachingStore) loadMissed(ctx context.Context, agg Aggregate, fallback func(ctx context.Context, agg Aggregate) error) error {
+	if err := fallback(ctx, agg); err != nil {
+		return err
+	}
+	c.put(agg)
+	return nil
+}
+
+// restoreEntry restores the aggregate state from the cache entry.
+func (c *CachingStore) restoreEntry(agg Aggregate, entry *cacheEntry) error {
+	if err := c.base.snapCodec.Unmarshal(entry.data, agg); err != nil {
+		return err
+	}
+	b := agg.AggBase()
+	b.revision, b.timestamp = entry.revision, entry.timestamp
+	b.snapshotRevision, b.snapshotTimestamp = entry.snapshotRevision, entry.snapshotTimestamp
+	b.lastHash, b.hashRevision = entry.hash, entry.revision
+	return nil
+}
+
+// put stores the snapshot of the aggregate state in the cache. The aggregates with uncommitted events are not cached.
+func (c *CachingStore) put(agg Aggregate) {
+	b := agg.AggBase()
+	if len(b.uncommittedEvents) > 0 || b.revision == 0 || checkDeleted(b) != nil {
+		return
+	}
+	data, err := c.base.snapCodec.Marshal(agg)
+	if err != nil {
+		c.cache.remove(cacheKeyOf(b))
+		return
+	}
+	hash, _ := b.eventHash(b.revision)
+	c.cache.put(cacheKeyOf(b), &cacheEntry{
+		data:              data,
+		revision:          b.revision,
+		timestamp:         b.timestamp,
+		snapshotRevision:  b.snapshotRevision,
+		snapshotTimestamp: b.snapshotTimestamp,
+		hash:              hash,
+	})
+}
+
+type cacheKey struct {
+	id, aggType string
+	version     int64
+}
+
+func cacheKeyOf(b *AggregateBase) cacheKey {
+	return cacheKey{id: b.id, aggType: b.aggType, version: b.version}
+}
+
+type cacheEntry struct {
+	key               cacheKey
+	data              []byte
+	revision          int64
+	timestamp         int64
+	snapshotRevision  int64
+	snapshotTimestamp int64
+	hash              []byte
+	expiresAt         time.Time
+}
+
+// aggregateCache is the LRU cache of the aggregate snapshots with the optional expiration.
+type aggregateCache struct {
+	l       sync.Mutex
+	size    int
+	ttl     time.Duration
+	ll      *list.List
+	items   map[cacheKey]*list.Element
+	evicted func()
+}
+
+func newAggregateCache(size int, ttl time.Duration, evicted func()) *aggregateCache {
+	return &aggregateCache{
+		size:    size,
+		ttl:     ttl,
+		ll:      list.New(),
+		items:   make(map[cacheKey]*list.Element, size),
+		evicted: evicted,
+	}
+}
+
+func (c *aggregateCache) get(key cacheKey) (*cacheEntry, bool) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if c.ttl > 0 && time.Now().After(entry.expiresAt) {
+		c.removeElement(elem)
+		return nil, false
+	}
+	c.ll.MoveToFront(elem)
+	return entry, true
+}
+
+func (c *aggregateCache) put(key cacheKey, entry *cacheEntry) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	entry.key = key
+	if c.ttl > 0 {
+		entry.expiresAt = time.Now().Add(c.ttl)
+	}
+	if elem, ok := c.items[key]; ok {
+		elem.Value = entry
+		c.ll.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.ll.PushFront(entry)
+	if c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *aggregateCache) remove(key cacheKey) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+func (c *aggregateCache) removeElement(elem *list.Element) {
+	c.ll.Remove(elem)
+	delete(c.items, elem.Value.(*cacheEntry).key)
+	c.evicted()
+}
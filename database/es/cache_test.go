@@ -0,0 +1,193 @@
+package es_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/codec"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esmem"
+)
+
+func TestCachingStore(t *testing.T) {
+	ctx := context.Background()
+	const (
+		aggId   = "7a3e9c1f-5b2d-4e8a-b6f4-0d2c8a6e4f19"
+		otherId = "c1f5a9e3-7d4b-4a2c-9e8f-6b0d4f2a8c37"
+	)
+	storage := esmem.New()
+	cfg := es.DefaultConfig()
+	cfg.HashChain = true
+	store, err := es.New(cfg, codec.JSON(), codec.JSON(), storage)
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+	cached, err := es.NewCachingStore(store, &es.CacheConfig{Size: 1})
+	if err != nil {
+		t.Fatalf("creating caching store failed: %v", err)
+	}
+
+	agg := getTestAggregate(store, aggId)
+	if err = agg.Base.SetEvent(&aggregateCreated{}); err != nil {
+		t.Fatalf("setting event failed: %v", err)
+	}
+	if err = agg.Base.SetEvent(&aggregateNameChanged{Name: "first"}); err != nil {
+		t.Fatalf("setting event failed: %v", err)
+	}
+	if err = cached.Commit(ctx, agg); err != nil {
+		t.Fatalf("committing aggregate failed: %v", err)
+	}
+
+	loaded := getTestAggregate(store, aggId)
+	if err = cached.LoadEventsWithSnapshot(ctx, loaded); err != nil {
+		t.Fatalf("loading aggregate failed: %v", err)
+	}
+	if loaded.Name != "first" || loaded.Base.Revision() != 2 {
+		t.Fatalf("unexpected cached aggregate state: %s, revision: %d", loaded.Name, loaded.Base.Revision())
+	}
+	if s := cached.Stats(); s.Hits != 1 || s.Misses != 0 {
+		t.Fatalf("expected a single cache hit, but got: %+v", s)
+	}
+
+	// The aggregate is changed bypassing the cache, i.e. by another process.
+	other := getTestAggregate(store, aggId)
+	if err = store.LoadEvents(ctx, other); err != nil {
+		t.Fatalf("loading aggregate failed: %v", err)
+	}
+	if err = other.Base.SetEvent(&aggregateNameChanged{Name: "second"}); err != nil {
+		t.Fatalf("setting event failed: %v", err)
+	}
+	if err = store.Commit(ctx, other); err != nil {
+		t.Fatalf("committing aggregate failed: %v", err)
+	}
+
+	loaded = getTestAggregate(store, aggId)
+	if err = cached.LoadEvents(ctx, loaded); err != nil {
+		t.Fatalf("loading aggregate failed: %v", err)
+	}
+	if loaded.Name != "second" || loaded.Base.Revision() != 3 {
+		t.Fatalf("expected the cached aggregate to catch up, but is: %s, revision: %d", loaded.Name, loaded.Base.Revision())
+	}
+	if s := cached.Stats(); s.Stale != 1 {
+		t.Fatalf("expected a single stale load, but got: %+v", s)
+	}
+
+	// The aggregate restored from the cache links its new events with the stored ones.
+	if err = loaded.Base.SetEvent(&aggregateNameChanged{Name: "third"}); err != nil {
+		t.Fatalf("setting event failed: %v", err)
+	}
+	if err = cached.Commit(ctx, loaded); err != nil {
+		t.Fatalf("committing aggregate failed: %v", err)
+	}
+	if err = store.VerifyAggregateHashChain(ctx, aggId, aggregateType); err != nil {
+		t.Errorf("verifying hash chain failed: %v", err)
+	}
+
+	t.Run("Conflict", func(t *testing.T) {
+		if err := other.Base.SetEvent(&aggregateNameChanged{Name: "conflict"}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		failCtx := es.WithCommitPolicy(ctx, es.CommitPolicy{Strategy: es.ConflictFail})
+		if err := cached.Commit(failCtx, other); !es.IsConflict(err) {
+			t.Fatalf("expected conflict error but got: %v", err)
+		}
+		before := cached.Stats()
+		loaded := getTestAggregate(store, aggId)
+		if err := cached.LoadEvents(ctx, loaded); err != nil {
+			t.Fatalf("loading aggregate failed: %v", err)
+		}
+		if s := cached.Stats(); s.Misses != before.Misses+1 {
+			t.Errorf("expected the conflicted aggregate to be evicted, but got: %+v", s)
+		}
+		if loaded.Name != "third" {
+			t.Errorf("expected the committed state, but got: %s", loaded.Name)
+		}
+	})
+
+	t.Run("Size", func(t *testing.T) {
+		agg := getTestAggregate(store, otherId)
+		if err := agg.Base.SetEvent(&aggregateCreated{}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		before := cached.Stats()
+		if err := cached.Commit(ctx, agg); err != nil {
+			t.Fatalf("committing aggregate failed: %v", err)
+		}
+		if s := cached.Stats(); s.Evictions != before.Evictions+1 {
+			t.Errorf("expected the least recently used aggregate to be evicted, but got: %+v", s)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		agg := getTestAggregate(store, otherId)
+		if err := cached.LoadEvents(ctx, agg); err != nil {
+			t.Fatalf("loading aggregate failed: %v", err)
+		}
+		if err := cached.Delete(ctx, agg); err != nil {
+			t.Fatalf("deleting aggregate failed: %v", err)
+		}
+		if err := cached.LoadEvents(ctx, getTestAggregate(store, otherId)); !es.IsDeleted(err) {
+			t.Errorf("expected deleted error but got: %v", err)
+		}
+	})
+}
+
+func TestCachingStorePurged(t *testing.T) {
+	ctx := context.Background()
+	const aggId = "3b5d7f9a-1c3e-4a5b-8d7f-9e1a3c5b7d02"
+	storage := &replaceableStorage{Storage: esmem.New()}
+	store, err := es.New(es.DefaultConfig(), codec.JSON(), codec.JSON(), storage)
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+	cached, err := es.NewCachingStore(store, nil)
+	if err != nil {
+		t.Fatalf("creating caching store failed: %v", err)
+	}
+
+	create := func(t *testing.T, s es.EventStore, name string) {
+		agg := getTestAggregate(store, aggId)
+		if err := agg.Base.SetEvent(&aggregateCreated{}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		if err := agg.Base.SetEvent(&aggregateNameChanged{Name: name}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		if err := s.Commit(ctx, agg); err != nil {
+			t.Fatalf("committing aggregate failed: %v", err)
+		}
+	}
+	create(t, cached, "first")
+
+	t.Run("Recreated", func(t *testing.T) {
+		// The aggregate is purged and created again with the same id, bypassing the cache.
+		storage.Storage = esmem.New()
+		create(t, store, "recreated")
+
+		loaded := getTestAggregate(store, aggId)
+		if err := cached.LoadEvents(ctx, loaded); err != nil {
+			t.Fatalf("loading aggregate failed: %v", err)
+		}
+		if loaded.Name != "recreated" || loaded.Base.Revision() != 2 {
+			t.Errorf("expected the re-created aggregate state, but got: %s, revision: %d", loaded.Name, loaded.Base.Revision())
+		}
+	})
+
+	t.Run("Purged", func(t *testing.T) {
+		storage.Storage = esmem.New()
+		if err := cached.LoadEvents(ctx, getTestAggregate(store, aggId)); !cgerrors.IsNotFound(err) {
+			t.Errorf("expected not found error on the purged aggregate but got: %v", err)
+		}
+		create(t, cached, "first")
+		storage.Storage = esmem.New()
+		if err := cached.LoadMany(ctx, getTestAggregate(store, aggId)); !cgerrors.IsNotFound(err) {
+			t.Errorf("expected not found error on loading many purged aggregates but got: %v", err)
+		}
+	})
+}
+
+// replaceableStorage allows to replace the storage content, as if it was purged bypassing the store.
+type replaceableStorage struct {
+	es.Storage
+}
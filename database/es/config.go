@@ -15,6 +15,14 @@ type EventCodec codec.Codec
 // Config is the configuration for the eventsource storage.
 type Config struct {
 	BufferSize int
+	// CommitPolicy is the default policy used on the commit revision conflict.
+	// It could be overwritten per commit call with the WithCommitPolicy context.
+	CommitPolicy CommitPolicy
+	// Snapshot is the configuration of the snapshots taken automatically on commit.
+	Snapshot SnapshotConfig
+	// HashChain enables the tamper-evident hash chain over the aggregate event streams.
+	// Each new event stores its hash along with the hash of the previous aggregate event (see Event.ComputeHash).
+	HashChain bool
 }
 
 // DefaultConfig sets up the default config for the event store.
@@ -31,5 +39,11 @@ func (c *Config) Validate() error {
 	if c.BufferSize < 0 {
 		return errors.New("event store buffer size is lower than 0")
 	}
+	if err := c.CommitPolicy.Validate(); err != nil {
+		return err
+	}
+	if err := c.Snapshot.Validate(); err != nil {
+		return err
+	}
 	return nil
 }
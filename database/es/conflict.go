@@ -0,0 +1,118 @@
+package es
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kucjac/cleango/cgerrors"
+)
+
+// ConflictStrategy defines how the Store reacts on a concurrent revision conflict while committing events.
+type ConflictStrategy int
+
+const (
+	// ConflictRetry reloads the aggregate and re-applies uncommitted events on top of its latest state.
+	// This is the default strategy.
+	ConflictRetry ConflictStrategy = iota
+	// ConflictFail returns a *ConflictError immediately, without any retry.
+	ConflictFail
+	// ConflictResolve calls the CommitPolicy.Resolver with the concurrently committed events
+	// and re-applies uncommitted events only if it doesn't return an error.
+	ConflictResolve
+)
+
+// String implements fmt.Stringer interface.
+func (c ConflictStrategy) String() string {
+	switch c {
+	case ConflictRetry:
+		return "retry"
+	case ConflictFail:
+		return "fail"
+	case ConflictResolve:
+		return "resolve"
+	default:
+		return fmt.Sprintf("ConflictStrategy(%d)", int(c))
+	}
+}
+
+// ConflictResolver is a function that inspects the events committed concurrently to the aggregate
+// before the pending (uncommitted) events are re-applied on top of them.
+// The aggregate is already reloaded to its latest state.
+// If the resolver returns an error the commit is aborted and the error is returned to the caller.
+type ConflictResolver func(ctx context.Context, agg Aggregate, concurrent, pending []*Event) error
+
+// CommitPolicy is the policy used by the Store when a commit fails on the revision conflict.
+type CommitPolicy struct {
+	// Strategy defines the reaction on the conflict.
+	Strategy ConflictStrategy
+	// MaxRetries is the maximum number of commit retries for the ConflictRetry and ConflictResolve strategies.
+	// A zero value means no limit.
+	MaxRetries int
+	// Resolver is the conflict resolver function used by the ConflictResolve strategy.
+	Resolver ConflictResolver
+}
+
+// Validate checks if the commit policy is valid.
+func (p *CommitPolicy) Validate() error {
+	switch p.Strategy {
+	case ConflictRetry, ConflictFail:
+	case ConflictResolve:
+		if p.Resolver == nil {
+			return cgerrors.ErrInternal("no conflict resolver provided for the resolve commit policy")
+		}
+	default:
+		return cgerrors.ErrInternalf("unknown commit conflict strategy: %s", p.Strategy)
+	}
+	if p.MaxRetries < 0 {
+		return cgerrors.ErrInternal("commit policy max retries is lower than 0")
+	}
+	return nil
+}
+
+func (p *CommitPolicy) retriesExceeded(retry int) bool {
+	return p.MaxRetries > 0 && retry >= p.MaxRetries
+}
+
+type commitPolicyCtxKey struct{}
+
+// WithCommitPolicy sets up the commit policy within given context.
+// The policy overrides the Store default policy for the commits done with the resulting context.
+func WithCommitPolicy(ctx context.Context, policy CommitPolicy) context.Context {
+	return context.WithValue(ctx, commitPolicyCtxKey{}, policy)
+}
+
+// CommitPolicyFromContext gets the commit policy stored in given context.
+func CommitPolicyFromContext(ctx context.Context) (CommitPolicy, bool) {
+	p, ok := ctx.Value(commitPolicyCtxKey{}).(CommitPolicy)
+	return p, ok
+}
+
+// Compile time check if ConflictError implements cgerrors.ErrorCoder.
+var _ cgerrors.ErrorCoder = (*ConflictError)(nil)
+
+// ConflictError is an error returned by the commit when the aggregate events were concurrently committed
+// by another process and the commit policy doesn't allow to retry it.
+type ConflictError struct {
+	AggregateID      string
+	AggregateType    string
+	ExpectedRevision int64
+	ActualRevision   int64
+}
+
+// Error implements error interface.
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("aggregate: %s with id: %s concurrency conflict - expected revision: %d, actual: %d",
+		e.AggregateType, e.AggregateID, e.ExpectedRevision, e.ActualRevision)
+}
+
+// ErrorCode implements cgerrors.ErrorCoder interface.
+func (e *ConflictError) ErrorCode(error) cgerrors.ErrorCode {
+	return cgerrors.CodeAlreadyExists
+}
+
+// IsConflict checks if given error is a *ConflictError.
+func IsConflict(err error) bool {
+	var ce *ConflictError
+	return errors.As(err, &ce)
+}
@@ -0,0 +1,130 @@
+package escrypto
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/codec"
+)
+
+// DataSubject is the interface of the event messages and aggregates containing the personal data of a subject.
+// Their encoded payloads are encrypted with the data key of the subject returned by the DataSubject method.
+// If the subject is empty, the payload is not encrypted.
+type DataSubject interface {
+	DataSubject() string
+}
+
+// Redactable is an optional interface of the decoded event messages and aggregates.
+// If the data key of the payload subject was shredded, the Redact method is called instead of decoding the payload.
+// The values not implementing it are left unchanged.
+type Redactable interface {
+	Redact(subject string)
+}
+
+// envelopeMagic prefixes the encrypted payloads. None of the supported codecs starts its output with the zero byte.
+var envelopeMagic = []byte{0x00, 'e', 's', 'c'}
+
+// Compile time check if Codec implements codec.Codec interface.
+var _ codec.Codec = (*Codec)(nil)
+
+// Codec is the codec.Codec wrapper, which encrypts the payloads of the DataSubject values with their subject data key.
+// It could be used as both es.EventCodec and es.SnapshotCodec. The payloads encoded without encryption are decoded
+// as is, thus the codec could be introduced to the store with already stored events.
+// The codec interface doesn't take the context, thus the key storage is accessed with the background context.
+type Codec struct {
+	codec   codec.Codec
+	keyring *Keyring
+}
+
+// NewCodec creates a new encrypting codec wrapping given one.
+func NewCodec(c codec.Codec, keyring *Keyring) *Codec {
+	return &Codec{codec: c, keyring: keyring}
+}
+
+// Marshal encodes the input with the wrapped codec, and encrypts it if the input implements DataSubject interface.
+// Implements codec.Codec interface.
+func (c *Codec) Marshal(v interface{}) ([]byte, error) {
+	data, err := c.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	ds, ok := v.(DataSubject)
+	if !ok || ds.DataSubject() == "" {
+		return data, nil
+	}
+	subject := ds.DataSubject()
+	keyID, aead, err := c.keyring.currentKey(context.Background(), subject)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := seal(aead, data, []byte(subject))
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(envelopeMagic)+binary.MaxVarintLen64+len(subject)+len(keyID)+len(sealed)))
+	buf.Write(envelopeMagic)
+	var length [binary.MaxVarintLen64]byte
+	buf.Write(length[:binary.PutUvarint(length[:], uint64(len(subject)))])
+	buf.WriteString(subject)
+	buf.Write(keyID)
+	buf.Write(sealed)
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decrypts the payload if it is encrypted, and decodes it with the wrapped codec.
+// If the subject data key the payload was encrypted with was shredded, the output is redacted (see Redactable) instead of decoded.
+// Implements codec.Codec interface.
+func (c *Codec) Unmarshal(data []byte, v interface{}) error {
+	if !IsEncrypted(data) {
+		return c.codec.Unmarshal(data, v)
+	}
+	subject, keyID, sealed, err := parseEnvelope(data[len(envelopeMagic):])
+	if err != nil {
+		return err
+	}
+	aead, err := c.keyring.dataKey(context.Background(), subject, keyID)
+	if err != nil {
+		if !cgerrors.IsNotFound(err) {
+			return err
+		}
+		if r, ok := v.(Redactable); ok {
+			r.Redact(subject)
+		}
+		return nil
+	}
+	plaintext, err := open(aead, sealed, []byte(subject))
+	if err != nil {
+		return cgerrors.ErrInternalf("decrypting payload of subject: %s failed: %v", subject, err)
+	}
+	return c.codec.Unmarshal(plaintext, v)
+}
+
+// Encoding gets the encoding of the wrapped codec.
+// Implements codec.Codec interface.
+func (c *Codec) Encoding() string {
+	return c.codec.Encoding()
+}
+
+// Name gets the name of the codec.
+// Implements codec.Codec interface.
+func (c *Codec) Name() string {
+	return "encrypted-" + c.codec.Name()
+}
+
+// IsEncrypted checks if given payload is encrypted by the Codec.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, envelopeMagic)
+}
+
+// parseEnvelope parses the subject, the data key identifier and the sealed payload of the envelope.
+func parseEnvelope(data []byte) (subject string, keyID, sealed []byte, err error) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < length+keyIDSize {
+		return "", nil, nil, cgerrors.ErrInternal("malformed encrypted payload")
+	}
+	data = data[n:]
+	return string(data[:length]), data[length : length+keyIDSize], data[length+keyIDSize:], nil
+}
@@ -0,0 +1,268 @@
+package escrypto_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/codec"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/escrypto"
+	"github.com/kucjac/cleango/database/es/esmem"
+)
+
+const (
+	customerType        = "customer"
+	customerCreatedType = "customer:created"
+	emailChangedType    = "customer:email_changed"
+	redacted            = "[redacted]"
+)
+
+type customer struct {
+	Base     *es.AggregateBase `json:"-"`
+	Email    string            `json:"email"`
+	Redacted bool              `json:"-"`
+}
+
+func (c *customer) Apply(e *es.Event) error {
+	switch e.EventType {
+	case customerCreatedType:
+	case emailChangedType:
+		msg := emailChanged{CustomerID: c.Base.ID()}
+		if err := c.Base.DecodeEventAs(e.EventData, &msg); err != nil {
+			return err
+		}
+		c.Email = msg.Email
+	default:
+		return cgerrors.ErrInternalf("unknown event type: %s", e.EventType)
+	}
+	return nil
+}
+
+func (c *customer) SetBase(base *es.AggregateBase) { c.Base = base }
+func (c *customer) AggBase() *es.AggregateBase     { return c.Base }
+func (c *customer) Reset()                         { *c = customer{Base: c.Base} }
+func (c *customer) DataSubject() string            { return c.Base.ID() }
+func (c *customer) Redact(string)                  { c.Email, c.Redacted = redacted, true }
+
+type customerCreated struct{}
+
+func (customerCreated) MessageType() string { return customerCreatedType }
+
+type emailChanged struct {
+	CustomerID string `json:"-"`
+	Email      string `json:"email"`
+}
+
+func (emailChanged) MessageType() string      { return emailChangedType }
+func (e *emailChanged) DataSubject() string   { return e.CustomerID }
+func (e *emailChanged) Redact(subject string) { e.Email = redacted }
+
+func TestCodec(t *testing.T) {
+	ctx := context.Background()
+	const (
+		customerID = "b1d3f5a7-9c2e-4b6d-8f0a-3c5e7a9b1d24"
+		email      = "jane.doe@example.com"
+	)
+	masterKey := bytes.Repeat([]byte{7}, 32)
+	keys := esmem.NewKeyStorage()
+	keyring, err := escrypto.NewKeyring(keys, masterKey)
+	if err != nil {
+		t.Fatalf("creating keyring failed: %v", err)
+	}
+	c := escrypto.NewCodec(codec.JSON(), keyring)
+	storage := esmem.New()
+	store, err := es.New(es.DefaultConfig(), c, c, storage)
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+
+	agg := &customer{}
+	store.SetAggregateBase(agg, customerID, customerType, 1)
+	if err = agg.Base.SetEvent(customerCreated{}); err != nil {
+		t.Fatalf("setting event failed: %v", err)
+	}
+	if err = agg.Base.SetEvent(&emailChanged{CustomerID: customerID, Email: email}); err != nil {
+		t.Fatalf("setting event failed: %v", err)
+	}
+	if err = store.Commit(ctx, agg); err != nil {
+		t.Fatalf("committing aggregate failed: %v", err)
+	}
+	if err = store.SaveSnapshot(ctx, agg); err != nil {
+		t.Fatalf("saving snapshot failed: %v", err)
+	}
+
+	t.Run("Encrypted", func(t *testing.T) {
+		events, err := storage.ListEvents(ctx, customerID, customerType)
+		if err != nil {
+			t.Fatalf("listing events failed: %v", err)
+		}
+		if len(events) != 2 {
+			t.Fatalf("expected 2 events but got: %d", len(events))
+		}
+		if escrypto.IsEncrypted(events[0].EventData) {
+			t.Error("expected the event without the data subject not to be encrypted")
+		}
+		if !escrypto.IsEncrypted(events[1].EventData) || bytes.Contains(events[1].EventData, []byte(email)) {
+			t.Errorf("expected the event data to be encrypted: %q", events[1].EventData)
+		}
+		snap, err := storage.GetSnapshot(ctx, customerID, customerType, 1)
+		if err != nil {
+			t.Fatalf("getting snapshot failed: %v", err)
+		}
+		if !escrypto.IsEncrypted(snap.SnapshotData) {
+			t.Errorf("expected the snapshot data to be encrypted: %q", snap.SnapshotData)
+		}
+	})
+
+	t.Run("Decrypted", func(t *testing.T) {
+		loaded := &customer{}
+		store.SetAggregateBase(loaded, customerID, customerType, 1)
+		if err := store.LoadEvents(ctx, loaded); err != nil {
+			t.Fatalf("loading aggregate failed: %v", err)
+		}
+		if loaded.Email != email {
+			t.Errorf("expected email: %s but is: %s", email, loaded.Email)
+		}
+	})
+
+	t.Run("InvalidMasterKey", func(t *testing.T) {
+		other, err := escrypto.NewKeyring(keys, bytes.Repeat([]byte{8}, 32))
+		if err != nil {
+			t.Fatalf("creating keyring failed: %v", err)
+		}
+		data, err := c.Marshal(&emailChanged{CustomerID: customerID, Email: email})
+		if err != nil {
+			t.Fatalf("marshaling failed: %v", err)
+		}
+		var msg emailChanged
+		if err = escrypto.NewCodec(codec.JSON(), other).Unmarshal(data, &msg); err == nil {
+			t.Errorf("expected error on decrypting with invalid master key, got: %+v", msg)
+		}
+		if _, err = escrypto.NewKeyring(keys, []byte("short")); err == nil {
+			t.Error("expected error on invalid master key length")
+		}
+	})
+
+	if err = keyring.Shred(ctx, customerID); err != nil {
+		t.Fatalf("shredding subject failed: %v", err)
+	}
+
+	t.Run("Shredded", func(t *testing.T) {
+		loaded := &customer{}
+		store.SetAggregateBase(loaded, customerID, customerType, 1)
+		if err := store.LoadEvents(ctx, loaded); err != nil {
+			t.Fatalf("loading shredded aggregate failed: %v", err)
+		}
+		if loaded.Email != redacted || loaded.Base.Revision() != 2 {
+			t.Errorf("expected redacted aggregate at revision 2, but got email: %s, revision: %d", loaded.Email, loaded.Base.Revision())
+		}
+
+		loaded = &customer{}
+		store.SetAggregateBase(loaded, customerID, customerType, 1)
+		if err := store.LoadEventsWithSnapshot(ctx, loaded); err != nil {
+			t.Fatalf("loading shredded aggregate with snapshot failed: %v", err)
+		}
+		if !loaded.Redacted {
+			t.Error("expected the snapshot to be redacted")
+		}
+	})
+	// The writes after the shredding use a new data key, which doesn't reveal the shredded payloads.
+	t.Run("WriteAfterShred", func(t *testing.T) {
+		agg := &customer{}
+		store.SetAggregateBase(agg, customerID, customerType, 1)
+		if err := store.LoadEvents(ctx, agg); err != nil {
+			t.Fatalf("loading shredded aggregate failed: %v", err)
+		}
+		const newEmail = "jane.smith@example.com"
+		if err := agg.Base.SetEvent(&emailChanged{CustomerID: customerID, Email: newEmail}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		if err := store.Commit(ctx, agg); err != nil {
+			t.Fatalf("committing aggregate failed: %v", err)
+		}
+		if err := store.SaveSnapshot(ctx, agg); err != nil {
+			t.Fatalf("saving snapshot failed: %v", err)
+		}
+
+		events, err := storage.ListEvents(ctx, customerID, customerType)
+		if err != nil {
+			t.Fatalf("listing events failed: %v", err)
+		}
+		if len(events) != 3 {
+			t.Fatalf("expected 3 events but got: %d", len(events))
+		}
+		shredded := emailChanged{CustomerID: customerID}
+		if err = c.Unmarshal(events[1].EventData, &shredded); err != nil {
+			t.Fatalf("decoding shredded event failed: %v", err)
+		}
+		if shredded.Email != redacted {
+			t.Errorf("expected the shredded event to stay redacted, but is: %s", shredded.Email)
+		}
+
+		loaded := &customer{}
+		store.SetAggregateBase(loaded, customerID, customerType, 1)
+		if err = store.LoadEvents(ctx, loaded); err != nil {
+			t.Fatalf("loading aggregate failed: %v", err)
+		}
+		if loaded.Email != newEmail || loaded.Base.Revision() != 3 {
+			t.Errorf("expected email: %s at revision 3, but got: %s at revision: %d", newEmail, loaded.Email, loaded.Base.Revision())
+		}
+
+		loaded = &customer{}
+		store.SetAggregateBase(loaded, customerID, customerType, 1)
+		if err = store.LoadEventsWithSnapshot(ctx, loaded); err != nil {
+			t.Fatalf("loading aggregate with snapshot failed: %v", err)
+		}
+		if loaded.Email != newEmail || loaded.Redacted {
+			t.Errorf("expected the snapshot with email: %s, but got: %s", newEmail, loaded.Email)
+		}
+	})
+}
+
+func TestCachingStoreShred(t *testing.T) {
+	ctx := context.Background()
+	const customerID = "e4a6c8f0-2b4d-4f6a-8c0e-5a7c9e1b3d46"
+	keyring, err := escrypto.NewKeyring(esmem.NewKeyStorage(), bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatalf("creating keyring failed: %v", err)
+	}
+	c := escrypto.NewCodec(codec.JSON(), keyring)
+	store, err := es.New(es.DefaultConfig(), c, c, esmem.New())
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+	cached, err := es.NewCachingStore(store, nil)
+	if err != nil {
+		t.Fatalf("creating caching store failed: %v", err)
+	}
+
+	agg := &customer{}
+	store.SetAggregateBase(agg, customerID, customerType, 1)
+	if err = agg.Base.SetEvent(customerCreated{}); err != nil {
+		t.Fatalf("setting event failed: %v", err)
+	}
+	if err = agg.Base.SetEvent(&emailChanged{CustomerID: customerID, Email: "john.doe@example.com"}); err != nil {
+		t.Fatalf("setting event failed: %v", err)
+	}
+	if err = cached.Commit(ctx, agg); err != nil {
+		t.Fatalf("committing aggregate failed: %v", err)
+	}
+	if err = keyring.Shred(ctx, customerID); err != nil {
+		t.Fatalf("shredding subject failed: %v", err)
+	}
+
+	// The cached state is encrypted with the shredded key, thus it is redacted as the stored snapshots are.
+	loaded := &customer{}
+	store.SetAggregateBase(loaded, customerID, customerType, 1)
+	if err = cached.LoadEvents(ctx, loaded); err != nil {
+		t.Fatalf("loading shredded aggregate failed: %v", err)
+	}
+	if s := cached.Stats(); s.Hits != 1 {
+		t.Fatalf("expected the aggregate loaded from the cache, but got: %+v", s)
+	}
+	if loaded.Email != redacted || !loaded.Redacted {
+		t.Errorf("expected the cached aggregate to be redacted, but got email: %s", loaded.Email)
+	}
+}
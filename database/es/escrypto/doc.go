@@ -0,0 +1,6 @@
+// Package escrypto provides the crypto-shredding of the personal data stored in the events and snapshots.
+// The payloads of the messages and aggregates implementing the DataSubject interface are encrypted with the data key
+// of their subject, which is stored encrypted with the master key in the KeyStorage (envelope encryption).
+// Shredding the subject key makes all its payloads unreadable - they are decoded as redacted placeholders.
+// The Codec wraps the codecs used by the es.Store, so that the encryption is transparent for the aggregates.
+package escrypto
@@ -0,0 +1,164 @@
+package escrypto
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+
+	"github.com/kucjac/cleango/cgerrors"
+)
+
+// KeyStorage stores the encrypted data keys of the subjects.
+type KeyStorage interface {
+	// GetDataKey gets the encrypted data key of given subject.
+	// If the key doesn't exist, an error with the cgerrors.CodeNotFound is returned.
+	GetDataKey(ctx context.Context, subject string) ([]byte, error)
+	// SaveDataKey stores the encrypted data key of given subject.
+	// If the subject already has a key, an error with the cgerrors.CodeAlreadyExists is returned.
+	SaveDataKey(ctx context.Context, subject string, key []byte) error
+	// DeleteDataKey deletes the data key of given subject.
+	DeleteDataKey(ctx context.Context, subject string) error
+}
+
+// dataKeySize is the size of the AES-256 keys.
+const dataKeySize = 32
+
+// keyIDSize is the size of the random data key identifiers.
+const keyIDSize = 16
+
+// Keyring manages the data keys of the subjects. The data keys are stored in the KeyStorage encrypted with the master key.
+// Each data key has a random identifier, stored along with the key and in the envelopes of the payloads it encrypts.
+// A key created for the subject after its shredding has a new identifier, thus the payloads encrypted with
+// the shredded key stay unreadable.
+type Keyring struct {
+	storage KeyStorage
+	master  cipher.AEAD
+}
+
+// NewKeyring creates a new keyring with given key storage and the 32 bytes long AES-256 master key.
+func NewKeyring(storage KeyStorage, masterKey []byte) (*Keyring, error) {
+	if storage == nil {
+		return nil, cgerrors.ErrInternal("no key storage provided")
+	}
+	if len(masterKey) != dataKeySize {
+		return nil, cgerrors.ErrInternalf("master key needs to be %d bytes long", dataKeySize)
+	}
+	master, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Keyring{storage: storage, master: master}, nil
+}
+
+// Shred deletes the data key of given subject, so that all its encrypted payloads become unreadable.
+// The payloads encrypted for the subject afterwards use a new data key.
+func (k *Keyring) Shred(ctx context.Context, subject string) error {
+	return k.storage.DeleteDataKey(ctx, subject)
+}
+
+// currentKey gets the identifier and the cipher of the subject data key. If the key doesn't exist, a new one is created.
+func (k *Keyring) currentKey(ctx context.Context, subject string) ([]byte, cipher.AEAD, error) {
+	encrypted, err := k.storage.GetDataKey(ctx, subject)
+	if err == nil {
+		return k.openDataKey(subject, encrypted)
+	}
+	if !cgerrors.IsNotFound(err) {
+		return nil, nil, err
+	}
+
+	key := make([]byte, keyIDSize+dataKeySize)
+	if _, err = io.ReadFull(rand.Reader, key); err != nil {
+		return nil, nil, cgerrors.ErrInternalf("generating data key failed: %v", err)
+	}
+	keyID, key := key[:keyIDSize], key[keyIDSize:]
+	sealed, err := seal(k.master, key, keyAD(subject, keyID))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = k.storage.SaveDataKey(ctx, subject, append(keyID, sealed...)); err != nil {
+		if !cgerrors.IsAlreadyExists(err) {
+			return nil, nil, err
+		}
+		// The key was created concurrently.
+		if encrypted, err = k.storage.GetDataKey(ctx, subject); err != nil {
+			return nil, nil, err
+		}
+		return k.openDataKey(subject, encrypted)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return keyID, aead, nil
+}
+
+// dataKey gets the cipher of the subject data key with given identifier. If the key doesn't exist,
+// or the subject has a different key - i.e. created after the shredding, an error with the cgerrors.CodeNotFound is returned.
+func (k *Keyring) dataKey(ctx context.Context, subject string, keyID []byte) (cipher.AEAD, error) {
+	encrypted, err := k.storage.GetDataKey(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+	storedID, aead, err := k.openDataKey(subject, encrypted)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(storedID, keyID) {
+		return nil, cgerrors.ErrNotFoundf("data key of subject: %s was shredded", subject)
+	}
+	return aead, nil
+}
+
+func (k *Keyring) openDataKey(subject string, encrypted []byte) ([]byte, cipher.AEAD, error) {
+	if len(encrypted) < keyIDSize {
+		return nil, nil, cgerrors.ErrInternalf("malformed data key of subject: %s", subject)
+	}
+	keyID := encrypted[:keyIDSize]
+	key, err := open(k.master, encrypted[keyIDSize:], keyAD(subject, keyID))
+	if err != nil {
+		return nil, nil, cgerrors.ErrInternalf("decrypting data key of subject: %s failed: %v", subject, err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return keyID, aead, nil
+}
+
+// keyAD gets the additional data authenticated with the data key - its subject and identifier.
+func keyAD(subject string, keyID []byte) []byte {
+	return append([]byte(subject), keyID...)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, cgerrors.ErrInternalf("creating cipher failed: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, cgerrors.ErrInternalf("creating cipher failed: %v", err)
+	}
+	return aead, nil
+}
+
+// seal encrypts the plaintext with a random nonce, authenticating the additional data. The nonce is prefixed to the result.
+func seal(aead cipher.AEAD, plaintext, ad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, cgerrors.ErrInternalf("generating nonce failed: %v", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+// open decrypts the data created by the seal function.
+func open(aead cipher.AEAD, data, ad []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, cgerrors.ErrInternal("encrypted data too short")
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, ad)
+}
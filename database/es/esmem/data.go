@@ -0,0 +1,403 @@
+package esmem
+
+import (
+	"sort"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esstate"
+	"github.com/kucjac/cleango/ddd/events/eventstate"
+)
+
+// aggregateKey is the unique key of the aggregate stream.
+type aggregateKey struct {
+	id, aggType string
+}
+
+// revisionKey is the unique key of the aggregate event or snapshot revision.
+type revisionKey struct {
+	aggregateKey
+	revision int64
+}
+
+// aggregate is the in-memory row of the aggregate table.
+type aggregate struct {
+	ID         string
+	Type       string
+	InsertedAt int64
+}
+
+// eventStateKey is the unique key of the event state row.
+type eventStateKey struct {
+	eventID, handlerName string
+}
+
+// eventState is the in-memory row of the event state table.
+type eventState struct {
+	State     esstate.State
+	Timestamp int64
+}
+
+// data contains all the tables of the in-memory storage.
+// Each writing function validates the constraints before changing any value, so that a failed
+// write doesn't leave the data partially modified.
+type data struct {
+	// events is the event table ordered by the insertion. The event position is its index incremented by one.
+	events     []*es.Event
+	eventIDs   map[string]struct{}
+	revisions  map[revisionKey]int
+	snapshots  []*es.Snapshot
+	snapshotUq map[revisionKey]struct{}
+	aggregates []aggregate
+	aggIndex   map[aggregateKey]int
+	// deleted are the aggregates with the stored tombstone event.
+	deleted map[aggregateKey]struct{}
+	// reservations are the unique values reserved by the aggregates.
+	reservations map[reservationKey]es.Reservation
+
+	// Event state tables.
+	handlers    map[string][]string
+	eventStates map[eventStateKey]eventState
+	stateOrder  []eventStateKey
+	failures    []eventstate.HandleFailure
+}
+
+func newData() *data {
+	return &data{
+		eventIDs:     map[string]struct{}{},
+		revisions:    map[revisionKey]int{},
+		snapshotUq:   map[revisionKey]struct{}{},
+		aggIndex:     map[aggregateKey]int{},
+		deleted:      map[aggregateKey]struct{}{},
+		reservations: map[reservationKey]es.Reservation{},
+		handlers:     map[string][]string{},
+		eventStates:  map[eventStateKey]eventState{},
+	}
+}
+
+// clone creates a copy of the data tables. Stored events and snapshots are immutable,
+// thus only the containers are copied.
+func (d *data) clone() *data {
+	cp := &data{
+		events:       make([]*es.Event, len(d.events)),
+		eventIDs:     make(map[string]struct{}, len(d.eventIDs)),
+		revisions:    make(map[revisionKey]int, len(d.revisions)),
+		snapshots:    make([]*es.Snapshot, len(d.snapshots)),
+		snapshotUq:   make(map[revisionKey]struct{}, len(d.snapshotUq)),
+		aggregates:   make([]aggregate, len(d.aggregates)),
+		aggIndex:     make(map[aggregateKey]int, len(d.aggIndex)),
+		deleted:      make(map[aggregateKey]struct{}, len(d.deleted)),
+		reservations: make(map[reservationKey]es.Reservation, len(d.reservations)),
+		handlers:     make(map[string][]string, len(d.handlers)),
+		eventStates:  make(map[eventStateKey]eventState, len(d.eventStates)),
+		stateOrder:   make([]eventStateKey, len(d.stateOrder)),
+		failures:     make([]eventstate.HandleFailure, len(d.failures)),
+	}
+	copy(cp.events, d.events)
+	copy(cp.snapshots, d.snapshots)
+	copy(cp.aggregates, d.aggregates)
+	copy(cp.stateOrder, d.stateOrder)
+	copy(cp.failures, d.failures)
+	for k, v := range d.eventIDs {
+		cp.eventIDs[k] = v
+	}
+	for k, v := range d.revisions {
+		cp.revisions[k] = v
+	}
+	for k, v := range d.snapshotUq {
+		cp.snapshotUq[k] = v
+	}
+	for k, v := range d.aggIndex {
+		cp.aggIndex[k] = v
+	}
+	for k, v := range d.deleted {
+		cp.deleted[k] = v
+	}
+	for k, v := range d.reservations {
+		cp.reservations[k] = v
+	}
+	for k, v := range d.handlers {
+		cp.handlers[k] = append([]string(nil), v...)
+	}
+	for k, v := range d.eventStates {
+		cp.eventStates[k] = v
+	}
+	return cp
+}
+
+// insertEvents atomically inserts provided events, enforcing the unique constraints on the (aggregate_id, aggregate_type, revision)
+// and the event_id.
+func (d *data) insertEvents(events []*es.Event) error {
+	ids := make(map[string]struct{}, len(events))
+	revs := make(map[revisionKey]struct{}, len(events))
+	for _, e := range events {
+		if _, ok := d.eventIDs[e.EventId]; ok {
+			return cgerrors.ErrAlreadyExistsf("event: %s already exists", e.EventId)
+		}
+		if _, ok := ids[e.EventId]; ok {
+			return cgerrors.ErrAlreadyExistsf("event: %s already exists", e.EventId)
+		}
+		ids[e.EventId] = struct{}{}
+
+		rk := revisionKey{aggregateKey: aggregateKey{id: e.AggregateId, aggType: e.AggregateType}, revision: e.Revision}
+		if _, ok := d.revisions[rk]; ok {
+			return cgerrors.ErrAlreadyExists("event revision already exists")
+		}
+		if _, ok := revs[rk]; ok {
+			return cgerrors.ErrAlreadyExists("event revision already exists")
+		}
+		revs[rk] = struct{}{}
+		if e.Revision == 1 {
+			if _, ok := d.aggIndex[rk.aggregateKey]; ok {
+				return cgerrors.ErrAlreadyExistsf("aggregate: %s with id: %s already exists", e.AggregateType, e.AggregateId)
+			}
+		}
+	}
+	reservations, err := d.stageReservations(events)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range events {
+		ak := aggregateKey{id: e.AggregateId, aggType: e.AggregateType}
+		stored := e.Copy()
+		stored.Position = int64(len(d.events) + 1)
+		d.events = append(d.events, stored)
+		d.eventIDs[e.EventId] = struct{}{}
+		d.revisions[revisionKey{aggregateKey: ak, revision: e.Revision}] = len(d.events) - 1
+		if e.Revision == 1 {
+			d.aggIndex[ak] = len(d.aggregates)
+			d.aggregates = append(d.aggregates, aggregate{ID: e.AggregateId, Type: e.AggregateType, InsertedAt: e.Timestamp})
+		}
+		if es.IsTombstone(e) {
+			d.deleted[ak] = struct{}{}
+		}
+	}
+	d.applyReservations(reservations)
+	return nil
+}
+
+// isDeleted checks if the aggregate of given event is deleted with the tombstone event.
+func (d *data) isDeleted(e *es.Event) bool {
+	_, ok := d.deleted[aggregateKey{id: e.AggregateId, aggType: e.AggregateType}]
+	return ok
+}
+
+// listEvents lists the events of given aggregate with the revision greater than provided, ordered by the revision.
+// If the match function is provided, only the events matching it are listed.
+func (d *data) listEvents(aggId, aggType string, after int64, match func(e *es.Event) bool) []*es.Event {
+	var events []*es.Event
+	for _, e := range d.events {
+		if e.AggregateId != aggId || e.AggregateType != aggType || e.Revision <= after {
+			continue
+		}
+		if match == nil || match(e) {
+			events = append(events, e.Copy())
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Revision < events[j].Revision
+	})
+	return events
+}
+
+// queryEvents gets the events matching the query, ordered by their position.
+// The event position is its index in the events table incremented by one.
+func (d *data) queryEvents(q *es.EventQuery) []*es.Event {
+	first, last := int64(1), int64(len(d.events))
+	if q.AfterPosition >= first {
+		first = q.AfterPosition + 1
+	}
+	if q.BeforePosition > 0 && q.BeforePosition <= last {
+		last = q.BeforePosition - 1
+	}
+	aggTypes, aggIDs, eventTypes := toSet(q.AggregateTypes), toSet(q.AggregateIDs), toSet(q.EventTypes)
+	matches := func(e *es.Event) bool {
+		if e.Timestamp < q.FromTimestamp || (q.ToTimestamp != 0 && e.Timestamp > q.ToTimestamp) {
+			return false
+		}
+		return inSet(aggTypes, e.AggregateType) && inSet(aggIDs, e.AggregateId) && inSet(eventTypes, e.EventType)
+	}
+
+	var events []*es.Event
+	for i := int64(0); i <= last-first && (q.Limit <= 0 || len(events) < q.Limit); i++ {
+		position := first + i
+		if q.Descending {
+			position = last - i
+		}
+		if e := d.events[position-1]; matches(e) {
+			events = append(events, e.Copy())
+		}
+	}
+	return events
+}
+
+// listAggregates lists the aggregates of given type with the position greater than after, ordered by the position.
+// The aggregate position is its index in the aggregate table incremented by one.
+func (d *data) listAggregates(aggType string, after int64, limit int) []*es.AggregateRecord {
+	var aggregates []*es.AggregateRecord
+	for i := int(after); i >= 0 && i < len(d.aggregates) && (limit <= 0 || len(aggregates) < limit); i++ {
+		agg := d.aggregates[i]
+		if agg.Type != aggType {
+			continue
+		}
+		aggregates = append(aggregates, &es.AggregateRecord{
+			ID:         agg.ID,
+			Type:       agg.Type,
+			InsertedAt: agg.InsertedAt,
+			Position:   int64(i + 1),
+		})
+	}
+	return aggregates
+}
+
+func (d *data) insertSnapshot(snap *es.Snapshot) error {
+	rk := revisionKey{aggregateKey: aggregateKey{id: snap.AggregateId, aggType: snap.AggregateType}, revision: snap.Revision}
+	if _, ok := d.snapshotUq[rk]; ok {
+		return cgerrors.ErrAlreadyExists("snapshot revision already exists")
+	}
+	cp := *snap
+	d.snapshots = append(d.snapshots, &cp)
+	d.snapshotUq[rk] = struct{}{}
+	return nil
+}
+
+// getSnapshot gets the snapshot with the greatest revision for given aggregate and its version.
+// If the match function is provided, only the snapshots matching it are taken into account.
+func (d *data) getSnapshot(aggId, aggType string, aggVersion int64, match func(snap *es.Snapshot) bool) (*es.Snapshot, error) {
+	var latest *es.Snapshot
+	for _, snap := range d.snapshots {
+		if snap.AggregateId != aggId || snap.AggregateType != aggType || snap.AggregateVersion != aggVersion {
+			continue
+		}
+		if match != nil && !match(snap) {
+			continue
+		}
+		if latest == nil || snap.Revision > latest.Revision {
+			latest = snap
+		}
+	}
+	if latest == nil {
+		return nil, cgerrors.ErrNotFound("snapshot not found")
+	}
+	cp := *latest
+	return &cp, nil
+}
+
+// listEventsAfterRevisions lists the events of the aggregates of given type with the revision greater than the ones
+// provided in the after map, ordered by the aggregate id and revision.
+func (d *data) listEventsAfterRevisions(aggType string, after map[string]int64) []*es.Event {
+	var events []*es.Event
+	for _, e := range d.events {
+		if rev, ok := after[e.AggregateId]; ok && e.AggregateType == aggType && e.Revision > rev {
+			events = append(events, e.Copy())
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].AggregateId != events[j].AggregateId {
+			return events[i].AggregateId < events[j].AggregateId
+		}
+		return events[i].Revision < events[j].Revision
+	})
+	return events
+}
+
+// listSnapshots gets the copies of all the snapshots of given aggregate, ordered by their revision.
+func (d *data) listSnapshots(aggId, aggType string) []*es.Snapshot {
+	var snapshots []*es.Snapshot
+	for _, snap := range d.snapshots {
+		if snap.AggregateId == aggId && snap.AggregateType == aggType {
+			cp := *snap
+			snapshots = append(snapshots, &cp)
+		}
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool { return snapshots[i].Revision < snapshots[j].Revision })
+	return snapshots
+}
+
+// pruneSnapshots removes the snapshots of given aggregate and its version, except the latest keep ones.
+func (d *data) pruneSnapshots(aggId, aggType string, aggVersion int64, keep int) {
+	var revisions []int64
+	for _, snap := range d.snapshots {
+		if snap.AggregateId == aggId && snap.AggregateType == aggType && snap.AggregateVersion == aggVersion {
+			revisions = append(revisions, snap.Revision)
+		}
+	}
+	if len(revisions) <= keep {
+		return
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i] > revisions[j] })
+	// Snapshots with the revision lower or equal to the cutoff are pruned.
+	cutoff := revisions[keep]
+
+	snapshots := d.snapshots[:0]
+	for _, snap := range d.snapshots {
+		if snap.AggregateId == aggId && snap.AggregateType == aggType && snap.AggregateVersion == aggVersion && snap.Revision <= cutoff {
+			delete(d.snapshotUq, revisionKey{aggregateKey: aggregateKey{id: aggId, aggType: aggType}, revision: snap.Revision})
+			continue
+		}
+		snapshots = append(snapshots, snap)
+	}
+	d.snapshots = snapshots
+}
+
+func (d *data) insertHandlers(handlers []eventstate.Handler) error {
+	for _, h := range handlers {
+		seen := map[string]struct{}{}
+		for _, et := range d.handlers[h.Name] {
+			seen[et] = struct{}{}
+		}
+		for _, et := range h.EventTypes {
+			if _, ok := seen[et]; ok {
+				return cgerrors.ErrAlreadyExistsf("handler: %s for event type: %s already exists", h.Name, et)
+			}
+			seen[et] = struct{}{}
+		}
+	}
+	for _, h := range handlers {
+		d.handlers[h.Name] = append(d.handlers[h.Name], h.EventTypes...)
+	}
+	return nil
+}
+
+func (d *data) listHandlers() []eventstate.Handler {
+	handlers := make([]eventstate.Handler, 0, len(d.handlers))
+	for name, eventTypes := range d.handlers {
+		handlers = append(handlers, eventstate.Handler{Name: name, EventTypes: append([]string(nil), eventTypes...)})
+	}
+	sort.Slice(handlers, func(i, j int) bool {
+		return handlers[i].Name < handlers[j].Name
+	})
+	return handlers
+}
+
+// markUnhandled inserts an unhandled event state for each handler registered for given event type.
+func (d *data) markUnhandled(eventID, eventType string, timestamp int64) error {
+	var keys []eventStateKey
+	for _, h := range d.listHandlers() {
+		for _, et := range h.EventTypes {
+			if et != eventType {
+				continue
+			}
+			k := eventStateKey{eventID: eventID, handlerName: h.Name}
+			if _, ok := d.eventStates[k]; ok {
+				return cgerrors.ErrAlreadyExistsf("event state for event: %s and handler: %s already exists", eventID, h.Name)
+			}
+			keys = append(keys, k)
+		}
+	}
+	for _, k := range keys {
+		d.eventStates[k] = eventState{State: esstate.StateUnhandled, Timestamp: timestamp}
+		d.stateOrder = append(d.stateOrder, k)
+	}
+	return nil
+}
+
+// updateEventState sets the state of given event and handler. If no such event state exists nothing is changed.
+func (d *data) updateEventState(eventID, handlerName string, state esstate.State, timestamp int64) {
+	k := eventStateKey{eventID: eventID, handlerName: handlerName}
+	if _, ok := d.eventStates[k]; !ok {
+		return
+	}
+	d.eventStates[k] = eventState{State: state, Timestamp: timestamp}
+}
@@ -0,0 +1,4 @@
+// Package esmem provides an in-memory implementation of the es.Storage, es.ReservationStorage, esstate.Storage
+// and escrypto.KeyStorage.
+// It is meant to be used in tests and local development, where a deterministic and fast event storage is required.
+package esmem
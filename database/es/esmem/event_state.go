@@ -0,0 +1,123 @@
+package esmem
+
+import (
+	"context"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es/esstate"
+	"github.com/kucjac/cleango/ddd/events/eventstate"
+)
+
+// Compile time check if StateStorage implements esstate.Storage interface.
+var _ esstate.Storage = (*StateStorage)(nil)
+
+// NewStateStorage creates a new empty in-memory event storage with the event state tracking.
+// Provided handlers are registered in the storage.
+func NewStateStorage(handlers ...eventstate.Handler) (*StateStorage, error) {
+	s := &StateStorage{storage: storage{db: newDatabase()}}
+	if err := s.RegisterHandlers(context.Background(), handlers...); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// StateStorage is the in-memory implementation of the esstate.Storage interface.
+// It also implements es.StorageBase.
+type StateStorage struct {
+	storage
+}
+
+// BeginTx starts a new transaction.
+func (s *StateStorage) BeginTx(context.Context) (esstate.TxStorage, error) {
+	return s.beginTx(), nil
+}
+
+// As exposes the *esmem.StateStorage implementation.
+func (s *StateStorage) As(dst interface{}) error {
+	ds, ok := dst.(**StateStorage)
+	if !ok {
+		return cgerrors.ErrInternalf("invalid input type: %T, wanted **esmem.StateStorage", dst)
+	}
+	*ds = s
+	return nil
+}
+
+// RegisterHandlers implements esstate.StorageBase.
+func (s *storage) RegisterHandlers(_ context.Context, eventHandlers ...eventstate.Handler) error {
+	handlers := make([]eventstate.Handler, len(eventHandlers))
+	for i, h := range eventHandlers {
+		handlers[i] = eventstate.Handler{Name: h.Name, EventTypes: append([]string(nil), h.EventTypes...)}
+	}
+	return s.write(func(d *data) error {
+		return d.insertHandlers(handlers)
+	})
+}
+
+// ListHandlers implements esstate.StorageBase.
+func (s *storage) ListHandlers(context.Context) (handlers []eventstate.Handler, err error) {
+	s.read(func(d *data) {
+		handlers = d.listHandlers()
+	})
+	return handlers, nil
+}
+
+// MarkUnhandled implements esstate.StorageBase.
+func (s *storage) MarkUnhandled(_ context.Context, eventID, eventType string, timestamp int64) error {
+	return s.write(func(d *data) error {
+		return d.markUnhandled(eventID, eventType, timestamp)
+	})
+}
+
+// StartHandling implements esstate.StorageBase.
+func (s *storage) StartHandling(_ context.Context, eventID string, handlerName string, timestamp int64) error {
+	return s.write(func(d *data) error {
+		d.updateEventState(eventID, handlerName, esstate.StateStarted, timestamp)
+		return nil
+	})
+}
+
+// FinishHandling implements esstate.StorageBase.
+func (s *storage) FinishHandling(_ context.Context, eventID string, handlerName string, timestamp int64) error {
+	return s.write(func(d *data) error {
+		d.updateEventState(eventID, handlerName, esstate.StateFinished, timestamp)
+		return nil
+	})
+}
+
+// HandlingFailed implements esstate.StorageBase.
+func (s *storage) HandlingFailed(_ context.Context, failure *eventstate.HandleFailure) error {
+	f := *failure
+	return s.write(func(d *data) error {
+		d.updateEventState(f.EventID, f.HandlerName, esstate.StateFailed, f.Timestamp.UnixNano())
+		d.failures = append(d.failures, f)
+		return nil
+	})
+}
+
+// FindUnhandled implements esstate.StorageBase interface.
+// Finds all unhandled event state matching given query.
+func (s *storage) FindUnhandled(_ context.Context, query eventstate.FindUnhandledQuery) (result []eventstate.Unhandled, err error) {
+	handlers := toSet(query.HandlerNames)
+	s.read(func(d *data) {
+		for _, k := range d.stateOrder {
+			if d.eventStates[k].State != esstate.StateUnhandled || !inSet(handlers, k.handlerName) {
+				continue
+			}
+			result = append(result, eventstate.Unhandled{EventID: k.eventID, HandlerName: k.handlerName})
+		}
+	})
+	return result, nil
+}
+
+// FindFailures implements esstate.StorageBase.
+func (s *storage) FindFailures(_ context.Context, query eventstate.FindFailureQuery) (result []eventstate.HandleFailure, err error) {
+	handlers := toSet(query.HandlerNames)
+	s.read(func(d *data) {
+		for _, f := range d.failures {
+			if inSet(handlers, f.HandlerName) {
+				result = append(result, f)
+			}
+		}
+	})
+	return result, nil
+}
@@ -0,0 +1,56 @@
+package esmem
+
+import (
+	"context"
+	"sync"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es/escrypto"
+)
+
+// Compile time check if KeyStorage implements escrypto.KeyStorage interface.
+var _ escrypto.KeyStorage = (*KeyStorage)(nil)
+
+// NewKeyStorage creates a new empty in-memory data key storage.
+func NewKeyStorage() *KeyStorage {
+	return &KeyStorage{keys: map[string][]byte{}}
+}
+
+// KeyStorage is the in-memory implementation of the escrypto.KeyStorage interface.
+type KeyStorage struct {
+	l    sync.RWMutex
+	keys map[string][]byte
+}
+
+// GetDataKey gets the encrypted data key of given subject.
+// Implements escrypto.KeyStorage interface.
+func (k *KeyStorage) GetDataKey(_ context.Context, subject string) ([]byte, error) {
+	k.l.RLock()
+	defer k.l.RUnlock()
+	key, ok := k.keys[subject]
+	if !ok {
+		return nil, cgerrors.ErrNotFoundf("data key of subject: %s not found", subject)
+	}
+	return append([]byte(nil), key...), nil
+}
+
+// SaveDataKey stores the encrypted data key of given subject.
+// Implements escrypto.KeyStorage interface.
+func (k *KeyStorage) SaveDataKey(_ context.Context, subject string, key []byte) error {
+	k.l.Lock()
+	defer k.l.Unlock()
+	if _, ok := k.keys[subject]; ok {
+		return cgerrors.ErrAlreadyExistsf("data key of subject: %s already exists", subject)
+	}
+	k.keys[subject] = append([]byte(nil), key...)
+	return nil
+}
+
+// DeleteDataKey deletes the data key of given subject.
+// Implements escrypto.KeyStorage interface.
+func (k *KeyStorage) DeleteDataKey(_ context.Context, subject string) error {
+	k.l.Lock()
+	defer k.l.Unlock()
+	delete(k.keys, subject)
+	return nil
+}
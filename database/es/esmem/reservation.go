@@ -0,0 +1,109 @@
+package esmem
+
+import (
+	"context"
+	"sort"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
+)
+
+// Compile time check if Storage implements es.ReservationStorage interface.
+var _ es.ReservationStorage = (*Storage)(nil)
+
+// reservationKey is the unique key of the reservation.
+type reservationKey struct {
+	scope, value string
+}
+
+// GetReservation gets the reservation of the value within the scope.
+// Implements es.ReservationStorage interface.
+func (s *storage) GetReservation(_ context.Context, scope, value string) (r *es.Reservation, err error) {
+	s.read(func(d *data) {
+		if res, ok := d.reservations[reservationKey{scope: scope, value: value}]; ok {
+			r = &res
+		}
+	})
+	if r == nil {
+		return nil, cgerrors.ErrNotFoundf("reservation of value: '%s' within the scope: %s not found", value, scope)
+	}
+	return r, nil
+}
+
+// ListReservations lists the reservations of given aggregate, ordered by the scope and value.
+// Implements es.ReservationStorage interface.
+func (s *storage) ListReservations(_ context.Context, aggId, aggType string) (reservations []*es.Reservation, err error) {
+	s.read(func(d *data) {
+		for _, res := range d.reservations {
+			if res.AggregateID == aggId && res.AggregateType == aggType {
+				cp := res
+				reservations = append(reservations, &cp)
+			}
+		}
+	})
+	sort.Slice(reservations, func(i, j int) bool {
+		if reservations[i].Scope != reservations[j].Scope {
+			return reservations[i].Scope < reservations[j].Scope
+		}
+		return reservations[i].Value < reservations[j].Value
+	})
+	return reservations, nil
+}
+
+// stageReservations computes the reservation changes of given events without applying them.
+// The resulting map contains the new state of the changed reservations, where nil stands for the released one.
+func (d *data) stageReservations(events []*es.Event) (map[reservationKey]*es.Reservation, error) {
+	changes, err := es.EventReservationChanges(events)
+	if err != nil || len(changes) == 0 {
+		return nil, err
+	}
+	staged := map[reservationKey]*es.Reservation{}
+	current := func(key reservationKey) *es.Reservation {
+		if r, ok := staged[key]; ok {
+			return r
+		}
+		if r, ok := d.reservations[key]; ok {
+			return &r
+		}
+		return nil
+	}
+	for _, c := range changes {
+		key := reservationKey{scope: c.Scope, value: c.Value}
+		r := current(key)
+		owned := r != nil && r.AggregateID == c.AggregateID && r.AggregateType == c.AggregateType
+		switch c.Op {
+		case es.ReservationReserve, es.ReservationTransfer:
+			if owned {
+				continue
+			}
+			if r != nil && (c.Op == es.ReservationReserve || r.AggregateID != c.FromAggregateID || r.AggregateType != c.FromAggregateType) {
+				return nil, &es.ReservationTakenError{Scope: c.Scope, Value: c.Value}
+			}
+			staged[key] = &es.Reservation{
+				Scope:         c.Scope,
+				Value:         c.Value,
+				AggregateID:   c.AggregateID,
+				AggregateType: c.AggregateType,
+				ReservedAt:    c.Timestamp,
+			}
+		case es.ReservationRelease:
+			if owned {
+				staged[key] = nil
+			}
+		default:
+			return nil, cgerrors.ErrInvalidArgumentf("unknown reservation operation: %s", c.Op)
+		}
+	}
+	return staged, nil
+}
+
+// applyReservations applies the staged reservation changes.
+func (d *data) applyReservations(staged map[reservationKey]*es.Reservation) {
+	for key, r := range staged {
+		if r == nil {
+			delete(d.reservations, key)
+			continue
+		}
+		d.reservations[key] = *r
+	}
+}
@@ -0,0 +1,314 @@
+package esmem
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
+)
+
+// Compile time check if Storage implements es.Storage interface.
+var _ es.Storage = (*Storage)(nil)
+
+// New creates a new empty in-memory event storage.
+func New() *Storage {
+	return &Storage{storage: storage{db: newDatabase()}}
+}
+
+// Storage is the in-memory implementation of the es.Storage interface.
+type Storage struct {
+	storage
+}
+
+// BeginTx creates and begins a new transaction.
+// The transaction works on the snapshot of the storage taken at the moment of its start.
+// All its changes are applied atomically on Commit.
+func (s *Storage) BeginTx(context.Context) (es.TxStorage, error) {
+	return s.beginTx(), nil
+}
+
+// As exposes the *esmem.Storage implementation.
+func (s *Storage) As(dst interface{}) error {
+	ds, ok := dst.(**Storage)
+	if !ok {
+		return cgerrors.ErrInternalf("invalid input type: %T, wanted **esmem.Storage", dst)
+	}
+	*ds = s
+	return nil
+}
+
+// database is the shared, synchronized container of the storage data.
+type database struct {
+	l    sync.RWMutex
+	data *data
+	// changed is closed and replaced each time new data is stored.
+	changed chan struct{}
+}
+
+func newDatabase() *database {
+	return &database{data: newData(), changed: make(chan struct{})}
+}
+
+// changes gets the channel closed on the next change of the data.
+func (db *database) changes() <-chan struct{} {
+	db.l.RLock()
+	defer db.l.RUnlock()
+	return db.changed
+}
+
+// notify wakes up all the changes listeners. It needs to be called with the write lock held.
+func (db *database) notify() {
+	close(db.changed)
+	db.changed = make(chan struct{})
+}
+
+// storage is the internal common implementation of the es.StorageBase for both Storage and Transaction.
+type storage struct {
+	db *database
+	tx *txState
+}
+
+func (s *storage) beginTx() *Transaction {
+	s.db.l.RLock()
+	d := s.db.data.clone()
+	s.db.l.RUnlock()
+	return &Transaction{
+		id:      uuid.New().String(),
+		storage: storage{db: s.db, tx: &txState{data: d}},
+	}
+}
+
+// read calls the function with the data visible by the storage.
+func (s *storage) read(fn func(d *data)) {
+	if s.tx != nil {
+		s.tx.l.Lock()
+		defer s.tx.l.Unlock()
+		fn(s.tx.data)
+		return
+	}
+	s.db.l.RLock()
+	defer s.db.l.RUnlock()
+	fn(s.db.data)
+}
+
+// write applies the writing function on the storage data.
+// Within a transaction the function is also stored, so that it could be applied on commit.
+func (s *storage) write(fn func(d *data) error) error {
+	if s.tx != nil {
+		s.tx.l.Lock()
+		defer s.tx.l.Unlock()
+		if s.tx.done {
+			return cgerrors.ErrInternal("transaction is already done")
+		}
+		if err := fn(s.tx.data); err != nil {
+			return err
+		}
+		s.tx.ops = append(s.tx.ops, fn)
+		return nil
+	}
+	s.db.l.Lock()
+	defer s.db.l.Unlock()
+	if err := fn(s.db.data); err != nil {
+		return err
+	}
+	s.db.notify()
+	return nil
+}
+
+// ErrorCode gets the error code related to given error.
+func (s *storage) ErrorCode(err error) cgerrors.ErrorCode {
+	return cgerrors.Code(err)
+}
+
+// SaveEvents stores provided events atomically.
+// Implements es.StorageBase interface.
+func (s *storage) SaveEvents(_ context.Context, events []*es.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	// Copy the input events, so that any further change done by the caller doesn't affect the storage.
+	cp := make([]*es.Event, len(events))
+	for i, e := range events {
+		cp[i] = e.Copy()
+	}
+	return s.write(func(d *data) error {
+		return d.insertEvents(cp)
+	})
+}
+
+// ListEvents gets the event stream for provided aggregate ordered by the revision.
+// Implements es.StorageBase interface.
+func (s *storage) ListEvents(_ context.Context, aggId string, aggType string) ([]*es.Event, error) {
+	var events []*es.Event
+	s.read(func(d *data) {
+		events = d.listEvents(aggId, aggType, 0, nil)
+	})
+	return events, nil
+}
+
+// ListEventsAfterRevision gets the event stream for given aggregate where the revision is subsequent from provided.
+// Implements es.StorageBase interface.
+func (s *storage) ListEventsAfterRevision(_ context.Context, aggId string, aggType string, from int64) ([]*es.Event, error) {
+	var events []*es.Event
+	s.read(func(d *data) {
+		events = d.listEvents(aggId, aggType, from, nil)
+	})
+	return events, nil
+}
+
+// ListEventsUntilRevision gets the event stream for given aggregate with the revision in the range (after, until].
+// Implements es.StorageBase interface.
+func (s *storage) ListEventsUntilRevision(_ context.Context, aggId string, aggType string, after, until int64) ([]*es.Event, error) {
+	var events []*es.Event
+	s.read(func(d *data) {
+		events = d.listEvents(aggId, aggType, after, func(e *es.Event) bool {
+			return e.Revision <= until
+		})
+	})
+	return events, nil
+}
+
+// ListEventsUntilTimestamp gets the event stream for given aggregate with the revision greater than after,
+// and the timestamp lower or equal to until.
+// Implements es.StorageBase interface.
+func (s *storage) ListEventsUntilTimestamp(_ context.Context, aggId string, aggType string, after, until int64) ([]*es.Event, error) {
+	var events []*es.Event
+	s.read(func(d *data) {
+		events = d.listEvents(aggId, aggType, after, func(e *es.Event) bool {
+			return e.Timestamp <= until
+		})
+	})
+	return events, nil
+}
+
+// SaveSnapshot stores the snapshot.
+// Implements es.StorageBase interface.
+func (s *storage) SaveSnapshot(_ context.Context, snap *es.Snapshot) error {
+	cp := *snap
+	return s.write(func(d *data) error {
+		return d.insertSnapshot(&cp)
+	})
+}
+
+// GetSnapshot gets the latest snapshot for given aggregate and its version.
+// Implements es.StorageBase interface.
+func (s *storage) GetSnapshot(_ context.Context, aggId string, aggType string, aggVersion int64) (snap *es.Snapshot, err error) {
+	s.read(func(d *data) {
+		snap, err = d.getSnapshot(aggId, aggType, aggVersion, nil)
+	})
+	return snap, err
+}
+
+// ListLatestSnapshots gets the latest snapshots of the aggregates of given type and version with given ids.
+// Implements es.StorageBase interface.
+func (s *storage) ListLatestSnapshots(_ context.Context, aggType string, aggVersion int64, aggIds []string) (snapshots []*es.Snapshot, err error) {
+	s.read(func(d *data) {
+		for _, id := range aggIds {
+			if snap, er := d.getSnapshot(id, aggType, aggVersion, nil); er == nil {
+				snapshots = append(snapshots, snap)
+			}
+		}
+	})
+	return snapshots, nil
+}
+
+// ListEventsAfterRevisions lists the events of the aggregates of given type with the revision greater than the ones
+// provided in the after map, ordered by the aggregate id and revision.
+// Implements es.StorageBase interface.
+func (s *storage) ListEventsAfterRevisions(_ context.Context, aggType string, after map[string]int64) (events []*es.Event, err error) {
+	s.read(func(d *data) {
+		events = d.listEventsAfterRevisions(aggType, after)
+	})
+	return events, nil
+}
+
+// GetSnapshotAtRevision gets the latest snapshot for given aggregate and its version with the revision lower or equal to provided.
+// Implements es.StorageBase interface.
+func (s *storage) GetSnapshotAtRevision(_ context.Context, aggId string, aggType string, aggVersion, revision int64) (snap *es.Snapshot, err error) {
+	s.read(func(d *data) {
+		snap, err = d.getSnapshot(aggId, aggType, aggVersion, func(snap *es.Snapshot) bool {
+			return snap.Revision <= revision
+		})
+	})
+	return snap, err
+}
+
+// GetSnapshotAtTimestamp gets the latest snapshot for given aggregate and its version with the timestamp lower or equal to provided.
+// Implements es.StorageBase interface.
+func (s *storage) GetSnapshotAtTimestamp(_ context.Context, aggId string, aggType string, aggVersion, timestamp int64) (snap *es.Snapshot, err error) {
+	s.read(func(d *data) {
+		snap, err = d.getSnapshot(aggId, aggType, aggVersion, func(snap *es.Snapshot) bool {
+			return snap.Timestamp <= timestamp
+		})
+	})
+	return snap, err
+}
+
+// ListSnapshots lists all the snapshots of given aggregate, of all its versions, ordered by the revision.
+// Implements es.StorageBase interface.
+func (s *storage) ListSnapshots(_ context.Context, aggId string, aggType string) (snapshots []*es.Snapshot, err error) {
+	s.read(func(d *data) {
+		snapshots = d.listSnapshots(aggId, aggType)
+	})
+	return snapshots, nil
+}
+
+// PruneSnapshots deletes the snapshots of given aggregate and its version, except the latest keep ones.
+// Implements es.StorageBase interface.
+func (s *storage) PruneSnapshots(_ context.Context, aggId string, aggType string, aggVersion int64, keep int) error {
+	return s.write(func(d *data) error {
+		d.pruneSnapshots(aggId, aggType, aggVersion, keep)
+		return nil
+	})
+}
+
+// StreamEvents opens the channel of the events stream that matches given request.
+// Implements es.StorageBase interface.
+func (s *storage) StreamEvents(ctx context.Context, req *es.StreamEventsRequest) (<-chan *es.Event, error) {
+	c := s.newStreamCursor(ctx, req)
+	return c.openChannel(), nil
+}
+
+// QueryEvents gets the events matching given query, ordered by their global position.
+// Implements es.StorageBase interface.
+func (s *storage) QueryEvents(_ context.Context, query *es.EventQuery) ([]*es.Event, error) {
+	var events []*es.Event
+	s.read(func(d *data) {
+		events = d.queryEvents(query)
+	})
+	return events, nil
+}
+
+// AggregateExists checks if the aggregate with given id and type is stored.
+// Implements es.StorageBase interface.
+func (s *storage) AggregateExists(_ context.Context, aggId string, aggType string) (exists bool, err error) {
+	s.read(func(d *data) {
+		_, exists = d.aggIndex[aggregateKey{id: aggId, aggType: aggType}]
+	})
+	return exists, nil
+}
+
+// ListAggregates lists the aggregates of given type with the catalog position greater than after, ordered by the position.
+// Implements es.StorageBase interface.
+func (s *storage) ListAggregates(_ context.Context, aggType string, after int64, limit int) (aggregates []*es.AggregateRecord, err error) {
+	s.read(func(d *data) {
+		aggregates = d.listAggregates(aggType, after, limit)
+	})
+	return aggregates, nil
+}
+
+// CountAggregates counts the aggregates of given type.
+// Implements es.StorageBase interface.
+func (s *storage) CountAggregates(_ context.Context, aggType string) (count int64, err error) {
+	s.read(func(d *data) {
+		for _, agg := range d.aggregates {
+			if agg.Type == aggType {
+				count++
+			}
+		}
+	})
+	return count, nil
+}
@@ -0,0 +1,371 @@
+package esmem_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/codec"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esmem"
+	"github.com/kucjac/cleango/database/es/esstate"
+	"github.com/kucjac/cleango/database/es/estest"
+	"github.com/kucjac/cleango/ddd/events/eventstate"
+)
+
+const (
+	aggType   = "TEST_AGG_TYPE"
+	aggID     = "12430e53-edba-476a-ac07-989b201b89e4"
+	agg2ID    = "f2b19e0f-cb6c-4dc3-8c3a-341762d4b87f"
+	eventType = "TEST_EVENT_TYPE"
+	otherType = "OTHER_EVENT_TYPE"
+)
+
+func testEvents() []*es.Event {
+	ts := time.Now().UTC().UnixNano()
+	return []*es.Event{
+		{EventId: "0a76941b-08ec-4bb9-bae5-7b8d8f6623b6", EventType: eventType, AggregateType: aggType, AggregateId: aggID, Timestamp: ts, Revision: 1},
+		{EventId: "45606771-e303-496b-8399-f1a71762735c", EventType: otherType, AggregateType: aggType, AggregateId: aggID, Timestamp: ts + 1, Revision: 2},
+		{EventId: "4cedbacb-3480-4499-b977-f6b0aaaa5ad1", EventType: eventType, AggregateType: aggType, AggregateId: agg2ID, Timestamp: ts + 2, Revision: 1},
+		{EventId: "951d6648-371d-4d57-a065-202afd985d29", EventType: eventType, AggregateType: aggType, AggregateId: aggID, Timestamp: ts + 3, Revision: 3},
+	}
+}
+
+func TestStorageConformance(t *testing.T) {
+	estest.TestStorage(t, func(*testing.T) es.Storage { return esmem.New() })
+}
+
+func TestStateStorageConformance(t *testing.T) {
+	estest.TestStateStorage(t, func(t *testing.T) esstate.Storage {
+		s, err := esmem.NewStateStorage()
+		if err != nil {
+			t.Fatalf("creating state storage failed: %v", err)
+		}
+		return s
+	})
+}
+
+func TestStorage(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Events", func(t *testing.T) {
+		s := esmem.New()
+		events := testEvents()
+		if err := s.SaveEvents(ctx, events); err != nil {
+			t.Fatalf("saving events failed: %v", err)
+		}
+
+		stream, err := s.ListEvents(ctx, aggID, aggType)
+		if err != nil {
+			t.Fatalf("listing events failed: %v", err)
+		}
+		if len(stream) != 3 {
+			t.Fatalf("expected 3 events but got: %d", len(stream))
+		}
+		for i, e := range stream {
+			if e.Revision != int64(i+1) {
+				t.Errorf("event at index: %d should have revision: %d but has: %d", i, i+1, e.Revision)
+			}
+		}
+
+		after, err := s.ListEventsAfterRevision(ctx, aggID, aggType, 1)
+		if err != nil {
+			t.Fatalf("listing events after revision failed: %v", err)
+		}
+		if len(after) != 2 || after[0].EventId != events[1].EventId || after[1].EventId != events[3].EventId {
+			t.Errorf("invalid events listed after revision 1: %v", after)
+		}
+	})
+
+	t.Run("AlreadyExists", func(t *testing.T) {
+		s := esmem.New()
+		events := testEvents()
+		if err := s.SaveEvents(ctx, events[:1]); err != nil {
+			t.Fatalf("saving events failed: %v", err)
+		}
+
+		duplicatedRevision := events[1].Copy()
+		duplicatedRevision.Revision = 1
+		err := s.SaveEvents(ctx, []*es.Event{events[2], duplicatedRevision})
+		if s.ErrorCode(err) != cgerrors.CodeAlreadyExists {
+			t.Errorf("expected already exists error on duplicated revision, but got: %v", err)
+		}
+
+		duplicatedID := events[1].Copy()
+		duplicatedID.EventId = events[0].EventId
+		err = s.SaveEvents(ctx, []*es.Event{duplicatedID})
+		if s.ErrorCode(err) != cgerrors.CodeAlreadyExists {
+			t.Errorf("expected already exists error on duplicated event id, but got: %v", err)
+		}
+
+		// None of the failed batch events should be stored.
+		stream, _ := s.ListEvents(ctx, agg2ID, aggType)
+		if len(stream) != 0 {
+			t.Errorf("failed batch should not store any event, but found: %d", len(stream))
+		}
+	})
+
+	t.Run("Snapshots", func(t *testing.T) {
+		s := esmem.New()
+		if _, err := s.GetSnapshot(ctx, aggID, aggType, 1); !cgerrors.IsNotFound(err) {
+			t.Errorf("expected not found error but got: %v", err)
+		}
+		for _, snap := range []*es.Snapshot{
+			{AggregateId: aggID, AggregateType: aggType, AggregateVersion: 1, Revision: 2},
+			{AggregateId: aggID, AggregateType: aggType, AggregateVersion: 1, Revision: 5},
+			{AggregateId: aggID, AggregateType: aggType, AggregateVersion: 2, Revision: 3},
+		} {
+			if err := s.SaveSnapshot(ctx, snap); err != nil {
+				t.Fatalf("saving snapshot failed: %v", err)
+			}
+		}
+		snap, err := s.GetSnapshot(ctx, aggID, aggType, 1)
+		if err != nil {
+			t.Fatalf("getting snapshot failed: %v", err)
+		}
+		if snap.Revision != 5 {
+			t.Errorf("expected latest snapshot revision: 5 but got: %d", snap.Revision)
+		}
+
+		err = s.SaveSnapshot(ctx, &es.Snapshot{AggregateId: aggID, AggregateType: aggType, AggregateVersion: 1, Revision: 5})
+		if !cgerrors.IsAlreadyExists(err) {
+			t.Errorf("expected already exists error on duplicated snapshot but got: %v", err)
+		}
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		s := esmem.New()
+		events := testEvents()
+		if err := s.SaveEvents(ctx, events); err != nil {
+			t.Fatalf("saving events failed: %v", err)
+		}
+
+		tests := []struct {
+			name     string
+			req      es.StreamEventsRequest
+			expected []*es.Event
+		}{
+			{name: "All", req: es.StreamEventsRequest{}, expected: events},
+			{name: "AggregateIDs", req: es.StreamEventsRequest{AggregateIDs: []string{agg2ID}}, expected: events[2:3]},
+			{name: "AggregateTypes", req: es.StreamEventsRequest{AggregateTypes: []string{"OTHER"}}},
+			{name: "EventTypes", req: es.StreamEventsRequest{EventTypes: []string{otherType}}, expected: events[1:2]},
+			{name: "ExcludeEventTypes", req: es.StreamEventsRequest{ExcludeEventTypes: []string{otherType}, BuffSize: 1}, expected: []*es.Event{events[0], events[2], events[3]}},
+			{name: "FromPosition", req: es.StreamEventsRequest{FromPosition: 2}, expected: events[2:]},
+			{name: "FromTimestamp", req: es.StreamEventsRequest{FromTimestamp: events[1].Timestamp}, expected: events[1:]},
+		}
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				req := tc.req
+				stream, err := s.StreamEvents(ctx, &req)
+				if err != nil {
+					t.Fatalf("streaming events failed: %v", err)
+				}
+				var i int
+				for e := range stream {
+					if i >= len(tc.expected) {
+						t.Fatalf("streamed more events than expected")
+					}
+					if e.EventId != tc.expected[i].EventId {
+						t.Errorf("event at index: %d expected: %s but is: %s", i, tc.expected[i].EventId, e.EventId)
+					}
+					if e.Position == 0 {
+						t.Errorf("event at index: %d has no position", i)
+					}
+					i++
+				}
+				if i != len(tc.expected) {
+					t.Errorf("expected %d events but streamed: %d", len(tc.expected), i)
+				}
+			})
+		}
+
+		t.Run("Follow", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			stream, err := s.StreamEvents(ctx, &es.StreamEventsRequest{FromPosition: int64(len(events)), Follow: true})
+			if err != nil {
+				t.Fatalf("streaming events failed: %v", err)
+			}
+
+			next := &es.Event{EventId: "b3c4f5f2-3f39-4d43-a2a3-4d2c6a0a6d7e", EventType: eventType, AggregateType: aggType, AggregateId: agg2ID, Timestamp: time.Now().UnixNano(), Revision: 2}
+			if err = s.SaveEvents(ctx, []*es.Event{next}); err != nil {
+				t.Fatalf("saving events failed: %v", err)
+			}
+			select {
+			case e := <-stream:
+				if e.EventId != next.EventId || e.Position != int64(len(events)+1) {
+					t.Errorf("unexpected followed event: %v", e)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("followed event not received")
+			}
+
+			cancel()
+			if _, ok := <-stream; ok {
+				t.Error("stream should be closed after the context is canceled")
+			}
+		})
+	})
+
+	t.Run("Transaction", func(t *testing.T) {
+		s := esmem.New()
+		events := testEvents()
+
+		tx, err := s.BeginTx(ctx)
+		if err != nil {
+			t.Fatalf("beginning transaction failed: %v", err)
+		}
+		if err = tx.SaveEvents(ctx, events[:2]); err != nil {
+			t.Fatalf("saving events in transaction failed: %v", err)
+		}
+		if stream, _ := tx.ListEvents(ctx, aggID, aggType); len(stream) != 2 {
+			t.Errorf("transaction should see its own events, but found: %d", len(stream))
+		}
+		if stream, _ := s.ListEvents(ctx, aggID, aggType); len(stream) != 0 {
+			t.Errorf("storage should not see uncommitted transaction events, but found: %d", len(stream))
+		}
+		if err = tx.Rollback(ctx); err != nil {
+			t.Fatalf("rolling back failed: %v", err)
+		}
+		if stream, _ := s.ListEvents(ctx, aggID, aggType); len(stream) != 0 {
+			t.Errorf("storage should not contain rolled back events, but found: %d", len(stream))
+		}
+
+		tx, _ = s.BeginTx(ctx)
+		if err = tx.SaveEvents(ctx, events[:2]); err != nil {
+			t.Fatalf("saving events in transaction failed: %v", err)
+		}
+		// Concurrently commit the event with the same revision.
+		if err = s.SaveEvents(ctx, events[1:2]); err != nil {
+			t.Fatalf("saving events failed: %v", err)
+		}
+		if err = tx.Commit(ctx); !cgerrors.IsAlreadyExists(err) {
+			t.Errorf("expected already exists error on conflicting commit but got: %v", err)
+		}
+		if stream, _ := s.ListEvents(ctx, aggID, aggType); len(stream) != 1 {
+			t.Errorf("conflicting transaction should not be applied, found: %d events", len(stream))
+		}
+		if err = tx.Commit(ctx); err == nil {
+			t.Error("expected error on committing finished transaction")
+		}
+	})
+}
+
+func TestStateStorage(t *testing.T) {
+	ctx := context.Background()
+	s, err := esmem.NewStateStorage(
+		eventstate.Handler{Name: "handler_1", EventTypes: []string{eventType}},
+		eventstate.Handler{Name: "handler_2", EventTypes: []string{eventType, otherType}},
+	)
+	if err != nil {
+		t.Fatalf("creating state storage failed: %v", err)
+	}
+
+	store, err := esstate.NewStore(es.DefaultConfig(), codec.JSON(), codec.JSON(), s)
+	if err != nil {
+		t.Fatalf("creating event state store failed: %v", err)
+	}
+
+	events := testEvents()
+	e := events[0]
+	state, err := esstate.InitializeUnhandledEventState(e.EventId, e.EventType, e.Time(), store.AggregateBaseSetter, nil)
+	if err != nil {
+		t.Fatalf("initializing event state failed: %v", err)
+	}
+	if err = store.Commit(ctx, state); err != nil {
+		t.Fatalf("committing event state failed: %v", err)
+	}
+	if err = s.MarkUnhandled(ctx, e.EventId, e.EventType, e.Timestamp); err != nil {
+		t.Fatalf("marking unhandled failed: %v", err)
+	}
+
+	unhandled, err := s.FindUnhandled(ctx, eventstate.FindUnhandledQuery{})
+	if err != nil {
+		t.Fatalf("finding unhandled failed: %v", err)
+	}
+	if len(unhandled) != 2 {
+		t.Fatalf("expected two unhandled event states but got: %d", len(unhandled))
+	}
+
+	if err = store.StartHandling(ctx, e.EventId, "handler_1"); err != nil {
+		t.Fatalf("start handling failed: %v", err)
+	}
+	if err = store.HandlingFailed(ctx, e.EventId, "handler_1", cgerrors.ErrInternal("failed")); err != nil {
+		t.Fatalf("handling failed failed: %v", err)
+	}
+
+	unhandled, _ = s.FindUnhandled(ctx, eventstate.FindUnhandledQuery{HandlerNames: []string{"handler_1"}})
+	if len(unhandled) != 0 {
+		t.Errorf("expected no unhandled events for handler_1 but got: %d", len(unhandled))
+	}
+	failures, _ := s.FindFailures(ctx, eventstate.FindFailureQuery{HandlerNames: []string{"handler_1"}})
+	if len(failures) != 1 {
+		t.Errorf("expected a single failure for handler_1 but got: %d", len(failures))
+	}
+
+	handlers, _ := s.ListHandlers(ctx)
+	if len(handlers) != 2 || handlers[1].Name != "handler_2" || len(handlers[1].EventTypes) != 2 {
+		t.Errorf("unexpected handlers listed: %v", handlers)
+	}
+}
+
+// testAggregate is a minimal aggregate that accepts all the events.
+type testAggregate struct {
+	base *es.AggregateBase
+}
+
+func (a *testAggregate) Apply(*es.Event) error          { return nil }
+func (a *testAggregate) SetBase(base *es.AggregateBase) { a.base = base }
+func (a *testAggregate) AggBase() *es.AggregateBase     { return a.base }
+func (a *testAggregate) Reset()                         {}
+
+type testMessage struct{}
+
+func (testMessage) MessageType() string { return eventType }
+
+func TestStateStoreCommitAll(t *testing.T) {
+	ctx := context.Background()
+	s, err := esmem.NewStateStorage(eventstate.Handler{Name: "handler_1", EventTypes: []string{eventType}})
+	if err != nil {
+		t.Fatalf("creating state storage failed: %v", err)
+	}
+	store, err := esstate.NewStore(es.DefaultConfig(), codec.JSON(), codec.JSON(), s)
+	if err != nil {
+		t.Fatalf("creating event state store failed: %v", err)
+	}
+
+	aggs := make([]es.Aggregate, 2)
+	for i, id := range []string{aggID, agg2ID} {
+		agg := &testAggregate{}
+		store.SetAggregateBase(agg, id, aggType, 1)
+		if err = agg.base.SetEvent(testMessage{}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		aggs[i] = agg
+	}
+	if err = store.CommitAll(ctx, aggs...); err != nil {
+		t.Fatalf("committing aggregates failed: %v", err)
+	}
+
+	for _, agg := range aggs {
+		events, err := s.ListEvents(ctx, agg.AggBase().ID(), aggType)
+		if err != nil {
+			t.Fatalf("listing events failed: %v", err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("expected a single event stored but got: %d", len(events))
+		}
+		state := esstate.NewEventState(events[0].EventId, store.AggregateBaseSetter)
+		if err = store.LoadEvents(ctx, state); err != nil {
+			t.Errorf("loading event state failed: %v", err)
+		}
+	}
+	unhandled, err := s.FindUnhandled(ctx, eventstate.FindUnhandledQuery{})
+	if err != nil {
+		t.Fatalf("finding unhandled failed: %v", err)
+	}
+	if len(unhandled) != 2 {
+		t.Errorf("expected two unhandled events but got: %d", len(unhandled))
+	}
+}
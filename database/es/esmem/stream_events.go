@@ -0,0 +1,129 @@
+package esmem
+
+import (
+	"context"
+
+	"github.com/kucjac/cleango/database/es"
+)
+
+// streamBatchSize is the number of events taken by the cursor at once.
+const streamBatchSize = 100
+
+type streamEventsCursor struct {
+	ctx       context.Context
+	s         *storage
+	req       *es.StreamEventsRequest
+	filter    streamFilter
+	lastTaken int
+}
+
+func (s *storage) newStreamCursor(ctx context.Context, req *es.StreamEventsRequest) *streamEventsCursor {
+	c := &streamEventsCursor{ctx: ctx, s: s, req: req, filter: newStreamFilter(req)}
+	// The event position is its index in the events table incremented by one.
+	if req.FromPosition > 0 {
+		c.lastTaken = int(req.FromPosition)
+	}
+	return c
+}
+
+func (c *streamEventsCursor) openChannel() <-chan *es.Event {
+	ch := make(chan *es.Event, c.req.BuffSize)
+	go c.startReadingEvents(ch)
+	return ch
+}
+
+func (c *streamEventsCursor) startReadingEvents(ch chan *es.Event) {
+	defer close(ch)
+	for {
+		// Take the changes channel before reading, so that no event stored in the meantime is missed.
+		changed := c.s.db.changes()
+		batch := c.nextBatch()
+		if len(batch) == 0 {
+			if !c.req.Follow {
+				return
+			}
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-changed:
+			}
+			continue
+		}
+		for _, e := range batch {
+			select {
+			case <-c.ctx.Done():
+				return
+			case ch <- e:
+			}
+		}
+	}
+}
+
+// nextBatch takes the next batch of the events matching the filter, starting after the last taken position.
+func (c *streamEventsCursor) nextBatch() []*es.Event {
+	var batch []*es.Event
+	c.s.read(func(d *data) {
+		for c.lastTaken < len(d.events) && len(batch) < streamBatchSize {
+			e := d.events[c.lastTaken]
+			c.lastTaken++
+			if c.filter.matches(e) && !(c.filter.excludeDeleted && d.isDeleted(e)) {
+				batch = append(batch, e.Copy())
+			}
+		}
+	})
+	return batch
+}
+
+// streamFilter is the set based representation of the es.StreamEventsRequest filters.
+type streamFilter struct {
+	aggregateTypes    map[string]struct{}
+	aggregateIDs      map[string]struct{}
+	eventTypes        map[string]struct{}
+	excludeEventTypes map[string]struct{}
+	fromTimestamp     int64
+	excludeDeleted    bool
+}
+
+func newStreamFilter(req *es.StreamEventsRequest) streamFilter {
+	return streamFilter{
+		aggregateTypes:    toSet(req.AggregateTypes),
+		aggregateIDs:      toSet(req.AggregateIDs),
+		eventTypes:        toSet(req.EventTypes),
+		excludeEventTypes: toSet(req.ExcludeEventTypes),
+		fromTimestamp:     req.FromTimestamp,
+		excludeDeleted:    req.ExcludeDeleted,
+	}
+}
+
+func (f streamFilter) matches(e *es.Event) bool {
+	if e.Timestamp < f.fromTimestamp {
+		return false
+	}
+	if !inSet(f.aggregateTypes, e.AggregateType) || !inSet(f.aggregateIDs, e.AggregateId) || !inSet(f.eventTypes, e.EventType) {
+		return false
+	}
+	if _, ok := f.excludeEventTypes[e.EventType]; ok {
+		return false
+	}
+	return true
+}
+
+// inSet checks if the value is in the set. An empty set matches all values.
+func inSet(set map[string]struct{}, v string) bool {
+	if len(set) == 0 {
+		return true
+	}
+	_, ok := set[v]
+	return ok
+}
+
+func toSet(values []string) map[string]struct{} {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,82 @@
+package esmem
+
+import (
+	"context"
+	"sync"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esstate"
+)
+
+// Compile time check if Transaction implements es.TxStorage and esstate.TxStorage.
+var (
+	_ es.TxStorage      = (*Transaction)(nil)
+	_ esstate.TxStorage = (*Transaction)(nil)
+)
+
+// Transaction is the in-memory storage transaction.
+type Transaction struct {
+	id string
+	storage
+}
+
+// txState is the state of the transaction, with its own copy of the data and the list of the writes done within it.
+type txState struct {
+	l    sync.Mutex
+	data *data
+	ops  []func(d *data) error
+	done bool
+}
+
+// As sets the destination with the *esmem.Transaction.
+func (t *Transaction) As(dst interface{}) error {
+	dt, ok := dst.(**Transaction)
+	if !ok {
+		return cgerrors.ErrInternalf("provided invalid input type: %T, wanted: **esmem.Transaction", dst)
+	}
+	*dt = t
+	return nil
+}
+
+// Done checks if the transaction is already done.
+func (t *Transaction) Done() bool {
+	t.tx.l.Lock()
+	defer t.tx.l.Unlock()
+	return t.tx.done
+}
+
+// Commit applies all the transaction changes atomically on the storage.
+// If any of the changes conflicts with the data committed in the meantime, no change is applied
+// and the conflict error is returned.
+func (t *Transaction) Commit(context.Context) error {
+	t.tx.l.Lock()
+	defer t.tx.l.Unlock()
+	if t.tx.done {
+		return cgerrors.ErrInternalf("transaction '%s' is already done", t.id)
+	}
+	t.tx.done = true
+
+	t.db.l.Lock()
+	defer t.db.l.Unlock()
+	d := t.db.data.clone()
+	for _, op := range t.tx.ops {
+		if err := op(d); err != nil {
+			return err
+		}
+	}
+	t.db.data = d
+	t.db.notify()
+	return nil
+}
+
+// Rollback the transaction.
+func (t *Transaction) Rollback(context.Context) error {
+	t.tx.l.Lock()
+	defer t.tx.l.Unlock()
+	if t.tx.done {
+		return cgerrors.ErrInternalf("transaction '%s' is already done", t.id)
+	}
+	t.tx.done = true
+	return nil
+}
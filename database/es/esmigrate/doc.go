@@ -0,0 +1,6 @@
+// Package esmigrate provides the migration of the events from one es.StorageBase to another, i.e. when the tables
+// are re-partitioned, the aggregate types are renamed or the store is moved to another database engine.
+// The events are transformed on the fly by the chain of Transform functions, which could rename, drop, split
+// or re-encode them. The Migrator keeps its progress in the esproj.CheckpointStore, so that an interrupted
+// migration resumes where it stopped, and verifies the event counts and revisions of the migrated aggregates.
+package esmigrate
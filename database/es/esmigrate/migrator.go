@@ -0,0 +1,307 @@
+package esmigrate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esproj"
+)
+
+// MigratorConfig is the configuration of the Migrator.
+type MigratorConfig struct {
+	// Name is the name of the migration, used as the name of its checkpoint.
+	Name string
+	// AggregateTypes migrates only the events of selected source aggregate types. If empty, all the events are migrated.
+	AggregateTypes []string
+	// BatchSize is the maximum number of the source events migrated at once. The checkpoint is stored after each batch.
+	BatchSize int
+	// BuffSize is the buffer size of the source event stream.
+	BuffSize int
+	// Verify enables the verification of the migrated aggregates after all the events are copied.
+	Verify bool
+}
+
+// DefaultMigratorConfig creates the default config of the migration with given name.
+func DefaultMigratorConfig(name string) *MigratorConfig {
+	return &MigratorConfig{
+		Name:      name,
+		BatchSize: 100,
+		BuffSize:  100,
+		Verify:    true,
+	}
+}
+
+// Validate checks if the config is valid to use.
+func (c *MigratorConfig) Validate() error {
+	if c.Name == "" {
+		return cgerrors.ErrInvalidArgument("migration name is required")
+	}
+	if c.BatchSize <= 0 {
+		return cgerrors.ErrInvalidArgument("migrator batch size needs to be greater than 0")
+	}
+	if c.BuffSize < 0 {
+		return cgerrors.ErrInvalidArgument("migrator buffer size cannot be negative")
+	}
+	return nil
+}
+
+// Report is the summary of the migration run.
+type Report struct {
+	// Read is the number of the source events read in this run.
+	Read int64
+	// Written is the number of the events stored in the target storage in this run.
+	Written int64
+	// Skipped is the number of the transformed events that were already stored in the target, i.e. by the interrupted run.
+	Skipped int64
+	// Position is the global position of the last migrated source event.
+	Position int64
+	// Aggregates is the number of the target aggregates verified after the migration. Zero if not verified.
+	Aggregates int
+}
+
+// Migrator copies the events from the source to the target storage, transforming them on the fly.
+// The events are read in the order of their global position, and the resulting events of each target aggregate are given
+// the subsequent revisions of its target stream. If the source events are hash chained, the target events are chained anew.
+// The snapshots are not migrated, as these might not match the transformed events - they are recreated by the es.Store.
+type Migrator struct {
+	source      es.StorageBase
+	target      es.StorageBase
+	checkpoints esproj.CheckpointStore
+	transforms  []Transform
+	cfg         MigratorConfig
+}
+
+// NewMigrator creates a new migrator of the events from the source to the target storage, with given transforms applied in order.
+func NewMigrator(source, target es.StorageBase, checkpoints esproj.CheckpointStore, cfg *MigratorConfig, transforms ...Transform) (*Migrator, error) {
+	if cfg == nil {
+		return nil, cgerrors.ErrInvalidArgument("migrator config is required")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		source:      source,
+		target:      target,
+		checkpoints: checkpoints,
+		transforms:  transforms,
+		cfg:         *cfg,
+	}, nil
+}
+
+// Run migrates the source events stored after the migration checkpoint, and verifies the migrated aggregates if configured.
+// It stops when all the currently stored source events are migrated. It could be run again to migrate the events stored
+// since the last run - i.e. until the source storage is switched off.
+func (m *Migrator) Run(ctx context.Context) (*Report, error) {
+	var position int64
+	cp, err := m.checkpoints.GetCheckpoint(ctx, m.cfg.Name)
+	if err == nil {
+		position = cp.Position
+	} else if !cgerrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var streamErr error
+	c, err := m.source.StreamEvents(streamCtx, &es.StreamEventsRequest{
+		AggregateTypes: m.cfg.AggregateTypes,
+		FromPosition:   position,
+		BuffSize:       m.cfg.BuffSize,
+		OnError:        func(err error) { streamErr = err },
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Report{Position: position}
+	streams := map[streamKey]*targetStream{}
+	batch := make([]*es.Event, 0, m.cfg.BatchSize)
+	for event := range c {
+		batch = append(batch, event)
+		if len(batch) < m.cfg.BatchSize {
+			continue
+		}
+		if err = m.migrateBatch(ctx, batch, streams, r); err != nil {
+			return nil, err
+		}
+		batch = batch[:0]
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	// The stream stopped on error, thus the migrated events are followed by the source events which were not read.
+	if streamErr != nil {
+		return nil, streamErr
+	}
+	if len(batch) > 0 {
+		if err = m.migrateBatch(ctx, batch, streams, r); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.cfg.Verify {
+		if r.Aggregates, err = m.Verify(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Reset removes the checkpoint of the migration, so that the next run starts from the beginning of the source stream.
+// The events already stored in the target are recognized and skipped.
+func (m *Migrator) Reset(ctx context.Context) error {
+	return m.checkpoints.ResetCheckpoint(ctx, m.cfg.Name)
+}
+
+// Verify checks if each target aggregate has as many events as results from transforming the source events,
+// and if its revisions are subsequent starting from 1. It returns the number of verified aggregates.
+// The target storage is expected to contain no other events of the migrated aggregates.
+func (m *Migrator) Verify(ctx context.Context) (int, error) {
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var streamErr error
+	c, err := m.source.StreamEvents(streamCtx, &es.StreamEventsRequest{
+		AggregateTypes: m.cfg.AggregateTypes,
+		BuffSize:       m.cfg.BuffSize,
+		OnError:        func(err error) { streamErr = err },
+	})
+	if err != nil {
+		return 0, err
+	}
+	var keys []streamKey
+	expected := map[streamKey]int64{}
+	for event := range c {
+		events, err := m.transform(event)
+		if err != nil {
+			return 0, err
+		}
+		for _, e := range events {
+			key := streamKey{id: e.AggregateId, typ: e.AggregateType}
+			if _, ok := expected[key]; !ok {
+				keys = append(keys, key)
+			}
+			expected[key]++
+		}
+	}
+	if err = ctx.Err(); err != nil {
+		return 0, err
+	}
+	if streamErr != nil {
+		return 0, streamErr
+	}
+
+	for _, key := range keys {
+		events, err := m.target.ListEvents(ctx, key.id, key.typ)
+		if err != nil && !cgerrors.IsNotFound(err) {
+			return 0, err
+		}
+		if int64(len(events)) != expected[key] {
+			return 0, verificationError(key, "expected %d events, but the target has %d", expected[key], len(events))
+		}
+		for i, e := range events {
+			if e.Revision != int64(i+1) {
+				return 0, verificationError(key, "expected revision: %d, but the target has: %d", i+1, e.Revision)
+			}
+		}
+	}
+	return len(keys), nil
+}
+
+// migrateBatch transforms and stores the batch of the source events, and saves the checkpoint after its last event.
+func (m *Migrator) migrateBatch(ctx context.Context, batch []*es.Event, streams map[streamKey]*targetStream, r *Report) error {
+	var out []*es.Event
+	for _, source := range batch {
+		events, err := m.transform(source.Copy())
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			key := streamKey{id: e.AggregateId, typ: e.AggregateType}
+			ts, ok := streams[key]
+			if !ok {
+				if ts, err = m.loadTargetStream(ctx, key); err != nil {
+					return err
+				}
+				streams[key] = ts
+			}
+			if _, ok = ts.stored[e.EventId]; ok {
+				r.Skipped++
+				continue
+			}
+			ts.revision++
+			e.Revision = ts.revision
+			e.Position = 0
+			if len(source.Hash) > 0 {
+				e.PreviousHash = ts.hash
+				e.Hash = e.ComputeHash()
+				ts.hash = e.Hash
+			}
+			out = append(out, e)
+		}
+	}
+	if len(out) > 0 {
+		if err := m.target.SaveEvents(ctx, out); err != nil {
+			return err
+		}
+	}
+	r.Read += int64(len(batch))
+	r.Written += int64(len(out))
+	r.Position = batch[len(batch)-1].Position
+	return m.checkpoints.SaveCheckpoint(ctx, &esproj.Checkpoint{Projection: m.cfg.Name, Position: r.Position, UpdatedAt: time.Now().UTC()})
+}
+
+// transform applies the migrator transforms on given event.
+func (m *Migrator) transform(event *es.Event) ([]*es.Event, error) {
+	events := []*es.Event{event}
+	for _, t := range m.transforms {
+		var next []*es.Event
+		for _, e := range events {
+			out, err := t.Transform(e)
+			if err != nil {
+				return nil, cgerrors.ErrInternalf("transforming event: %s failed: %v", e.EventId, err)
+			}
+			next = append(next, out...)
+		}
+		events = next
+	}
+	for _, e := range events {
+		if e.EventId == "" || e.AggregateId == "" || e.AggregateType == "" {
+			return nil, cgerrors.ErrInternalf("transformed event of the source event: %s has no identifier or aggregate", event.EventId)
+		}
+	}
+	return events, nil
+}
+
+// loadTargetStream gets the state of the target aggregate stream - its revision, last hash and the identifiers of the
+// stored events, so that the events stored by the interrupted run are not duplicated.
+func (m *Migrator) loadTargetStream(ctx context.Context, key streamKey) (*targetStream, error) {
+	events, err := m.target.ListEvents(ctx, key.id, key.typ)
+	if err != nil && !cgerrors.IsNotFound(err) {
+		return nil, err
+	}
+	ts := &targetStream{stored: make(map[string]struct{}, len(events))}
+	for _, e := range events {
+		ts.stored[e.EventId] = struct{}{}
+	}
+	if n := len(events); n > 0 {
+		ts.revision, ts.hash = events[n-1].Revision, events[n-1].Hash
+	}
+	return ts, nil
+}
+
+type streamKey struct {
+	id, typ string
+}
+
+type targetStream struct {
+	revision int64
+	hash     []byte
+	stored   map[string]struct{}
+}
+
+func verificationError(key streamKey, format string, args ...interface{}) error {
+	return cgerrors.New("", fmt.Sprintf("aggregate: %s with id: %s migration mismatch: ", key.typ, key.id)+fmt.Sprintf(format, args...), cgerrors.CodeDataLoss)
+}
@@ -0,0 +1,204 @@
+package esmigrate_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esmem"
+	"github.com/kucjac/cleango/database/es/esmigrate"
+	"github.com/kucjac/cleango/database/es/esproj"
+)
+
+// failingCheckpoints fails to save the checkpoint once, which interrupts the migration after the batch was stored.
+type failingCheckpoints struct {
+	*esproj.MemoryCheckpointStore
+	fail bool
+}
+
+func (f *failingCheckpoints) SaveCheckpoint(ctx context.Context, cp *esproj.Checkpoint) error {
+	if f.fail {
+		f.fail = false
+		return errors.New("checkpoint failed")
+	}
+	return f.MemoryCheckpointStore.SaveCheckpoint(ctx, cp)
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	source := esmem.New()
+	newEvent := func(id, eventType, aggId string, revision int64) *es.Event {
+		e := &es.Event{EventId: id, EventType: eventType, AggregateType: "order", AggregateId: aggId, Revision: revision, Timestamp: revision, EventData: []byte(`{}`)}
+		e.Hash = e.ComputeHash()
+		return e
+	}
+	events := []*es.Event{
+		newEvent("e1", "created", "o1", 1),
+		newEvent("e2", "created", "o2", 1),
+		newEvent("e3", "viewed", "o1", 2),
+		newEvent("e4", "merged", "o1", 3),
+		newEvent("e5", "changed", "o2", 2),
+	}
+	for _, e := range events {
+		if err := source.SaveEvents(ctx, []*es.Event{e}); err != nil {
+			t.Fatalf("saving events failed: %v", err)
+		}
+	}
+
+	split := esmigrate.SplitEvent("merged", func(e *es.Event) ([]*es.Event, error) {
+		first, second := e.Copy(), e.Copy()
+		first.EventType, second.EventType = "first", "second"
+		return []*es.Event{first, second}, nil
+	})
+	transforms := []esmigrate.Transform{
+		esmigrate.RenameAggregateType("order", "purchase"),
+		esmigrate.DropEventTypes("viewed"),
+		esmigrate.RenameEventType("changed", "updated"),
+		esmigrate.ReencodeEvents("updated", func([]byte) ([]byte, error) { return []byte(`{"v":2}`), nil }),
+		split,
+	}
+
+	target := esmem.New()
+	checkpoints := &failingCheckpoints{MemoryCheckpointStore: esproj.NewMemoryCheckpointStore(), fail: true}
+	cfg := esmigrate.DefaultMigratorConfig("orders")
+	cfg.BatchSize = 3
+	m, err := esmigrate.NewMigrator(source, target, checkpoints, cfg, transforms...)
+	if err != nil {
+		t.Fatalf("creating migrator failed: %v", err)
+	}
+
+	// The first run is interrupted after the first batch is stored.
+	if _, err = m.Run(ctx); err == nil {
+		t.Fatal("expected the first run to fail")
+	}
+	r, err := m.Run(ctx)
+	if err != nil {
+		t.Fatalf("running migration failed: %v", err)
+	}
+	if r.Read != 5 || r.Written != 3 || r.Skipped != 2 || r.Aggregates != 2 {
+		t.Errorf("unexpected migration report: %+v", r)
+	}
+
+	o1, err := target.ListEvents(ctx, "o1", "purchase")
+	if err != nil {
+		t.Fatalf("listing events failed: %v", err)
+	}
+	if len(o1) != 3 || o1[1].EventType != "first" || o1[2].EventType != "second" || o1[2].Revision != 3 {
+		t.Fatalf("unexpected migrated stream: %v", o1)
+	}
+	// The split events identifiers are derived from the source event.
+	resplit, err := split.Transform(events[3].Copy())
+	if err != nil {
+		t.Fatalf("splitting event failed: %v", err)
+	}
+	if resplit[0].EventId != o1[1].EventId || resplit[1].EventId != o1[2].EventId || o1[1].EventId == o1[2].EventId {
+		t.Errorf("expected deterministic split event ids, got: %s, %s", o1[1].EventId, o1[2].EventId)
+	}
+	o2, err := target.ListEvents(ctx, "o2", "purchase")
+	if err != nil {
+		t.Fatalf("listing events failed: %v", err)
+	}
+	if len(o2) != 2 || o2[1].EventType != "updated" || string(o2[1].EventData) != `{"v":2}` {
+		t.Fatalf("unexpected migrated stream: %v", o2)
+	}
+	for _, stream := range [][]*es.Event{o1, o2} {
+		if err = es.VerifyHashChain(stream); err != nil {
+			t.Errorf("expected the migrated stream to be chained: %v", err)
+		}
+	}
+
+	// The events stored since the last run are migrated by the next one.
+	if err = source.SaveEvents(ctx, []*es.Event{newEvent("e6", "changed", "o1", 4)}); err != nil {
+		t.Fatalf("saving event failed: %v", err)
+	}
+	if r, err = m.Run(ctx); err != nil {
+		t.Fatalf("running migration failed: %v", err)
+	}
+	if r.Read != 1 || r.Written != 1 {
+		t.Errorf("unexpected migration report: %+v", r)
+	}
+
+	t.Run("Mismatch", func(t *testing.T) {
+		if err := target.SaveEvents(ctx, []*es.Event{{EventId: "x", EventType: "x", AggregateType: "purchase", AggregateId: "o2", Revision: 3}}); err != nil {
+			t.Fatalf("saving event failed: %v", err)
+		}
+		if _, err := m.Verify(ctx); cgerrors.Code(err) != cgerrors.CodeDataLoss {
+			t.Errorf("expected data loss error but got: %v", err)
+		}
+	})
+
+	t.Run("InvalidConfig", func(t *testing.T) {
+		if _, err := esmigrate.NewMigrator(source, target, checkpoints, &esmigrate.MigratorConfig{Name: "orders"}); cgerrors.Code(err) != cgerrors.CodeInvalidArgument {
+			t.Errorf("expected invalid argument error but got: %v", err)
+		}
+	})
+}
+
+func TestMigratorStreamError(t *testing.T) {
+	ctx := context.Background()
+	source := esmem.New()
+	for i, id := range []string{"o1", "o2", "o3"} {
+		e := &es.Event{EventId: fmt.Sprintf("e%d", i+1), EventType: "created", AggregateType: "order", AggregateId: id, Revision: 1, Timestamp: 1, EventData: []byte(`{}`)}
+		if err := source.SaveEvents(ctx, []*es.Event{e}); err != nil {
+			t.Fatalf("saving events failed: %v", err)
+		}
+	}
+
+	target := esmem.New()
+	checkpoints := esproj.NewMemoryCheckpointStore()
+	cfg := esmigrate.DefaultMigratorConfig("orders")
+	cfg.Verify = false
+	m, err := esmigrate.NewMigrator(&failingStorage{Storage: source, after: 1}, target, checkpoints, cfg)
+	if err != nil {
+		t.Fatalf("creating migrator failed: %v", err)
+	}
+
+	if _, err = m.Run(ctx); cgerrors.Code(err) != cgerrors.CodeUnavailable {
+		t.Errorf("expected the stream error returned from the run, but got: %v", err)
+	}
+	if _, err = checkpoints.GetCheckpoint(ctx, cfg.Name); !cgerrors.IsNotFound(err) {
+		t.Errorf("expected no checkpoint saved for the partially read batch, but got: %v", err)
+	}
+	if events, err := target.ListEvents(ctx, "o1", "order"); err != nil || len(events) != 0 {
+		t.Errorf("expected no events migrated, got: %d, err: %v", len(events), err)
+	}
+	if _, err = m.Verify(ctx); cgerrors.Code(err) != cgerrors.CodeUnavailable {
+		t.Errorf("expected the stream error returned from the verification, but got: %v", err)
+	}
+}
+
+// failingStorage stops the event stream with an error after given number of events.
+type failingStorage struct {
+	*esmem.Storage
+	after int
+}
+
+func (s *failingStorage) StreamEvents(ctx context.Context, req *es.StreamEventsRequest) (<-chan *es.Event, error) {
+	c, err := s.Storage.StreamEvents(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan *es.Event)
+	go func() {
+		defer close(out)
+		var n int
+		for e := range c {
+			if n == s.after {
+				if req.OnError != nil {
+					req.OnError(cgerrors.ErrUnavailable("connection lost"))
+				}
+				return
+			}
+			n++
+			select {
+			case out <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,104 @@
+package esmigrate
+
+import (
+	"strconv"
+
+	"github.com/google/uuid"
+
+	"github.com/kucjac/cleango/database/es"
+)
+
+// Transform transforms a source event before it is stored in the target storage.
+// It could change the event in place, drop it by returning no events or split it into multiple events.
+// The resulting events of an aggregate are given the subsequent revisions of the target stream, thus the transform
+// doesn't need to care about the revisions. The transform should be deterministic - including the identifiers
+// of the split events - so that the resumed migration recognizes the events that were already stored.
+type Transform interface {
+	Transform(e *es.Event) ([]*es.Event, error)
+}
+
+// TransformFunc is a function that implements Transform interface.
+type TransformFunc func(e *es.Event) ([]*es.Event, error)
+
+// Transform implements Transform interface.
+func (t TransformFunc) Transform(e *es.Event) ([]*es.Event, error) {
+	return t(e)
+}
+
+// RenameAggregateType creates a transform that changes the aggregate type of the events from the old to the new one.
+func RenameAggregateType(oldType, newType string) Transform {
+	return TransformFunc(func(e *es.Event) ([]*es.Event, error) {
+		if e.AggregateType == oldType {
+			e.AggregateType = newType
+		}
+		return []*es.Event{e}, nil
+	})
+}
+
+// RenameEventType creates a transform that changes the event type of the events from the old to the new one.
+func RenameEventType(oldType, newType string) Transform {
+	return TransformFunc(func(e *es.Event) ([]*es.Event, error) {
+		if e.EventType == oldType {
+			e.EventType = newType
+		}
+		return []*es.Event{e}, nil
+	})
+}
+
+// DropEventTypes creates a transform that drops the events of given types.
+func DropEventTypes(eventTypes ...string) Transform {
+	drop := make(map[string]struct{}, len(eventTypes))
+	for _, t := range eventTypes {
+		drop[t] = struct{}{}
+	}
+	return TransformFunc(func(e *es.Event) ([]*es.Event, error) {
+		if _, ok := drop[e.EventType]; ok {
+			return nil, nil
+		}
+		return []*es.Event{e}, nil
+	})
+}
+
+// ReencodeEvents creates a transform that replaces the data of the events of given type with the result of fn,
+// i.e. decoded with one codec and encoded with another.
+func ReencodeEvents(eventType string, fn func(data []byte) ([]byte, error)) Transform {
+	return TransformFunc(func(e *es.Event) ([]*es.Event, error) {
+		if e.EventType != eventType {
+			return []*es.Event{e}, nil
+		}
+		data, err := fn(e.EventData)
+		if err != nil {
+			return nil, err
+		}
+		e.EventData = data
+		return []*es.Event{e}, nil
+	})
+}
+
+// SplitEvent creates a transform that splits the events of given type into the events returned by fn,
+// i.e. the copies of the source event with the changed event type and data.
+// The split events are given the identifiers derived deterministically from the source event identifier
+// and their position, so that the resumed migration recognizes the events that were already stored.
+func SplitEvent(eventType string, fn func(e *es.Event) ([]*es.Event, error)) Transform {
+	return TransformFunc(func(e *es.Event) ([]*es.Event, error) {
+		if e.EventType != eventType {
+			return []*es.Event{e}, nil
+		}
+		out, err := fn(e)
+		if err != nil {
+			return nil, err
+		}
+		for i, split := range out {
+			split.EventId = splitEventId(e.EventId, i)
+		}
+		return out, nil
+	})
+}
+
+// splitEventNamespace is the namespace of the name based identifiers of the split events.
+var splitEventNamespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("github.com/kucjac/cleango/database/es/esmigrate"))
+
+// splitEventId gets the name based UUID of the i-th event split from the source event.
+func splitEventId(sourceId string, i int) string {
+	return uuid.NewSHA1(splitEventNamespace, []byte(sourceId+"/"+strconv.Itoa(i))).String()
+}
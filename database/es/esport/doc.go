@@ -0,0 +1,6 @@
+// Package esport provides the export and import of the event store content in a portable stream format.
+// The events, snapshots and aggregate catalog records of any es.StorageBase are written as newline delimited JSON
+// records, each followed by its SHA-256 checksum, and closed with the trailer holding the record counts and the checksum
+// of the whole stream. The import verifies all the checksums, thus a truncated or tampered stream is rejected.
+// The events archived by the storage, which are not returned by its StreamEvents, are exported from the aggregate event listing.
+package esport
@@ -0,0 +1,238 @@
+package esport_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esmem"
+	"github.com/kucjac/cleango/database/es/esport"
+)
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	source := esmem.New()
+	events := []*es.Event{
+		{EventId: "e1", EventType: "created", AggregateType: "order", AggregateId: "o1", Revision: 1, Timestamp: 1, EventData: []byte(`{}`), Hash: []byte{1}},
+		{EventId: "e2", EventType: "created", AggregateType: "user", AggregateId: "u1", Revision: 1, Timestamp: 2, EventData: []byte(`{}`)},
+		{EventId: "e3", EventType: "changed", AggregateType: "order", AggregateId: "o1", Revision: 2, Timestamp: 3, EventData: []byte(`{"a":"<b>"}`), Metadata: map[string]string{"k": "v"}},
+	}
+	if err := source.SaveEvents(ctx, events); err != nil {
+		t.Fatalf("saving events failed: %v", err)
+	}
+	snap := &es.Snapshot{AggregateId: "o1", AggregateType: "order", AggregateVersion: 1, Revision: 2, Timestamp: 3, SnapshotData: []byte(`{}`)}
+	if err := source.SaveSnapshot(ctx, snap); err != nil {
+		t.Fatalf("saving snapshot failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	stats, err := esport.Export(ctx, &buf, source, nil)
+	if err != nil {
+		t.Fatalf("exporting failed: %v", err)
+	}
+	if stats.Events != 3 || stats.Snapshots != 1 || stats.Aggregates != 2 {
+		t.Fatalf("unexpected export stats: %+v", stats)
+	}
+	exported := buf.String()
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		target := esmem.New()
+		stats, err := esport.Import(ctx, strings.NewReader(exported), target, nil)
+		if err != nil {
+			t.Fatalf("importing failed: %v", err)
+		}
+		if stats.Events != 3 || stats.Snapshots != 1 || stats.Aggregates != 2 {
+			t.Fatalf("unexpected import stats: %+v", stats)
+		}
+		imported, err := target.ListEvents(ctx, "o1", "order")
+		if err != nil {
+			t.Fatalf("listing events failed: %v", err)
+		}
+		if len(imported) != 2 {
+			t.Fatalf("expected 2 events but got: %d", len(imported))
+		}
+		if string(imported[1].EventData) != string(events[2].EventData) || imported[1].Metadata["k"] != "v" {
+			t.Errorf("imported event doesn't match the exported one: %v", imported[1])
+		}
+		if !bytes.Equal(imported[0].Hash, events[0].Hash) {
+			t.Errorf("imported event hash doesn't match the exported one")
+		}
+		s, err := target.GetSnapshot(ctx, "o1", "order", 1)
+		if err != nil {
+			t.Fatalf("getting snapshot failed: %v", err)
+		}
+		if s.Revision != 2 {
+			t.Errorf("expected snapshot at revision 2 but is: %d", s.Revision)
+		}
+	})
+
+	t.Run("Filter", func(t *testing.T) {
+		var filtered bytes.Buffer
+		stats, err := esport.Export(ctx, &filtered, source, &esport.ExportOptions{AggregateTypes: []string{"user"}, PageSize: 1})
+		if err != nil {
+			t.Fatalf("exporting failed: %v", err)
+		}
+		if stats.Events != 1 || stats.Snapshots != 0 || stats.Aggregates != 1 {
+			t.Fatalf("unexpected export stats: %+v", stats)
+		}
+
+		target := esmem.New()
+		if _, err = esport.Import(ctx, strings.NewReader(exported), target, &esport.ImportOptions{AggregateTypes: []string{"order"}, BatchSize: 1}); err != nil {
+			t.Fatalf("importing failed: %v", err)
+		}
+		if exists, _ := target.AggregateExists(ctx, "u1", "user"); exists {
+			t.Errorf("expected user aggregate to be filtered out")
+		}
+		if exists, _ := target.AggregateExists(ctx, "o1", "order"); !exists {
+			t.Errorf("expected order aggregate to be imported")
+		}
+	})
+
+	t.Run("Corrupted", func(t *testing.T) {
+		lines := strings.SplitAfter(exported, "\n")
+		tests := []struct {
+			name  string
+			input string
+		}{
+			{name: "Tampered", input: strings.Replace(exported, `"revision":2`, `"revision":3`, 1)},
+			{name: "Truncated", input: strings.Join(lines[:len(lines)-2], "")},
+			{name: "Removed", input: strings.Join(append(lines[:2:2], lines[3:]...), "")},
+			{name: "NoHeader", input: strings.Join(lines[1:], "")},
+		}
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				_, err := esport.Import(ctx, strings.NewReader(tc.input), esmem.New(), nil)
+				if err == nil {
+					t.Fatal("expected error on corrupted stream")
+				}
+				if code := cgerrors.Code(err); code != cgerrors.CodeDataLoss {
+					t.Errorf("expected data loss error code but got: %v", err)
+				}
+			})
+		}
+	})
+}
+
+func TestExportStreamError(t *testing.T) {
+	ctx := context.Background()
+	source := esmem.New()
+	events := []*es.Event{
+		{EventId: "e1", EventType: "created", AggregateType: "order", AggregateId: "o1", Revision: 1, Timestamp: 1, EventData: []byte(`{}`)},
+		{EventId: "e2", EventType: "changed", AggregateType: "order", AggregateId: "o1", Revision: 2, Timestamp: 2, EventData: []byte(`{}`)},
+	}
+	if err := source.SaveEvents(ctx, events); err != nil {
+		t.Fatalf("saving events failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	_, err := esport.Export(ctx, &buf, &failingStorage{Storage: source, after: 1}, nil)
+	if err == nil {
+		t.Fatal("expected error on the failed event stream")
+	}
+	if code := cgerrors.Code(err); code != cgerrors.CodeUnavailable {
+		t.Errorf("expected unavailable error code but got: %v", err)
+	}
+	if strings.Contains(buf.String(), string(esport.KindTrailer)) {
+		t.Errorf("expected no trailer written for the failed export")
+	}
+}
+
+func TestExportArchived(t *testing.T) {
+	ctx := context.Background()
+	source := esmem.New()
+	events := []*es.Event{
+		{EventId: "e1", EventType: "created", AggregateType: "order", AggregateId: "o1", Revision: 1, Timestamp: 1, EventData: []byte(`{}`)},
+		{EventId: "e2", EventType: "created", AggregateType: "order", AggregateId: "o2", Revision: 1, Timestamp: 2, EventData: []byte(`{}`)},
+		{EventId: "e3", EventType: "changed", AggregateType: "order", AggregateId: "o1", Revision: 2, Timestamp: 3, EventData: []byte(`{}`)},
+		{EventId: "e4", EventType: "changed", AggregateType: "order", AggregateId: "o1", Revision: 3, Timestamp: 4, EventData: []byte(`{}`)},
+	}
+	if err := source.SaveEvents(ctx, events); err != nil {
+		t.Fatalf("saving events failed: %v", err)
+	}
+
+	// The o1 stream is archived up to the revision 2, and the o2 stream as a whole.
+	var buf bytes.Buffer
+	stats, err := esport.Export(ctx, &buf, &archivedStorage{Storage: source, revision: 2}, nil)
+	if err != nil {
+		t.Fatalf("exporting failed: %v", err)
+	}
+	if stats.Events != 4 || stats.Aggregates != 2 {
+		t.Fatalf("unexpected export stats: %+v", stats)
+	}
+
+	target := esmem.New()
+	if _, err = esport.Import(ctx, &buf, target, nil); err != nil {
+		t.Fatalf("importing failed: %v", err)
+	}
+	for id, count := range map[string]int{"o1": 3, "o2": 1} {
+		imported, err := target.ListEvents(ctx, id, "order")
+		if err != nil {
+			t.Fatalf("listing events failed: %v", err)
+		}
+		if len(imported) != count {
+			t.Errorf("expected %d events of aggregate: %s but got: %d", count, id, len(imported))
+		}
+	}
+}
+
+// failingStorage stops the event stream with an error after given number of events.
+type failingStorage struct {
+	*esmem.Storage
+	after int
+}
+
+func (s *failingStorage) StreamEvents(ctx context.Context, req *es.StreamEventsRequest) (<-chan *es.Event, error) {
+	c, err := s.Storage.StreamEvents(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan *es.Event)
+	go func() {
+		defer close(out)
+		var n int
+		for e := range c {
+			if n == s.after {
+				req.OnError(cgerrors.ErrUnavailable("connection lost"))
+				return
+			}
+			n++
+			select {
+			case out <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// archivedStorage doesn't stream the events up to given revision, as the storages with archived events do.
+type archivedStorage struct {
+	*esmem.Storage
+	revision int64
+}
+
+func (s *archivedStorage) StreamEvents(ctx context.Context, req *es.StreamEventsRequest) (<-chan *es.Event, error) {
+	c, err := s.Storage.StreamEvents(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan *es.Event)
+	go func() {
+		defer close(out)
+		for e := range c {
+			if e.Revision <= s.revision {
+				continue
+			}
+			select {
+			case out <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,221 @@
+package esport
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
+)
+
+// ExportOptions are the options of the export.
+type ExportOptions struct {
+	// AggregateTypes exports only the aggregates of selected types. If empty, all the aggregates are exported.
+	AggregateTypes []string
+	// BuffSize is the buffer size of the storage event stream.
+	BuffSize int
+	// PageSize is the number of aggregate catalog records listed at once.
+	PageSize int
+}
+
+// DefaultExportOptions creates the default export options.
+func DefaultExportOptions() *ExportOptions {
+	return &ExportOptions{BuffSize: 100, PageSize: 100}
+}
+
+// Validate checks if the export options are valid.
+func (o *ExportOptions) Validate() error {
+	if o.BuffSize < 0 {
+		return cgerrors.ErrInvalidArgument("export buffer size cannot be negative")
+	}
+	if o.PageSize <= 0 {
+		return cgerrors.ErrInvalidArgument("export page size needs to be greater than 0")
+	}
+	return nil
+}
+
+// Export writes all the events, aggregate catalog records and snapshots of given storage to the writer.
+// The events are written in the order of their global position, followed by the aggregate records of the exported
+// aggregate types and the snapshots of these aggregates. The events not returned by the storage stream - i.e. archived,
+// are listed with the aggregate events: the stream prefix is written before the first streamed event of its aggregate,
+// and the streams archived as a whole are written before their aggregate records. The aggregate types with all their
+// streams archived are found only if selected in the options.
+// The export fails if the storage stream stops on error, thus the trailer is written only for the complete stream.
+// The export should be run on a storage with no concurrent writes, or within a transaction, so that the stream is consistent.
+func Export(ctx context.Context, w io.Writer, s es.StorageBase, opts *ExportOptions) (*Stats, error) {
+	if opts == nil {
+		opts = DefaultExportOptions()
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	bw := bufio.NewWriter(w)
+	x := &exporter{w: bw, s: s, digest: newDigest(), stats: &Stats{}, revisions: map[aggregateKey]int64{}}
+	err := x.write(KindHeader, &Header{
+		Format:         Format,
+		Version:        Version,
+		ExportedAt:     time.Now().UnixNano(),
+		AggregateTypes: opts.AggregateTypes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// The error is set before the stream channel is closed.
+	var streamErr error
+	c, err := s.StreamEvents(streamCtx, &es.StreamEventsRequest{
+		AggregateTypes: opts.AggregateTypes,
+		BuffSize:       opts.BuffSize,
+		OnError:        func(err error) { streamErr = err },
+	})
+	if err != nil {
+		return nil, err
+	}
+	aggTypes := append([]string{}, opts.AggregateTypes...)
+	seen := map[string]struct{}{}
+	for _, aggType := range aggTypes {
+		seen[aggType] = struct{}{}
+	}
+	for event := range c {
+		if _, ok := seen[event.AggregateType]; !ok {
+			seen[event.AggregateType] = struct{}{}
+			aggTypes = append(aggTypes, event.AggregateType)
+		}
+		if err = x.writeEvent(ctx, event); err != nil {
+			return nil, err
+		}
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	if streamErr != nil {
+		return nil, streamErr
+	}
+
+	for _, aggType := range aggTypes {
+		if err = x.exportAggregates(ctx, aggType, opts.PageSize); err != nil {
+			return nil, err
+		}
+	}
+
+	trailer := &Trailer{
+		Events:     x.stats.Events,
+		Snapshots:  x.stats.Snapshots,
+		Aggregates: x.stats.Aggregates,
+		Checksum:   x.digest.sum(),
+	}
+	if err = x.write(KindTrailer, trailer); err != nil {
+		return nil, err
+	}
+	if err = bw.Flush(); err != nil {
+		return nil, err
+	}
+	return x.stats, nil
+}
+
+type aggregateKey struct {
+	id, aggType string
+}
+
+type exporter struct {
+	w      *bufio.Writer
+	s      es.StorageBase
+	digest *digest
+	stats  *Stats
+	// revisions are the latest exported event revisions of the aggregates.
+	revisions map[aggregateKey]int64
+}
+
+// writeEvent writes the streamed event, preceded by the events of its aggregate which were not streamed.
+func (x *exporter) writeEvent(ctx context.Context, event *es.Event) error {
+	key := aggregateKey{id: event.AggregateId, aggType: event.AggregateType}
+	if last := x.revisions[key]; event.Revision > last+1 {
+		prefix, err := x.s.ListEventsUntilRevision(ctx, event.AggregateId, event.AggregateType, last, event.Revision-1)
+		if err != nil {
+			return err
+		}
+		for _, pe := range prefix {
+			if err = x.write(KindEvent, pe); err != nil {
+				return err
+			}
+			x.stats.Events++
+		}
+	}
+	if err := x.write(KindEvent, event); err != nil {
+		return err
+	}
+	x.stats.Events++
+	x.revisions[key] = event.Revision
+	return nil
+}
+
+// exportAggregates writes the catalog records and the snapshots of the aggregates of given type.
+// The events of the aggregates which were not streamed are written before their catalog records.
+func (x *exporter) exportAggregates(ctx context.Context, aggType string, pageSize int) error {
+	var after int64
+	for {
+		aggregates, err := x.s.ListAggregates(ctx, aggType, after, pageSize)
+		if err != nil {
+			return err
+		}
+		for _, agg := range aggregates {
+			if _, ok := x.revisions[aggregateKey{id: agg.ID, aggType: agg.Type}]; !ok {
+				events, err := x.s.ListEvents(ctx, agg.ID, agg.Type)
+				if err != nil {
+					return err
+				}
+				for _, event := range events {
+					if err = x.write(KindEvent, event); err != nil {
+						return err
+					}
+					x.stats.Events++
+				}
+			}
+			if err = x.write(KindAggregate, &Aggregate{ID: agg.ID, Type: agg.Type, InsertedAt: agg.InsertedAt}); err != nil {
+				return err
+			}
+			x.stats.Aggregates++
+
+			snapshots, err := x.s.ListSnapshots(ctx, agg.ID, agg.Type)
+			if err != nil {
+				return err
+			}
+			for _, snap := range snapshots {
+				if err = x.write(KindSnapshot, snap); err != nil {
+					return err
+				}
+				x.stats.Snapshots++
+			}
+		}
+		if len(aggregates) < pageSize {
+			return nil
+		}
+		after = aggregates[len(aggregates)-1].Position
+	}
+}
+
+// write writes the record with given kind and value, and adds its checksum to the stream digest.
+func (x *exporter) write(kind RecordKind, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return cgerrors.ErrInternalf("marshaling %s record failed: %v", kind, err)
+	}
+	sum := checksum(kind, data)
+	line, err := json.Marshal(&record{Kind: kind, Data: data, SHA256: hex.EncodeToString(sum)})
+	if err != nil {
+		return cgerrors.ErrInternalf("marshaling %s record failed: %v", kind, err)
+	}
+	if kind != KindTrailer {
+		x.digest.add(sum)
+	}
+	if _, err = x.w.Write(line); err != nil {
+		return err
+	}
+	return x.w.WriteByte('\n')
+}
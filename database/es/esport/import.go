@@ -0,0 +1,207 @@
+package esport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
+)
+
+// ImportOptions are the options of the import.
+type ImportOptions struct {
+	// AggregateTypes imports only the aggregates of selected types. If empty, all the aggregates are imported.
+	AggregateTypes []string
+	// BatchSize is the maximum number of events saved at once.
+	BatchSize int
+}
+
+// DefaultImportOptions creates the default import options.
+func DefaultImportOptions() *ImportOptions {
+	return &ImportOptions{BatchSize: 100}
+}
+
+// Validate checks if the import options are valid.
+func (o *ImportOptions) Validate() error {
+	if o.BatchSize <= 0 {
+		return cgerrors.ErrInvalidArgument("import batch size needs to be greater than 0")
+	}
+	return nil
+}
+
+// Import reads the stream written by the Export and stores its events and snapshots in given storage.
+// The checksum of each record is verified when it is read, and the checksum of the whole stream is verified
+// with the trailer, thus the tampered or truncated stream results in the error with the cgerrors.CodeDataLoss code.
+// The aggregate catalog records are maintained by the storage itself, thus the imported ones are only checked for
+// existence after the events are saved. The records are stored while the stream is read, therefore the import should be
+// run within a transaction, which is rolled back on failure.
+func Import(ctx context.Context, r io.Reader, s es.StorageBase, opts *ImportOptions) (*Stats, error) {
+	if opts == nil {
+		opts = DefaultImportOptions()
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	m := &importer{s: s, opts: opts, digest: newDigest(), stats: &Stats{}}
+	br := bufio.NewReader(r)
+	var (
+		line    int
+		trailer *Trailer
+	)
+	for {
+		data, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(data)) > 0 {
+			line++
+			if trailer != nil {
+				return nil, dataLoss("unexpected record after the trailer at line: %d", line)
+			}
+			if trailer, err = m.read(ctx, line, data); err != nil {
+				return nil, err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if trailer == nil {
+		return nil, dataLoss("stream trailer not found - the stream is truncated")
+	}
+	if err := m.flush(ctx); err != nil {
+		return nil, err
+	}
+	for _, agg := range m.aggregates {
+		exists, err := s.AggregateExists(ctx, agg.ID, agg.Type)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, dataLoss("aggregate: %s with id: %s has no imported events", agg.Type, agg.ID)
+		}
+	}
+	return m.stats, nil
+}
+
+type importer struct {
+	s          es.StorageBase
+	opts       *ImportOptions
+	digest     *digest
+	stats      *Stats
+	counts     Stats
+	batch      []*es.Event
+	aggregates []*Aggregate
+}
+
+// read verifies and handles a single record line. It returns the trailer if the line is the verified stream trailer.
+func (m *importer) read(ctx context.Context, line int, data []byte) (*Trailer, error) {
+	var rec record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, dataLoss("malformed record at line: %d: %v", line, err)
+	}
+	sum := checksum(rec.Kind, rec.Data)
+	if hex.EncodeToString(sum) != rec.SHA256 {
+		return nil, dataLoss("record checksum mismatch at line: %d", line)
+	}
+	if (line == 1) != (rec.Kind == KindHeader) {
+		return nil, dataLoss("stream header expected only at the first line, found: %s at line: %d", rec.Kind, line)
+	}
+
+	switch rec.Kind {
+	case KindHeader:
+		var h Header
+		if err := json.Unmarshal(rec.Data, &h); err != nil {
+			return nil, dataLoss("malformed header record: %v", err)
+		}
+		if h.Format != Format || h.Version != Version {
+			return nil, cgerrors.ErrInvalidArgumentf("unsupported stream format: %s version: %d", h.Format, h.Version)
+		}
+	case KindEvent:
+		var e es.Event
+		if err := json.Unmarshal(rec.Data, &e); err != nil {
+			return nil, dataLoss("malformed event record at line: %d: %v", line, err)
+		}
+		if err := validateEvent(&e); err != nil {
+			return nil, err
+		}
+		m.counts.Events++
+		if !filter(m.opts.AggregateTypes, e.AggregateType) {
+			break
+		}
+		m.batch = append(m.batch, &e)
+		if len(m.batch) >= m.opts.BatchSize {
+			if err := m.flush(ctx); err != nil {
+				return nil, err
+			}
+		}
+	case KindAggregate:
+		var agg Aggregate
+		if err := json.Unmarshal(rec.Data, &agg); err != nil {
+			return nil, dataLoss("malformed aggregate record at line: %d: %v", line, err)
+		}
+		m.counts.Aggregates++
+		if filter(m.opts.AggregateTypes, agg.Type) {
+			m.aggregates = append(m.aggregates, &agg)
+			m.stats.Aggregates++
+		}
+	case KindSnapshot:
+		var snap es.Snapshot
+		if err := json.Unmarshal(rec.Data, &snap); err != nil {
+			return nil, dataLoss("malformed snapshot record at line: %d: %v", line, err)
+		}
+		m.counts.Snapshots++
+		if !filter(m.opts.AggregateTypes, snap.AggregateType) {
+			break
+		}
+		// The snapshot follows all the events, but these might still be batched.
+		if err := m.flush(ctx); err != nil {
+			return nil, err
+		}
+		if err := m.s.SaveSnapshot(ctx, &snap); err != nil {
+			return nil, err
+		}
+		m.stats.Snapshots++
+	case KindTrailer:
+		var t Trailer
+		if err := json.Unmarshal(rec.Data, &t); err != nil {
+			return nil, dataLoss("malformed trailer record: %v", err)
+		}
+		if t.Checksum != m.digest.sum() {
+			return nil, dataLoss("stream checksum mismatch")
+		}
+		if t.Events != m.counts.Events || t.Snapshots != m.counts.Snapshots || t.Aggregates != m.counts.Aggregates {
+			return nil, dataLoss("stream record counts doesn't match the trailer")
+		}
+		return &t, nil
+	default:
+		return nil, dataLoss("unknown record kind: %s at line: %d", rec.Kind, line)
+	}
+	m.digest.add(sum)
+	return nil, nil
+}
+
+// flush saves the batched events.
+func (m *importer) flush(ctx context.Context) error {
+	if len(m.batch) == 0 {
+		return nil
+	}
+	if err := m.s.SaveEvents(ctx, m.batch); err != nil {
+		return err
+	}
+	m.stats.Events += int64(len(m.batch))
+	m.batch = nil
+	return nil
+}
+
+func dataLoss(format string, args ...interface{}) error {
+	return cgerrors.New("", fmt.Sprintf(format, args...), cgerrors.CodeDataLoss)
+}
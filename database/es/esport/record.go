@@ -0,0 +1,116 @@
+package esport
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
+)
+
+const (
+	// Format is the name of the stream format written in the header record.
+	Format = "cleango.es.ndjson"
+	// Version is the version of the stream format.
+	Version = 1
+)
+
+// RecordKind is the kind of the stream record.
+type RecordKind string
+
+// Enumerated record kinds.
+const (
+	KindHeader    RecordKind = "header"
+	KindEvent     RecordKind = "event"
+	KindSnapshot  RecordKind = "snapshot"
+	KindAggregate RecordKind = "aggregate"
+	KindTrailer   RecordKind = "trailer"
+)
+
+// Header is the first record of the stream.
+type Header struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	// ExportedAt is the timestamp (unix nano) of the export start.
+	ExportedAt int64 `json:"exported_at"`
+	// AggregateTypes are the aggregate types the export was filtered by. Empty if all the aggregates were exported.
+	AggregateTypes []string `json:"aggregate_types,omitempty"`
+}
+
+// Aggregate is the exported aggregate catalog record.
+type Aggregate struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	InsertedAt int64  `json:"inserted_at,omitempty"`
+}
+
+// Trailer is the last record of the stream.
+type Trailer struct {
+	Events     int64 `json:"events"`
+	Snapshots  int64 `json:"snapshots"`
+	Aggregates int64 `json:"aggregates"`
+	// Checksum is the hex encoded SHA-256 hash of the checksums of all the preceding records.
+	Checksum string `json:"checksum"`
+}
+
+// record is a single line of the stream.
+type record struct {
+	Kind   RecordKind      `json:"kind"`
+	Data   json.RawMessage `json:"data"`
+	SHA256 string          `json:"sha256"`
+}
+
+// Stats are the numbers of exported or imported records.
+type Stats struct {
+	Events     int64
+	Snapshots  int64
+	Aggregates int64
+}
+
+// checksum computes the checksum of the record with given kind and data.
+func checksum(kind RecordKind, data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(kind))
+	h.Write([]byte{'\n'})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// digest is the running checksum of the stream records.
+type digest struct {
+	h hash.Hash
+}
+
+func newDigest() *digest {
+	return &digest{h: sha256.New()}
+}
+
+func (d *digest) add(sum []byte) {
+	d.h.Write(sum)
+}
+
+func (d *digest) sum() string {
+	return hex.EncodeToString(d.h.Sum(nil))
+}
+
+// filter checks if given aggregate type passes the aggregate types filter.
+func filter(aggTypes []string, aggType string) bool {
+	if len(aggTypes) == 0 {
+		return true
+	}
+	for _, t := range aggTypes {
+		if t == aggType {
+			return true
+		}
+	}
+	return false
+}
+
+func validateEvent(e *es.Event) error {
+	if e.AggregateId == "" || e.AggregateType == "" || e.EventId == "" || e.Revision <= 0 {
+		return cgerrors.ErrInvalidArgumentf("invalid event record: %s", e.EventId)
+	}
+	return nil
+}
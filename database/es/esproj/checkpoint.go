@@ -0,0 +1,70 @@
+package esproj
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kucjac/cleango/cgerrors"
+)
+
+// Checkpoint is the progress of the projection over the event stream.
+type Checkpoint struct {
+	// Projection is the name of the projection.
+	Projection string
+	// Position is the global position of the last event processed by the projection.
+	Position int64
+	// UpdatedAt is the time of the last checkpoint update.
+	UpdatedAt time.Time
+}
+
+// CheckpointStore is the storage of the projection checkpoints.
+type CheckpointStore interface {
+	// GetCheckpoint gets the checkpoint of given projection. If it is not found a cgerrors.ErrNotFound is returned.
+	GetCheckpoint(ctx context.Context, projection string) (*Checkpoint, error)
+	// SaveCheckpoint inserts or updates the checkpoint of the projection.
+	SaveCheckpoint(ctx context.Context, checkpoint *Checkpoint) error
+	// ResetCheckpoint removes the checkpoint of given projection.
+	ResetCheckpoint(ctx context.Context, projection string) error
+}
+
+// Compile time check if MemoryCheckpointStore implements CheckpointStore.
+var _ CheckpointStore = (*MemoryCheckpointStore)(nil)
+
+// MemoryCheckpointStore is the in-memory implementation of the CheckpointStore.
+type MemoryCheckpointStore struct {
+	l           sync.RWMutex
+	checkpoints map[string]Checkpoint
+}
+
+// NewMemoryCheckpointStore creates a new empty in-memory checkpoint store.
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{checkpoints: map[string]Checkpoint{}}
+}
+
+// GetCheckpoint implements CheckpointStore interface.
+func (m *MemoryCheckpointStore) GetCheckpoint(_ context.Context, projection string) (*Checkpoint, error) {
+	m.l.RLock()
+	defer m.l.RUnlock()
+	cp, ok := m.checkpoints[projection]
+	if !ok {
+		return nil, cgerrors.ErrNotFoundf("checkpoint of projection: %s not found", projection)
+	}
+	return &cp, nil
+}
+
+// SaveCheckpoint implements CheckpointStore interface.
+func (m *MemoryCheckpointStore) SaveCheckpoint(_ context.Context, checkpoint *Checkpoint) error {
+	m.l.Lock()
+	defer m.l.Unlock()
+	m.checkpoints[checkpoint.Projection] = *checkpoint
+	return nil
+}
+
+// ResetCheckpoint implements CheckpointStore interface.
+func (m *MemoryCheckpointStore) ResetCheckpoint(_ context.Context, projection string) error {
+	m.l.Lock()
+	defer m.l.Unlock()
+	delete(m.checkpoints, projection)
+	return nil
+}
@@ -0,0 +1,4 @@
+// Package esproj provides the projections that build read models from the event store stream.
+// The Runner feeds the projections with the streamed events and keeps track of their progress in the CheckpointStore,
+// so that the projections resume where they stopped after a restart.
+package esproj
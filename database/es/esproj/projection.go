@@ -0,0 +1,21 @@
+package esproj
+
+import (
+	"context"
+
+	"github.com/kucjac/cleango/database/es"
+)
+
+// Projection is a read model built from the stream of the events.
+type Projection interface {
+	// Name is the unique name of the projection. It is used as the key of its checkpoint.
+	Name() string
+	// Filter defines the events streamed to the projection.
+	// The FromPosition and Follow fields are set by the Runner.
+	Filter() es.StreamEventsRequest
+	// Project applies the batch of the events on the read model.
+	// If it returns an error the batch is retried and the checkpoint is not moved.
+	Project(ctx context.Context, events []*es.Event) error
+	// Reset clears the read model, so that it could be rebuilt from the beginning of the stream.
+	Reset(ctx context.Context) error
+}
@@ -0,0 +1,276 @@
+package esproj
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/pkg/xlog"
+	"github.com/kucjac/cleango/xservice"
+)
+
+// RunnerConfig is the configuration of the projection Runner.
+type RunnerConfig struct {
+	// BatchSize is the maximum number of the events passed to the Projection.Project at once.
+	BatchSize int
+	// RetryInterval is the time the runner waits before it reopens the stream of a failed projection.
+	RetryInterval time.Duration
+}
+
+// DefaultRunnerConfig creates the default projection runner config.
+func DefaultRunnerConfig() *RunnerConfig {
+	return &RunnerConfig{
+		BatchSize:     100,
+		RetryInterval: time.Second,
+	}
+}
+
+// Validate checks if the config is valid to use.
+func (c *RunnerConfig) Validate() error {
+	if c.BatchSize <= 0 {
+		return cgerrors.ErrInternal("projection runner batch size needs to be greater than 0")
+	}
+	if c.RetryInterval <= 0 {
+		return cgerrors.ErrInternal("projection runner retry interval needs to be greater than 0")
+	}
+	return nil
+}
+
+// errRebuilt is returned when the projection was rebuilt while its stream was being processed.
+var errRebuilt = errors.New("projection rebuilt")
+
+// Compile time check if the Runner implements xservice.RunnerCloser interface.
+var _ xservice.RunnerCloser = (*Runner)(nil)
+
+// Runner feeds the projections with the events streamed from the event store in follow mode.
+// Each projection is processed independently and resumes after the position stored in its last checkpoint.
+// The events are delivered at least once - a batch might be projected again if storing its checkpoint fails,
+// thus the projections should be idempotent.
+// Implements xservice.RunnerCloser interface.
+type Runner struct {
+	store       es.EventStore
+	checkpoints CheckpointStore
+	cfg         RunnerConfig
+	projections []*projectionRunner
+	byName      map[string]*projectionRunner
+
+	l       sync.Mutex
+	running bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+type projectionRunner struct {
+	p Projection
+	// l is held while the batch is projected or the projection is rebuilt.
+	l sync.Mutex
+	// generation is increased on each rebuild of the projection.
+	generation int64
+	// stop cancels the stream currently followed by the projection.
+	stop context.CancelFunc
+}
+
+// NewRunner creates a new projection runner for given projections.
+func NewRunner(store es.EventStore, checkpoints CheckpointStore, cfg *RunnerConfig, projections ...Projection) (*Runner, error) {
+	if cfg == nil {
+		cfg = DefaultRunnerConfig()
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	r := &Runner{
+		store:       store,
+		checkpoints: checkpoints,
+		cfg:         *cfg,
+		byName:      make(map[string]*projectionRunner, len(projections)),
+	}
+	for _, p := range projections {
+		if _, ok := r.byName[p.Name()]; ok {
+			return nil, cgerrors.ErrAlreadyExistsf("projection: %s already registered", p.Name())
+		}
+		pr := &projectionRunner{p: p}
+		r.projections = append(r.projections, pr)
+		r.byName[p.Name()] = pr
+	}
+	return r, nil
+}
+
+// Run starts processing the projections and blocks until the runner is closed.
+// Implements xservice.Runner interface.
+func (r *Runner) Run() error {
+	r.l.Lock()
+	if r.running {
+		r.l.Unlock()
+		return cgerrors.ErrInternal("projection runner is already running")
+	}
+	var ctx context.Context
+	ctx, r.cancel = context.WithCancel(context.Background())
+	r.running = true
+	for _, pr := range r.projections {
+		r.wg.Add(1)
+		go r.runProjection(ctx, pr)
+	}
+	r.l.Unlock()
+
+	r.wg.Wait()
+	return nil
+}
+
+// Close stops processing the projections and waits until the batches being projected are finished.
+// Implements xservice.Closer interface.
+func (r *Runner) Close(ctx context.Context) error {
+	r.l.Lock()
+	if !r.running {
+		r.l.Unlock()
+		return nil
+	}
+	r.cancel()
+	r.running = false
+	r.l.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Rebuild resets the read model and the checkpoint of the projection with given name,
+// so that it is rebuilt from the beginning of the stream.
+// If the runner is running, the projection is restarted once the batch being projected is finished.
+func (r *Runner) Rebuild(ctx context.Context, name string) error {
+	pr, ok := r.byName[name]
+	if !ok {
+		return cgerrors.ErrNotFoundf("projection: %s not found", name)
+	}
+	pr.l.Lock()
+	defer pr.l.Unlock()
+
+	if err := pr.p.Reset(ctx); err != nil {
+		return cgerrors.Wrapf(err, cgerrors.Code(err), "resetting projection: %s failed", name)
+	}
+	if err := r.checkpoints.ResetCheckpoint(ctx, name); err != nil {
+		return cgerrors.Wrapf(err, cgerrors.Code(err), "resetting projection: %s checkpoint failed", name)
+	}
+	pr.generation++
+	if pr.stop != nil {
+		pr.stop()
+	}
+	return nil
+}
+
+func (r *Runner) runProjection(ctx context.Context, pr *projectionRunner) {
+	defer r.wg.Done()
+	for {
+		err := r.processStream(ctx, pr)
+		if errors.Is(err, errRebuilt) {
+			continue
+		}
+		if err != nil && ctx.Err() == nil {
+			xlog.WithContext(ctx).Errorf("processing projection: %s failed: %v", pr.p.Name(), err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.cfg.RetryInterval):
+		}
+	}
+}
+
+// processStream follows the events stored after the projection checkpoint and projects them in batches.
+func (r *Runner) processStream(ctx context.Context, pr *projectionRunner) error {
+	ctx, cancel := context.WithCancel(ctx)
+	pr.l.Lock()
+	generation := pr.generation
+	pr.stop = cancel
+	position, err := r.position(ctx, pr.p.Name())
+	pr.l.Unlock()
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	req := pr.p.Filter()
+	if req.BuffSize == 0 {
+		req.BuffSize = r.cfg.BatchSize
+	}
+	req.FromPosition = position
+	req.Follow = true
+	stream, err := r.store.StreamEvents(ctx, &req)
+	if err != nil {
+		cancel()
+		return err
+	}
+	defer func() {
+		// Cancel the stream and drain its channel, so that its reader could finish.
+		cancel()
+		for range stream {
+		}
+	}()
+
+	batch := make([]*es.Event, 0, r.cfg.BatchSize)
+	for e := range stream {
+		batch = append(batch, e)
+		// Flush the batch once it is full, or there are no more events waiting in the stream.
+		if len(batch) < r.cfg.BatchSize && len(stream) > 0 {
+			continue
+		}
+		if position, err = r.project(ctx, pr, generation, position, batch); err != nil {
+			return err
+		}
+		batch = batch[:0]
+	}
+	if ctx.Err() != nil {
+		pr.l.Lock()
+		rebuilt := pr.generation != generation
+		pr.l.Unlock()
+		if rebuilt {
+			return errRebuilt
+		}
+		return ctx.Err()
+	}
+	_, err = r.project(ctx, pr, generation, position, batch)
+	return err
+}
+
+// project applies the batch on the projection and stores its checkpoint moved after the batch.
+func (r *Runner) project(ctx context.Context, pr *projectionRunner, generation, position int64, batch []*es.Event) (int64, error) {
+	if len(batch) == 0 {
+		return position, nil
+	}
+	pr.l.Lock()
+	defer pr.l.Unlock()
+	if pr.generation != generation {
+		return position, errRebuilt
+	}
+
+	if err := pr.p.Project(ctx, batch); err != nil {
+		return position, err
+	}
+	position = batch[len(batch)-1].Position
+	cp := &Checkpoint{Projection: pr.p.Name(), Position: position, UpdatedAt: time.Now().UTC()}
+	if err := r.checkpoints.SaveCheckpoint(ctx, cp); err != nil {
+		return position, cgerrors.Wrap(err, cgerrors.Code(err), "saving checkpoint failed")
+	}
+	return position, nil
+}
+
+func (r *Runner) position(ctx context.Context, name string) (int64, error) {
+	cp, err := r.checkpoints.GetCheckpoint(ctx, name)
+	if err != nil {
+		if cgerrors.IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, cgerrors.Wrap(err, cgerrors.Code(err), "getting checkpoint failed")
+	}
+	return cp.Position, nil
+}
@@ -0,0 +1,168 @@
+package esproj_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kucjac/cleango/codec"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esmem"
+	"github.com/kucjac/cleango/database/es/esproj"
+)
+
+const (
+	aggType   = "TEST_AGG_TYPE"
+	eventType = "TEST_EVENT_TYPE"
+)
+
+// countingProjection counts the projected events by their aggregate id.
+type countingProjection struct {
+	l       sync.Mutex
+	counts  map[string]int
+	batches int
+}
+
+func (c *countingProjection) Name() string { return "counting" }
+
+func (c *countingProjection) Filter() es.StreamEventsRequest {
+	return es.StreamEventsRequest{AggregateTypes: []string{aggType}}
+}
+
+func (c *countingProjection) Project(_ context.Context, events []*es.Event) error {
+	c.l.Lock()
+	defer c.l.Unlock()
+	for _, e := range events {
+		c.counts[e.AggregateId]++
+	}
+	c.batches++
+	return nil
+}
+
+func (c *countingProjection) Reset(context.Context) error {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.counts = map[string]int{}
+	return nil
+}
+
+func (c *countingProjection) total() int {
+	c.l.Lock()
+	defer c.l.Unlock()
+	var total int
+	for _, n := range c.counts {
+		total += n
+	}
+	return total
+}
+
+func saveTestEvents(t *testing.T, s *esmem.Storage, aggId string, from, count int) {
+	t.Helper()
+	events := make([]*es.Event, count)
+	for i := range events {
+		revision := int64(from + i)
+		events[i] = &es.Event{
+			EventId:       fmt.Sprintf("%s-%d", aggId, revision),
+			EventType:     eventType,
+			AggregateType: aggType,
+			AggregateId:   aggId,
+			Timestamp:     time.Now().UnixNano(),
+			Revision:      revision,
+		}
+	}
+	if err := s.SaveEvents(context.Background(), events); err != nil {
+		t.Fatalf("saving events failed: %v", err)
+	}
+}
+
+func startRunner(t *testing.T, store *es.Store, checkpoints esproj.CheckpointStore, p esproj.Projection) *esproj.Runner {
+	t.Helper()
+	r, err := esproj.NewRunner(store, checkpoints, &esproj.RunnerConfig{BatchSize: 4, RetryInterval: 10 * time.Millisecond}, p)
+	if err != nil {
+		t.Fatalf("creating runner failed: %v", err)
+	}
+	go func() {
+		if err := r.Run(); err != nil {
+			t.Errorf("running projections failed: %v", err)
+		}
+	}()
+	return r
+}
+
+func waitForTotal(t *testing.T, p *countingProjection, expected int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for p.total() != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d projected events but got: %d", expected, p.total())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRunner(t *testing.T) {
+	ctx := context.Background()
+	s := esmem.New()
+	store, err := es.New(es.DefaultConfig(), codec.JSON(), codec.JSON(), s)
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+	checkpoints := esproj.NewMemoryCheckpointStore()
+	p := &countingProjection{counts: map[string]int{}}
+
+	saveTestEvents(t, s, "agg-1", 1, 10)
+	r := startRunner(t, store, checkpoints, p)
+	waitForTotal(t, p, 10)
+
+	// New events should be projected while the runner is running.
+	saveTestEvents(t, s, "agg-2", 1, 3)
+	waitForTotal(t, p, 13)
+	if err = r.Close(ctx); err != nil {
+		t.Fatalf("closing runner failed: %v", err)
+	}
+
+	cp, err := checkpoints.GetCheckpoint(ctx, p.Name())
+	if err != nil {
+		t.Fatalf("getting checkpoint failed: %v", err)
+	}
+	if cp.Position != 13 {
+		t.Errorf("expected checkpoint position: 13 but is: %d", cp.Position)
+	}
+
+	t.Run("Resume", func(t *testing.T) {
+		saveTestEvents(t, s, "agg-1", 11, 2)
+		r := startRunner(t, store, checkpoints, p)
+		defer r.Close(ctx)
+		waitForTotal(t, p, 15)
+
+		// Give the runner a chance to project the events again, if it didn't resume from the checkpoint.
+		time.Sleep(50 * time.Millisecond)
+		p.l.Lock()
+		defer p.l.Unlock()
+		if p.counts["agg-1"] != 12 || p.counts["agg-2"] != 3 {
+			t.Errorf("unexpected projected counts: %v", p.counts)
+		}
+	})
+
+	t.Run("Rebuild", func(t *testing.T) {
+		r := startRunner(t, store, checkpoints, p)
+		defer r.Close(ctx)
+		waitForTotal(t, p, 15)
+
+		if err := r.Rebuild(ctx, p.Name()); err != nil {
+			t.Fatalf("rebuilding projection failed: %v", err)
+		}
+		waitForTotal(t, p, 15)
+		if err := r.Rebuild(ctx, "unknown"); err == nil {
+			t.Error("expected error on rebuilding unknown projection")
+		}
+	})
+
+	t.Run("Duplicated", func(t *testing.T) {
+		if _, err := esproj.NewRunner(store, checkpoints, nil, p, p); err == nil {
+			t.Error("expected error on duplicated projection")
+		}
+	})
+}
@@ -42,6 +42,19 @@ const AggregateType = "eventsource.event_state"
 // Compile time check if the EventState implements es.Aggregate.
 var _ es.Aggregate = (*EventState)(nil)
 
+// eventStateRegistry dispatches the events applied on the EventState to their typed handlers.
+var eventStateRegistry = es.NewEventRegistry[*EventState](AggregateType)
+
+func init() {
+	es.MustRegister(
+		es.RegisterHandlerWithEvent(eventStateRegistry, (*EventState).applyUnhandled),
+		es.RegisterHandlerWithEvent(eventStateRegistry, (*EventState).applyHandlingStarted),
+		es.RegisterHandlerWithEvent(eventStateRegistry, (*EventState).applyHandlingFinished),
+		es.RegisterHandlerWithEvent(eventStateRegistry, (*EventState).applyHandlingFailed),
+		es.RegisterHandlerWithEvent(eventStateRegistry, (*EventState).applyFailureCountReset),
+	)
+}
+
 type Options struct {
 	// MaxFailures is the maximum number of failures for which the event would not allow to, start until it is reset.
 	MaxFailures int
@@ -115,7 +128,7 @@ type EventState struct {
 }
 
 // Apply implements es.Aggregate interface.
-func (s *EventState) Apply(e *es.Event) (err error) {
+func (s *EventState) Apply(e *es.Event) error {
 	if s.base == nil {
 		return cgerrors.ErrInternal("event handle aggregate base undefined")
 	}
@@ -123,21 +136,7 @@ func (s *EventState) Apply(e *es.Event) (err error) {
 		return cgerrors.ErrInternal("input event has different aggregate type").
 			WithMeta("aggregate_type", e.AggregateType)
 	}
-	switch e.EventType {
-	case EventUnhandledType:
-		err = s.applyUnhandled(e)
-	case EventHandlingStartedType:
-		err = s.applyHandlingStarted(e)
-	case EventHandlingFinishedType:
-		err = s.applyHandlingFinished(e)
-	case EventHandlingFailedType:
-		err = s.applyHandlingFailed(e)
-	case FailureCountResetType:
-		err = s.applyFailureCountReset(e)
-	default:
-		return cgerrors.ErrInternal("undefined event type").WithMeta("event_type", e.EventType)
-	}
-	return err
+	return eventStateRegistry.Apply(s, e)
 }
 
 // SetBase implements es.Aggregate interface.
@@ -203,11 +202,7 @@ func (s *EventState) ResetFailures(handlerName string) error {
 	return nil
 }
 
-func (s *EventState) applyUnhandled(e *es.Event) error {
-	var msg EventUnhandled
-	if err := s.base.DecodeEventAs(e.EventData, &msg); err != nil {
-		return err
-	}
+func (s *EventState) applyUnhandled(msg *EventUnhandled, e *es.Event) error {
 	s.timestamp = msg.Timestamp
 	s.eventType = msg.EventType
 	s.minFailInterval = time.Duration(msg.MinFailInterval)
@@ -216,11 +211,7 @@ func (s *EventState) applyUnhandled(e *es.Event) error {
 	return nil
 }
 
-func (s *EventState) applyHandlingStarted(e *es.Event) error {
-	var msg EventHandlingStarted
-	if err := s.base.DecodeEventAs(e.EventData, &msg); err != nil {
-		return err
-	}
+func (s *EventState) applyHandlingStarted(msg *EventHandlingStarted, e *es.Event) error {
 	h := s.handlers[msg.HandlerName]
 	if h.latestState == StateStarted &&
 		time.Now().UTC().Before(h.lastStarted.Add(s.maxHandlingInterval)) {
@@ -252,11 +243,7 @@ func (s *EventState) applyHandlingStarted(e *es.Event) error {
 	return nil
 }
 
-func (s *EventState) applyHandlingFinished(e *es.Event) error {
-	var msg EventHandlingFinished
-	if err := s.base.DecodeEventAs(e.EventData, &msg); err != nil {
-		return err
-	}
+func (s *EventState) applyHandlingFinished(msg *EventHandlingFinished, e *es.Event) error {
 	h := s.handlers[msg.HandlerName]
 	h.latestState = StateFinished
 	h.finishedAt = e.Time()
@@ -266,11 +253,7 @@ func (s *EventState) applyHandlingFinished(e *es.Event) error {
 	return nil
 }
 
-func (s *EventState) applyHandlingFailed(e *es.Event) error {
-	var msg EventHandlingFailed
-	if err := s.base.DecodeEventAs(e.EventData, &msg); err != nil {
-		return err
-	}
+func (s *EventState) applyHandlingFailed(msg *EventHandlingFailed, e *es.Event) error {
 	h := s.handlers[msg.HandlerName]
 	h.latestState = StateFailed
 	h.totalFailures++
@@ -284,11 +267,7 @@ func (s *EventState) applyHandlingFailed(e *es.Event) error {
 	return nil
 }
 
-func (s *EventState) applyFailureCountReset(e *es.Event) error {
-	var msg FailureCountReset
-	if err := s.base.DecodeEventAs(e.EventData, &msg); err != nil {
-		return err
-	}
+func (s *EventState) applyFailureCountReset(msg *FailureCountReset, e *es.Event) error {
 	h := s.handlers[msg.HandlerName]
 	h.totalFailures = 0
 	h.latestState = StateUnhandled
@@ -3,9 +3,9 @@ package esstate
 import (
 	"context"
 
+	"github.com/kucjac/cleango/cgerrors"
 	"github.com/kucjac/cleango/database/es"
 	eventstate2 "github.com/kucjac/cleango/ddd/events/eventstate"
-	"github.com/kucjac/cleango/pkg/xlog"
 )
 
 // EventStore is an interface that allows to operate on top of the standard es.EventStore, but also
@@ -61,61 +61,67 @@ func (s *Store) Commit(ctx context.Context, aggregate es.Aggregate) error {
 	if aggregate.AggBase().Type() == AggregateType {
 		return s.Store.Commit(ctx, aggregate)
 	}
-	tx, err := s.storage.BeginTx(ctx)
-	if err != nil {
-		return err
-	}
+	return s.CommitAll(ctx, aggregate)
+}
 
+// CommitAll overwrites the default method of the es.Store and atomically commits the events of all given aggregates
+// within a single transaction, along with a new EventState per each committed event.
+// On the revision conflict the whole transaction is rolled back and retried, as in the es.Store CommitAll.
+func (s *Store) CommitAll(ctx context.Context, aggregates ...es.Aggregate) error {
+	return s.Store.WithStorage(txBeginner{Storage: s.storage}).CommitAllTx(ctx, s.commitEventStates, aggregates...)
+}
+
+// commitEventStates creates the event states for the events of the aggregates committed within the transaction.
+func (s *Store) commitEventStates(ctx context.Context, tx es.TxStorage, aggregates []es.Aggregate) error {
+	stateTx, ok := tx.(TxStorage)
+	if !ok {
+		return cgerrors.ErrInternal("event state storage transaction doesn't implement esstate.TxStorage")
+	}
 	txStore := s.Store.WithStorage(tx)
-	if err = txStore.Commit(ctx, aggregate); err != nil {
-		if er := tx.Rollback(ctx); er != nil {
-			xlog.WithContext(ctx).
-				WithField("err", err).
-				Errorf("Rolling back transaction failed")
+	for _, aggregate := range aggregates {
+		// The event states are not tracked for the EventState aggregates.
+		if aggregate.AggBase().Type() == AggregateType {
+			continue
 		}
-		return err
-	}
 
-	// Iterate over all committed events and create a new event state for each.
-	events := aggregate.AggBase().CommittedEvents()
-	for _, e := range events {
-		// Check if there are some custom options for given event type.
-		options := s.getEventOptions(e.EventType)
+		// Iterate over all committed events and create a new event state for each.
+		events := aggregate.AggBase().UncommittedEvents()
+		for _, e := range events {
+			// Check if there are some custom options for given event type.
+			options := s.getEventOptions(e.EventType)
 
-		// define new event state aggregate.
-		state, err := InitializeUnhandledEventState(e.EventId, e.EventType, e.Time(), s.Store.AggregateBaseSetter, options)
-		if err != nil {
-			if er := tx.Rollback(ctx); er != nil {
-				xlog.WithContext(ctx).
-					WithField("err", err).
-					Errorf("Rolling back transaction failed")
+			// define new event state aggregate.
+			state, err := InitializeUnhandledEventState(e.EventId, e.EventType, e.Time(), s.Store.AggregateBaseSetter, options)
+			if err != nil {
+				return err
 			}
-			return err
-		}
 
-		// Commit it immediately.
-		if err = txStore.Commit(ctx, state); err != nil {
-			if er := tx.Rollback(ctx); er != nil {
-				xlog.WithContext(ctx).
-					WithField("err", err).
-					Errorf("Rolling back transaction failed")
+			// Commit it immediately.
+			if err = txStore.Commit(ctx, state); err != nil {
+				return err
 			}
-			return err
 		}
-	}
 
-	// Mark the events unhandled.
-	for _, e := range events {
-		if err = tx.MarkUnhandled(ctx, e.EventId, e.EventType, e.Timestamp); err != nil {
-			return err
+		// Mark the events unhandled.
+		for _, e := range events {
+			if err := stateTx.MarkUnhandled(ctx, e.EventId, e.EventType, e.Timestamp); err != nil {
+				return err
+			}
 		}
 	}
-	if err = tx.Commit(ctx); err != nil {
-		return err
-	}
 	return nil
 }
 
+// txBeginner exposes the Storage as the es.Storage, so that the es.Store could begin its transactions.
+type txBeginner struct {
+	Storage
+}
+
+// BeginTx implements es.Storage interface.
+func (b txBeginner) BeginTx(ctx context.Context) (es.TxStorage, error) {
+	return b.Storage.BeginTx(ctx)
+}
+
 // StartHandling starts handling given event by the handler with a name = handlerName.
 func (s *Store) StartHandling(ctx context.Context, eventID, handlerName string) error {
 	state := NewEventState(eventID, s.AggregateBaseSetter)
@@ -0,0 +1,184 @@
+package esstate_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/codec"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esmem"
+	"github.com/kucjac/cleango/database/es/esstate"
+)
+
+const (
+	counterType        = "counter"
+	counterIncremented = "counter:incremented"
+	counterId          = "7d1f3c5e-2a4b-4c6d-8e9f-0a1b2c3d4e5f"
+)
+
+func TestStoreCommitAll(t *testing.T) {
+	ctx := context.Background()
+	storage, err := esmem.NewStateStorage()
+	if err != nil {
+		t.Fatalf("creating storage failed: %v", err)
+	}
+	store, err := esstate.NewStore(es.DefaultConfig(), codec.JSON(), codec.JSON(), &abortingStorage{StateStorage: storage})
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+
+	increment := func(t *testing.T, c *counter) {
+		if err := c.base.SetEvent(&incremented{}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+	}
+	load := func(t *testing.T) *counter {
+		c := &counter{}
+		store.SetAggregateBase(c, counterId, counterType, 1)
+		if err := store.LoadEvents(ctx, c); err != nil {
+			t.Fatalf("loading counter failed: %v", err)
+		}
+		return c
+	}
+
+	c := &counter{}
+	store.SetAggregateBase(c, counterId, counterType, 1)
+	increment(t, c)
+	if err = store.CommitAll(ctx, c); err != nil {
+		t.Fatalf("committing counter failed: %v", err)
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		if err := store.CommitAll(ctx, load(t)); err != nil {
+			t.Errorf("committing aggregate with no uncommitted events failed: %v", err)
+		}
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		stale, concurrent := load(t), load(t)
+		increment(t, concurrent)
+		if err := store.CommitAll(ctx, concurrent); err != nil {
+			t.Fatalf("committing concurrent counter failed: %v", err)
+		}
+
+		// The conflicting save aborts the transaction, thus the commit needs to be retried within a new one.
+		increment(t, stale)
+		if err := store.CommitAll(ctx, stale); err != nil {
+			t.Fatalf("committing conflicted counter failed: %v", err)
+		}
+		if stale.base.Revision() != 3 || stale.Count != 3 {
+			t.Errorf("expected counter rebased to revision: 3 but is at: %d with count: %d", stale.base.Revision(), stale.Count)
+		}
+
+		committed := stale.base.CommittedEvents()
+		state := esstate.NewEventState(committed[0].EventId, store.AggregateBaseSetter)
+		if err := store.LoadEvents(ctx, state); err != nil {
+			t.Errorf("loading event state of the rebased event failed: %v", err)
+		}
+	})
+}
+
+type counter struct {
+	base  *es.AggregateBase
+	Count int `json:"count"`
+}
+
+func (c *counter) Apply(e *es.Event) error {
+	if e.EventType != counterIncremented {
+		return cgerrors.ErrInternalf("unsupported event type: %v", e.EventType)
+	}
+	c.Count++
+	return nil
+}
+
+func (c *counter) SetBase(base *es.AggregateBase) {
+	c.base = base
+}
+
+func (c *counter) AggBase() *es.AggregateBase {
+	return c.base
+}
+
+func (c *counter) Reset() {
+	*c = counter{}
+}
+
+type incremented struct{}
+
+func (x *incremented) MessageType() string {
+	return counterIncremented
+}
+
+// abortingStorage begins the transactions which are aborted on the failed save, as the SQL transactions are.
+type abortingStorage struct {
+	*esmem.StateStorage
+}
+
+func (s *abortingStorage) BeginTx(ctx context.Context) (esstate.TxStorage, error) {
+	tx, err := s.StateStorage.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &abortingTx{TxStorage: tx}, nil
+}
+
+type abortingTx struct {
+	esstate.TxStorage
+	l       sync.Mutex
+	aborted bool
+}
+
+func (tx *abortingTx) SaveEvents(ctx context.Context, events []*es.Event) error {
+	tx.l.Lock()
+	defer tx.l.Unlock()
+	if tx.aborted {
+		return cgerrors.ErrInternal("current transaction is aborted")
+	}
+	err := tx.TxStorage.SaveEvents(ctx, events)
+	if err != nil {
+		tx.aborted = true
+	}
+	return err
+}
+
+func TestCachingStore(t *testing.T) {
+	ctx := context.Background()
+	storage, err := esmem.NewStateStorage()
+	if err != nil {
+		t.Fatalf("creating storage failed: %v", err)
+	}
+	store, err := esstate.NewStore(es.DefaultConfig(), codec.JSON(), codec.JSON(), storage)
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+	cached, err := es.NewCachingStore(store, nil)
+	if err != nil {
+		t.Fatalf("creating caching store failed: %v", err)
+	}
+
+	c := &counter{}
+	store.SetAggregateBase(c, counterId, counterType, 1)
+	if err = c.base.SetEvent(&incremented{}); err != nil {
+		t.Fatalf("setting event failed: %v", err)
+	}
+	if err = cached.Commit(ctx, c); err != nil {
+		t.Fatalf("committing counter failed: %v", err)
+	}
+
+	// The commit goes through the esstate.Store, thus the event state is created along with the events.
+	state := esstate.NewEventState(c.base.CommittedEvents()[0].EventId, store.AggregateBaseSetter)
+	if err = store.LoadEvents(ctx, state); err != nil {
+		t.Errorf("loading event state failed: %v", err)
+	}
+
+	loaded := &counter{}
+	store.SetAggregateBase(loaded, counterId, counterType, 1)
+	if err = cached.LoadEvents(ctx, loaded); err != nil {
+		t.Fatalf("loading counter failed: %v", err)
+	}
+	if s := cached.Stats(); s.Hits != 1 || loaded.Count != 1 {
+		t.Errorf("expected the counter loaded from the cache, but got count: %d, stats: %+v", loaded.Count, s)
+	}
+}
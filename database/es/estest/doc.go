@@ -0,0 +1,23 @@
+// Package estest provides the Given/When/Then test kit for the event-sourced aggregates.
+// The Fixture creates the aggregate with the prior events declared as typed messages, the command is run on it,
+// and the uncommitted events it emits are decoded back into the messages and compared with the expected ones:
+//
+//	fixture := estest.NewFixture("order", 1, func() *Order { return &Order{} })
+//
+//	func TestOrderCancel(t *testing.T) {
+//		fixture.Given(t, &OrderCreated{ID: "1"}).
+//			When(func(o *Order) error { return o.Cancel("reason") }).
+//			Then(&OrderCanceled{Reason: "reason"})
+//	}
+//
+// The mismatches are reported with the readable diffs of the messages.
+// The scenario created with the GivenCtx passes its context to the command run by the WhenCtx, so that the event
+// metadata taken from the context, i.e. the correlation id, could be checked on the emitted events.
+//
+// The package also provides the conformance test suites of the storage implementations - TestStorage for es.Storage
+// and TestStateStorage for esstate.Storage:
+//
+//	func TestConformance(t *testing.T) {
+//		estest.TestStorage(t, func(t *testing.T) es.Storage { return esmem.New() })
+//	}
+package estest
@@ -0,0 +1,176 @@
+package estest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/codec"
+	"github.com/kucjac/cleango/database/es"
+)
+
+// DefaultAggregateID is the identifier of the aggregates created by the Fixture, unless it is changed.
+const DefaultAggregateID = "00000000-0000-4000-8000-000000000001"
+
+// Fixture creates the aggregates of given type for the test scenarios.
+type Fixture[A es.Aggregate] struct {
+	// AggregateID is the identifier set to the created aggregates.
+	AggregateID string
+	aggType     string
+	version     int64
+	newAgg      func() A
+	setter      *es.AggregateBaseSetter
+}
+
+// NewFixture creates a new fixture of the aggregate with given type and version, created by the newAgg function.
+// The aggregate events and snapshots are encoded with the JSON codec, and their identifiers are UUIDs.
+func NewFixture[A es.Aggregate](aggType string, version int64, newAgg func() A) *Fixture[A] {
+	return &Fixture[A]{
+		AggregateID: DefaultAggregateID,
+		aggType:     aggType,
+		version:     version,
+		newAgg:      newAgg,
+		setter:      es.NewAggregateBaseSetter(codec.JSON(), codec.JSON(), es.UUIDGenerator{}),
+	}
+}
+
+// WithSetter sets the aggregate base setter used by the fixture, i.e. with the codecs used by the aggregate in production.
+func (f *Fixture[A]) WithSetter(setter *es.AggregateBaseSetter) *Fixture[A] {
+	f.setter = setter
+	return f
+}
+
+// Given creates the aggregate with the prior events of given messages. The messages are applied to the aggregate
+// and marked as committed, thus only the events emitted by the command are checked by the scenario.
+func (f *Fixture[A]) Given(t testing.TB, msgs ...es.EventMessage) *Scenario[A] {
+	t.Helper()
+	return f.GivenCtx(context.Background(), t, msgs...)
+}
+
+// GivenCtx creates the aggregate with the prior events of given messages, just as the Given does.
+// The context is used to set the given events, and is passed to the command run by the WhenCtx, so that
+// the correlation id, causation id, actor and metadata it carries are set on the emitted events.
+func (f *Fixture[A]) GivenCtx(ctx context.Context, t testing.TB, msgs ...es.EventMessage) *Scenario[A] {
+	t.Helper()
+	agg := f.newAgg()
+	f.setter.SetAggregateBase(agg, f.AggregateID, f.aggType, f.version)
+	for i, msg := range msgs {
+		if err := agg.AggBase().SetEventCtx(ctx, msg); err != nil {
+			t.Fatalf("applying given event: %d of type: %s failed: %v", i, msg.MessageType(), err)
+		}
+	}
+	agg.AggBase().MarkEventsCommitted()
+	return &Scenario[A]{t: t, ctx: ctx, agg: agg}
+}
+
+// Scenario is the test scenario of the aggregate created by the Fixture.
+type Scenario[A es.Aggregate] struct {
+	t    testing.TB
+	ctx  context.Context
+	agg  A
+	err  error
+	done bool
+}
+
+// Aggregate gets the aggregate of the scenario, i.e. to check its state after the command.
+func (s *Scenario[A]) Aggregate() A {
+	return s.agg
+}
+
+// When runs the command on the aggregate. Its result is checked by the Then or ThenError methods.
+func (s *Scenario[A]) When(cmd func(agg A) error) *Scenario[A] {
+	s.t.Helper()
+	if s.done {
+		s.t.Fatalf("scenario command was already run")
+	}
+	s.err = cmd(s.agg)
+	s.done = true
+	return s
+}
+
+// WhenCtx runs the command on the aggregate with the context of the scenario, set by the Fixture.GivenCtx.
+// Its result is checked by the Then or ThenError methods.
+func (s *Scenario[A]) WhenCtx(cmd func(ctx context.Context, agg A) error) *Scenario[A] {
+	s.t.Helper()
+	return s.When(func(agg A) error { return cmd(s.ctx, agg) })
+}
+
+// Then checks if the command succeeded and emitted the events of given messages, in the same order.
+// The emitted events are decoded into the messages of the same Go types as the expected ones.
+func (s *Scenario[A]) Then(msgs ...es.EventMessage) *Scenario[A] {
+	s.t.Helper()
+	if !s.checkRun() {
+		return s
+	}
+	if s.err != nil {
+		s.t.Errorf("expected the command to succeed, but it failed: %v", s.err)
+		return s
+	}
+
+	events := s.agg.AggBase().UncommittedEvents()
+	expectedTypes, emittedTypes := make([]string, len(msgs)), make([]string, len(events))
+	for i, msg := range msgs {
+		expectedTypes[i] = msg.MessageType()
+	}
+	for i, e := range events {
+		emittedTypes[i] = e.EventType
+	}
+	if !assert.Equal(s.t, expectedTypes, emittedTypes, "emitted event types mismatch") {
+		return s
+	}
+
+	for i, msg := range msgs {
+		emitted, err := s.decode(events[i], msg)
+		if err != nil {
+			s.t.Errorf("decoding emitted event: %d of type: %s failed: %v", i, events[i].EventType, err)
+			continue
+		}
+		assert.Equal(s.t, msg, emitted, fmt.Sprintf("emitted event: %d of type: %s mismatch", i, events[i].EventType))
+	}
+	return s
+}
+
+// ThenError checks if the command failed with the error of given code.
+func (s *Scenario[A]) ThenError(code cgerrors.ErrorCode) *Scenario[A] {
+	s.t.Helper()
+	if !s.checkRun() {
+		return s
+	}
+	if s.err == nil {
+		s.t.Errorf("expected the command to fail with the code: %s, but it succeeded", code)
+		return s
+	}
+	if c := cgerrors.Code(s.err); c != code {
+		s.t.Errorf("expected the command to fail with the code: %s, but got: %s - %v", code, c, s.err)
+	}
+	return s
+}
+
+func (s *Scenario[A]) checkRun() bool {
+	s.t.Helper()
+	if !s.done {
+		s.t.Errorf("scenario command was not run - call When first")
+	}
+	return s.done
+}
+
+// decode decodes the event data into a new message of the same type as the expected one.
+func (s *Scenario[A]) decode(e *es.Event, expected es.EventMessage) (interface{}, error) {
+	tp := reflect.TypeOf(expected)
+	if tp.Kind() == reflect.Ptr {
+		msg := reflect.New(tp.Elem())
+		if err := s.agg.AggBase().DecodeEventAs(e.EventData, msg.Interface()); err != nil {
+			return nil, err
+		}
+		return msg.Interface(), nil
+	}
+	msg := reflect.New(tp)
+	if err := s.agg.AggBase().DecodeEventAs(e.EventData, msg.Interface()); err != nil {
+		return nil, err
+	}
+	return msg.Elem().Interface(), nil
+}
@@ -0,0 +1,144 @@
+package estest_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/estest"
+)
+
+const accountType = "account"
+
+var accountRegistry = es.NewEventRegistry[*account](accountType)
+
+func init() {
+	es.MustRegister(
+		es.RegisterHandler(accountRegistry, (*account).applyOpened),
+		es.RegisterHandler(accountRegistry, (*account).applyDeposited),
+		es.RegisterHandler(accountRegistry, (*account).applyWithdrawn),
+	)
+}
+
+type account struct {
+	base    *es.AggregateBase
+	Opened  bool
+	Balance int64
+}
+
+func (a *account) Apply(e *es.Event) error           { return accountRegistry.Apply(a, e) }
+func (a *account) SetBase(base *es.AggregateBase)    { a.base = base }
+func (a *account) AggBase() *es.AggregateBase        { return a.base }
+func (a *account) Reset()                            { *a = account{} }
+func (a *account) applyOpened(*accountOpened) error  { a.Opened = true; return nil }
+func (a *account) applyDeposited(m *deposited) error { a.Balance += m.Amount; return nil }
+func (a *account) applyWithdrawn(m *withdrawn) error { a.Balance -= m.Amount; return nil }
+
+func (a *account) Withdraw(amount int64) error {
+	if !a.Opened {
+		return cgerrors.ErrFailedPrecondition("account is not opened")
+	}
+	if amount > a.Balance {
+		return cgerrors.ErrInvalidArgumentf("insufficient balance: %d", a.Balance)
+	}
+	return a.base.SetEvent(&withdrawn{Amount: amount})
+}
+
+func (a *account) Deposit(ctx context.Context, amount int64) error {
+	if !a.Opened {
+		return cgerrors.ErrFailedPrecondition("account is not opened")
+	}
+	return a.base.SetEventCtx(ctx, &deposited{Amount: amount})
+}
+
+type accountOpened struct{}
+
+func (accountOpened) MessageType() string { return "account_opened" }
+
+type deposited struct {
+	Amount int64 `json:"amount"`
+}
+
+func (deposited) MessageType() string { return "deposited" }
+
+type withdrawn struct {
+	Amount int64 `json:"amount"`
+}
+
+func (withdrawn) MessageType() string { return "withdrawn" }
+
+var fixture = estest.NewFixture(accountType, 1, func() *account { return &account{} })
+
+func TestScenario(t *testing.T) {
+	t.Run("Then", func(t *testing.T) {
+		s := fixture.Given(t, &accountOpened{}, &deposited{Amount: 100}).
+			When(func(a *account) error { return a.Withdraw(40) }).
+			Then(&withdrawn{Amount: 40})
+		if b := s.Aggregate().Balance; b != 60 {
+			t.Errorf("expected balance: 60, but is: %d", b)
+		}
+	})
+
+	t.Run("Context", func(t *testing.T) {
+		ctx := es.WithCorrelationID(context.Background(), "correlation-id")
+		s := fixture.GivenCtx(ctx, t, &accountOpened{}).
+			WhenCtx(func(ctx context.Context, a *account) error { return a.Deposit(ctx, 40) }).
+			Then(&deposited{Amount: 40})
+		events := s.Aggregate().AggBase().UncommittedEvents()
+		if len(events) != 1 || events[0].CorrelationId != "correlation-id" {
+			t.Errorf("expected the emitted event to carry the correlation id of the scenario context")
+		}
+	})
+
+	t.Run("ThenError", func(t *testing.T) {
+		fixture.Given(t).
+			When(func(a *account) error { return a.Withdraw(40) }).
+			ThenError(cgerrors.CodeFailedPrecondition)
+		fixture.Given(t, &accountOpened{}).
+			When(func(a *account) error { return a.Withdraw(40) }).
+			ThenError(cgerrors.CodeInvalidArgument)
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		withdraw := func(a *account) error { return a.Withdraw(40) }
+		given := []es.EventMessage{&accountOpened{}, &deposited{Amount: 100}}
+
+		r := &recorder{TB: t}
+		fixture.Given(r, given...).When(withdraw).Then(&withdrawn{Amount: 50})
+		if len(r.errors) != 1 {
+			t.Errorf("expected a single message mismatch, but got: %v", r.errors)
+		}
+
+		r = &recorder{TB: t}
+		fixture.Given(r, given...).When(withdraw).Then(&deposited{Amount: 40})
+		if len(r.errors) != 1 {
+			t.Errorf("expected a single event type mismatch, but got: %v", r.errors)
+		}
+
+		r = &recorder{TB: t}
+		fixture.Given(r, given...).When(withdraw).ThenError(cgerrors.CodeInvalidArgument)
+		if len(r.errors) != 1 {
+			t.Errorf("expected an error for the succeeded command, but got: %v", r.errors)
+		}
+
+		r = &recorder{TB: t}
+		fixture.Given(r).When(withdraw).Then()
+		if len(r.errors) != 1 {
+			t.Errorf("expected an error for the failed command, but got: %v", r.errors)
+		}
+	})
+}
+
+// recorder records the errors reported by the scenario.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,188 @@
+package estest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esstate"
+	"github.com/kucjac/cleango/ddd/events/eventstate"
+)
+
+// The names of the handlers registered by the TestStateStorage suite.
+const (
+	stateHandler      = "estest_handler"
+	otherStateHandler = "estest_other_handler"
+)
+
+// TestStateStorage is the conformance test suite of the esstate.Storage implementations. Besides the TestStorage
+// suite run on the storage, it checks the handler registration, and the event state changes along with their rollback.
+// Each test case gets a new, empty storage created by newStorage with the test case *testing.T.
+func TestStateStorage(t *testing.T, newStorage func(t *testing.T) esstate.Storage) {
+	t.Run("Storage", func(t *testing.T) {
+		TestStorage(t, func(t *testing.T) es.Storage { return stateStorage{Storage: newStorage(t)} })
+	})
+	t.Run("Handlers", func(t *testing.T) { testHandlers(t, newStorage(t)) })
+	t.Run("EventState", func(t *testing.T) { testEventState(t, newStorage(t)) })
+	t.Run("Transaction", func(t *testing.T) { testStateTransaction(t, newStorage(t)) })
+}
+
+func testHandlers(t *testing.T, s esstate.Storage) {
+	ctx := context.Background()
+	registerStateHandlers(t, s)
+
+	handlers, err := s.ListHandlers(ctx)
+	if err != nil {
+		t.Fatalf("listing handlers failed: %v", err)
+	}
+	found := map[string][]string{}
+	for _, h := range handlers {
+		found[h.Name] = h.EventTypes
+	}
+	for name, eventTypes := range map[string][]string{
+		stateHandler:      {createdEventType},
+		otherStateHandler: {createdEventType, changedEventType},
+	} {
+		registered, ok := found[name]
+		if !ok {
+			t.Errorf("handler: %s not listed", name)
+			continue
+		}
+		if !sameStrings(registered, eventTypes) {
+			t.Errorf("handler: %s event types mismatch, is: %v, want: %v", name, registered, eventTypes)
+		}
+	}
+}
+
+func testEventState(t *testing.T, s esstate.Storage) {
+	ctx := context.Background()
+	registerStateHandlers(t, s)
+	g := newEventGen()
+	created, changed := g.event(AggregateType, "a", createdEventType, 1), g.event(AggregateType, "a", changedEventType, 2)
+	saveEvents(t, s, created, changed)
+	for _, e := range []*es.Event{created, changed} {
+		if err := s.MarkUnhandled(ctx, e.EventId, e.EventType, e.Timestamp); err != nil {
+			t.Fatalf("marking event unhandled failed: %v", err)
+		}
+	}
+
+	// The event is unhandled by each handler of its type.
+	checkUnhandled(t, s, []string{stateHandler}, eventstate.Unhandled{EventID: created.EventId, HandlerName: stateHandler})
+	checkUnhandled(t, s, []string{otherStateHandler},
+		eventstate.Unhandled{EventID: created.EventId, HandlerName: otherStateHandler},
+		eventstate.Unhandled{EventID: changed.EventId, HandlerName: otherStateHandler},
+	)
+
+	if err := s.StartHandling(ctx, created.EventId, stateHandler, time.Now().UTC().UnixNano()); err != nil {
+		t.Fatalf("starting handling failed: %v", err)
+	}
+	checkUnhandled(t, s, []string{stateHandler})
+
+	failure := &eventstate.HandleFailure{
+		EventID:     created.EventId,
+		HandlerName: stateHandler,
+		Err:         "failed",
+		ErrCode:     cgerrors.CodeInternal,
+		RetryNo:     1,
+		Timestamp:   time.Now().UTC(),
+	}
+	if err := s.HandlingFailed(ctx, failure); err != nil {
+		t.Fatalf("marking handling failed failed: %v", err)
+	}
+	failures, err := s.FindFailures(ctx, eventstate.FindFailureQuery{HandlerNames: []string{stateHandler, otherStateHandler}})
+	if err != nil {
+		t.Fatalf("finding failures failed: %v", err)
+	}
+	if len(failures) != 1 {
+		t.Fatalf("expected a single handling failure, but got: %d", len(failures))
+	}
+	if f := failures[0]; f.EventID != failure.EventID || f.HandlerName != failure.HandlerName || f.Err != failure.Err || f.ErrCode != failure.ErrCode {
+		t.Errorf("handling failure mismatch, is: %+v, want: %+v", f, failure)
+	}
+
+	if err = s.FinishHandling(ctx, changed.EventId, otherStateHandler, time.Now().UTC().UnixNano()); err != nil {
+		t.Fatalf("finishing handling failed: %v", err)
+	}
+	checkUnhandled(t, s, []string{stateHandler, otherStateHandler}, eventstate.Unhandled{EventID: created.EventId, HandlerName: otherStateHandler})
+}
+
+func testStateTransaction(t *testing.T, s esstate.Storage) {
+	ctx := context.Background()
+	registerStateHandlers(t, s)
+	g := newEventGen()
+
+	tx, err := s.BeginTx(ctx)
+	if err != nil {
+		t.Fatalf("beginning transaction failed: %v", err)
+	}
+	e := g.event(AggregateType, "a", createdEventType, 1)
+	saveEvents(t, tx, e)
+	if err = tx.MarkUnhandled(ctx, e.EventId, e.EventType, e.Timestamp); err != nil {
+		t.Fatalf("marking event unhandled failed: %v", err)
+	}
+	checkUnhandled(t, tx, []string{stateHandler}, eventstate.Unhandled{EventID: e.EventId, HandlerName: stateHandler})
+	if err = tx.Rollback(ctx); err != nil {
+		t.Fatalf("rolling back transaction failed: %v", err)
+	}
+	checkUnhandled(t, s, []string{stateHandler, otherStateHandler})
+	checkStream(t, s, AggregateType, "a")
+}
+
+func registerStateHandlers(t *testing.T, s esstate.StorageBase) {
+	t.Helper()
+	err := s.RegisterHandlers(context.Background(),
+		eventstate.Handler{Name: stateHandler, EventTypes: []string{createdEventType}},
+		eventstate.Handler{Name: otherStateHandler, EventTypes: []string{createdEventType, changedEventType}},
+	)
+	if err != nil {
+		t.Fatalf("registering handlers failed: %v", err)
+	}
+}
+
+func checkUnhandled(t *testing.T, s esstate.StorageBase, handlers []string, expected ...eventstate.Unhandled) {
+	t.Helper()
+	unhandled, err := s.FindUnhandled(context.Background(), eventstate.FindUnhandledQuery{HandlerNames: handlers})
+	if err != nil {
+		t.Fatalf("finding unhandled events failed: %v", err)
+	}
+	if len(unhandled) != len(expected) {
+		t.Fatalf("expected %d unhandled events of handlers: %v, but got: %d", len(expected), handlers, len(unhandled))
+	}
+	found := map[eventstate.Unhandled]struct{}{}
+	for _, u := range unhandled {
+		found[u] = struct{}{}
+	}
+	for _, u := range expected {
+		if _, ok := found[u]; !ok {
+			t.Errorf("event: %s is not unhandled by the handler: %s", u.EventID, u.HandlerName)
+		}
+	}
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]struct{}, len(a))
+	for _, v := range a {
+		set[v] = struct{}{}
+	}
+	for _, v := range b {
+		if _, ok := set[v]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// stateStorage adapts the esstate.Storage to the es.Storage interface.
+type stateStorage struct {
+	esstate.Storage
+}
+
+// BeginTx implements es.Storage interface.
+func (s stateStorage) BeginTx(ctx context.Context) (es.TxStorage, error) {
+	return s.Storage.BeginTx(ctx)
+}
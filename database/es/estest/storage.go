@@ -0,0 +1,356 @@
+package estest
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
+)
+
+// The aggregate types of the events stored by the conformance test suites.
+// The storages created by the factories need to accept the events of these types.
+const (
+	AggregateType      = "estest_aggregate"
+	OtherAggregateType = "estest_other_aggregate"
+)
+
+// The event types of the events stored by the conformance test suites.
+const (
+	createdEventType = "estest_created"
+	changedEventType = "estest_changed"
+)
+
+// streamTimeout is the maximum duration of reading a single stream in the conformance tests.
+const streamTimeout = 10 * time.Second
+
+// TestStorage is the conformance test suite of the es.Storage implementations. It checks the revision uniqueness
+// with its CodeAlreadyExists mapping, the transaction rollback, listing the events after revision,
+// getting the snapshots of the aggregate versions, and all the StreamEventsRequest filters.
+// Each test case gets a new, empty storage created by newStorage with the test case *testing.T,
+// i.e. to name its schema after t.Name() and drop it within t.Cleanup.
+func TestStorage(t *testing.T, newStorage func(t *testing.T) es.Storage) {
+	t.Run("Revisions", func(t *testing.T) { testRevisions(t, newStorage(t)) })
+	t.Run("Transaction", func(t *testing.T) { testTransaction(t, newStorage(t)) })
+	t.Run("ListEventsAfterRevision", func(t *testing.T) { testListEventsAfterRevision(t, newStorage(t)) })
+	t.Run("Snapshots", func(t *testing.T) { testSnapshots(t, newStorage(t)) })
+	t.Run("StreamEvents", func(t *testing.T) { testStreamEvents(t, newStorage(t)) })
+}
+
+func testRevisions(t *testing.T, s es.Storage) {
+	ctx := context.Background()
+	g := newEventGen()
+	stream := []*es.Event{
+		g.event(AggregateType, "a", createdEventType, 1),
+		g.event(AggregateType, "a", changedEventType, 2),
+	}
+	saveEvents(t, s, stream...)
+	checkStream(t, s, AggregateType, "a", stream...)
+
+	conflicting := g.event(AggregateType, "a", changedEventType, 2)
+	checkAlreadyExists(t, s.SaveEvents(ctx, []*es.Event{conflicting}), "saving event with the stored revision")
+
+	// The whole batch is rejected if any of its events conflicts.
+	batch := []*es.Event{g.event(AggregateType, "a", changedEventType, 3), g.event(AggregateType, "a", changedEventType, 3)}
+	checkAlreadyExists(t, s.SaveEvents(ctx, batch), "saving batch with duplicated revision")
+	batch = []*es.Event{g.event(AggregateType, "a", changedEventType, 3), g.event(AggregateType, "a", changedEventType, 2)}
+	checkAlreadyExists(t, s.SaveEvents(ctx, batch), "saving batch with the stored revision")
+	checkStream(t, s, AggregateType, "a", stream...)
+
+	duplicated := g.event(AggregateType, "a", changedEventType, 3)
+	duplicated.EventId = stream[0].EventId
+	checkAlreadyExists(t, s.SaveEvents(ctx, []*es.Event{duplicated}), "saving event with the stored id")
+
+	// The revisions are unique within the aggregate - the other aggregates, also of other types, are not affected.
+	other := []*es.Event{g.event(AggregateType, "b", createdEventType, 1), g.event(OtherAggregateType, "a", createdEventType, 1)}
+	saveEvents(t, s, other...)
+	checkStream(t, s, AggregateType, "b", other[0])
+	checkStream(t, s, OtherAggregateType, "a", other[1])
+	checkStream(t, s, AggregateType, "a", stream...)
+}
+
+func testTransaction(t *testing.T, s es.Storage) {
+	ctx := context.Background()
+	g := newEventGen()
+
+	tx, err := s.BeginTx(ctx)
+	if err != nil {
+		t.Fatalf("beginning transaction failed: %v", err)
+	}
+	rolledBack := g.event(AggregateType, "a", createdEventType, 1)
+	if err = tx.SaveEvents(ctx, []*es.Event{rolledBack}); err != nil {
+		t.Fatalf("saving events within transaction failed: %v", err)
+	}
+	if err = tx.SaveSnapshot(ctx, g.snapshot(AggregateType, "a", 1, 1)); err != nil {
+		t.Fatalf("saving snapshot within transaction failed: %v", err)
+	}
+	checkStream(t, tx, AggregateType, "a", rolledBack)
+	if err = tx.Rollback(ctx); err != nil {
+		t.Fatalf("rolling back transaction failed: %v", err)
+	}
+	checkStream(t, s, AggregateType, "a")
+	if _, err = s.GetSnapshot(ctx, "a", AggregateType, 1); !cgerrors.IsNotFound(err) {
+		t.Errorf("expected rolled back snapshot not to be found, but got: %v", err)
+	}
+
+	// The revision of the rolled back event is free to use.
+	if tx, err = s.BeginTx(ctx); err != nil {
+		t.Fatalf("beginning transaction failed: %v", err)
+	}
+	committed := g.event(AggregateType, "a", createdEventType, 1)
+	if err = tx.SaveEvents(ctx, []*es.Event{committed}); err != nil {
+		t.Fatalf("saving events within transaction failed: %v", err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		t.Fatalf("committing transaction failed: %v", err)
+	}
+	checkStream(t, s, AggregateType, "a", committed)
+}
+
+func testListEventsAfterRevision(t *testing.T, s es.Storage) {
+	ctx := context.Background()
+	g := newEventGen()
+	stream := []*es.Event{
+		g.event(AggregateType, "a", createdEventType, 1),
+		g.event(AggregateType, "a", changedEventType, 2),
+		g.event(AggregateType, "a", changedEventType, 3),
+	}
+	saveEvents(t, s, stream[:2]...)
+	saveEvents(t, s, g.event(AggregateType, "b", createdEventType, 1), g.event(OtherAggregateType, "a", createdEventType, 1))
+	saveEvents(t, s, stream[2])
+
+	for after := int64(0); after <= 4; after++ {
+		events, err := s.ListEventsAfterRevision(ctx, "a", AggregateType, after)
+		if err != nil {
+			t.Fatalf("listing events after revision: %d failed: %v", after, err)
+		}
+		var expected []*es.Event
+		if after < int64(len(stream)) {
+			expected = stream[after:]
+		}
+		checkEvents(t, "events after revision", events, expected...)
+	}
+	events, err := s.ListEventsAfterRevision(ctx, "c", AggregateType, 0)
+	if err != nil {
+		t.Fatalf("listing events of not stored aggregate failed: %v", err)
+	}
+	checkEvents(t, "events of not stored aggregate", events)
+}
+
+func testSnapshots(t *testing.T, s es.Storage) {
+	ctx := context.Background()
+	g := newEventGen()
+	if _, err := s.GetSnapshot(ctx, "a", AggregateType, 1); !cgerrors.IsNotFound(err) {
+		t.Fatalf("expected not found snapshot error, but got: %v", err)
+	}
+
+	v1 := g.snapshot(AggregateType, "a", 1, 1)
+	v1Latest := g.snapshot(AggregateType, "a", 1, 3)
+	v2 := g.snapshot(AggregateType, "a", 2, 2)
+	for _, snap := range []*es.Snapshot{v1, v1Latest, v2, g.snapshot(AggregateType, "b", 1, 5), g.snapshot(OtherAggregateType, "a", 1, 4)} {
+		if err := s.SaveSnapshot(ctx, snap); err != nil {
+			t.Fatalf("saving snapshot failed: %v", err)
+		}
+	}
+	checkAlreadyExists(t, s.SaveSnapshot(ctx, g.snapshot(AggregateType, "a", 1, 3)), "saving snapshot with the stored revision")
+
+	// The latest snapshot of given version is taken.
+	for _, expected := range []*es.Snapshot{v1Latest, v2} {
+		snap, err := s.GetSnapshot(ctx, "a", AggregateType, expected.AggregateVersion)
+		if err != nil {
+			t.Fatalf("getting snapshot of version: %d failed: %v", expected.AggregateVersion, err)
+		}
+		checkSnapshot(t, snap, expected)
+	}
+	if _, err := s.GetSnapshot(ctx, "a", AggregateType, 3); !cgerrors.IsNotFound(err) {
+		t.Errorf("expected not found snapshot of not stored version, but got: %v", err)
+	}
+}
+
+func testStreamEvents(t *testing.T, s es.Storage) {
+	g := newEventGen()
+	a1 := g.event(AggregateType, "a", createdEventType, 1)
+	b1 := g.event(AggregateType, "b", createdEventType, 1)
+	a2 := g.event(AggregateType, "a", changedEventType, 2)
+	o1 := g.event(OtherAggregateType, "o", createdEventType, 1)
+	b2 := g.event(AggregateType, "b", es.TombstoneEventType, 2)
+	// Each event is saved separately, so that their global positions follow the order above.
+	for _, e := range []*es.Event{a1, b1, a2, o1, b2} {
+		saveEvents(t, s, e)
+	}
+
+	cases := []struct {
+		name     string
+		req      es.StreamEventsRequest
+		expected []*es.Event
+	}{
+		{name: "All", expected: []*es.Event{a1, b1, a2, o1, b2}},
+		{name: "AggregateTypes", req: es.StreamEventsRequest{AggregateTypes: []string{OtherAggregateType}}, expected: []*es.Event{o1}},
+		{name: "AggregateIDs", req: es.StreamEventsRequest{AggregateIDs: []string{"b", "o"}}, expected: []*es.Event{b1, o1, b2}},
+		{name: "EventTypes", req: es.StreamEventsRequest{EventTypes: []string{changedEventType, es.TombstoneEventType}}, expected: []*es.Event{a2, b2}},
+		{name: "ExcludeEventTypes", req: es.StreamEventsRequest{ExcludeEventTypes: []string{createdEventType}}, expected: []*es.Event{a2, b2}},
+		{name: "ExcludeDeleted", req: es.StreamEventsRequest{ExcludeDeleted: true}, expected: []*es.Event{a1, a2, o1}},
+		{name: "FromTimestamp", req: es.StreamEventsRequest{FromTimestamp: a2.Timestamp}, expected: []*es.Event{a2, o1, b2}},
+		{
+			name:     "Combined",
+			req:      es.StreamEventsRequest{AggregateTypes: []string{AggregateType}, AggregateIDs: []string{"a", "b"}, ExcludeEventTypes: []string{changedEventType}, FromTimestamp: b1.Timestamp},
+			expected: []*es.Event{b1, b2},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := tc.req
+			checkEvents(t, "streamed events", readStream(t, s, &req), tc.expected...)
+		})
+	}
+
+	t.Run("FromPosition", func(t *testing.T) {
+		all := readStream(t, s, &es.StreamEventsRequest{})
+		if len(all) != 5 {
+			t.Fatalf("expected 5 streamed events, but got: %d", len(all))
+		}
+		for i := 1; i < len(all); i++ {
+			if all[i].Position <= all[i-1].Position {
+				t.Fatalf("expected streamed events ordered by increasing position, but got: %d after %d", all[i].Position, all[i-1].Position)
+			}
+		}
+		events := readStream(t, s, &es.StreamEventsRequest{FromPosition: all[1].Position})
+		checkEvents(t, "streamed events", events, a2, o1, b2)
+	})
+
+	t.Run("Follow", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+		defer cancel()
+		stream, err := s.StreamEvents(ctx, &es.StreamEventsRequest{AggregateIDs: []string{"a"}, Follow: true})
+		if err != nil {
+			t.Fatalf("streaming events failed: %v", err)
+		}
+		next := func() *es.Event {
+			select {
+			case e, ok := <-stream:
+				if !ok {
+					t.Fatalf("followed stream closed before the context is canceled")
+				}
+				return e
+			case <-ctx.Done():
+				t.Fatalf("reading followed stream timed out")
+			}
+			return nil
+		}
+		checkEvents(t, "followed events", []*es.Event{next(), next()}, a1, a2)
+
+		a3 := g.event(AggregateType, "a", changedEventType, 3)
+		saveEvents(t, s, g.event(AggregateType, "c", createdEventType, 1), a3)
+		checkEvents(t, "followed events", []*es.Event{next()}, a3)
+
+		cancel()
+		for range stream {
+		}
+	})
+}
+
+// eventGen generates the test events and snapshots with the unique ids and increasing timestamps.
+type eventGen struct {
+	ids es.UUIDGenerator
+	ts  int64
+}
+
+func newEventGen() *eventGen {
+	return &eventGen{ts: time.Now().UTC().UnixNano()}
+}
+
+func (g *eventGen) event(aggType, aggId, eventType string, revision int64) *es.Event {
+	g.ts++
+	return &es.Event{
+		EventId:       g.ids.GenerateId(),
+		EventType:     eventType,
+		AggregateType: aggType,
+		AggregateId:   aggId,
+		EventData:     []byte(`{"revision":` + strconv.FormatInt(revision, 10) + `}`),
+		Timestamp:     g.ts,
+		Revision:      revision,
+	}
+}
+
+func (g *eventGen) snapshot(aggType, aggId string, version, revision int64) *es.Snapshot {
+	g.ts++
+	return &es.Snapshot{
+		AggregateId:      aggId,
+		AggregateType:    aggType,
+		AggregateVersion: version,
+		Revision:         revision,
+		Timestamp:        g.ts,
+		SnapshotData:     []byte(`{}`),
+	}
+}
+
+func saveEvents(t *testing.T, s es.StorageBase, events ...*es.Event) {
+	t.Helper()
+	if err := s.SaveEvents(context.Background(), events); err != nil {
+		t.Fatalf("saving events failed: %v", err)
+	}
+}
+
+func readStream(t *testing.T, s es.StorageBase, req *es.StreamEventsRequest) []*es.Event {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+	defer cancel()
+	stream, err := s.StreamEvents(ctx, req)
+	if err != nil {
+		t.Fatalf("streaming events failed: %v", err)
+	}
+	var events []*es.Event
+	for e := range stream {
+		events = append(events, e)
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("reading stream timed out")
+	}
+	return events
+}
+
+func checkStream(t *testing.T, s es.StorageBase, aggType, aggId string, expected ...*es.Event) {
+	t.Helper()
+	events, err := s.ListEvents(context.Background(), aggId, aggType)
+	if err != nil {
+		t.Fatalf("listing events failed: %v", err)
+	}
+	checkEvents(t, "aggregate events", events, expected...)
+}
+
+func checkEvents(t *testing.T, name string, events []*es.Event, expected ...*es.Event) {
+	t.Helper()
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d %s, but got: %d", len(expected), name, len(events))
+	}
+	for i, e := range events {
+		want := expected[i]
+		if e.EventId != want.EventId || e.EventType != want.EventType || e.AggregateId != want.AggregateId ||
+			e.AggregateType != want.AggregateType || e.Revision != want.Revision || e.Timestamp != want.Timestamp ||
+			string(e.EventData) != string(want.EventData) {
+			t.Errorf("%s at index: %d mismatch, is: %+v, want: %+v", name, i, e, want)
+		}
+	}
+}
+
+func checkSnapshot(t *testing.T, snap, expected *es.Snapshot) {
+	t.Helper()
+	if snap.AggregateId != expected.AggregateId || snap.AggregateType != expected.AggregateType ||
+		snap.AggregateVersion != expected.AggregateVersion || snap.Revision != expected.Revision ||
+		snap.Timestamp != expected.Timestamp || string(snap.SnapshotData) != string(expected.SnapshotData) {
+		t.Errorf("snapshot mismatch, is: %+v, want: %+v", snap, expected)
+	}
+}
+
+func checkAlreadyExists(t *testing.T, err error, action string) {
+	t.Helper()
+	if err == nil {
+		t.Errorf("%s: expected already exists error, but succeeded", action)
+		return
+	}
+	if c := cgerrors.Code(err); c != cgerrors.CodeAlreadyExists {
+		t.Errorf("%s: expected already exists error, but got code: %s - %v", action, c, err)
+	}
+}
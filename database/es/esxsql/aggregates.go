@@ -0,0 +1,61 @@
+package esxsql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
+)
+
+// AggregateExists checks if the aggregate with given id and type is stored in the aggregate table.
+// Implements es.StorageBase interface.
+func (s *storage) AggregateExists(ctx context.Context, aggId string, aggType string) (bool, error) {
+	var found int
+	if err := s.conn.QueryRowContext(ctx, s.query.aggregateExists, aggId, aggType).Scan(&found); err != nil {
+		if cgerrors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, cgerrors.New("", err.Error(), s.conn.ErrorCode(err))
+	}
+	return true, nil
+}
+
+// ListAggregates lists the aggregates of given type with the aggregate table id greater than after, ordered by the id.
+// Implements es.StorageBase interface.
+func (s *storage) ListAggregates(ctx context.Context, aggType string, after int64, limit int) ([]*es.AggregateRecord, error) {
+	query := s.query.listNextAggregates
+	args := []interface{}{aggType, after}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+	rows, err := s.conn.QueryContext(ctx, s.conn.Rebind(query), args...)
+	if err != nil {
+		return nil, cgerrors.New("", err.Error(), s.conn.ErrorCode(err))
+	}
+	defer rows.Close()
+
+	var aggregates []*es.AggregateRecord
+	for rows.Next() {
+		var agg es.AggregateRecord
+		if err = rows.Scan(&agg.Position, &agg.ID, &agg.Type, &agg.InsertedAt); err != nil {
+			return nil, cgerrors.ErrInternalf("scanning aggregate row failed: %v", err)
+		}
+		aggregates = append(aggregates, &agg)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, cgerrors.New("", err.Error(), s.conn.ErrorCode(err))
+	}
+	return aggregates, nil
+}
+
+// CountAggregates counts the aggregates of given type.
+// Implements es.StorageBase interface.
+func (s *storage) CountAggregates(ctx context.Context, aggType string) (int64, error) {
+	var count int64
+	if err := s.conn.QueryRowContext(ctx, s.query.countAggregates, aggType).Scan(&count); err != nil {
+		return 0, cgerrors.New("", err.Error(), s.conn.ErrorCode(err))
+	}
+	return count, nil
+}
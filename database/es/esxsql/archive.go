@@ -0,0 +1,454 @@
+package esxsql
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"gocloud.dev/blob"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/xsql"
+	"github.com/kucjac/cleango/pkg/xlog"
+	"github.com/kucjac/cleango/xblob"
+)
+
+// WithArchive creates a copy of the storage, which reads the archived event streams back from given bucket.
+// The storage needs to have the ArchiveTable configured.
+func (s *Storage) WithArchive(bucket xblob.Bucket) *Storage {
+	cp := *s
+	cp.archive = bucket
+	return &cp
+}
+
+// ArchiverConfig is the configuration of the event stream Archiver.
+type ArchiverConfig struct {
+	// MaxAge archives the streams which latest event is older than given duration.
+	MaxAge time.Duration
+	// ClosedEventTypes archives the streams containing any of given event types regardless of their age,
+	// i.e. the events closing the aggregate lifecycle.
+	ClosedEventTypes []string
+	// AggregateTypes limits the archived streams to given aggregate types. If empty all the aggregates are archived.
+	AggregateTypes []string
+	// BatchSize is the maximum number of the streams archived by a single Archive call.
+	BatchSize int
+	// KeyPrefix is the prefix of the segment keys in the bucket.
+	KeyPrefix string
+}
+
+// DefaultArchiverConfig creates a new default archiver config, which archives the streams older than given age.
+func DefaultArchiverConfig(maxAge time.Duration) *ArchiverConfig {
+	return &ArchiverConfig{
+		MaxAge:    maxAge,
+		BatchSize: 100,
+		KeyPrefix: "es",
+	}
+}
+
+// Validate checks if the archiver config is valid to use.
+func (c *ArchiverConfig) Validate() error {
+	if c.MaxAge < 0 {
+		return cgerrors.ErrInternal("archiver max age is lower than 0")
+	}
+	if c.MaxAge == 0 && len(c.ClosedEventTypes) == 0 {
+		return cgerrors.ErrInternal("archiver requires either max age or closed event types")
+	}
+	if c.BatchSize <= 0 {
+		return cgerrors.ErrInternal("archiver batch size needs to be greater than 0")
+	}
+	return nil
+}
+
+// NewArchiver creates a new event stream archiver for given *Storage or *Transaction.
+// The storage needs to have the ArchiveTable configured and the bucket set with the WithArchive method.
+func NewArchiver(s es.StorageBase, cfg *ArchiverConfig) (*Archiver, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	var st storage
+	switch t := s.(type) {
+	case *Storage:
+		st = t.storage
+	case *Transaction:
+		st = t.storage
+	default:
+		return nil, cgerrors.ErrInternalf("invalid archiver storage type: %T", s)
+	}
+	if st.cfg.ArchiveTable == "" {
+		return nil, cgerrors.ErrInternal("no archive table name provided")
+	}
+	if st.archive == nil {
+		return nil, cgerrors.ErrInternal("no archive bucket provided")
+	}
+	return &Archiver{s: st, cfg: cfg}, nil
+}
+
+// Archiver moves the old or closed aggregate event streams along with their snapshots from the database
+// into the blob bucket segments, leaving a pointer row in the archive table behind.
+// The storage reads the archived events back on listing the aggregate events, thus loading the aggregates is unaffected.
+// The archived events are no longer streamed nor queried across the aggregates.
+// If the aggregate gets new events after it is archived, these are appended to its segment on the next archival.
+type Archiver struct {
+	s   storage
+	cfg *ArchiverConfig
+}
+
+// Archive archives the batch of the streams matching the archiver config. It returns the number of archived streams.
+func (a *Archiver) Archive(ctx context.Context) (int, error) {
+	aggregates, err := a.listCandidates(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for i, agg := range aggregates {
+		if err = a.archiveStream(ctx, agg); err != nil {
+			return i, cgerrors.New("", fmt.Sprintf("archiving aggregate: %s with id: %s failed: %v", agg.Type, agg.ID, err), a.s.conn.ErrorCode(err))
+		}
+	}
+	return len(aggregates), nil
+}
+
+func (a *Archiver) listCandidates(ctx context.Context) ([]aggregate, error) {
+	query, args := a.candidatesQuery()
+	rows, err := a.s.conn.QueryContext(ctx, a.s.conn.Rebind(query), args...)
+	if err != nil {
+		return nil, cgerrors.New("", err.Error(), a.s.conn.ErrorCode(err))
+	}
+	defer rows.Close()
+
+	var aggregates []aggregate
+	for rows.Next() {
+		var agg aggregate
+		if err = rows.Scan(&agg.ID, &agg.Type); err != nil {
+			return nil, cgerrors.ErrInternalf("scanning archive candidate row failed: %v", err)
+		}
+		aggregates = append(aggregates, agg)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, cgerrors.New("", err.Error(), a.s.conn.ErrorCode(err))
+	}
+	return aggregates, nil
+}
+
+// candidatesQuery builds the query listing the streams to archive. The streams with events pending in the outbox are skipped.
+func (a *Archiver) candidatesQuery() (string, []interface{}) {
+	eventTable := a.s.cfg.eventTableName()
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf(listArchiveCandidatesQuery, eventTable))
+
+	var (
+		args       []interface{}
+		conditions []string
+	)
+	inValues := func(values []string) string {
+		sb := strings.Builder{}
+		sb.WriteRune('(')
+		for i, v := range values {
+			sb.WriteRune('?')
+			args = append(args, v)
+			if i != len(values)-1 {
+				sb.WriteRune(',')
+			}
+		}
+		sb.WriteRune(')')
+		return sb.String()
+	}
+	if len(a.cfg.AggregateTypes) > 0 {
+		conditions = append(conditions, "aggregate_type IN "+inValues(a.cfg.AggregateTypes))
+	}
+	if a.s.cfg.OutboxTable != "" {
+		conditions = append(conditions, fmt.Sprintf("(aggregate_id, aggregate_type) NOT IN (SELECT e.aggregate_id, e.aggregate_type FROM %s AS o JOIN %s AS e ON e.event_id = o.event_id)",
+			a.s.cfg.outboxTableName(), eventTable))
+	}
+	if len(conditions) > 0 {
+		sb.WriteString("WHERE ")
+		sb.WriteString(strings.Join(conditions, " AND "))
+		sb.WriteRune(' ')
+	}
+	sb.WriteString("GROUP BY aggregate_id, aggregate_type HAVING ")
+
+	var having []string
+	if a.cfg.MaxAge > 0 {
+		having = append(having, "MAX(timestamp) <= ?")
+		args = append(args, time.Now().Add(-a.cfg.MaxAge).UTC().UnixNano())
+	}
+	if len(a.cfg.ClosedEventTypes) > 0 {
+		having = append(having, "SUM(CASE WHEN event_type IN "+inValues(a.cfg.ClosedEventTypes)+" THEN 1 ELSE 0 END) > 0")
+	}
+	sb.WriteString(strings.Join(having, " OR "))
+	sb.WriteString(" ORDER BY MIN(id) LIMIT ?")
+	args = append(args, a.cfg.BatchSize)
+	return sb.String(), args
+}
+
+// archiveStream moves the stored events and snapshots of the aggregate into a new segment, which replaces
+// the previous segment of the aggregate, if it was already archived.
+func (a *Archiver) archiveStream(ctx context.Context, agg aggregate) error {
+	var (
+		key, prevKey string
+		written      bool
+	)
+	err := xsql.RunInTransaction(ctx, a.s.conn, func(tx *xsql.Tx) error {
+		st := a.s
+		st.conn = tx
+
+		seg := &segment{}
+		prev, err := st.getArchivePointer(ctx, agg.ID, agg.Type)
+		if err != nil && !cgerrors.IsNotFound(err) {
+			return err
+		}
+		if prev != nil {
+			prevKey = prev.segmentKey
+			if seg, err = st.readSegment(ctx, prev.segmentKey); err != nil {
+				return err
+			}
+		}
+
+		events, err := st.queryEvents(ctx, st.query.getStreamAfterRevision, agg.ID, agg.Type, seg.revision())
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		revision := events[len(events)-1].Revision
+		snapshots, err := st.listSnapshots(ctx, agg.ID, agg.Type)
+		if err != nil {
+			return err
+		}
+		seg.Events = append(seg.Events, events...)
+		for _, snap := range snapshots {
+			if snap.Revision <= revision {
+				seg.Snapshots = append(seg.Snapshots, snap)
+			}
+		}
+
+		key = a.segmentKey(agg, revision)
+		if err = st.writeSegment(ctx, key, seg); err != nil {
+			return err
+		}
+		written = true
+
+		for _, query := range a.deleteQueries() {
+			if _, err = tx.ExecContext(ctx, query, agg.ID, agg.Type, revision); err != nil {
+				return err
+			}
+		}
+		query := insertArchiveQuery
+		if prev != nil {
+			query = updateArchiveQuery
+		}
+		// The timestamp of the archived tombstone allows the purge to find the deleted aggregate.
+		var deletedAt sql.NullInt64
+		if last := seg.Events[len(seg.Events)-1]; es.IsTombstone(last) {
+			deletedAt = sql.NullInt64{Int64: last.Timestamp, Valid: true}
+		}
+		_, err = tx.ExecContext(ctx, tx.Rebind(fmt.Sprintf(query, st.cfg.archiveTableName())), key, revision, time.Now().UTC().UnixNano(), deletedAt, agg.ID, agg.Type)
+		return err
+	})
+	if err != nil {
+		if written {
+			// The segment is not referenced by any pointer, thus it could be safely removed.
+			if er := a.s.archive.Delete(ctx, key); er != nil {
+				xlog.WithContext(ctx).Errorf("deleting unreferenced archive segment: %s failed: %v", key, er)
+			}
+		}
+		return err
+	}
+	if prevKey != "" && prevKey != key {
+		if er := a.s.archive.Delete(ctx, prevKey); er != nil {
+			xlog.WithContext(ctx).Errorf("deleting replaced archive segment: %s failed: %v", prevKey, er)
+		}
+	}
+	return nil
+}
+
+// deleteQueries gets the queries removing the archived rows, taking the aggregate id, type and the archived revision arguments.
+// The rows referencing the archived events are removed before the events.
+func (a *Archiver) deleteQueries() []string {
+	cfg := a.s.cfg
+	eventTable := cfg.eventTableName()
+	var queries []string
+	if cfg.EventState != nil {
+		queries = append(queries,
+			fmt.Sprintf(archiveEventReferencesQuery, cfg.eventStateTableName(), eventTable),
+			fmt.Sprintf(archiveEventReferencesQuery, cfg.eventHandleFailureTableName(), eventTable),
+		)
+	}
+	queries = append(queries,
+		fmt.Sprintf(archiveAggregateRowsQuery, cfg.snapshotTableName()),
+		fmt.Sprintf(archiveAggregateRowsQuery, eventTable),
+	)
+	for i, query := range queries {
+		queries[i] = a.s.conn.Rebind(query)
+	}
+	return queries
+}
+
+// segmentKey gets the bucket key of the aggregate segment archived up to given revision.
+func (a *Archiver) segmentKey(agg aggregate, revision int64) string {
+	return path.Join(a.cfg.KeyPrefix, agg.Type, agg.ID, strconv.FormatInt(revision, 10)+".seg.gz")
+}
+
+// segment is the archived part of the aggregate event stream along with its snapshots.
+// It is stored in the bucket as the gzip compressed JSON.
+type segment struct {
+	Events    []*es.Event    `json:"events"`
+	Snapshots []*es.Snapshot `json:"snapshots,omitempty"`
+}
+
+// revision gets the latest revision of the segment events.
+func (s *segment) revision() int64 {
+	if n := len(s.Events); n > 0 {
+		return s.Events[n-1].Revision
+	}
+	return 0
+}
+
+type archivePointer struct {
+	segmentKey string
+	revision   int64
+}
+
+func (s *storage) getArchivePointer(ctx context.Context, aggId, aggType string) (*archivePointer, error) {
+	query := s.conn.Rebind(fmt.Sprintf(getArchiveQuery, s.cfg.archiveTableName()))
+	var p archivePointer
+	if err := s.conn.QueryRowContext(ctx, query, aggId, aggType).Scan(&p.segmentKey, &p.revision); err != nil {
+		if cgerrors.Is(err, sql.ErrNoRows) {
+			return nil, cgerrors.ErrNotFoundf("archive of aggregate: %s with id: %s not found", aggType, aggId)
+		}
+		return nil, cgerrors.New("", err.Error(), s.conn.ErrorCode(err))
+	}
+	return &p, nil
+}
+
+func (s *storage) listSnapshots(ctx context.Context, aggId, aggType string) ([]*es.Snapshot, error) {
+	query := s.conn.Rebind(fmt.Sprintf(listAggregateSnapshotsQuery, s.cfg.snapshotTableName()))
+	return s.querySnapshots(ctx, query, aggId, aggType)
+}
+
+func (s *storage) readSegment(ctx context.Context, key string) (*segment, error) {
+	if s.archive == nil {
+		return nil, cgerrors.ErrInternalf("no archive bucket provided to read the segment: %s", key)
+	}
+	data, err := s.archive.ReadAll(ctx, key)
+	if err != nil {
+		return nil, cgerrors.ErrInternalf("reading archive segment: %s failed: %v", key, err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, cgerrors.ErrInternalf("reading archive segment: %s failed: %v", key, err)
+	}
+	defer zr.Close()
+
+	var seg segment
+	if err = json.NewDecoder(zr).Decode(&seg); err != nil {
+		return nil, cgerrors.ErrInternalf("decoding archive segment: %s failed: %v", key, err)
+	}
+	return &seg, nil
+}
+
+func (s *storage) writeSegment(ctx context.Context, key string, seg *segment) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(seg); err != nil {
+		return cgerrors.ErrInternalf("encoding archive segment: %s failed: %v", key, err)
+	}
+	if err := zw.Close(); err != nil {
+		return cgerrors.ErrInternalf("encoding archive segment: %s failed: %v", key, err)
+	}
+	if err := s.archive.WriteAll(ctx, key, buf.Bytes(), &blob.WriterOptions{ContentType: "application/gzip"}); err != nil {
+		return cgerrors.ErrInternalf("writing archive segment: %s failed: %v", key, err)
+	}
+	return nil
+}
+
+// archivedSegment gets the archived segment of the aggregate if it contains the events with the revision greater than after.
+// If the archive is not configured or the aggregate is not archived, the segment is nil.
+func (s *storage) archivedSegment(ctx context.Context, aggId, aggType string, after int64) (*segment, error) {
+	if s.cfg.ArchiveTable == "" {
+		return nil, nil
+	}
+	p, err := s.getArchivePointer(ctx, aggId, aggType)
+	if err != nil {
+		if cgerrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if p.revision <= after {
+		return nil, nil
+	}
+	return s.readSegment(ctx, p.segmentKey)
+}
+
+// withArchived prepends given stored events of the aggregate with its archived events with the revision greater than after,
+// and matching the filter.
+func (s *storage) withArchived(ctx context.Context, aggId, aggType string, after int64, match func(e *es.Event) bool, events []*es.Event) ([]*es.Event, error) {
+	seg, err := s.archivedSegment(ctx, aggId, aggType, after)
+	if err != nil || seg == nil {
+		return events, err
+	}
+	var archived []*es.Event
+	for _, e := range seg.Events {
+		if e.Revision > after && (match == nil || match(e)) {
+			archived = append(archived, e)
+		}
+	}
+	return append(archived, events...), nil
+}
+
+// archivedSnapshot gets the latest archived snapshot of the aggregate matching the filter.
+// If there is no such snapshot, the not found error is returned.
+func (s *storage) archivedSnapshot(ctx context.Context, aggId, aggType string, match func(snap *es.Snapshot) bool) (*es.Snapshot, error) {
+	seg, err := s.archivedSegment(ctx, aggId, aggType, 0)
+	if err != nil {
+		return nil, err
+	}
+	if seg != nil {
+		for i := len(seg.Snapshots) - 1; i >= 0; i-- {
+			if match(seg.Snapshots[i]) {
+				return seg.Snapshots[i], nil
+			}
+		}
+	}
+	return nil, cgerrors.ErrNotFound("snapshot not found")
+}
+
+// checkArchived checks if the events don't have the revisions already archived.
+// The revision conflicts with the archived events are reported with the already exists error.
+func (s *storage) checkArchived(ctx context.Context, events []*es.Event) error {
+	if s.cfg.ArchiveTable == "" {
+		return nil
+	}
+	checked := map[aggregateKey]struct{}{}
+	for _, e := range events {
+		key := aggregateKey{id: e.AggregateId, typ: e.AggregateType}
+		if _, ok := checked[key]; ok {
+			continue
+		}
+		checked[key] = struct{}{}
+		p, err := s.getArchivePointer(ctx, e.AggregateId, e.AggregateType)
+		if err != nil {
+			if cgerrors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if e.Revision <= p.revision {
+			return cgerrors.ErrAlreadyExists("event revision already exists")
+		}
+	}
+	return nil
+}
+
+type aggregateKey struct {
+	id, typ string
+}
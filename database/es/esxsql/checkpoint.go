@@ -0,0 +1,81 @@
+package esxsql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es/esproj"
+	"github.com/kucjac/cleango/database/xsql"
+)
+
+// Compile time check if CheckpointStore implements esproj.CheckpointStore interface.
+var _ esproj.CheckpointStore = (*CheckpointStore)(nil)
+
+// NewCheckpointStore creates a new projection checkpoint store based on the table defined in the config.
+func NewCheckpointStore(conn xsql.DB, cfg *Config) (*CheckpointStore, error) {
+	if cfg.CheckpointTable == "" {
+		return nil, cgerrors.ErrInternal("no projection checkpoint table name provided")
+	}
+	table := cfg.checkpointTableName()
+	return &CheckpointStore{
+		conn:             conn,
+		getCheckpoint:    conn.Rebind(fmt.Sprintf(getCheckpointQuery, table)),
+		updateCheckpoint: conn.Rebind(fmt.Sprintf(updateCheckpointQuery, table)),
+		insertCheckpoint: conn.Rebind(fmt.Sprintf(insertCheckpointQuery, table)),
+		deleteCheckpoint: conn.Rebind(fmt.Sprintf(deleteCheckpointQuery, table)),
+	}, nil
+}
+
+// CheckpointStore is the implementation of the esproj.CheckpointStore for the xsql driver.
+type CheckpointStore struct {
+	conn             xsql.DB
+	getCheckpoint    string
+	updateCheckpoint string
+	insertCheckpoint string
+	deleteCheckpoint string
+}
+
+// GetCheckpoint gets the checkpoint of given projection.
+// Implements esproj.CheckpointStore interface.
+func (c *CheckpointStore) GetCheckpoint(ctx context.Context, projection string) (*esproj.Checkpoint, error) {
+	cp := esproj.Checkpoint{Projection: projection}
+	var updatedAt int64
+	if err := c.conn.QueryRowContext(ctx, c.getCheckpoint, projection).Scan(&cp.Position, &updatedAt); err != nil {
+		if cgerrors.Is(err, sql.ErrNoRows) {
+			return nil, cgerrors.ErrNotFoundf("checkpoint of projection: %s not found", projection)
+		}
+		return nil, cgerrors.New("", err.Error(), c.conn.ErrorCode(err))
+	}
+	cp.UpdatedAt = time.Unix(0, updatedAt).UTC()
+	return &cp, nil
+}
+
+// SaveCheckpoint inserts or updates the checkpoint of the projection.
+// Implements esproj.CheckpointStore interface.
+func (c *CheckpointStore) SaveCheckpoint(ctx context.Context, checkpoint *esproj.Checkpoint) error {
+	// projection_name, position, updated_at
+	updatedAt := checkpoint.UpdatedAt.UnixNano()
+	res, err := c.conn.ExecContext(ctx, c.updateCheckpoint, checkpoint.Position, updatedAt, checkpoint.Projection)
+	if err != nil {
+		return cgerrors.New("", err.Error(), c.conn.ErrorCode(err))
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		return nil
+	}
+	if _, err = c.conn.ExecContext(ctx, c.insertCheckpoint, checkpoint.Projection, checkpoint.Position, updatedAt); err != nil {
+		return cgerrors.New("", err.Error(), c.conn.ErrorCode(err))
+	}
+	return nil
+}
+
+// ResetCheckpoint removes the checkpoint of given projection.
+// Implements esproj.CheckpointStore interface.
+func (c *CheckpointStore) ResetCheckpoint(ctx context.Context, projection string) error {
+	if _, err := c.conn.ExecContext(ctx, c.deleteCheckpoint, projection); err != nil {
+		return cgerrors.New("", err.Error(), c.conn.ErrorCode(err))
+	}
+	return nil
+}
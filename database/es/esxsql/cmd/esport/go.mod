@@ -0,0 +1,12 @@
+module github.com/kucjac/cleango/database/es/esxsql/cmd/esport
+
+go 1.18
+
+require (
+	github.com/kucjac/cleango v0.1.0
+	github.com/kucjac/cleango/database/es/esxsql v0.1.0
+	github.com/kucjac/cleango/database/xpq v0.1.0
+	github.com/kucjac/cleango/database/xsql v0.1.0
+	github.com/lib/pq v1.10.4
+	gocloud.dev v0.24.0
+)
@@ -0,0 +1,153 @@
+// Command esport exports and imports the content of the esxsql event store in the esport stream format.
+//
+// Usage:
+//
+//	esport export -uri postgres://... [-schema name] [-types a,b] [-file out.ndjson] [-archive-table name -archive-bucket file:///path]
+//	esport import -uri postgres://... [-schema name] [-types a,b] [-file in.ndjson] [-batch 100]
+//
+// If the file is not provided, the stream is written to the standard output, or read from the standard input.
+// The archived event streams are exported from the archive bucket, which needs to be provided along with the archive table.
+// The import is run within a single transaction, which is rolled back if the stream is corrupted.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esport"
+	"github.com/kucjac/cleango/database/es/esxsql"
+	"github.com/kucjac/cleango/database/xpq"
+	"github.com/kucjac/cleango/database/xsql"
+	"github.com/kucjac/cleango/xblob"
+	"gocloud.dev/blob"
+	_ "gocloud.dev/blob/fileblob"
+)
+
+func main() {
+	if err := run(context.Background(), os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "esport:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected export or import command")
+	}
+	cmd := args[0]
+	if cmd != "export" && cmd != "import" {
+		return fmt.Errorf("unknown command: %s", cmd)
+	}
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	var (
+		uri    = fs.String("uri", os.Getenv("ES_DATABASE_URI"), "postgres database connection uri")
+		schema = fs.String("schema", "", "event store schema name")
+		types  = fs.String("types", "", "comma separated aggregate types filter")
+		file   = fs.String("file", "", "stream file path, standard input or output if empty")
+		batch  = fs.Int("batch", 100, "import batch size")
+
+		archiveTable  = fs.String("archive-table", "", "archive pointers table name, if the event streams are archived")
+		archiveBucket = fs.String("archive-bucket", "", "archive bucket url, i.e. file:///path")
+	)
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *uri == "" {
+		return fmt.Errorf("database uri is required")
+	}
+	if (*archiveTable == "") != (*archiveBucket == "") {
+		return fmt.Errorf("archive table and archive bucket need to be provided together")
+	}
+	var aggTypes []string
+	if *types != "" {
+		aggTypes = strings.Split(*types, ",")
+	}
+
+	conn, err := xsql.Connect(xpq.NewDriver(), *uri)
+	if err != nil {
+		return err
+	}
+	cfg := esxsql.DefaultConfig()
+	if *schema != "" {
+		cfg.SchemaName = *schema
+	}
+	cfg.ArchiveTable = *archiveTable
+	storage, err := esxsql.New(conn, cfg)
+	if err != nil {
+		return err
+	}
+	if *archiveBucket != "" {
+		bucket, err := blob.OpenBucket(ctx, *archiveBucket)
+		if err != nil {
+			return err
+		}
+		defer bucket.Close()
+		storage = storage.WithArchive(xblob.Wrap(bucket))
+	}
+
+	var stats *esport.Stats
+	if cmd == "export" {
+		w := io.Writer(os.Stdout)
+		if *file != "" {
+			f, err := os.Create(*file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		opts := esport.DefaultExportOptions()
+		opts.AggregateTypes = aggTypes
+		if stats, err = exportTx(ctx, w, storage, opts); err != nil {
+			return err
+		}
+	} else {
+		r := io.Reader(os.Stdin)
+		if *file != "" {
+			f, err := os.Open(*file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		opts := &esport.ImportOptions{AggregateTypes: aggTypes, BatchSize: *batch}
+		if stats, err = importTx(ctx, r, storage, opts); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%sed %d events, %d snapshots, %d aggregates\n", cmd, stats.Events, stats.Snapshots, stats.Aggregates)
+	return nil
+}
+
+// exportTx exports the storage content within a transaction, so that the stream is consistent.
+func exportTx(ctx context.Context, w io.Writer, s es.Storage, opts *esport.ExportOptions) (*esport.Stats, error) {
+	tx, err := s.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	return esport.Export(ctx, w, tx, opts)
+}
+
+// importTx imports the stream within a transaction, which is committed only if the whole stream is verified.
+func importTx(ctx context.Context, r io.Reader, s es.Storage, opts *esport.ImportOptions) (*esport.Stats, error) {
+	tx, err := s.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := esport.Import(ctx, r, tx, opts)
+	if err != nil {
+		tx.Rollback(ctx)
+		return nil, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
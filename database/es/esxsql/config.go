@@ -1,7 +1,7 @@
 package esxsql
 
 import (
-	"strings"
+	"time"
 
 	"github.com/kucjac/cleango/cgerrors"
 	"github.com/kucjac/cleango/ddd/events/eventstate"
@@ -17,16 +17,41 @@ type Config struct {
 	AggregateTypes      []string
 	EventState          *EventStateConfig
 	WorkersCount        int
+	// FollowInterval is the interval between the queries for new events done by the streams in follow mode.
+	// If not set, the streams query for new events every second.
+	FollowInterval time.Duration
+	// StreamGapTimeout guards the event streams against skipping the events of the transactions committed out of order.
+	// The event ids are assigned on insert, thus a transaction could commit the event with a lower id after an event
+	// with a higher id is already streamed. If set, the streams don't advance past a gap in the event ids until it is
+	// filled, or it is older than the timeout - i.e. left by a rolled back transaction or removed by the archiver.
+	// The gap age is taken from the time the stream first saw it and the timestamp of the event following it.
+	// The streams which don't follow wait for such a gap to time out before they are closed.
+	// The transactions taking longer than the timeout still could be skipped. If zero, the gaps are not guarded.
+	StreamGapTimeout time.Duration
+	// CheckpointTable is the table of the esproj projection checkpoints. It is migrated only if provided.
+	CheckpointTable string
+	// OutboxTable is the table of the transactional outbox. If provided, the saved events are written to the outbox
+	// within the same transaction, so that they could be relayed to the pubsub topics by the OutboxRelay.
+	OutboxTable string
+	// KeyTable is the table of the escrypto data keys of the subjects. It is migrated only if provided.
+	KeyTable string
+	// ArchiveTable is the table of the pointers to the event stream segments moved to the blob bucket by the Archiver.
+	// If provided, the archived streams are transparently read back from the bucket set with the Storage.WithArchive.
+	ArchiveTable string
+	// ReservationTable is the table of the unique values reserved by the aggregates. If provided, the es.ReservationChange
+	// of the saved events are applied on this table within the same transaction.
+	ReservationTable string
 }
 
 // DefaultConfig creates a new default config.
 func DefaultConfig(aggregateTypes ...string) *Config {
 	return &Config{
-		EventTable:     "event",
-		SnapshotTable:  "snapshot",
-		AggregateTable: "aggregate",
-		WorkersCount:   10,
-		AggregateTypes: aggregateTypes,
+		EventTable:       "event",
+		SnapshotTable:    "snapshot",
+		AggregateTable:   "aggregate",
+		WorkersCount:     10,
+		AggregateTypes:   aggregateTypes,
+		StreamGapTimeout: defaultStreamGapTimeout,
 	}
 }
 
@@ -41,6 +66,9 @@ func (c *Config) Validate() error {
 	if c.AggregateTable == "" {
 		return cgerrors.ErrInternalf("no aggregate table name provided")
 	}
+	if c.StreamGapTimeout < 0 {
+		return cgerrors.ErrInternal("stream gap timeout cannot be negative")
+	}
 	// Validate event state inputs.
 	if c.EventState != nil {
 		if err := c.EventState.Validate(); err != nil {
@@ -56,73 +84,65 @@ func (c *Config) WithEventState(config EventStateConfig) *Config {
 	return c
 }
 
-func (c *Config) eventTableName() string {
-	sb := strings.Builder{}
-	if c.SchemaName != "" {
-		sb.WriteString(c.SchemaName)
-		sb.WriteRune('.')
+// tableName gets given table name qualified with the schema name, if it is set.
+func (c *Config) tableName(table string) string {
+	if c.SchemaName == "" {
+		return table
 	}
-	sb.WriteString(c.EventTable)
-	return sb.String()
+	return c.SchemaName + "." + table
+}
+
+func (c *Config) eventTableName() string {
+	return c.tableName(c.EventTable)
 }
 
 func (c *Config) snapshotTableName() string {
-	sb := strings.Builder{}
-	if c.SchemaName != "" {
-		sb.WriteString(c.SchemaName)
-		sb.WriteRune('.')
-	}
-	sb.WriteString(c.SnapshotTable)
-	return sb.String()
+	return c.tableName(c.SnapshotTable)
 }
 
 func (c *Config) aggregateTableName() string {
-	sb := strings.Builder{}
-	if c.SchemaName != "" {
-		sb.WriteString(c.SchemaName)
-		sb.WriteRune('.')
-	}
-	sb.WriteString(c.AggregateTable)
-	return sb.String()
+	return c.tableName(c.AggregateTable)
+}
+
+func (c *Config) checkpointTableName() string {
+	return c.tableName(c.CheckpointTable)
+}
+
+func (c *Config) outboxTableName() string {
+	return c.tableName(c.OutboxTable)
+}
+
+func (c *Config) keyTableName() string {
+	return c.tableName(c.KeyTable)
+}
+
+func (c *Config) archiveTableName() string {
+	return c.tableName(c.ArchiveTable)
+}
+
+func (c *Config) reservationTableName() string {
+	return c.tableName(c.ReservationTable)
 }
 
 func (c *Config) eventHandleFailureTableName() string {
 	if c.EventState == nil {
 		return ""
 	}
-	sb := strings.Builder{}
-	if c.SchemaName != "" {
-		sb.WriteString(c.SchemaName)
-		sb.WriteRune('.')
-	}
-	sb.WriteString(c.EventState.HandleFailureTable)
-	return sb.String()
+	return c.tableName(c.EventState.HandleFailureTable)
 }
 
 func (c *Config) eventStateTableName() string {
 	if c.EventState == nil {
 		return ""
 	}
-	sb := strings.Builder{}
-	if c.SchemaName != "" {
-		sb.WriteString(c.SchemaName)
-		sb.WriteRune('.')
-	}
-	sb.WriteString(c.EventState.EventStateTable)
-	return sb.String()
+	return c.tableName(c.EventState.EventStateTable)
 }
 
 func (c *Config) handlerTableName() string {
 	if c.EventState == nil {
 		return ""
 	}
-	sb := strings.Builder{}
-	if c.SchemaName != "" {
-		sb.WriteString(c.SchemaName)
-		sb.WriteRune('.')
-	}
-	sb.WriteString(c.EventState.HandlerTable)
-	return sb.String()
+	return c.tableName(c.EventState.HandlerTable)
 }
 
 // EventStateConfig is a configuration for the event state part.
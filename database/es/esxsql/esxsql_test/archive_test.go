@@ -0,0 +1,188 @@
+package esxsql_tst
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gocloud.dev/blob/memblob"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esxsql"
+	"github.com/kucjac/cleango/xblob"
+)
+
+func TestPostgresArchive(t *testing.T) {
+	ctx := context.Background()
+	config := esxsql.DefaultConfig()
+	config.SchemaName = strings.ReplaceAll(esxsql.ToSnakeCase(t.Name()), "/", "_")
+	config.ArchiveTable = "archive"
+	store, err := esxsql.New(testPostgresConn(t), config)
+	if err != nil {
+		t.Fatalf("creating esxsql storage failed: %v", err)
+	}
+	bucket := xblob.Wrap(memblob.OpenBucket(nil))
+	tx, cf := testTx(t, store.WithArchive(bucket))
+	defer cf()
+
+	if err = tx.SaveEvents(ctx, []*es.Event{e1.Copy(), e2.Copy(), e3.Copy()}); err != nil {
+		t.Fatalf("saving events failed: %v", err)
+	}
+	if err = tx.SaveSnapshot(ctx, &es.Snapshot{AggregateId: aggId, AggregateType: aggType, AggregateVersion: 1, Revision: 2, Timestamp: e2.Timestamp, SnapshotData: []byte(`{}`)}); err != nil {
+		t.Fatalf("saving snapshot failed: %v", err)
+	}
+
+	// The stream of the first aggregate is closed by the other event type.
+	archiver, err := esxsql.NewArchiver(tx, &esxsql.ArchiverConfig{ClosedEventTypes: []string{otherEventType}, BatchSize: 10, KeyPrefix: "es"})
+	if err != nil {
+		t.Fatalf("creating archiver failed: %v", err)
+	}
+	n, err := archiver.Archive(ctx)
+	if err != nil {
+		t.Fatalf("archiving failed: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected a single archived stream, but archived: %d", n)
+	}
+
+	keys := func() []string {
+		var keys []string
+		it := bucket.List(nil)
+		for {
+			obj, err := it.Next(ctx)
+			if err != nil {
+				return keys
+			}
+			keys = append(keys, obj.Key)
+		}
+	}
+	if k := keys(); len(k) != 1 {
+		t.Fatalf("expected a single segment in the bucket, but got: %v", k)
+	}
+
+	t.Run("Load", func(t *testing.T) {
+		events, err := tx.ListEvents(ctx, aggId, aggType)
+		if err != nil {
+			t.Fatalf("listing events failed: %v", err)
+		}
+		if len(events) != 2 {
+			t.Fatalf("expected 2 archived events, but got: %d", len(events))
+		}
+		compareEvents(t, events[0], &e1, 0)
+		compareEvents(t, events[1], &e2, 1)
+
+		if events, err = tx.ListEventsAfterRevision(ctx, aggId, aggType, 1); err != nil || len(events) != 1 {
+			t.Errorf("expected single event after revision, got: %d, err: %v", len(events), err)
+		}
+		snap, err := tx.GetSnapshot(ctx, aggId, aggType, 1)
+		if err != nil {
+			t.Fatalf("getting archived snapshot failed: %v", err)
+		}
+		if snap.Revision != 2 {
+			t.Errorf("expected archived snapshot at revision 2, but is: %d", snap.Revision)
+		}
+		if _, err = tx.GetSnapshotAtRevision(ctx, aggId, aggType, 1, 1); !cgerrors.IsNotFound(err) {
+			t.Errorf("expected not found snapshot at revision 1, but got: %v", err)
+		}
+
+		// The archived events are not queried across the aggregates.
+		queried, err := tx.QueryEvents(ctx, &es.EventQuery{})
+		if err != nil {
+			t.Fatalf("querying events failed: %v", err)
+		}
+		if len(queried) != 1 || queried[0].EventId != e3.EventId {
+			t.Errorf("expected only not archived events to be queried, but got: %d", len(queried))
+		}
+	})
+
+	t.Run("Append", func(t *testing.T) {
+		conflicting := e5.Copy()
+		conflicting.Revision = 2
+		if err := tx.SaveEvents(ctx, []*es.Event{conflicting}); !cgerrors.IsAlreadyExists(err) {
+			t.Fatalf("expected already exists error on archived revision, but got: %v", err)
+		}
+		if err := tx.SaveEvents(ctx, []*es.Event{e5.Copy()}); err != nil {
+			t.Fatalf("saving event after archived ones failed: %v", err)
+		}
+		events, err := tx.ListEvents(ctx, aggId, aggType)
+		if err != nil {
+			t.Fatalf("listing events failed: %v", err)
+		}
+		if len(events) != 3 || events[2].EventId != e5.EventId {
+			t.Fatalf("expected archived events followed by the stored one, but got: %d", len(events))
+		}
+
+		// The stream is archived again, and its segment replaces the previous one.
+		n, err := archiver.Archive(ctx)
+		if err != nil || n != 1 {
+			t.Fatalf("expected a single archived stream, archived: %d, err: %v", n, err)
+		}
+		if k := keys(); len(k) != 1 || !strings.HasSuffix(k[0], "3.seg.gz") {
+			t.Fatalf("expected a single replaced segment in the bucket, but got: %v", k)
+		}
+		if events, err = tx.ListEvents(ctx, aggId, aggType); err != nil || len(events) != 3 {
+			t.Errorf("expected 3 archived events, got: %d, err: %v", len(events), err)
+		}
+	})
+}
+
+func TestPostgresArchivePurge(t *testing.T) {
+	ctx := context.Background()
+	config := esxsql.DefaultConfig()
+	config.SchemaName = strings.ReplaceAll(esxsql.ToSnakeCase(t.Name()), "/", "_")
+	config.ArchiveTable = "archive"
+	store, err := esxsql.New(testPostgresConn(t), config)
+	if err != nil {
+		t.Fatalf("creating esxsql storage failed: %v", err)
+	}
+	bucket := xblob.Wrap(memblob.OpenBucket(nil))
+	tx, cf := testTx(t, store.WithArchive(bucket))
+	defer cf()
+
+	tombstone := func(eventId, aggId string, revision int64) *es.Event {
+		return &es.Event{EventId: eventId, EventType: es.TombstoneEventType, AggregateType: aggType, AggregateId: aggId, Timestamp: now(), Revision: revision}
+	}
+	// The first aggregate is archived before it is deleted, and the second one along with its tombstone.
+	if err = tx.SaveEvents(ctx, []*es.Event{e1.Copy(), e2.Copy(), e3.Copy()}); err != nil {
+		t.Fatalf("saving events failed: %v", err)
+	}
+	archiver, err := esxsql.NewArchiver(tx, &esxsql.ArchiverConfig{ClosedEventTypes: []string{otherEventType}, BatchSize: 10, KeyPrefix: "es"})
+	if err != nil {
+		t.Fatalf("creating archiver failed: %v", err)
+	}
+	if n, err := archiver.Archive(ctx); err != nil || n != 1 {
+		t.Fatalf("expected a single archived stream, archived: %d, err: %v", n, err)
+	}
+	if err = tx.SaveEvents(ctx, []*es.Event{
+		tombstone("5e2b8d4f-1a7c-4f3e-9b6d-0c8a2e4f6b13", aggId, 3),
+		tombstone("a9c3e5f7-2b4d-4d6f-8a1c-3e5b7d9f1a24", agg2ID, 2),
+	}); err != nil {
+		t.Fatalf("saving tombstones failed: %v", err)
+	}
+	archiver, err = esxsql.NewArchiver(tx, &esxsql.ArchiverConfig{ClosedEventTypes: []string{es.TombstoneEventType}, AggregateTypes: []string{aggType}, BatchSize: 1, KeyPrefix: "es"})
+	if err != nil {
+		t.Fatalf("creating archiver failed: %v", err)
+	}
+	// Only the first of the tombstoned streams is archived - the other keeps its tombstone in the event table.
+	if n, err := archiver.Archive(ctx); err != nil || n != 1 {
+		t.Fatalf("expected a single archived stream, archived: %d, err: %v", n, err)
+	}
+
+	n, err := tx.(*esxsql.Transaction).PurgeDeleted(ctx, 0)
+	if err != nil {
+		t.Fatalf("purging deleted aggregates failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected both archived aggregates to be purged, but purged: %d", n)
+	}
+	for _, id := range []string{aggId, agg2ID} {
+		if events, err := tx.ListEvents(ctx, id, aggType); err != nil || len(events) != 0 {
+			t.Errorf("expected purged aggregate: %s events to be removed, got: %d, err: %v", id, len(events), err)
+		}
+	}
+	it := bucket.List(nil)
+	if obj, err := it.Next(ctx); err == nil {
+		t.Errorf("expected purged segments to be deleted, but found: %s", obj.Key)
+	}
+}
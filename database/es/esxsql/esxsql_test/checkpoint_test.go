@@ -0,0 +1,60 @@
+package esxsql_tst
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es/esproj"
+	"github.com/kucjac/cleango/database/es/esxsql"
+	"github.com/kucjac/cleango/database/xsql"
+)
+
+func TestPostgresCheckpointStore(t *testing.T) {
+	ctx := context.Background()
+	config := esxsql.DefaultConfig()
+	config.SchemaName = esxsql.ToSnakeCase(t.Name())
+	config.CheckpointTable = "projection_checkpoint"
+	store, err := esxsql.New(testPostgresConn(t), config)
+	if err != nil {
+		t.Fatalf("creating esxsql storage failed: %v", err)
+	}
+	tx, cf := testTx(t, store)
+	defer cf()
+
+	var txc *xsql.Tx
+	if err = tx.As(&txc); err != nil {
+		t.Fatalf("getting tx conn failed: %v", err)
+	}
+	cs, err := esxsql.NewCheckpointStore(txc, config)
+	if err != nil {
+		t.Fatalf("creating checkpoint store failed: %v", err)
+	}
+
+	const name = "test_projection"
+	if _, err = cs.GetCheckpoint(ctx, name); !cgerrors.IsNotFound(err) {
+		t.Fatalf("expected not found error but got: %v", err)
+	}
+
+	for _, position := range []int64{10, 25} {
+		err = cs.SaveCheckpoint(ctx, &esproj.Checkpoint{Projection: name, Position: position, UpdatedAt: time.Now()})
+		if err != nil {
+			t.Fatalf("saving checkpoint failed: %v", err)
+		}
+		cp, err := cs.GetCheckpoint(ctx, name)
+		if err != nil {
+			t.Fatalf("getting checkpoint failed: %v", err)
+		}
+		if cp.Position != position {
+			t.Errorf("expected position: %d but is: %d", position, cp.Position)
+		}
+	}
+
+	if err = cs.ResetCheckpoint(ctx, name); err != nil {
+		t.Fatalf("resetting checkpoint failed: %v", err)
+	}
+	if _, err = cs.GetCheckpoint(ctx, name); !cgerrors.IsNotFound(err) {
+		t.Errorf("expected not found error after reset but got: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package esxsql_tst
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esstate"
+	"github.com/kucjac/cleango/database/es/estest"
+	"github.com/kucjac/cleango/database/es/esxsql"
+	"github.com/kucjac/cleango/database/xsql"
+)
+
+func TestPostgresConformance(t *testing.T) {
+	estest.TestStorage(t, func(t *testing.T) es.Storage {
+		conn, config := testConformanceSchema(t)
+		s, err := esxsql.New(conn, config)
+		if err != nil {
+			t.Fatalf("creating esxsql storage failed: %v", err)
+		}
+		return s
+	})
+}
+
+func TestPostgresStateConformance(t *testing.T) {
+	estest.TestStateStorage(t, func(t *testing.T) esstate.Storage {
+		conn, config := testConformanceSchema(t, func(c *esxsql.Config) {
+			c.WithEventState(esxsql.DefaultEventStateConfig())
+		})
+		s, err := esxsql.NewStateStorage(conn, config)
+		if err != nil {
+			t.Fatalf("creating esxsql state storage failed: %v", err)
+		}
+		return s
+	})
+}
+
+// testConformanceSchema creates and migrates the schema named after the test, which is dropped on the test cleanup.
+// Contrary to the testTx, the schema is committed, so that the suites are able to run their own transactions.
+func testConformanceSchema(t *testing.T, options ...func(c *esxsql.Config)) (*xsql.Conn, *esxsql.Config) {
+	conn := testPostgresConn(t)
+	config := esxsql.DefaultConfig()
+	config.SchemaName = strings.ReplaceAll(esxsql.ToSnakeCase(t.Name()), "/", "_")
+	config.AggregateTypes = []string{estest.AggregateType, estest.OtherAggregateType}
+	config.FollowInterval = 50 * time.Millisecond
+	for _, option := range options {
+		option(config)
+	}
+
+	if _, err := conn.Exec(fmt.Sprintf("CREATE SCHEMA %s;", config.SchemaName)); err != nil {
+		t.Fatalf("creating schema failed: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := conn.Exec(fmt.Sprintf("DROP SCHEMA %s CASCADE;", config.SchemaName)); err != nil {
+			t.Errorf("dropping schema failed: %v", err)
+		}
+	})
+	if err := esxsql.Migrate(conn, config); err != nil {
+		t.Fatalf("migrating failed: %v", err)
+	}
+	return conn, config
+}
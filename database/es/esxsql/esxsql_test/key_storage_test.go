@@ -0,0 +1,58 @@
+package esxsql_tst
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es/esxsql"
+	"github.com/kucjac/cleango/database/xsql"
+)
+
+func TestPostgresKeyStorage(t *testing.T) {
+	ctx := context.Background()
+	config := esxsql.DefaultConfig()
+	config.SchemaName = strings.ReplaceAll(esxsql.ToSnakeCase(t.Name()), "/", "_")
+	config.KeyTable = "data_key"
+	store, err := esxsql.New(testPostgresConn(t), config)
+	if err != nil {
+		t.Fatalf("creating esxsql storage failed: %v", err)
+	}
+	tx, cf := testTx(t, store)
+	defer cf()
+
+	var txc *xsql.Tx
+	if err = tx.As(&txc); err != nil {
+		t.Fatalf("getting tx conn failed: %v", err)
+	}
+	cfg := store.Config()
+	ks, err := esxsql.NewKeyStorage(txc, &cfg)
+	if err != nil {
+		t.Fatalf("creating key storage failed: %v", err)
+	}
+
+	const subject = "b1d3f5a7-9c2e-4b6d-8f0a-3c5e7a9b1d24"
+	if _, err = ks.GetDataKey(ctx, subject); !cgerrors.IsNotFound(err) {
+		t.Fatalf("expected not found error but got: %v", err)
+	}
+	key := []byte("encrypted-data-key")
+	if err = ks.SaveDataKey(ctx, subject, key); err != nil {
+		t.Fatalf("saving data key failed: %v", err)
+	}
+	got, err := ks.GetDataKey(ctx, subject)
+	if err != nil {
+		t.Fatalf("getting data key failed: %v", err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Errorf("expected data key: %q but is: %q", key, got)
+	}
+
+	if err = ks.DeleteDataKey(ctx, subject); err != nil {
+		t.Fatalf("deleting data key failed: %v", err)
+	}
+	if _, err = ks.GetDataKey(ctx, subject); !cgerrors.IsNotFound(err) {
+		t.Errorf("expected not found error after delete but got: %v", err)
+	}
+}
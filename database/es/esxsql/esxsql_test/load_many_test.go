@@ -0,0 +1,61 @@
+package esxsql_tst
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esxsql"
+)
+
+func TestPostgresLoadMany(t *testing.T) {
+	ctx := context.Background()
+	config := esxsql.DefaultConfig()
+	config.SchemaName = strings.ReplaceAll(esxsql.ToSnakeCase(t.Name()), "/", "_")
+	store, err := esxsql.New(testPostgresConn(t), config)
+	if err != nil {
+		t.Fatalf("creating esxsql storage failed: %v", err)
+	}
+	tx, cf := testTx(t, store)
+	defer cf()
+
+	if err = tx.SaveEvents(ctx, []*es.Event{e1.Copy(), e2.Copy(), e3.Copy(), e4.Copy(), e5.Copy()}); err != nil {
+		t.Fatalf("saving events failed: %v", err)
+	}
+	for _, snap := range []*es.Snapshot{
+		{AggregateId: aggId, AggregateType: aggType, AggregateVersion: 1, Revision: 1, Timestamp: e1.Timestamp, SnapshotData: []byte(`{}`)},
+		{AggregateId: aggId, AggregateType: aggType, AggregateVersion: 1, Revision: 2, Timestamp: e2.Timestamp, SnapshotData: []byte(`{}`)},
+		{AggregateId: agg2ID, AggregateType: aggType, AggregateVersion: 2, Revision: 1, Timestamp: e3.Timestamp, SnapshotData: []byte(`{}`)},
+	} {
+		if err = tx.SaveSnapshot(ctx, snap); err != nil {
+			t.Fatalf("saving snapshot failed: %v", err)
+		}
+	}
+
+	t.Run("Snapshots", func(t *testing.T) {
+		snapshots, err := tx.ListLatestSnapshots(ctx, aggType, 1, []string{aggId, agg2ID, e4.AggregateId})
+		if err != nil {
+			t.Fatalf("listing latest snapshots failed: %v", err)
+		}
+		if len(snapshots) != 1 {
+			t.Fatalf("expected a single snapshot of given version, but got: %d", len(snapshots))
+		}
+		if snapshots[0].AggregateId != aggId || snapshots[0].Revision != 2 {
+			t.Errorf("expected the latest snapshot of the first aggregate, but got: %s at revision: %d", snapshots[0].AggregateId, snapshots[0].Revision)
+		}
+	})
+
+	t.Run("Events", func(t *testing.T) {
+		events, err := tx.ListEventsAfterRevisions(ctx, aggType, map[string]int64{aggId: 2, agg2ID: 0, e4.AggregateId: 1})
+		if err != nil {
+			t.Fatalf("listing events after revisions failed: %v", err)
+		}
+		if len(events) != 2 {
+			t.Fatalf("expected 2 events, but got: %d", len(events))
+		}
+		// The events are ordered by the aggregate id.
+		compareEvents(t, events[0], &e5, 0)
+		compareEvents(t, events[1], &e3, 1)
+	})
+}
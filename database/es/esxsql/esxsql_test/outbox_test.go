@@ -0,0 +1,119 @@
+package esxsql_tst
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"gocloud.dev/pubsub"
+
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esxsql"
+	"github.com/kucjac/cleango/database/xsql"
+	"github.com/kucjac/cleango/xpubsub"
+)
+
+// testTopic is the xpubsub.Topic which records the sent messages, and fails to send the events of selected aggregate.
+type testTopic struct {
+	l        sync.Mutex
+	messages []*pubsub.Message
+	failAgg  string
+}
+
+func (t *testTopic) Send(_ context.Context, m *pubsub.Message) error {
+	t.l.Lock()
+	defer t.l.Unlock()
+	if t.failAgg != "" && m.Metadata[esxsql.MessageAggregateIDKey] == t.failAgg {
+		return errors.New("send failed")
+	}
+	t.messages = append(t.messages, m)
+	return nil
+}
+
+func (t *testTopic) Shutdown(context.Context) error  { return nil }
+func (t *testTopic) ErrorAs(error, interface{}) bool { return false }
+func (t *testTopic) As(interface{}) bool             { return false }
+
+func (t *testTopic) sentEventIDs() []string {
+	t.l.Lock()
+	defer t.l.Unlock()
+	ids := make([]string, len(t.messages))
+	for i, m := range t.messages {
+		ids[i] = m.Metadata[esxsql.MessageEventIDKey]
+	}
+	return ids
+}
+
+func TestPostgresOutbox(t *testing.T) {
+	ctx := context.Background()
+	config := esxsql.DefaultConfig()
+	config.SchemaName = strings.ReplaceAll(esxsql.ToSnakeCase(t.Name()), "/", "_")
+	config.OutboxTable = "outbox"
+	store, err := esxsql.New(testPostgresConn(t), config)
+	if err != nil {
+		t.Fatalf("creating esxsql storage failed: %v", err)
+	}
+	tx, cf := testTx(t, store)
+	defer cf()
+
+	events := []*es.Event{e1.Copy(), e3.Copy()}
+	if err = tx.SaveEvents(ctx, events); err != nil {
+		t.Fatalf("saving events failed: %v", err)
+	}
+	if err = tx.SaveEvents(ctx, []*es.Event{e2.Copy()}); err != nil {
+		t.Fatalf("saving events failed: %v", err)
+	}
+
+	var txc *xsql.Tx
+	if err = tx.As(&txc); err != nil {
+		t.Fatalf("getting tx conn failed: %v", err)
+	}
+	cfg := store.Config()
+	relayCfg := esxsql.DefaultOutboxRelayConfig("default")
+	relayCfg.Subjects.EventTypes = map[string]string{otherEventType: "other"}
+	defaultTopic, otherTopic := &testTopic{failAgg: aggId}, &testTopic{}
+	relay, err := esxsql.NewOutboxRelay(txc, &cfg, relayCfg, map[string]xpubsub.Topic{"default": defaultTopic, "other": otherTopic})
+	if err != nil {
+		t.Fatalf("creating outbox relay failed: %v", err)
+	}
+
+	// The first event of the aggregate fails to be sent, thus its second event should be held back.
+	n, err := relay.Relay(ctx)
+	if err == nil {
+		t.Error("expected send error")
+	}
+	if n != 1 {
+		t.Errorf("expected a single delivered event but got: %d", n)
+	}
+	if ids := defaultTopic.sentEventIDs(); len(ids) != 1 || ids[0] != e3.EventId {
+		t.Errorf("unexpected events sent: %v", ids)
+	}
+	if ids := otherTopic.sentEventIDs(); len(ids) != 0 {
+		t.Errorf("no events of the failed aggregate should be sent, but got: %v", ids)
+	}
+
+	defaultTopic.failAgg = ""
+	if n, err = relay.Relay(ctx); err != nil {
+		t.Fatalf("relaying outbox failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected two delivered events but got: %d", n)
+	}
+	if ids := defaultTopic.sentEventIDs(); len(ids) != 2 || ids[1] != e1.EventId {
+		t.Errorf("unexpected events sent: %v", ids)
+	}
+	ids := otherTopic.sentEventIDs()
+	if len(ids) != 1 || ids[0] != e2.EventId {
+		t.Fatalf("unexpected events sent: %v", ids)
+	}
+	if md := otherTopic.messages[0].Metadata; md[esxsql.MessageCorrelationIDKey] != e2.CorrelationId || md["source"] != "test" {
+		t.Errorf("unexpected message metadata: %v", md)
+	}
+
+	// The outbox should be drained.
+	if n, err = relay.Relay(ctx); err != nil || n != 0 {
+		t.Errorf("expected empty outbox, but relayed: %d, err: %v", n, err)
+	}
+}
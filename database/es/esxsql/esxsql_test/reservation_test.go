@@ -0,0 +1,74 @@
+package esxsql_tst
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esxsql"
+)
+
+func TestPostgresReservations(t *testing.T) {
+	ctx := context.Background()
+	config := esxsql.DefaultConfig()
+	config.SchemaName = strings.ReplaceAll(esxsql.ToSnakeCase(t.Name()), "/", "_")
+	config.ReservationTable = "reservation"
+	store, err := esxsql.New(testPostgresConn(t), config)
+	if err != nil {
+		t.Fatalf("creating esxsql storage failed: %v", err)
+	}
+	tx, cf := testTx(t, store)
+	defer cf()
+	rs := tx.(es.ReservationStorage)
+
+	withChanges := func(e *es.Event, changes string) *es.Event {
+		cp := e.Copy()
+		cp.Metadata = map[string]string{es.ReservationsMetadataKey: changes}
+		return cp
+	}
+	const reserve = `[{"op":"reserve","scope":"email","value":"john@example.com"}]`
+
+	if err = tx.SaveEvents(ctx, []*es.Event{withChanges(&e1, reserve)}); err != nil {
+		t.Fatalf("saving events failed: %v", err)
+	}
+	r, err := rs.GetReservation(ctx, "email", "john@example.com")
+	if err != nil {
+		t.Fatalf("getting reservation failed: %v", err)
+	}
+	if r.AggregateID != aggId || r.AggregateType != aggType || r.ReservedAt != e1.Timestamp {
+		t.Errorf("unexpected reservation: %+v", r)
+	}
+
+	// Reserving the value by the same aggregate is a no-op.
+	if err = tx.SaveEvents(ctx, []*es.Event{withChanges(&e2, reserve)}); err != nil {
+		t.Fatalf("saving events failed: %v", err)
+	}
+	if err = tx.SaveEvents(ctx, []*es.Event{withChanges(&e3, reserve)}); !es.IsReservationTaken(err) {
+		t.Fatalf("expected reservation taken error but got: %v", err)
+	}
+
+	const transfer = `[{"op":"transfer","scope":"email","value":"john@example.com","from_aggregate_id":"` + aggId + `","from_aggregate_type":"` + aggType + `"},` +
+		`{"op":"reserve","scope":"username","value":"john"}]`
+	if err = tx.SaveEvents(ctx, []*es.Event{withChanges(&e4, transfer)}); err != nil {
+		t.Fatalf("saving events failed: %v", err)
+	}
+	reservations, err := rs.ListReservations(ctx, e4.AggregateId, aggType)
+	if err != nil {
+		t.Fatalf("listing reservations failed: %v", err)
+	}
+	if len(reservations) != 2 || reservations[0].Scope != "email" || reservations[1].Value != "john" {
+		t.Fatalf("expected transferred and reserved values, but got: %d", len(reservations))
+	}
+
+	const release = `[{"op":"release","scope":"email","value":"john@example.com"}]`
+	released := withChanges(&e4, release)
+	released.EventId, released.Revision = "2f8c4a6e-0b3d-4f7a-9c1e-5a7d3f9b1e64", 2
+	if err = tx.SaveEvents(ctx, []*es.Event{released}); err != nil {
+		t.Fatalf("saving events failed: %v", err)
+	}
+	if _, err = rs.GetReservation(ctx, "email", "john@example.com"); !cgerrors.IsNotFound(err) {
+		t.Errorf("expected released value not to be found, but got: %v", err)
+	}
+}
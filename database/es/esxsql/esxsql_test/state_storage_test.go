@@ -149,3 +149,44 @@ func TestPostgresStateStorage(t *testing.T) {
 	}
 
 }
+
+func TestPostgresPurgeEventStates(t *testing.T) {
+	ctx := context.Background()
+	store := testPostgresStateStore(t)
+	tx, cf := testStateTx(t, store)
+	defer cf()
+
+	tombstone := &es.Event{
+		EventId:       "5b8e2d4f-1a3c-4e6b-8d0f-2c4a6e8b0d13",
+		EventType:     es.TombstoneEventType,
+		AggregateType: aggType,
+		AggregateId:   agg2ID,
+		Timestamp:     now(),
+		Revision:      2,
+	}
+	state := &es.Event{
+		EventId:       "9c1e3a5b-7d2f-4b6a-8e0c-1f3b5d7a9c24",
+		EventType:     "event_state:created",
+		AggregateType: esstate.AggregateType,
+		AggregateId:   e3.EventId,
+		Timestamp:     now(),
+		Revision:      1,
+	}
+	if err := tx.SaveEvents(ctx, []*es.Event{e3.Copy(), tombstone, state}); err != nil {
+		t.Fatalf("saving events failed: %v", err)
+	}
+
+	n, err := tx.(*esxsql.Transaction).PurgeDeleted(ctx, 0)
+	if err != nil {
+		t.Fatalf("purging deleted aggregates failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected a single aggregate to be purged, but purged: %d", n)
+	}
+	if events, err := tx.ListEvents(ctx, e3.EventId, esstate.AggregateType); err != nil || len(events) != 0 {
+		t.Errorf("expected the event state stream of the purged event to be removed, got: %d, err: %v", len(events), err)
+	}
+	if exists, err := tx.AggregateExists(ctx, e3.EventId, esstate.AggregateType); err != nil || exists {
+		t.Errorf("expected the event state aggregate of the purged event to be removed, exists: %v, err: %v", exists, err)
+	}
+}
@@ -151,6 +151,32 @@ func TestPostgresEvents(t *testing.T) {
 		compareEvents(t, e, &e3, -1)
 	})
 
+	t.Run("Until", func(t *testing.T) {
+		store := testPostgresStore(t)
+		tx, cf := testTx(t, store)
+		defer cf()
+
+		if err := tx.SaveEvents(ctx, []*es.Event{e1.Copy(), e2.Copy()}); err != nil {
+			t.Fatalf("saving events failed: %v", err)
+		}
+		events, err := tx.ListEventsUntilRevision(ctx, aggId, aggType, 0, 1)
+		if err != nil {
+			t.Fatalf("listing events until revision failed: %v", err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("expected a single event but got: %d", len(events))
+		}
+		compareEvents(t, events[0], &e1, 0)
+
+		if events, err = tx.ListEventsUntilTimestamp(ctx, aggId, aggType, 1, e2.Timestamp); err != nil {
+			t.Fatalf("listing events until timestamp failed: %v", err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("expected a single event but got: %d", len(events))
+		}
+		compareEvents(t, events[0], &e2, 0)
+	})
+
 	t.Run("AlreadyExists", func(t *testing.T) {
 		store := testPostgresStore(t)
 		tx, cf := testTx(t, store)
@@ -185,8 +211,15 @@ func TestPostgresEvents(t *testing.T) {
 			t.Fatalf("getting event stream failed: %v", err)
 		}
 
-		var i int
+		var (
+			i         int
+			positions []int64
+		)
 		for e := range stream {
+			if len(positions) > 0 && e.Position <= positions[len(positions)-1] {
+				t.Errorf("event at index: %d position: %d is not greater than the previous one", i, e.Position)
+			}
+			positions = append(positions, e.Position)
 			var expected *es.Event
 			switch i {
 			case 0:
@@ -205,9 +238,198 @@ func TestPostgresEvents(t *testing.T) {
 		}
 
 		if i != 5 {
-			t.Errorf("obtained fewer events: %d", i)
+			t.Fatalf("obtained fewer events: %d", i)
+		}
+
+		// Resume the stream after the second event.
+		stream, err = tx.StreamEvents(ctx, &es.StreamEventsRequest{BuffSize: 2, FromPosition: positions[1]})
+		if err != nil {
+			t.Fatalf("getting event stream from position failed: %v", err)
+		}
+		i = 0
+		for e := range stream {
+			if e.Position != positions[i+2] {
+				t.Errorf("event at index: %d expected position: %d but is: %d", i, positions[i+2], e.Position)
+			}
+			i++
+		}
+		if i != 3 {
+			t.Errorf("expected 3 events streamed from position but got: %d", i)
 		}
 	})
+
+	t.Run("Query", func(t *testing.T) {
+		store := testPostgresStore(t)
+		tx, cf := testTx(t, store)
+		defer cf()
+
+		err := tx.SaveEvents(ctx, []*es.Event{&e1, &e2, &e3, &e4, &e5})
+		if err != nil {
+			t.Fatalf("saving events failed: %v", err)
+		}
+
+		events, err := tx.QueryEvents(ctx, &es.EventQuery{EventTypes: []string{"EVENT_TYPE"}, Descending: true, Limit: 2})
+		if err != nil {
+			t.Fatalf("querying events failed: %v", err)
+		}
+		if len(events) != 2 {
+			t.Fatalf("expected 2 events but got: %d", len(events))
+		}
+		compareEvents(t, events[0], &e5, 0)
+		compareEvents(t, events[1], &e4, 1)
+
+		events, err = tx.QueryEvents(ctx, &es.EventQuery{AggregateIDs: []string{aggId}, AfterPosition: events[1].Position, BeforePosition: events[0].Position})
+		if err != nil {
+			t.Fatalf("querying events failed: %v", err)
+		}
+		if len(events) != 0 {
+			t.Errorf("expected no events between the positions but got: %d", len(events))
+		}
+	})
+}
+
+func TestPostgresAggregates(t *testing.T) {
+	ctx := context.Background()
+	store := testPostgresStore(t)
+	tx, cf := testTx(t, store)
+	defer cf()
+
+	if err := tx.SaveEvents(ctx, []*es.Event{&e1, &e2, &e3, &e4, &e5}); err != nil {
+		t.Fatalf("saving events failed: %v", err)
+	}
+
+	exists, err := tx.AggregateExists(ctx, agg2ID, aggType)
+	if err != nil {
+		t.Fatalf("checking aggregate existence failed: %v", err)
+	}
+	if !exists {
+		t.Error("expected aggregate to exist")
+	}
+	if exists, err = tx.AggregateExists(ctx, agg2ID, "OTHER_AGG_TYPE"); err != nil || exists {
+		t.Errorf("expected aggregate to not exist, exists: %v, err: %v", exists, err)
+	}
+
+	count, err := tx.CountAggregates(ctx, aggType)
+	if err != nil {
+		t.Fatalf("counting aggregates failed: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 aggregates but got: %d", count)
+	}
+
+	aggregates, err := tx.ListAggregates(ctx, aggType, 0, 2)
+	if err != nil {
+		t.Fatalf("listing aggregates failed: %v", err)
+	}
+	if len(aggregates) != 2 || aggregates[0].ID != aggId || aggregates[1].ID != agg2ID {
+		t.Fatalf("unexpected aggregates listed: %v", aggregates)
+	}
+	if aggregates, err = tx.ListAggregates(ctx, aggType, aggregates[1].Position, 0); err != nil {
+		t.Fatalf("listing next aggregates failed: %v", err)
+	}
+	if len(aggregates) != 1 || aggregates[0].ID != e4.AggregateId || aggregates[0].InsertedAt != e4.Timestamp {
+		t.Errorf("unexpected next aggregates listed: %v", aggregates)
+	}
+}
+
+func TestPostgresStreamGap(t *testing.T) {
+	ctx := context.Background()
+	conn, config := testConformanceSchema(t)
+	config.StreamGapTimeout = 500 * time.Millisecond
+	store, err := esxsql.New(conn, config)
+	if err != nil {
+		t.Fatalf("creating esxsql storage failed: %v", err)
+	}
+
+	// The rolled back insert leaves a gap in the event ids, followed by the event committed right after it.
+	tx, err := store.BeginTx(ctx)
+	if err != nil {
+		t.Fatalf("starting transaction failed: %v", err)
+	}
+	if err = tx.SaveEvents(ctx, []*es.Event{e1.Copy()}); err != nil {
+		t.Fatalf("saving events failed: %v", err)
+	}
+	if err = tx.Rollback(ctx); err != nil {
+		t.Fatalf("rolling back transaction failed: %v", err)
+	}
+	if err = store.SaveEvents(ctx, []*es.Event{e1.Copy()}); err != nil {
+		t.Fatalf("saving events failed: %v", err)
+	}
+
+	var streamErr error
+	stream, err := store.StreamEvents(ctx, &es.StreamEventsRequest{OnError: func(err error) { streamErr = err }})
+	if err != nil {
+		t.Fatalf("opening stream failed: %v", err)
+	}
+	var streamed []string
+	for e := range stream {
+		streamed = append(streamed, e.EventId)
+	}
+	if streamErr != nil {
+		t.Fatalf("streaming events failed: %v", streamErr)
+	}
+	if len(streamed) != 1 || streamed[0] != e1.EventId {
+		t.Errorf("expected the event following the gap to be streamed, but got: %v", streamed)
+	}
+}
+
+func TestPostgresPurgeDeleted(t *testing.T) {
+	ctx := context.Background()
+	store := testPostgresStore(t)
+	tx, cf := testTx(t, store)
+	defer cf()
+
+	tombstone := &es.Event{
+		EventId:       "d5a3f1b7-2c8e-4a6d-9b0f-7e1c3a5d9f28",
+		EventType:     es.TombstoneEventType,
+		AggregateType: aggType,
+		AggregateId:   agg2ID,
+		Timestamp:     now(),
+		Revision:      2,
+	}
+	if err := tx.SaveEvents(ctx, []*es.Event{e1.Copy(), e3.Copy(), tombstone}); err != nil {
+		t.Fatalf("saving events failed: %v", err)
+	}
+	if err := tx.SaveSnapshot(ctx, &es.Snapshot{AggregateId: agg2ID, AggregateType: aggType, AggregateVersion: 1, Revision: 1, Timestamp: e3.Timestamp}); err != nil {
+		t.Fatalf("saving snapshot failed: %v", err)
+	}
+
+	stream, err := tx.StreamEvents(ctx, &es.StreamEventsRequest{ExcludeDeleted: true})
+	if err != nil {
+		t.Fatalf("opening stream failed: %v", err)
+	}
+	var streamed []string
+	for e := range stream {
+		streamed = append(streamed, e.EventId)
+	}
+	if len(streamed) != 1 || streamed[0] != e1.EventId {
+		t.Errorf("expected only the events of not deleted aggregates to be streamed, but got: %v", streamed)
+	}
+
+	// The tombstone is not old enough to be purged.
+	purger := tx.(*esxsql.Transaction)
+	n, err := purger.PurgeDeleted(ctx, time.Hour)
+	if err != nil || n != 0 {
+		t.Fatalf("expected no aggregates purged, purged: %d, err: %v", n, err)
+	}
+	if n, err = purger.PurgeDeleted(ctx, 0); err != nil {
+		t.Fatalf("purging deleted aggregates failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected a single aggregate to be purged, but purged: %d", n)
+	}
+	if events, err := tx.ListEvents(ctx, agg2ID, aggType); err != nil || len(events) != 0 {
+		t.Errorf("expected purged events to be removed, got: %d, err: %v", len(events), err)
+	}
+	if _, err = tx.GetSnapshot(ctx, agg2ID, aggType, 1); !cgerrors.IsNotFound(err) {
+		t.Errorf("expected purged snapshot to be removed, but got: %v", err)
+	}
+	if exists, err := tx.AggregateExists(ctx, agg2ID, aggType); err != nil || exists {
+		t.Errorf("expected purged aggregate to be removed, exists: %v, err: %v", exists, err)
+	}
+	if exists, err := tx.AggregateExists(ctx, aggId, aggType); err != nil || !exists {
+		t.Errorf("expected other aggregate to be kept, exists: %v, err: %v", exists, err)
+	}
 }
 
 func TestPostgresSnapshots(t *testing.T) {
@@ -266,6 +488,36 @@ func TestPostgresSnapshots(t *testing.T) {
 
 		compareSnapshots(t, taken, snap)
 	})
+
+	t.Run("Historical", func(t *testing.T) {
+		store := testPostgresStore(t)
+
+		tx, cf := testTx(t, store)
+		defer cf()
+		for _, revision := range []int64{1, 3} {
+			snap := &es.Snapshot{AggregateId: aggId, AggregateType: aggType, AggregateVersion: 1, Revision: revision, Timestamp: revision * 100}
+			if err := tx.SaveSnapshot(ctx, snap); err != nil {
+				t.Fatalf("saving snapshot failed: %v", err)
+			}
+		}
+
+		taken, err := tx.GetSnapshotAtRevision(ctx, aggId, aggType, 1, 2)
+		if err != nil {
+			t.Fatalf("getting snapshot at revision failed: %v", err)
+		}
+		if taken.Revision != 1 {
+			t.Errorf("expected snapshot at revision: 1 but is: %d", taken.Revision)
+		}
+		if taken, err = tx.GetSnapshotAtTimestamp(ctx, aggId, aggType, 1, 300); err != nil {
+			t.Fatalf("getting snapshot at timestamp failed: %v", err)
+		}
+		if taken.Revision != 3 {
+			t.Errorf("expected snapshot at revision: 3 but is: %d", taken.Revision)
+		}
+		if _, err = tx.GetSnapshotAtTimestamp(ctx, aggId, aggType, 1, 50); !cgerrors.IsNotFound(err) {
+			t.Errorf("expected not found error but got: %v", err)
+		}
+	})
 }
 
 func compareEvents(t *testing.T, e *es.Event, expectedEvent *es.Event, i int) {
@@ -290,6 +542,32 @@ func compareEvents(t *testing.T, e *es.Event, expectedEvent *es.Event, i int) {
 	if e.Revision != expectedEvent.Revision {
 		t.Errorf("event at index: %d mismatch value of Revision, is: %v, want: %v", i, e.Revision, expectedEvent.Revision)
 	}
+	if e.EventVersion != expectedEvent.EventVersion {
+		t.Errorf("event at index: %d mismatch value of EventVersion, is: %v, want: %v", i, e.EventVersion, expectedEvent.EventVersion)
+	}
+	if !bytes.Equal(e.PreviousHash, expectedEvent.PreviousHash) {
+		t.Errorf("event at index: %d mismatch value of PreviousHash, is: %x, want: %x", i, e.PreviousHash, expectedEvent.PreviousHash)
+	}
+	if !bytes.Equal(e.Hash, expectedEvent.Hash) {
+		t.Errorf("event at index: %d mismatch value of Hash, is: %x, want: %x", i, e.Hash, expectedEvent.Hash)
+	}
+	if e.CorrelationId != expectedEvent.CorrelationId {
+		t.Errorf("event at index: %d mismatch value of CorrelationId, is: %v, want: %v", i, e.CorrelationId, expectedEvent.CorrelationId)
+	}
+	if e.CausationId != expectedEvent.CausationId {
+		t.Errorf("event at index: %d mismatch value of CausationId, is: %v, want: %v", i, e.CausationId, expectedEvent.CausationId)
+	}
+	if e.Actor != expectedEvent.Actor {
+		t.Errorf("event at index: %d mismatch value of Actor, is: %v, want: %v", i, e.Actor, expectedEvent.Actor)
+	}
+	if len(e.Metadata) != len(expectedEvent.Metadata) {
+		t.Errorf("event at index: %d mismatch value of Metadata, is: %v, want: %v", i, e.Metadata, expectedEvent.Metadata)
+	}
+	for k, v := range expectedEvent.Metadata {
+		if e.Metadata[k] != v {
+			t.Errorf("event at index: %d mismatch value of Metadata key: %s, is: %v, want: %v", i, k, e.Metadata[k], v)
+		}
+	}
 }
 
 func compareSnapshots(t *testing.T, s, compare *es.Snapshot) {
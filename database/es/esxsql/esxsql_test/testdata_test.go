@@ -1,6 +1,8 @@
 package esxsql_tst
 
 import (
+	"bytes"
+
 	"github.com/kucjac/cleango/database/es"
 )
 
@@ -32,6 +34,13 @@ var (
 		EventData:     nil,
 		Timestamp:     now(),
 		Revision:      2,
+		EventVersion:  1,
+		Metadata:      map[string]string{"source": "test"},
+		CorrelationId: "8b7b1d3e-4a5d-4f0f-9a43-5f8f4c3c2c11",
+		CausationId:   "0a76941b-08ec-4bb9-bae5-7b8d8f6623b6",
+		Actor:         "test-user",
+		PreviousHash:  bytes.Repeat([]byte{1}, 32),
+		Hash:          bytes.Repeat([]byte{2}, 32),
 	}
 	e3 = es.Event{
 		EventId:       "4cedbacb-3480-4499-b977-f6b0aaaa5ad1",
@@ -1,6 +1,6 @@
 module github.com/kucjac/cleango/database/es/esxsql
 
-go 1.16
+go 1.18
 
 require (
 	github.com/kucjac/cleango v0.1.0
@@ -0,0 +1,68 @@
+package esxsql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es/escrypto"
+	"github.com/kucjac/cleango/database/xsql"
+)
+
+// Compile time check if KeyStorage implements escrypto.KeyStorage interface.
+var _ escrypto.KeyStorage = (*KeyStorage)(nil)
+
+// NewKeyStorage creates a new data key storage based on the key table defined in the config.
+func NewKeyStorage(conn xsql.DB, cfg *Config) (*KeyStorage, error) {
+	if cfg.KeyTable == "" {
+		return nil, cgerrors.ErrInternal("no key table name provided")
+	}
+	table := cfg.keyTableName()
+	return &KeyStorage{
+		conn:          conn,
+		getDataKey:    conn.Rebind(fmt.Sprintf(getDataKeyQuery, table)),
+		insertDataKey: conn.Rebind(fmt.Sprintf(insertDataKeyQuery, table)),
+		deleteDataKey: conn.Rebind(fmt.Sprintf(deleteDataKeyQuery, table)),
+	}, nil
+}
+
+// KeyStorage is the implementation of the escrypto.KeyStorage for the xsql driver.
+type KeyStorage struct {
+	conn          xsql.DB
+	getDataKey    string
+	insertDataKey string
+	deleteDataKey string
+}
+
+// GetDataKey gets the encrypted data key of given subject.
+// Implements escrypto.KeyStorage interface.
+func (k *KeyStorage) GetDataKey(ctx context.Context, subject string) ([]byte, error) {
+	var key []byte
+	if err := k.conn.QueryRowContext(ctx, k.getDataKey, subject).Scan(&key); err != nil {
+		if cgerrors.Is(err, sql.ErrNoRows) {
+			return nil, cgerrors.ErrNotFoundf("data key of subject: %s not found", subject)
+		}
+		return nil, cgerrors.New("", err.Error(), k.conn.ErrorCode(err))
+	}
+	return key, nil
+}
+
+// SaveDataKey stores the encrypted data key of given subject.
+// Implements escrypto.KeyStorage interface.
+func (k *KeyStorage) SaveDataKey(ctx context.Context, subject string, key []byte) error {
+	if _, err := k.conn.ExecContext(ctx, k.insertDataKey, subject, key, time.Now().UTC().UnixNano()); err != nil {
+		return cgerrors.New("", err.Error(), k.conn.ErrorCode(err))
+	}
+	return nil
+}
+
+// DeleteDataKey deletes the data key of given subject.
+// Implements escrypto.KeyStorage interface.
+func (k *KeyStorage) DeleteDataKey(ctx context.Context, subject string) error {
+	if _, err := k.conn.ExecContext(ctx, k.deleteDataKey, subject); err != nil {
+		return cgerrors.New("", err.Error(), k.conn.ErrorCode(err))
+	}
+	return nil
+}
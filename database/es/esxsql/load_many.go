@@ -0,0 +1,139 @@
+package esxsql
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
+)
+
+// ListLatestSnapshots gets the latest snapshots of the aggregates of given type and version with given ids in a single query.
+// The latest archived snapshots are taken for the aggregates with no stored snapshot, if the archive is configured.
+// Implements es.StorageBase interface.
+func (s *storage) ListLatestSnapshots(ctx context.Context, aggType string, aggVersion int64, aggIds []string) ([]*es.Snapshot, error) {
+	if len(aggIds) == 0 {
+		return nil, nil
+	}
+	table := s.cfg.snapshotTableName()
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf(listLatestSnapshotsQuery, table, table))
+	sb.WriteRune('(')
+	values := make([]interface{}, 0, len(aggIds)+2)
+	values = append(values, aggType, aggVersion)
+	for i, id := range aggIds {
+		if i > 0 {
+			sb.WriteRune(',')
+		}
+		sb.WriteRune('?')
+		values = append(values, id)
+	}
+	sb.WriteRune(')')
+	snapshots, err := s.querySnapshots(ctx, s.conn.Rebind(sb.String()), values...)
+	if err != nil || s.cfg.ArchiveTable == "" {
+		return snapshots, err
+	}
+
+	found := make(map[string]struct{}, len(snapshots))
+	for _, snap := range snapshots {
+		found[snap.AggregateId] = struct{}{}
+	}
+	for _, id := range aggIds {
+		if _, ok := found[id]; ok {
+			continue
+		}
+		snap, err := s.archivedSnapshot(ctx, id, aggType, func(snap *es.Snapshot) bool {
+			return snap.AggregateVersion == aggVersion
+		})
+		if err != nil {
+			if cgerrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		snapshots = append(snapshots, snap)
+	}
+	return snapshots, nil
+}
+
+// ListEventsAfterRevisions lists the events of the aggregates of given type with the revision greater than the ones
+// provided in the after map, ordered by the aggregate id and revision. The stored events are taken with a single query,
+// and the archived events are merged, if the archive is configured.
+// Implements es.StorageBase interface.
+func (s *storage) ListEventsAfterRevisions(ctx context.Context, aggType string, after map[string]int64) ([]*es.Event, error) {
+	if len(after) == 0 {
+		return nil, nil
+	}
+	ids := make([]string, 0, len(after))
+	for id := range after {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf(listEventsAfterRevisionsQuery, s.cfg.eventTableName()))
+	values := make([]interface{}, 0, 2*len(ids)+1)
+	values = append(values, aggType)
+	for i, id := range ids {
+		if i > 0 {
+			sb.WriteString(" OR ")
+		}
+		sb.WriteString("(aggregate_id = ? AND revision > ?)")
+		values = append(values, id, after[id])
+	}
+	sb.WriteString(") ORDER BY aggregate_id, revision")
+
+	rows, err := s.conn.QueryContext(ctx, s.conn.Rebind(sb.String()), values...)
+	if err != nil {
+		return nil, cgerrors.New("", err.Error(), s.conn.ErrorCode(err))
+	}
+	defer rows.Close()
+
+	streams := make(map[string][]*es.Event, len(ids))
+	for rows.Next() {
+		e := &es.Event{}
+		if err = rows.Scan(eventScanDest(e)...); err != nil {
+			return nil, cgerrors.ErrInternalf("scanning event row failed: %v", err)
+		}
+		streams[e.AggregateId] = append(streams[e.AggregateId], e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, cgerrors.New("", err.Error(), s.conn.ErrorCode(err))
+	}
+
+	var events []*es.Event
+	for _, id := range ids {
+		stream := streams[id]
+		if s.cfg.ArchiveTable != "" {
+			if stream, err = s.withArchived(ctx, id, aggType, after[id], nil, stream); err != nil {
+				return nil, err
+			}
+		}
+		events = append(events, stream...)
+	}
+	return events, nil
+}
+
+// querySnapshots gets the snapshots returned by given query.
+func (s *storage) querySnapshots(ctx context.Context, query string, args ...interface{}) ([]*es.Snapshot, error) {
+	rows, err := s.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, cgerrors.New("", err.Error(), s.conn.ErrorCode(err))
+	}
+	defer rows.Close()
+
+	var snapshots []*es.Snapshot
+	for rows.Next() {
+		var snap es.Snapshot
+		if err = rows.Scan(&snap.AggregateId, &snap.AggregateType, &snap.AggregateVersion, &snap.Revision, &snap.Timestamp, &snap.SnapshotData); err != nil {
+			return nil, cgerrors.ErrInternalf("scanning snapshot row failed: %v", err)
+		}
+		snapshots = append(snapshots, &snap)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, cgerrors.New("", err.Error(), s.conn.ErrorCode(err))
+	}
+	return snapshots, nil
+}
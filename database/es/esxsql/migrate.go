@@ -110,6 +110,26 @@ func migratePostgresTables(ctx context.Context, conn xsql.DB, cfg *Config) error
 		return err
 	}
 
+	if err = migratePostgresCheckpointTable(ctx, conn, cfg); err != nil {
+		return err
+	}
+
+	if err = migratePostgresOutboxTable(ctx, conn, cfg); err != nil {
+		return err
+	}
+
+	if err = migratePostgresKeyTable(ctx, conn, cfg); err != nil {
+		return err
+	}
+
+	if err = migratePostgresArchiveTable(ctx, conn, cfg); err != nil {
+		return err
+	}
+
+	if err = migratePostgresReservationTable(ctx, conn, cfg); err != nil {
+		return err
+	}
+
 	// If the eventstate config is undefined, no tables should be migrated for the eventstate.
 	if cfg.EventState == nil {
 		return nil
@@ -129,108 +149,197 @@ func migratePostgresTables(ctx context.Context, conn xsql.DB, cfg *Config) error
 	return nil
 }
 
-func migratePostgresSnapshotTable(ctx context.Context, conn xsql.DB, cfg *Config) error {
-	schema := cfg.SchemaName
-	if schema == "" {
-		schema = "public"
+// migratePostgresTable creates the table in given schema with the ddl statement, if the table doesn't exist yet.
+// The ddl is formatted with the schema qualified table name as the first, the table name as the second
+// and given args as the following arguments. It reports whether the table was created.
+func migratePostgresTable(ctx context.Context, conn xsql.DB, schema, table, ddl string, args ...interface{}) (bool, error) {
+	exists, err := postgresTableExists(ctx, conn, schema, table)
+	if err != nil || exists {
+		return false, err
 	}
+	args = append([]interface{}{schema + "." + table, table}, args...)
+	if _, err = conn.ExecContext(ctx, fmt.Sprintf(ddl, args...)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
 
-	exists, err := postgresTableExists(ctx, conn, schema, cfg.SnapshotTable)
-	if err != nil {
-		return err
+// postgresPartitioning gets the primary key and the partitioning clauses of the table, partitioned by given column.
+// The primary key of the partitioned table would need to include the partition column, thus it is not set.
+func postgresPartitioning(partitioned bool, column string) (primaryKey, partition string) {
+	if !partitioned {
+		return " PRIMARY KEY", ""
 	}
-	if exists {
-		return nil
+	return "", " PARTITION BY LIST(" + column + ")"
+}
+
+// postgresSchema gets the schema name of the config tables.
+func postgresSchema(cfg *Config) string {
+	if cfg.SchemaName == "" {
+		return "public"
 	}
+	return cfg.SchemaName
+}
 
-	var sb strings.Builder
-	sb.WriteString("CREATE TABLE ")
-	sb.WriteString(schema)
-	sb.WriteString(".")
-	sb.WriteString(cfg.SnapshotTable)
-	sb.WriteString(" (\n")
-	sb.WriteString("\tid BIGSERIAL NOT NULL PRIMARY KEY,\n")
-	sb.WriteString("\taggregate_id TEXT NOT NULL,\n")
-	sb.WriteString("\taggregate_type TEXT NOT NULL,\n")
-	sb.WriteString("\taggregate_version integer NOT NULL,\n")
-	sb.WriteString("\trevision integer NOT NULL,\n")
-	sb.WriteString("\ttimestamp bigint NOT NULL,\n")
-	sb.WriteString("\tsnapshot_data bytea,\n")
-	sb.WriteString("\tCONSTRAINT ")
-	sb.WriteString(cfg.SnapshotTable)
-	sb.WriteString("_aggregate_revision_uidx UNIQUE(aggregate_id, aggregate_type, revision)\n")
-	sb.WriteString(")")
-
-	_, err = conn.ExecContext(ctx, sb.String())
+const (
+	// language=PostgreSQL
+	postgresSnapshotTableDDL = `CREATE TABLE %[1]s (
+	id BIGSERIAL NOT NULL PRIMARY KEY,
+	aggregate_id TEXT NOT NULL,
+	aggregate_type TEXT NOT NULL,
+	aggregate_version integer NOT NULL,
+	revision integer NOT NULL,
+	timestamp bigint NOT NULL,
+	snapshot_data bytea,
+	CONSTRAINT %[2]s_aggregate_revision_uidx UNIQUE(aggregate_id, aggregate_type, revision)
+)`
+	// language=PostgreSQL
+	postgresAggregateTableDDL = `CREATE TABLE %[1]s (
+	id BIGSERIAL NOT NULL PRIMARY KEY,
+	aggregate_id TEXT NOT NULL,
+	aggregate_type TEXT NOT NULL,
+	inserted_at bigint NOT NULL,
+	CONSTRAINT %[2]s_aggregate_id_aggregate_type_uidx UNIQUE(aggregate_id, aggregate_type)
+)`
+	// language=PostgreSQL
+	postgresCheckpointTableDDL = `CREATE TABLE %[1]s (
+	projection_name TEXT NOT NULL PRIMARY KEY,
+	position bigint NOT NULL,
+	updated_at bigint NOT NULL
+)`
+	// language=PostgreSQL
+	postgresKeyTableDDL = `CREATE TABLE %[1]s (
+	subject TEXT NOT NULL PRIMARY KEY,
+	data_key BYTEA NOT NULL,
+	created_at bigint NOT NULL
+)`
+	// language=PostgreSQL
+	postgresArchiveTableDDL = `CREATE TABLE %[1]s (
+	aggregate_id TEXT NOT NULL,
+	aggregate_type TEXT NOT NULL,
+	segment_key TEXT NOT NULL,
+	revision bigint NOT NULL,
+	archived_at bigint NOT NULL,
+	deleted_at bigint,
+	PRIMARY KEY (aggregate_id, aggregate_type)
+)`
+	// language=PostgreSQL
+	postgresReservationTableDDL = `CREATE TABLE %[1]s (
+	scope TEXT NOT NULL,
+	value TEXT NOT NULL,
+	aggregate_id TEXT NOT NULL,
+	aggregate_type TEXT NOT NULL,
+	reserved_at bigint NOT NULL,
+	PRIMARY KEY (scope, value)
+)`
+	// language=PostgreSQL
+	postgresOutboxTableDDL = `CREATE TABLE %[1]s (
+	id BIGSERIAL NOT NULL PRIMARY KEY,
+	event_id TEXT NOT NULL
+)`
+	// language=PostgreSQL
+	postgresHandlerTableDDL = `CREATE TABLE %[1]s (
+	id BIGSERIAL NOT NULL PRIMARY KEY,
+	handler_name TEXT NOT NULL,
+	event_type TEXT NOT NULL,
+	CONSTRAINT %[2]s_handler_name_event_type_uidx UNIQUE(handler_name, event_type)
+)`
+	// language=PostgreSQL
+	postgresEventStateTableDDL = `CREATE TABLE %[1]s (
+	id BIGSERIAL NOT NULL%[3]s,
+	event_id TEXT NOT NULL,
+	handler_name TEXT NOT NULL,
+	state smallint NOT NULL,
+	timestamp bigint NOT NULL,
+	CONSTRAINT %[2]s_event_id_handler_name_uidx UNIQUE (event_id, handler_name)
+)%[4]s`
+	// language=PostgreSQL
+	postgresEventTableDDL = `CREATE TABLE %[1]s (
+	id BIGSERIAL NOT NULL%[3]s,
+	event_id TEXT NOT NULL,
+	aggregate_id TEXT NOT NULL,
+	aggregate_type TEXT NOT NULL,
+	revision integer NOT NULL,
+	timestamp bigint NOT NULL,
+	event_type TEXT NOT NULL,
+	event_data bytea,
+%[5]s	CONSTRAINT %[2]s_aggregate_revision_uidx UNIQUE (aggregate_id, aggregate_type, revision)
+)%[4]s`
+	// language=PostgreSQL
+	postgresEventHandleFailureTableDDL = `CREATE TABLE %[1]s (
+	id BIGSERIAL NOT NULL PRIMARY KEY,
+	event_id TEXT NOT NULL,
+	handler_name TEXT NOT NULL,
+	timestamp bigint NOT NULL,
+	error_message TEXT NOT NULL,
+	error_code smallint NOT NULL,
+	retry_no smallint NOT NULL
+)`
+)
+
+func migratePostgresSnapshotTable(ctx context.Context, conn xsql.DB, cfg *Config) error {
+	_, err := migratePostgresTable(ctx, conn, postgresSchema(cfg), cfg.SnapshotTable, postgresSnapshotTableDDL)
 	return err
 }
 
 func migratePostgresAggregateTables(ctx context.Context, conn xsql.DB, cfg *Config) error {
-	schema := cfg.SchemaName
-	if schema == "" {
-		schema = "public"
+	_, err := migratePostgresTable(ctx, conn, postgresSchema(cfg), cfg.AggregateTable, postgresAggregateTableDDL)
+	return err
+}
+
+func migratePostgresCheckpointTable(ctx context.Context, conn xsql.DB, cfg *Config) error {
+	if cfg.CheckpointTable == "" {
+		return nil
 	}
+	_, err := migratePostgresTable(ctx, conn, postgresSchema(cfg), cfg.CheckpointTable, postgresCheckpointTableDDL)
+	return err
+}
 
-	exists, err := postgresTableExists(ctx, conn, schema, cfg.AggregateTable)
-	if err != nil {
-		return err
+func migratePostgresKeyTable(ctx context.Context, conn xsql.DB, cfg *Config) error {
+	if cfg.KeyTable == "" {
+		return nil
 	}
-	if exists {
+	_, err := migratePostgresTable(ctx, conn, postgresSchema(cfg), cfg.KeyTable, postgresKeyTableDDL)
+	return err
+}
+
+func migratePostgresArchiveTable(ctx context.Context, conn xsql.DB, cfg *Config) error {
+	if cfg.ArchiveTable == "" {
 		return nil
 	}
+	_, err := migratePostgresTable(ctx, conn, postgresSchema(cfg), cfg.ArchiveTable, postgresArchiveTableDDL)
+	return err
+}
 
-	var sb strings.Builder
-	sb.WriteString("CREATE TABLE ")
-	sb.WriteString(schema)
-	sb.WriteString(".")
-	sb.WriteString(cfg.AggregateTable)
-	sb.WriteString(" (\n")
-	sb.WriteString("\tid BIGSERIAL NOT NULL PRIMARY KEY,\n")
-	sb.WriteString("\taggregate_id TEXT NOT NULL,\n")
-	sb.WriteString("\taggregate_type TEXT NOT NULL,\n")
-	sb.WriteString("\tinserted_at bigint NOT NULL,\n")
-	sb.WriteString("\tCONSTRAINT ")
-	sb.WriteString(cfg.AggregateTable)
-	sb.WriteString("_aggregate_id_aggregate_type_uidx UNIQUE(aggregate_id, aggregate_type)\n")
-	sb.WriteString(")")
-
-	_, err = conn.ExecContext(ctx, sb.String())
+func migratePostgresReservationTable(ctx context.Context, conn xsql.DB, cfg *Config) error {
+	if cfg.ReservationTable == "" {
+		return nil
+	}
+	schema := postgresSchema(cfg)
+	created, err := migratePostgresTable(ctx, conn, schema, cfg.ReservationTable, postgresReservationTableDDL)
+	if err != nil || !created {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("CREATE INDEX %[2]s_aggregate_idx ON %[1]s.%[2]s (aggregate_id, aggregate_type)", schema, cfg.ReservationTable))
 	return err
 }
 
-func migratePostgresHandlersTables(ctx context.Context, conn xsql.DB, cfg *Config) error {
-	schema := cfg.SchemaName
-	if schema == "" {
-		schema = "public"
+func migratePostgresOutboxTable(ctx context.Context, conn xsql.DB, cfg *Config) error {
+	if cfg.OutboxTable == "" {
+		return nil
 	}
+	_, err := migratePostgresTable(ctx, conn, postgresSchema(cfg), cfg.OutboxTable, postgresOutboxTableDDL)
+	return err
+}
 
-	exists, err := postgresTableExists(ctx, conn, schema, cfg.EventState.HandlerTable)
-	if err != nil {
+func migratePostgresHandlersTables(ctx context.Context, conn xsql.DB, cfg *Config) error {
+	schema := postgresSchema(cfg)
+	if _, err := migratePostgresTable(ctx, conn, schema, cfg.EventState.HandlerTable, postgresHandlerTableDDL); err != nil {
 		return err
 	}
-	if !exists {
-		var sb strings.Builder
-		sb.WriteString("CREATE TABLE ")
-		sb.WriteString(schema)
-		sb.WriteString(".")
-		sb.WriteString(cfg.EventState.HandlerTable)
-		sb.WriteString(" (\n")
-		sb.WriteString("\tid BIGSERIAL NOT NULL PRIMARY KEY,\n")
-		sb.WriteString("\thandler_name TEXT NOT NULL,\n")
-		sb.WriteString("\tevent_type TEXT NOT NULL,\n")
-		sb.WriteString("\tCONSTRAINT ")
-		sb.WriteString(cfg.EventState.HandlerTable)
-		sb.WriteString("_handler_name_event_type_uidx UNIQUE(handler_name, event_type)\n")
-		sb.WriteString(")")
-
-		_, err = conn.ExecContext(ctx, sb.String())
-		if err != nil {
-			return err
-		}
-	}
 
 	idxName := fmt.Sprintf("%s_event_type_idx", cfg.EventState.HandlerTable)
-	exists, err = postgresIndexExists(ctx, conn, schema, cfg.EventState.HandlerTable, idxName)
+	exists, err := postgresIndexExists(ctx, conn, schema, cfg.EventState.HandlerTable, idxName)
 	if err != nil {
 		return err
 	}
@@ -267,48 +376,12 @@ func insertHandlers(ctx context.Context, conn xsql.DB, handlersTable string, han
 }
 
 func migratePostgresEventStateTable(ctx context.Context, conn xsql.DB, cfg *Config) error {
-	schema := cfg.SchemaName
-	if schema == "" {
-		schema = "public"
-	}
-	// language=PostgreSQL
-	exists, err := postgresTableExists(ctx, conn, schema, cfg.EventState.EventStateTable)
+	primaryKey, partition := postgresPartitioning(cfg.EventState.PartitionState, "handler_name")
+	_, err := migratePostgresTable(ctx, conn, postgresSchema(cfg), cfg.EventState.EventStateTable, postgresEventStateTableDDL, primaryKey, partition)
 	if err != nil {
 		return err
 	}
 
-	sb := strings.Builder{}
-	if !exists {
-		sb.WriteString("CREATE TABLE ")
-		sb.WriteString(schema)
-		sb.WriteRune('.')
-		sb.WriteString(cfg.EventState.EventStateTable)
-		sb.WriteString(" (\n")
-		sb.WriteString("\tid BIGSERIAL NOT NULL")
-		if !cfg.EventState.PartitionState {
-			sb.WriteString(" PRIMARY KEY")
-		}
-		sb.WriteString(",\n")
-		sb.WriteString("\tevent_id TEXT NOT NULL,\n")
-		sb.WriteString("\thandler_name TEXT NOT NULL,\n")
-		sb.WriteString("\tstate smallint NOT NULL,\n")
-		sb.WriteString("\ttimestamp bigint NOT NULL,\n")
-		sb.WriteString("\tCONSTRAINT ")
-		sb.WriteString(cfg.EventState.EventStateTable)
-		sb.WriteString("_event_id_handler_name_uidx UNIQUE (event_id, handler_name)\n")
-		if !cfg.EventState.PartitionState {
-			sb.WriteString(")")
-		} else {
-			sb.WriteString(") PARTITION BY LIST(handler_name);")
-		}
-
-		q := sb.String()
-		if _, err := conn.ExecContext(ctx, q); err != nil {
-			return err
-		}
-		sb.Reset()
-	}
-
 	if cfg.EventState.PartitionState && len(cfg.EventState.Handlers) > 0 {
 		handlerNames := make([]string, len(cfg.EventState.Handlers))
 		for i, h := range cfg.EventState.Handlers {
@@ -323,82 +396,30 @@ func migratePostgresEventStateTable(ctx context.Context, conn xsql.DB, cfg *Conf
 }
 
 func migratePostgresEventHandleFailureTable(ctx context.Context, conn xsql.DB, cfg *Config) error {
-	schema := cfg.SchemaName
-	if schema == "" {
-		schema = "public"
-	}
-
-	exists, err := postgresTableExists(ctx, conn, schema, cfg.EventState.HandleFailureTable)
-	if err != nil {
-		return err
-	}
-	if exists {
-		return nil
-	}
-
-	var sb strings.Builder
-	sb.WriteString("CREATE TABLE ")
-	sb.WriteString(schema)
-	sb.WriteString(".")
-	sb.WriteString(cfg.EventState.HandleFailureTable)
-	sb.WriteString(" (\n")
-	sb.WriteString("\tid BIGSERIAL NOT NULL PRIMARY KEY,\n")
-	sb.WriteString("\tevent_id TEXT NOT NULL,\n")
-	sb.WriteString("\thandler_name TEXT NOT NULL,\n")
-	sb.WriteString("\ttimestamp bigint NOT NULL,\n")
-	sb.WriteString("\terror_message TEXT NOT NULL,\n")
-	sb.WriteString("\terror_code smallint NOT NULL,\n")
-	sb.WriteString("\tretry_no smallint NOT NULL\n")
-	sb.WriteString(")")
-
-	_, err = conn.ExecContext(ctx, sb.String())
+	_, err := migratePostgresTable(ctx, conn, postgresSchema(cfg), cfg.EventState.HandleFailureTable, postgresEventHandleFailureTableDDL)
 	return err
 }
 
 func migratePostgresEventTable(ctx context.Context, conn xsql.DB, cfg *Config) error {
-	schema := cfg.SchemaName
-	if schema == "" {
-		schema = "public"
+	schema := postgresSchema(cfg)
+	sb := strings.Builder{}
+	for _, c := range postgresEventColumns {
+		sb.WriteRune('\t')
+		sb.WriteString(c.name)
+		sb.WriteRune(' ')
+		sb.WriteString(c.definition)
+		sb.WriteString(",\n")
 	}
-	// language=PostgreSQL
-	exists, err := postgresTableExists(ctx, conn, schema, cfg.EventTable)
+	primaryKey, partition := postgresPartitioning(cfg.PartitionEventTable, "aggregate_type")
+	created, err := migratePostgresTable(ctx, conn, schema, cfg.EventTable, postgresEventTableDDL, primaryKey, partition, sb.String())
 	if err != nil {
 		return err
 	}
-
-	sb := strings.Builder{}
-	if !exists {
-		sb.WriteString("CREATE TABLE ")
-		sb.WriteString(schema)
-		sb.WriteRune('.')
-		sb.WriteString(cfg.EventTable)
-		sb.WriteString(" (\n")
-		sb.WriteString("\tid BIGSERIAL NOT NULL")
-		if !cfg.PartitionEventTable {
-			sb.WriteString(" PRIMARY KEY")
-		}
-		sb.WriteString(",\n")
-		sb.WriteString("\tevent_id TEXT NOT NULL,\n")
-		sb.WriteString("\taggregate_id TEXT NOT NULL,\n")
-		sb.WriteString("\taggregate_type TEXT NOT NULL,\n")
-		sb.WriteString("\trevision integer NOT NULL,\n")
-		sb.WriteString("\ttimestamp bigint NOT NULL,\n")
-		sb.WriteString("\tevent_type TEXT NOT NULL,\n")
-		sb.WriteString("\tevent_data bytea,\n")
-		sb.WriteString("\tCONSTRAINT ")
-		sb.WriteString(cfg.EventTable)
-		sb.WriteString("_aggregate_revision_uidx UNIQUE (aggregate_id, aggregate_type, revision)\n")
-		if !cfg.PartitionEventTable {
-			sb.WriteString(")")
-		} else {
-			sb.WriteString(") PARTITION BY LIST(aggregate_type);")
-		}
-
-		q := sb.String()
-		if _, err := conn.ExecContext(ctx, q); err != nil {
+	sb.Reset()
+	if !created {
+		if err = migratePostgresColumns(ctx, conn, schema, cfg.EventTable, postgresEventColumns); err != nil {
 			return err
 		}
-		sb.Reset()
 	}
 
 	// Check and create if not exists event_id index.
@@ -411,7 +432,7 @@ func migratePostgresEventTable(ctx context.Context, conn xsql.DB, cfg *Config) e
 	idxName := sb.String()
 	sb.Reset()
 
-	exists, err = postgresIndexExists(ctx, conn, schema, cfg.EventTable, idxName)
+	exists, err := postgresIndexExists(ctx, conn, schema, cfg.EventTable, idxName)
 	if err != nil {
 		return err
 	}
@@ -461,6 +482,53 @@ func migratePostgresEventTable(ctx context.Context, conn xsql.DB, cfg *Config) e
 	return nil
 }
 
+// postgresColumn is the definition of the table column added after the initial table migration.
+type postgresColumn struct {
+	name, definition string
+}
+
+// postgresEventColumns are the event table columns added on top of the base event columns.
+var postgresEventColumns = []postgresColumn{
+	{name: "event_version", definition: "integer NOT NULL DEFAULT 0"},
+	{name: "correlation_id", definition: "TEXT NOT NULL DEFAULT ''"},
+	{name: "causation_id", definition: "TEXT NOT NULL DEFAULT ''"},
+	{name: "actor", definition: "TEXT NOT NULL DEFAULT ''"},
+	{name: "metadata", definition: "jsonb"},
+	{name: "previous_hash", definition: "BYTEA"},
+	{name: "hash", definition: "BYTEA"},
+}
+
+// migratePostgresColumns adds the columns that doesn't exist yet in given table.
+func migratePostgresColumns(ctx context.Context, conn xsql.DB, schema, table string, columns []postgresColumn) error {
+	for _, c := range columns {
+		exists, err := postgresColumnExists(ctx, conn, schema, table, c.name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err = conn.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s.%s ADD COLUMN %s %s", schema, table, c.name, c.definition)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func postgresColumnExists(ctx context.Context, conn xsql.DB, schema, table, column string) (bool, error) {
+	// language=PostgreSQL
+	q := `SELECT 1 FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2 AND column_name = $3`
+	row := conn.QueryRowContext(ctx, q, schema, table, column)
+	var exists int
+	if err := row.Scan(&exists); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return false, err
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
 func postgresIndexExists(ctx context.Context, conn xsql.DB, schema string, eventTable string, idxName string) (bool, error) {
 	// language=PostgreSQL
 	q := `SELECT 1 FROM pg_indexes WHERE schemaname = $1 AND tablename = $2 and indexname = $3`
@@ -512,10 +580,7 @@ FROM pg_inherits
          JOIN pg_namespace nmsp_child    ON nmsp_child.oid   = child.relnamespace
 WHERE parent.relname = $1 AND nmsp_parent.nspname = $2`
 
-	schemaName := cfg.SchemaName
-	if schemaName == "" {
-		schemaName = "public"
-	}
+	schemaName := postgresSchema(cfg)
 
 	rows, err := conn.QueryContext(ctx, listPartitions, cfg.EventTable, schemaName)
 	if err != nil {
@@ -589,10 +654,7 @@ FROM pg_inherits
          JOIN pg_namespace nmsp_child    ON nmsp_child.oid   = child.relnamespace
 WHERE parent.relname = ? AND nmsp_parent.nspname = ?`
 
-	schemaName := cfg.SchemaName
-	if schemaName == "" {
-		schemaName = "public"
-	}
+	schemaName := postgresSchema(cfg)
 
 	rows, err := conn.QueryContext(ctx, conn.Rebind(listPartitions), cfg.EventState.EventStateTable, schemaName)
 	if err != nil {
@@ -0,0 +1,308 @@
+package esxsql
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gocloud.dev/pubsub"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/xsql"
+	"github.com/kucjac/cleango/pkg/xlog"
+	"github.com/kucjac/cleango/xpubsub"
+	"github.com/kucjac/cleango/xservice"
+)
+
+// The metadata keys of the messages sent by the OutboxRelay.
+// The event metadata is sent along with them.
+const (
+	MessageEventIDKey       = "event_id"
+	MessageEventTypeKey     = "event_type"
+	MessageAggregateIDKey   = "aggregate_id"
+	MessageAggregateTypeKey = "aggregate_type"
+	MessageRevisionKey      = "revision"
+	MessageTimestampKey     = "timestamp"
+	MessageCorrelationIDKey = "correlation_id"
+	MessageCausationIDKey   = "causation_id"
+	MessageActorKey         = "actor"
+)
+
+// SubjectMapping maps the relayed events to the subjects of the topics they are sent to.
+type SubjectMapping struct {
+	// EventTypes maps the event types to the subjects. It takes precedence over the AggregateTypes mapping.
+	EventTypes map[string]string
+	// AggregateTypes maps the aggregate types to the subjects.
+	AggregateTypes map[string]string
+	// Default is the subject of the events not matched by any other mapping.
+	// If empty, such events are removed from the outbox without being sent.
+	Default string
+}
+
+// Subject gets the subject of the topic given event should be sent to.
+func (m *SubjectMapping) Subject(e *es.Event) string {
+	if subject, ok := m.EventTypes[e.EventType]; ok {
+		return subject
+	}
+	if subject, ok := m.AggregateTypes[e.AggregateType]; ok {
+		return subject
+	}
+	return m.Default
+}
+
+func (m *SubjectMapping) subjects() []string {
+	var subjects []string
+	for _, subject := range m.EventTypes {
+		subjects = append(subjects, subject)
+	}
+	for _, subject := range m.AggregateTypes {
+		subjects = append(subjects, subject)
+	}
+	if m.Default != "" {
+		subjects = append(subjects, m.Default)
+	}
+	return subjects
+}
+
+// OutboxRelayConfig is the configuration of the OutboxRelay.
+type OutboxRelayConfig struct {
+	// BatchSize is the maximum number of the outbox entries relayed at once.
+	BatchSize int
+	// PollInterval is the time the relay waits for the new outbox entries, once the outbox is drained.
+	PollInterval time.Duration
+	// Subjects maps the events to the subjects of the relay topics.
+	Subjects SubjectMapping
+}
+
+// DefaultOutboxRelayConfig creates the default outbox relay config, which sends all events to given subject.
+func DefaultOutboxRelayConfig(subject string) *OutboxRelayConfig {
+	return &OutboxRelayConfig{
+		BatchSize:    100,
+		PollInterval: time.Second,
+		Subjects:     SubjectMapping{Default: subject},
+	}
+}
+
+// Validate checks if the config is valid to use.
+func (c *OutboxRelayConfig) Validate() error {
+	if c.BatchSize <= 0 {
+		return cgerrors.ErrInternal("outbox relay batch size needs to be greater than 0")
+	}
+	if c.PollInterval <= 0 {
+		return cgerrors.ErrInternal("outbox relay poll interval needs to be greater than 0")
+	}
+	return nil
+}
+
+// Compile time check if the OutboxRelay implements xservice.RunnerCloser interface.
+var _ xservice.RunnerCloser = (*OutboxRelay)(nil)
+
+// OutboxRelay sends the events written to the outbox table to the pubsub topics, and removes the delivered entries.
+// The events are delivered at least once - an event might be sent again if removing its entry fails.
+// The events of a single aggregate are sent in the order they were saved. If sending an event fails,
+// the following events of its aggregate are held back until the next relay.
+// Only a single relay should be running on given outbox table.
+// Implements xservice.RunnerCloser interface.
+type OutboxRelay struct {
+	conn         xsql.DB
+	cfg          OutboxRelayConfig
+	topics       map[string]xpubsub.Topic
+	listOutbox   string
+	deleteOutbox string
+
+	l       sync.Mutex
+	running bool
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// NewOutboxRelay creates a new relay of the outbox table defined in the config.
+// The topics are mapped by their subjects, and need to cover all the subjects of the relay config mapping.
+func NewOutboxRelay(conn xsql.DB, cfg *Config, relayCfg *OutboxRelayConfig, topics map[string]xpubsub.Topic) (*OutboxRelay, error) {
+	if cfg.OutboxTable == "" {
+		return nil, cgerrors.ErrInternal("no outbox table name provided")
+	}
+	if relayCfg == nil {
+		return nil, cgerrors.ErrInternal("no outbox relay config provided")
+	}
+	if err := relayCfg.Validate(); err != nil {
+		return nil, err
+	}
+	for _, subject := range relayCfg.Subjects.subjects() {
+		if _, ok := topics[subject]; !ok {
+			return nil, cgerrors.ErrInternalf("no topic provided for the outbox subject: %s", subject)
+		}
+	}
+	eventColumns := "e." + strings.ReplaceAll(selectEventColumns, ", ", ", e.")
+	return &OutboxRelay{
+		conn:         conn,
+		cfg:          *relayCfg,
+		topics:       topics,
+		listOutbox:   conn.Rebind(fmt.Sprintf(listOutboxQuery, eventColumns, cfg.outboxTableName(), cfg.eventTableName())),
+		deleteOutbox: fmt.Sprintf(deleteOutboxQueryBase, cfg.outboxTableName()),
+	}, nil
+}
+
+// Run starts relaying the outbox and blocks until the relay is closed.
+// Implements xservice.Runner interface.
+func (r *OutboxRelay) Run() error {
+	r.l.Lock()
+	if r.running {
+		r.l.Unlock()
+		return cgerrors.ErrInternal("outbox relay is already running")
+	}
+	var ctx context.Context
+	ctx, r.cancel = context.WithCancel(context.Background())
+	r.done = make(chan struct{})
+	r.running = true
+	done := r.done
+	r.l.Unlock()
+
+	defer close(done)
+	for {
+		n, err := r.Relay(ctx)
+		if err != nil && ctx.Err() == nil {
+			xlog.WithContext(ctx).Errorf("relaying outbox failed: %v", err)
+		}
+		// Continue immediately while there might be more entries waiting in the outbox.
+		if err == nil && n == r.cfg.BatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(r.cfg.PollInterval):
+		}
+	}
+}
+
+// Close stops relaying the outbox and waits until the batch being relayed is finished.
+// Implements xservice.Closer interface.
+func (r *OutboxRelay) Close(ctx context.Context) error {
+	r.l.Lock()
+	if !r.running {
+		r.l.Unlock()
+		return nil
+	}
+	r.cancel()
+	r.running = false
+	done := r.done
+	r.l.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Relay sends a single batch of the outbox entries and removes the delivered ones.
+// It returns the number of the entries removed from the outbox.
+func (r *OutboxRelay) Relay(ctx context.Context) (int, error) {
+	ids, events, err := r.readBatch(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		delivered []interface{}
+		sendErr   error
+	)
+	// blocked are the aggregates which events could not be sent in this batch.
+	blocked := map[[2]string]struct{}{}
+	for i, e := range events {
+		key := [2]string{e.AggregateType, e.AggregateId}
+		if _, ok := blocked[key]; ok {
+			continue
+		}
+		if subject := r.cfg.Subjects.Subject(e); subject != "" {
+			if err = r.topics[subject].Send(ctx, outboxMessage(e)); err != nil {
+				blocked[key] = struct{}{}
+				if sendErr == nil {
+					sendErr = cgerrors.ErrInternalf("sending event: %s to subject: %s failed: %v", e.EventId, subject, err)
+				}
+				continue
+			}
+		}
+		delivered = append(delivered, ids[i])
+	}
+
+	if len(delivered) > 0 {
+		if _, err = r.conn.ExecContext(ctx, r.deleteQuery(len(delivered)), delivered...); err != nil {
+			return 0, cgerrors.New("", err.Error(), r.conn.ErrorCode(err))
+		}
+	}
+	return len(delivered), sendErr
+}
+
+func (r *OutboxRelay) readBatch(ctx context.Context) ([]int64, []*es.Event, error) {
+	rows, err := r.conn.QueryContext(ctx, r.listOutbox, r.cfg.BatchSize)
+	if err != nil {
+		return nil, nil, cgerrors.New("", err.Error(), r.conn.ErrorCode(err))
+	}
+	defer rows.Close()
+
+	var (
+		ids    []int64
+		events []*es.Event
+	)
+	for rows.Next() {
+		var (
+			id int64
+			e  es.Event
+		)
+		if err = rows.Scan(append([]interface{}{&id}, eventScanDest(&e)...)...); err != nil {
+			return nil, nil, cgerrors.New("", err.Error(), r.conn.ErrorCode(err))
+		}
+		ids = append(ids, id)
+		events = append(events, &e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, cgerrors.New("", err.Error(), r.conn.ErrorCode(err))
+	}
+	return ids, events, nil
+}
+
+func (r *OutboxRelay) deleteQuery(length int) string {
+	sb := strings.Builder{}
+	sb.WriteString(r.deleteOutbox)
+	sb.WriteRune('(')
+	for i := 0; i < length; i++ {
+		sb.WriteRune('?')
+		if i != length-1 {
+			sb.WriteRune(',')
+		}
+	}
+	sb.WriteRune(')')
+	return r.conn.Rebind(sb.String())
+}
+
+// outboxMessage creates the pubsub message of given event.
+// The message body is the encoded event message, and the event fields are sent within the message metadata.
+func outboxMessage(e *es.Event) *pubsub.Message {
+	md := make(map[string]string, len(e.Metadata)+9)
+	for k, v := range e.Metadata {
+		md[k] = v
+	}
+	md[MessageEventIDKey] = e.EventId
+	md[MessageEventTypeKey] = e.EventType
+	md[MessageAggregateIDKey] = e.AggregateId
+	md[MessageAggregateTypeKey] = e.AggregateType
+	md[MessageRevisionKey] = strconv.FormatInt(e.Revision, 10)
+	md[MessageTimestampKey] = strconv.FormatInt(e.Timestamp, 10)
+	if e.CorrelationId != "" {
+		md[MessageCorrelationIDKey] = e.CorrelationId
+	}
+	if e.CausationId != "" {
+		md[MessageCausationIDKey] = e.CausationId
+	}
+	if e.Actor != "" {
+		md[MessageActorKey] = e.Actor
+	}
+	return &pubsub.Message{Body: e.EventData, Metadata: md}
+}
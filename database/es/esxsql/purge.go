@@ -0,0 +1,200 @@
+package esxsql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gocloud.dev/gcerrors"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esstate"
+	"github.com/kucjac/cleango/database/xsql"
+)
+
+// PurgeDeleted physically removes the aggregates deleted with the tombstone event at least the retention period ago.
+// Along with the aggregate events, its snapshots and the aggregate table entry are removed, as well as the event states,
+// handling failures and outbox entries of its events and its reservations, if these tables are configured.
+// If the EventState is configured, the esstate.EventState aggregates of the purged events are purged as well.
+// If the ArchiveTable is configured, the archived aggregates are purged as well - their archive pointers are removed
+// and their segments are deleted from the archive bucket.
+// Each aggregate is purged within its own transaction. It returns the number of purged aggregates.
+func (s *storage) PurgeDeleted(ctx context.Context, retention time.Duration) (int, error) {
+	if retention < 0 {
+		return 0, cgerrors.ErrInvalidArgument("purge retention period is lower than 0")
+	}
+	cutoff := time.Now().Add(-retention).UTC().UnixNano()
+	aggregates, err := s.listTombstoned(ctx, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	queries := s.purgeQueries()
+	for i, agg := range aggregates {
+		err = xsql.RunInTransaction(ctx, s.conn, func(tx *xsql.Tx) error {
+			st := *s
+			st.conn = tx
+			return st.purgeAggregate(ctx, agg, queries)
+		})
+		if err != nil {
+			return i, cgerrors.New("", fmt.Sprintf("purging aggregate: %s with id: %s failed: %v", agg.Type, agg.ID, err), s.conn.ErrorCode(err))
+		}
+	}
+	return len(aggregates), nil
+}
+
+// purgeAggregate removes the aggregate rows with given queries, along with its archived segment.
+// The segment is deleted right before the transaction is committed, so that a failed purge is retried with the next call.
+func (s *storage) purgeAggregate(ctx context.Context, agg aggregate, queries []string) error {
+	var segmentKey string
+	if s.cfg.ArchiveTable != "" {
+		p, err := s.getArchivePointer(ctx, agg.ID, agg.Type)
+		if err != nil && !cgerrors.IsNotFound(err) {
+			return err
+		}
+		if p != nil {
+			segmentKey = p.segmentKey
+		}
+	}
+	if segmentKey != "" && s.archive == nil {
+		return cgerrors.ErrInternalf("no archive bucket provided to delete the segment: %s", segmentKey)
+	}
+	if s.cfg.EventState != nil && agg.Type != esstate.AggregateType {
+		// The event states are the aggregates identified by the event id.
+		eventIds, err := s.listEventIds(ctx, agg, segmentKey)
+		if err != nil {
+			return err
+		}
+		for _, id := range eventIds {
+			if err = s.purgeAggregate(ctx, aggregate{ID: id, Type: esstate.AggregateType}, queries); err != nil {
+				return err
+			}
+		}
+	}
+	for _, query := range queries {
+		if _, err := s.conn.ExecContext(ctx, query, agg.ID, agg.Type); err != nil {
+			return err
+		}
+	}
+	if segmentKey == "" {
+		return nil
+	}
+	// The segment could be already deleted by the failed purge.
+	if err := s.archive.Delete(ctx, segmentKey); err != nil && gcerrors.Code(err) != gcerrors.NotFound {
+		return cgerrors.ErrInternalf("deleting archive segment: %s failed: %v", segmentKey, err)
+	}
+	return nil
+}
+
+// listEventIds lists the ids of the aggregate events, both stored and archived in the segment with given key.
+func (s *storage) listEventIds(ctx context.Context, agg aggregate, segmentKey string) ([]string, error) {
+	var ids []string
+	if segmentKey != "" {
+		// The segment could be already deleted by the failed purge.
+		exists, err := s.archive.Exists(ctx, segmentKey)
+		if err != nil {
+			return nil, cgerrors.ErrInternalf("checking archive segment: %s failed: %v", segmentKey, err)
+		}
+		if exists {
+			seg, err := s.readSegment(ctx, segmentKey)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range seg.Events {
+				ids = append(ids, e.EventId)
+			}
+		}
+	}
+
+	rows, err := s.conn.QueryContext(ctx, s.conn.Rebind(fmt.Sprintf(listAggregateEventIdsQuery, s.cfg.eventTableName())), agg.ID, agg.Type)
+	if err != nil {
+		return nil, cgerrors.New("", err.Error(), s.conn.ErrorCode(err))
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, cgerrors.ErrInternalf("scanning event id row failed: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, cgerrors.New("", err.Error(), s.conn.ErrorCode(err))
+	}
+	return ids, nil
+}
+
+// listTombstoned lists the aggregates which tombstone is not newer than the cutoff, both stored and archived.
+func (s *storage) listTombstoned(ctx context.Context, cutoff int64) ([]aggregate, error) {
+	aggregates, err := s.queryAggregates(ctx, fmt.Sprintf(listTombstonesQuery, s.cfg.eventTableName()), es.TombstoneEventType, cutoff)
+	if err != nil || s.cfg.ArchiveTable == "" {
+		return aggregates, err
+	}
+	archived, err := s.queryAggregates(ctx, fmt.Sprintf(listArchivedTombstonesQuery, s.cfg.archiveTableName()), cutoff)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[aggregate]struct{}, len(aggregates))
+	for _, agg := range aggregates {
+		found[agg] = struct{}{}
+	}
+	for _, agg := range archived {
+		if _, ok := found[agg]; !ok {
+			aggregates = append(aggregates, agg)
+		}
+	}
+	return aggregates, nil
+}
+
+func (s *storage) queryAggregates(ctx context.Context, query string, args ...interface{}) ([]aggregate, error) {
+	rows, err := s.conn.QueryContext(ctx, s.conn.Rebind(query), args...)
+	if err != nil {
+		return nil, cgerrors.New("", err.Error(), s.conn.ErrorCode(err))
+	}
+	defer rows.Close()
+
+	var aggregates []aggregate
+	for rows.Next() {
+		var agg aggregate
+		if err = rows.Scan(&agg.ID, &agg.Type); err != nil {
+			return nil, cgerrors.ErrInternalf("scanning tombstone row failed: %v", err)
+		}
+		aggregates = append(aggregates, agg)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, cgerrors.New("", err.Error(), s.conn.ErrorCode(err))
+	}
+	return aggregates, nil
+}
+
+// purgeQueries gets the queries removing the aggregate rows, taking the aggregate id and type arguments.
+// The rows referencing the aggregate events are removed before the events.
+func (s *storage) purgeQueries() []string {
+	eventTable := s.cfg.eventTableName()
+	var queries []string
+	if s.cfg.EventState != nil {
+		queries = append(queries,
+			fmt.Sprintf(purgeEventReferencesQuery, s.cfg.eventStateTableName(), eventTable),
+			fmt.Sprintf(purgeEventReferencesQuery, s.cfg.eventHandleFailureTableName(), eventTable),
+		)
+	}
+	if s.cfg.OutboxTable != "" {
+		queries = append(queries, fmt.Sprintf(purgeEventReferencesQuery, s.cfg.outboxTableName(), eventTable))
+	}
+	if s.cfg.ReservationTable != "" {
+		queries = append(queries, fmt.Sprintf(purgeAggregateRowsQuery, s.cfg.reservationTableName()))
+	}
+	if s.cfg.ArchiveTable != "" {
+		queries = append(queries, fmt.Sprintf(purgeAggregateRowsQuery, s.cfg.archiveTableName()))
+	}
+	queries = append(queries,
+		fmt.Sprintf(purgeAggregateRowsQuery, s.cfg.snapshotTableName()),
+		fmt.Sprintf(purgeAggregateRowsQuery, eventTable),
+		fmt.Sprintf(purgeAggregateRowsQuery, s.cfg.aggregateTableName()),
+	)
+	for i, query := range queries {
+		queries[i] = s.conn.Rebind(query)
+	}
+	return queries
+}
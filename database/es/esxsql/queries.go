@@ -1,25 +1,61 @@
 package esxsql
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
 	"github.com/kucjac/cleango/database/xsql"
 )
 
 const (
-	insertEventQuery           = `INSERT INTO %s (aggregate_id, aggregate_type, revision, timestamp, event_id, event_type, event_data) VALUES (?,?,?,?,?,?,?)`
-	getEventStreamQuery        = `SELECT aggregate_id, aggregate_type, revision, timestamp, event_id, event_type, event_data FROM %s WHERE aggregate_id = ? AND aggregate_type = ? ORDER BY timestamp`
-	saveSnapshotQuery          = `INSERT INTO %s (aggregate_id, aggregate_type, aggregate_version, revision, timestamp, snapshot_data) VALUES (?,?,?,?,?,?)`
-	getSnapshotQuery           = `SELECT aggregate_id, aggregate_type, aggregate_version, revision, timestamp, snapshot_data FROM %s WHERE aggregate_id = ? AND aggregate_type = ? AND aggregate_version = ? ORDER BY timestamp DESC LIMIT 1`
-	getStreamFromRevisionQuery = `SELECT aggregate_id, aggregate_type, revision, timestamp, event_id, event_type, event_data FROM %s WHERE aggregate_id = ? AND aggregate_type = ? AND revision > ? ORDER BY timestamp`
-	batchInsertQueryBase       = `INSERT INTO %s (aggregate_id, aggregate_type, revision, timestamp, event_id, event_type, event_data) VALUES `
-	insertAggregate            = `INSERT INTO %s (aggregate_id, aggregate_type, inserted_at) VALUES (?,?,?)`
-	// listAggregates             = `SELECT id, aggregate_id FROM %s WHERE aggregate_type = ? LIMIT ? ORDER BY id`
-	listNextAggregates   = `SELECT id, aggregate_id FROM %s WHERE aggregate_type = ? AND id > ? LIMIT ? ORDER BY id`
-	listEventStreamQuery = `SELECT id, aggregate_id, aggregate_type, revision, timestamp, event_id, event_type, event_data FROM %s `
-	registerHandler      = `INSERT INTO %s (handler_name, event_type) VALUES (?,?)`
-	listHandlers         = `
+	// eventColumns are the event table columns in the order of the eventValues function.
+	// The selectEventColumns are prefixed with the id, which is the event global position, in the order of the eventScanDest function.
+	eventColumns                  = `aggregate_id, aggregate_type, revision, timestamp, event_id, event_type, event_data, event_version, correlation_id, causation_id, actor, metadata, previous_hash, hash`
+	eventColumnsCount             = 14
+	selectEventColumns            = `id, ` + eventColumns
+	insertEventQuery              = `INSERT INTO %s (` + eventColumns + `) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?)`
+	getEventStreamQuery           = `SELECT ` + selectEventColumns + ` FROM %s WHERE aggregate_id = ? AND aggregate_type = ? ORDER BY timestamp`
+	saveSnapshotQuery             = `INSERT INTO %s (aggregate_id, aggregate_type, aggregate_version, revision, timestamp, snapshot_data) VALUES (?,?,?,?,?,?)`
+	getSnapshotQuery              = `SELECT aggregate_id, aggregate_type, aggregate_version, revision, timestamp, snapshot_data FROM %s WHERE aggregate_id = ? AND aggregate_type = ? AND aggregate_version = ? ORDER BY timestamp DESC LIMIT 1`
+	snapshotPruneCutoffQuery      = `SELECT revision FROM %s WHERE aggregate_id = ? AND aggregate_type = ? AND aggregate_version = ? ORDER BY revision DESC LIMIT 1 OFFSET ?`
+	pruneSnapshotsQuery           = `DELETE FROM %s WHERE aggregate_id = ? AND aggregate_type = ? AND aggregate_version = ? AND revision <= ?`
+	getStreamFromRevisionQuery    = `SELECT ` + selectEventColumns + ` FROM %s WHERE aggregate_id = ? AND aggregate_type = ? AND revision > ? ORDER BY timestamp`
+	getStreamUntilRevisionQuery   = `SELECT ` + selectEventColumns + ` FROM %s WHERE aggregate_id = ? AND aggregate_type = ? AND revision > ? AND revision <= ? ORDER BY revision`
+	getStreamUntilTimestampQuery  = `SELECT ` + selectEventColumns + ` FROM %s WHERE aggregate_id = ? AND aggregate_type = ? AND revision > ? AND timestamp <= ? ORDER BY revision`
+	getSnapshotAtRevisionQuery    = `SELECT aggregate_id, aggregate_type, aggregate_version, revision, timestamp, snapshot_data FROM %s WHERE aggregate_id = ? AND aggregate_type = ? AND aggregate_version = ? AND revision <= ? ORDER BY revision DESC LIMIT 1`
+	getSnapshotAtTimestampQuery   = `SELECT aggregate_id, aggregate_type, aggregate_version, revision, timestamp, snapshot_data FROM %s WHERE aggregate_id = ? AND aggregate_type = ? AND aggregate_version = ? AND timestamp <= ? ORDER BY revision DESC LIMIT 1`
+	batchInsertQueryBase          = `INSERT INTO %s (` + eventColumns + `) VALUES `
+	insertAggregate               = `INSERT INTO %s (aggregate_id, aggregate_type, inserted_at) VALUES (?,?,?)`
+	listNextAggregates            = `SELECT id, aggregate_id, aggregate_type, inserted_at FROM %s WHERE aggregate_type = ? AND id > ? ORDER BY id`
+	countAggregatesQuery          = `SELECT COUNT(*) FROM %s WHERE aggregate_type = ?`
+	aggregateExistsQuery          = `SELECT 1 FROM %s WHERE aggregate_id = ? AND aggregate_type = ?`
+	listEventStreamQuery          = `SELECT ` + selectEventColumns + ` FROM %s `
+	listEventIdsQuery             = `SELECT id, timestamp FROM %s WHERE id > ? ORDER BY id LIMIT ?`
+	excludeDeletedQuery           = `(aggregate_id, aggregate_type) NOT IN (SELECT aggregate_id, aggregate_type FROM %s WHERE event_type = ?)`
+	listTombstonesQuery           = `SELECT aggregate_id, aggregate_type FROM %s WHERE event_type = ? AND timestamp <= ? ORDER BY id`
+	purgeEventReferencesQuery     = `DELETE FROM %s WHERE event_id IN (SELECT event_id FROM %s WHERE aggregate_id = ? AND aggregate_type = ?)`
+	purgeAggregateRowsQuery       = `DELETE FROM %s WHERE aggregate_id = ? AND aggregate_type = ?`
+	listAggregateEventIdsQuery    = `SELECT event_id FROM %s WHERE aggregate_id = ? AND aggregate_type = ? ORDER BY revision`
+	getArchiveQuery               = `SELECT segment_key, revision FROM %s WHERE aggregate_id = ? AND aggregate_type = ?`
+	insertArchiveQuery            = `INSERT INTO %s (segment_key, revision, archived_at, deleted_at, aggregate_id, aggregate_type) VALUES (?,?,?,?,?,?)`
+	updateArchiveQuery            = `UPDATE %s SET segment_key = ?, revision = ?, archived_at = ?, deleted_at = ? WHERE aggregate_id = ? AND aggregate_type = ?`
+	listArchivedTombstonesQuery   = `SELECT aggregate_id, aggregate_type FROM %s WHERE deleted_at IS NOT NULL AND deleted_at <= ? ORDER BY archived_at`
+	listArchiveCandidatesQuery    = `SELECT aggregate_id, aggregate_type FROM %s `
+	listAggregateSnapshotsQuery   = `SELECT aggregate_id, aggregate_type, aggregate_version, revision, timestamp, snapshot_data FROM %s WHERE aggregate_id = ? AND aggregate_type = ? ORDER BY revision`
+	archiveEventReferencesQuery   = `DELETE FROM %s WHERE event_id IN (SELECT event_id FROM %s WHERE aggregate_id = ? AND aggregate_type = ? AND revision <= ?)`
+	archiveAggregateRowsQuery     = `DELETE FROM %s WHERE aggregate_id = ? AND aggregate_type = ? AND revision <= ?`
+	getReservationQuery           = `SELECT aggregate_id, aggregate_type, reserved_at FROM %s WHERE scope = ? AND value = ?`
+	insertReservationQuery        = `INSERT INTO %s (aggregate_id, aggregate_type, reserved_at, scope, value) VALUES (?,?,?,?,?)`
+	transferReservationQuery      = `UPDATE %s SET aggregate_id = ?, aggregate_type = ?, reserved_at = ? WHERE scope = ? AND value = ? AND aggregate_id = ? AND aggregate_type = ?`
+	releaseReservationQuery       = `DELETE FROM %s WHERE scope = ? AND value = ? AND aggregate_id = ? AND aggregate_type = ?`
+	listReservationsQuery         = `SELECT scope, value, reserved_at FROM %s WHERE aggregate_id = ? AND aggregate_type = ? ORDER BY scope, value`
+	listLatestSnapshotsQuery      = `SELECT aggregate_id, aggregate_type, aggregate_version, revision, timestamp, snapshot_data FROM %s AS s WHERE aggregate_type = ? AND aggregate_version = ? AND revision = (SELECT MAX(revision) FROM %s WHERE aggregate_id = s.aggregate_id AND aggregate_type = s.aggregate_type AND aggregate_version = s.aggregate_version) AND aggregate_id IN `
+	listEventsAfterRevisionsQuery = `SELECT ` + selectEventColumns + ` FROM %s WHERE aggregate_type = ? AND (`
+	registerHandler               = `INSERT INTO %s (handler_name, event_type) VALUES (?,?)`
+	listHandlers                  = `
 SELECT handler_name, array_agg(event_type) AS event_types 
 FROM %s 
 WHERE event_type = ?
@@ -29,6 +65,16 @@ GROUP BY handler_name`
 SELECT ?,?,handler_name,?
 FROM %s AS h
 WHERE h.event_type = ?`
+	getCheckpointQuery    = `SELECT position, updated_at FROM %s WHERE projection_name = ?`
+	updateCheckpointQuery = `UPDATE %s SET position = ?, updated_at = ? WHERE projection_name = ?`
+	insertCheckpointQuery = `INSERT INTO %s (projection_name, position, updated_at) VALUES (?,?,?)`
+	getDataKeyQuery       = `SELECT data_key FROM %s WHERE subject = ?`
+	insertDataKeyQuery    = `INSERT INTO %s (subject, data_key, created_at) VALUES (?,?,?)`
+	deleteDataKeyQuery    = `DELETE FROM %s WHERE subject = ?`
+	deleteCheckpointQuery = `DELETE FROM %s WHERE projection_name = ?`
+	insertOutboxQueryBase = `INSERT INTO %s (event_id) VALUES `
+	listOutboxQuery       = `SELECT o.id, %s FROM %s AS o JOIN %s AS e ON e.event_id = o.event_id ORDER BY o.id LIMIT ?`
+	deleteOutboxQueryBase = `DELETE FROM %s WHERE id IN `
 	insertHandlingFailure = `INSERT INTO %s (event_id, handler_name, timestamp, error_message, error_code, retry_no) VALUES (?,?,?,?,?,?)`
 	findHandlerEvents     = `SELECT es.event_id, es.handler_name FROM %s AS es`
 	findHandlingFailures  = `SELECT ef.event_id, ef.handler_name, ef.timestamp, ef.error_message, ef.error_code, ef.retry_no 
@@ -36,29 +82,46 @@ FROM %s AS ef`
 )
 
 type queries struct {
-	batchInsertQueryBase   string
-	getEventStream         string
-	saveSnapshot           string
-	getSnapshot            string
-	getStreamAfterRevision string
-	insertEvent            string
-	insertAggregate        string
-	listNextAggregates     string
-	listEventStreamQuery   string
-	registerHandler        string
-	listHandlers           string
-	updateEventState       string
-	insertEventState       string
-	insertHandlingFailure  string
-	findHandlerEvents      string
-	findHandlingFailures   string
+	batchInsertQueryBase    string
+	insertOutboxQueryBase   string
+	getEventStream          string
+	saveSnapshot            string
+	getSnapshot             string
+	snapshotPruneCutoff     string
+	pruneSnapshots          string
+	getStreamAfterRevision  string
+	getStreamUntilRevision  string
+	getStreamUntilTimestamp string
+	getSnapshotAtRevision   string
+	getSnapshotAtTimestamp  string
+	insertEvent             string
+	insertAggregate         string
+	listNextAggregates      string
+	countAggregates         string
+	aggregateExists         string
+	listEventStreamQuery    string
+	excludeDeleted          string
+	registerHandler         string
+	listHandlers            string
+	updateEventState        string
+	insertEventState        string
+	insertHandlingFailure   string
+	findHandlerEvents       string
+	findHandlingFailures    string
 }
 
 func (q queries) batchInsertEvent(length int) string {
 	sb := strings.Builder{}
 	sb.WriteString(q.batchInsertQueryBase)
 	for i := 0; i < length; i++ {
-		sb.WriteString("(?,?,?,?,?,?,?)")
+		sb.WriteRune('(')
+		for j := 0; j < eventColumnsCount; j++ {
+			sb.WriteRune('?')
+			if j != eventColumnsCount-1 {
+				sb.WriteRune(',')
+			}
+		}
+		sb.WriteRune(')')
 		if i != length-1 {
 			sb.WriteRune(',')
 		}
@@ -66,23 +129,121 @@ func (q queries) batchInsertEvent(length int) string {
 	return sb.String()
 }
 
+func (q queries) insertOutbox(length int) string {
+	sb := strings.Builder{}
+	sb.WriteString(q.insertOutboxQueryBase)
+	for i := 0; i < length; i++ {
+		sb.WriteString("(?)")
+		if i != length-1 {
+			sb.WriteRune(',')
+		}
+	}
+	return sb.String()
+}
+
+// eventValues gets the event values in the order of the eventColumns.
+func eventValues(e *es.Event) []interface{} {
+	return []interface{}{
+		e.AggregateId,
+		e.AggregateType,
+		e.Revision,
+		e.Timestamp,
+		e.EventId,
+		e.EventType,
+		e.EventData,
+		e.EventVersion,
+		e.CorrelationId,
+		e.CausationId,
+		e.Actor,
+		metadataValue(e.Metadata),
+		e.PreviousHash,
+		e.Hash,
+	}
+}
+
+// eventScanDest gets the scan destinations of the event fields in the order of the selectEventColumns.
+func eventScanDest(e *es.Event) []interface{} {
+	return []interface{}{
+		&e.Position,
+		&e.AggregateId,
+		&e.AggregateType,
+		&e.Revision,
+		&e.Timestamp,
+		&e.EventId,
+		&e.EventType,
+		&e.EventData,
+		&e.EventVersion,
+		&e.CorrelationId,
+		&e.CausationId,
+		&e.Actor,
+		&metadataScanner{md: &e.Metadata},
+		&e.PreviousHash,
+		&e.Hash,
+	}
+}
+
+// metadataValue gets the JSON encoded database value of the event metadata.
+func metadataValue(md map[string]string) interface{} {
+	if len(md) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(md)
+	if err != nil {
+		// The map of strings is always valid to marshal.
+		return nil
+	}
+	return string(data)
+}
+
+// metadataScanner is the sql.Scanner of the JSON encoded event metadata.
+type metadataScanner struct {
+	md *map[string]string
+}
+
+// Scan implements sql.Scanner interface.
+func (m *metadataScanner) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*m.md = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return cgerrors.ErrInternalf("invalid event metadata column type: %T", src)
+	}
+	return json.Unmarshal(data, m.md)
+}
+
 func newQueries(conn xsql.DB, c *Config) queries {
 	return queries{
-		batchInsertQueryBase:   fmt.Sprintf(batchInsertQueryBase, c.eventTableName()),
-		getEventStream:         conn.Rebind(fmt.Sprintf(getEventStreamQuery, c.eventTableName())),
-		saveSnapshot:           conn.Rebind(fmt.Sprintf(saveSnapshotQuery, c.snapshotTableName())),
-		getSnapshot:            conn.Rebind(fmt.Sprintf(getSnapshotQuery, c.snapshotTableName())),
-		getStreamAfterRevision: conn.Rebind(fmt.Sprintf(getStreamFromRevisionQuery, c.eventTableName())),
-		insertEvent:            conn.Rebind(fmt.Sprintf(insertEventQuery, c.eventTableName())),
-		insertAggregate:        conn.Rebind(fmt.Sprintf(insertAggregate, c.aggregateTableName())),
-		listNextAggregates:     conn.Rebind(fmt.Sprintf(listNextAggregates, c.aggregateTableName())),
-		listEventStreamQuery:   conn.Rebind(fmt.Sprintf(listEventStreamQuery, c.eventTableName())),
-		registerHandler:        conn.Rebind(fmt.Sprintf(registerHandler, c.handlerTableName())),
-		listHandlers:           conn.Rebind(fmt.Sprintf(listHandlers, c.handlerTableName())),
-		updateEventState:       conn.Rebind(fmt.Sprintf(updateEventState, c.eventStateTableName())),
-		insertEventState:       conn.Rebind(fmt.Sprintf(insertEventState, c.eventStateTableName(), c.handlerTableName())),
-		insertHandlingFailure:  conn.Rebind(fmt.Sprintf(insertHandlingFailure, c.eventHandleFailureTableName())),
-		findHandlerEvents:      conn.Rebind(fmt.Sprintf(findHandlerEvents, c.eventStateTableName())),
-		findHandlingFailures:   conn.Rebind(fmt.Sprintf(findHandlingFailures, c.eventHandleFailureTableName())),
+		batchInsertQueryBase:    fmt.Sprintf(batchInsertQueryBase, c.eventTableName()),
+		insertOutboxQueryBase:   fmt.Sprintf(insertOutboxQueryBase, c.outboxTableName()),
+		getEventStream:          conn.Rebind(fmt.Sprintf(getEventStreamQuery, c.eventTableName())),
+		saveSnapshot:            conn.Rebind(fmt.Sprintf(saveSnapshotQuery, c.snapshotTableName())),
+		getSnapshot:             conn.Rebind(fmt.Sprintf(getSnapshotQuery, c.snapshotTableName())),
+		snapshotPruneCutoff:     conn.Rebind(fmt.Sprintf(snapshotPruneCutoffQuery, c.snapshotTableName())),
+		pruneSnapshots:          conn.Rebind(fmt.Sprintf(pruneSnapshotsQuery, c.snapshotTableName())),
+		getStreamAfterRevision:  conn.Rebind(fmt.Sprintf(getStreamFromRevisionQuery, c.eventTableName())),
+		getStreamUntilRevision:  conn.Rebind(fmt.Sprintf(getStreamUntilRevisionQuery, c.eventTableName())),
+		getStreamUntilTimestamp: conn.Rebind(fmt.Sprintf(getStreamUntilTimestampQuery, c.eventTableName())),
+		getSnapshotAtRevision:   conn.Rebind(fmt.Sprintf(getSnapshotAtRevisionQuery, c.snapshotTableName())),
+		getSnapshotAtTimestamp:  conn.Rebind(fmt.Sprintf(getSnapshotAtTimestampQuery, c.snapshotTableName())),
+		insertEvent:             conn.Rebind(fmt.Sprintf(insertEventQuery, c.eventTableName())),
+		insertAggregate:         conn.Rebind(fmt.Sprintf(insertAggregate, c.aggregateTableName())),
+		listNextAggregates:      fmt.Sprintf(listNextAggregates, c.aggregateTableName()),
+		countAggregates:         conn.Rebind(fmt.Sprintf(countAggregatesQuery, c.aggregateTableName())),
+		aggregateExists:         conn.Rebind(fmt.Sprintf(aggregateExistsQuery, c.aggregateTableName())),
+		listEventStreamQuery:    conn.Rebind(fmt.Sprintf(listEventStreamQuery, c.eventTableName())),
+		excludeDeleted:          fmt.Sprintf(excludeDeletedQuery, c.eventTableName()),
+		registerHandler:         conn.Rebind(fmt.Sprintf(registerHandler, c.handlerTableName())),
+		listHandlers:            conn.Rebind(fmt.Sprintf(listHandlers, c.handlerTableName())),
+		updateEventState:        conn.Rebind(fmt.Sprintf(updateEventState, c.eventStateTableName())),
+		insertEventState:        conn.Rebind(fmt.Sprintf(insertEventState, c.eventStateTableName(), c.handlerTableName())),
+		insertHandlingFailure:   conn.Rebind(fmt.Sprintf(insertHandlingFailure, c.eventHandleFailureTableName())),
+		findHandlerEvents:       conn.Rebind(fmt.Sprintf(findHandlerEvents, c.eventStateTableName())),
+		findHandlingFailures:    conn.Rebind(fmt.Sprintf(findHandlingFailures, c.eventHandleFailureTableName())),
 	}
 }
@@ -0,0 +1,69 @@
+package esxsql
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kucjac/cleango/database/es"
+)
+
+// QueryEvents gets the events matching given query, ordered by their global position.
+// Implements es.StorageBase interface.
+func (s *storage) QueryEvents(ctx context.Context, query *es.EventQuery) ([]*es.Event, error) {
+	q, args := s.buildEventQuery(query)
+	return s.queryEvents(ctx, q, args...)
+}
+
+func (s *storage) buildEventQuery(query *es.EventQuery) (string, []interface{}) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	inCondition := func(column string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		sb := strings.Builder{}
+		sb.WriteString(column)
+		sb.WriteString(" IN (")
+		for i, v := range values {
+			sb.WriteRune('?')
+			args = append(args, v)
+			if i != len(values)-1 {
+				sb.WriteRune(',')
+			}
+		}
+		sb.WriteRune(')')
+		conditions = append(conditions, sb.String())
+	}
+	condition := func(cond string, arg int64) {
+		if arg == 0 {
+			return
+		}
+		conditions = append(conditions, cond)
+		args = append(args, arg)
+	}
+	inCondition("aggregate_id", query.AggregateIDs)
+	inCondition("aggregate_type", query.AggregateTypes)
+	inCondition("event_type", query.EventTypes)
+	condition("timestamp >= ?", query.FromTimestamp)
+	condition("timestamp <= ?", query.ToTimestamp)
+	condition("id > ?", query.AfterPosition)
+	condition("id < ?", query.BeforePosition)
+
+	sb := strings.Builder{}
+	sb.WriteString(s.query.listEventStreamQuery)
+	if len(conditions) > 0 {
+		sb.WriteString("WHERE ")
+		sb.WriteString(strings.Join(conditions, " AND "))
+	}
+	sb.WriteString(" ORDER BY id")
+	if query.Descending {
+		sb.WriteString(" DESC")
+	}
+	if query.Limit > 0 {
+		sb.WriteString(" LIMIT ?")
+		args = append(args, query.Limit)
+	}
+	return s.conn.Rebind(sb.String()), args
+}
@@ -0,0 +1,143 @@
+package esxsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/xsql"
+)
+
+// Compile time check if Storage implements es.ReservationStorage interface.
+var _ es.ReservationStorage = (*Storage)(nil)
+
+// GetReservation gets the reservation of the value within the scope.
+// The storage needs to have the ReservationTable configured.
+// Implements es.ReservationStorage interface.
+func (s *storage) GetReservation(ctx context.Context, scope, value string) (*es.Reservation, error) {
+	if s.cfg.ReservationTable == "" {
+		return nil, cgerrors.ErrFailedPrecondition("reservation table is not configured")
+	}
+	r, err := getReservation(ctx, s.conn, s.cfg, scope, value)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, cgerrors.ErrNotFoundf("reservation of value: '%s' within the scope: %s not found", value, scope)
+	}
+	return r, nil
+}
+
+// ListReservations lists the reservations of given aggregate, ordered by the scope and value.
+// The storage needs to have the ReservationTable configured.
+// Implements es.ReservationStorage interface.
+func (s *storage) ListReservations(ctx context.Context, aggId, aggType string) ([]*es.Reservation, error) {
+	if s.cfg.ReservationTable == "" {
+		return nil, cgerrors.ErrFailedPrecondition("reservation table is not configured")
+	}
+	query := s.conn.Rebind(fmt.Sprintf(listReservationsQuery, s.cfg.reservationTableName()))
+	rows, err := s.conn.QueryContext(ctx, query, aggId, aggType)
+	if err != nil {
+		return nil, cgerrors.New("", err.Error(), s.conn.ErrorCode(err))
+	}
+	defer rows.Close()
+
+	var reservations []*es.Reservation
+	for rows.Next() {
+		r := &es.Reservation{AggregateID: aggId, AggregateType: aggType}
+		if err = rows.Scan(&r.Scope, &r.Value, &r.ReservedAt); err != nil {
+			return nil, cgerrors.ErrInternalf("scanning reservation row failed: %v", err)
+		}
+		reservations = append(reservations, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, cgerrors.New("", err.Error(), s.conn.ErrorCode(err))
+	}
+	return reservations, nil
+}
+
+// reservationChanges gets the reservation changes of the events. The events carrying the changes could be stored
+// only if the ReservationTable is configured.
+func (s *storage) reservationChanges(events []*es.Event) ([]*es.ReservationChange, error) {
+	changes, err := es.EventReservationChanges(events)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) > 0 && s.cfg.ReservationTable == "" {
+		return nil, cgerrors.ErrFailedPrecondition("events carry reservation changes, but the reservation table is not configured")
+	}
+	return changes, nil
+}
+
+// applyReservations applies the reservation changes within given transaction.
+// The value reserved by another aggregate results in the *es.ReservationTakenError.
+func (s *storage) applyReservations(ctx context.Context, tx *xsql.Tx, changes []*es.ReservationChange) error {
+	table := s.cfg.reservationTableName()
+	for _, c := range changes {
+		if c.Op == es.ReservationRelease {
+			query := tx.Rebind(fmt.Sprintf(releaseReservationQuery, table))
+			if _, err := tx.ExecContext(ctx, query, c.Scope, c.Value, c.AggregateID, c.AggregateType); err != nil {
+				return err
+			}
+			continue
+		}
+		if c.Op != es.ReservationReserve && c.Op != es.ReservationTransfer {
+			return cgerrors.ErrInvalidArgumentf("unknown reservation operation: %s", c.Op)
+		}
+
+		current, err := getReservation(ctx, tx, s.cfg, c.Scope, c.Value)
+		if err != nil {
+			return err
+		}
+		var query string
+		args := []interface{}{c.AggregateID, c.AggregateType, c.Timestamp, c.Scope, c.Value}
+		switch {
+		case current == nil:
+			query = insertReservationQuery
+		case current.AggregateID == c.AggregateID && current.AggregateType == c.AggregateType:
+			// The value is already reserved by the aggregate.
+			continue
+		case c.Op == es.ReservationTransfer && current.AggregateID == c.FromAggregateID && current.AggregateType == c.FromAggregateType:
+			// The value is taken over only if it is still reserved by the aggregate it is transferred from.
+			query = transferReservationQuery
+			args = append(args, c.FromAggregateID, c.FromAggregateType)
+		default:
+			return &es.ReservationTakenError{Scope: c.Scope, Value: c.Value}
+		}
+		res, err := tx.ExecContext(ctx, tx.Rebind(fmt.Sprintf(query, table)), args...)
+		if err != nil {
+			if tx.ErrorCode(err) == cgerrors.CodeAlreadyExists {
+				// The value was reserved by the concurrent transaction.
+				return &es.ReservationTakenError{Scope: c.Scope, Value: c.Value}
+			}
+			return err
+		}
+		if query == transferReservationQuery {
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				// The value was released and reserved by another aggregate in the meantime.
+				return &es.ReservationTakenError{Scope: c.Scope, Value: c.Value}
+			}
+		}
+	}
+	return nil
+}
+
+func getReservation(ctx context.Context, conn xsql.DB, cfg *Config, scope, value string) (*es.Reservation, error) {
+	query := conn.Rebind(fmt.Sprintf(getReservationQuery, cfg.reservationTableName()))
+	r := &es.Reservation{Scope: scope, Value: value}
+	err := conn.QueryRowContext(ctx, query, scope, value).Scan(&r.AggregateID, &r.AggregateType, &r.ReservedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, cgerrors.New("", err.Error(), conn.ErrorCode(err))
+	}
+	return r, nil
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/kucjac/cleango/database/xsql"
 	"github.com/kucjac/cleango/pkg/xlog"
+	"github.com/kucjac/cleango/xblob"
 	uuid "github.com/satori/go.uuid"
 
 	"github.com/kucjac/cleango/cgerrors"
@@ -63,9 +64,10 @@ func (s *Storage) As(dst interface{}) error {
 
 // storage is the internal common implementation of the es.StorageBase for both Storage and Transaction.
 type storage struct {
-	conn  xsql.DB
-	cfg   *Config
-	query queries
+	conn    xsql.DB
+	cfg     *Config
+	query   queries
+	archive xblob.Bucket
 }
 
 // ErrorCode gets the error code related to given error.
@@ -86,41 +88,47 @@ func (s *storage) Err(err error) error {
 }
 
 // SaveEvents stores provided events in the database.
+// If the outbox table is configured, the events are also written to the outbox within the same transaction.
+// The reservation changes carried by the events are applied on the reservation table within the same transaction.
 // Implements eventsource.Storage interface.
 func (s *storage) SaveEvents(ctx context.Context, es []*es.Event) error {
 	var (
 		query  string
 		values []interface{}
 	)
-	switch len(es) {
-	case 0:
+	if len(es) == 0 {
 		return nil
+	}
+	if err := s.checkArchived(ctx, es); err != nil {
+		return err
+	}
+	reservations, err := s.reservationChanges(es)
+	if err != nil {
+		return err
+	}
+	switch len(es) {
 	case 1:
 		e := es[0]
 		query = s.query.insertEvent
-		values = []interface{}{
-			e.AggregateId,
-			e.AggregateType,
-			e.Revision,
-			e.Timestamp,
-			e.EventId,
-			e.EventType,
-			e.EventData,
-		}
+		values = eventValues(e)
 
-		var err error
 		// If this is initial aggregate revision insert new entry in the aggregate table.
-		if e.Revision == 1 {
+		if e.Revision == 1 || s.cfg.OutboxTable != "" || len(reservations) > 0 {
 			err = xsql.RunInTransaction(ctx, s.conn, func(tx *xsql.Tx) error {
 				_, err := tx.ExecContext(ctx, query, values...)
 				if err != nil {
 					return err
 				}
-				_, err = tx.ExecContext(ctx, s.query.insertAggregate, e.AggregateId, e.AggregateType, e.Timestamp)
-				if err != nil {
+				if e.Revision == 1 {
+					_, err = tx.ExecContext(ctx, s.query.insertAggregate, e.AggregateId, e.AggregateType, e.Timestamp)
+					if err != nil {
+						return err
+					}
+				}
+				if err = s.insertOutbox(ctx, tx, es); err != nil {
 					return err
 				}
-				return nil
+				return s.applyReservations(ctx, tx, reservations)
 			})
 		} else {
 			_, err = s.conn.ExecContext(ctx, query, values...)
@@ -131,9 +139,9 @@ func (s *storage) SaveEvents(ctx context.Context, es []*es.Event) error {
 		return nil
 	default:
 		query = s.conn.Rebind(s.query.batchInsertEvent(len(es)))
-		values = make([]interface{}, 7*len(es))
+		values = make([]interface{}, 0, eventColumnsCount*len(es))
 		var aggregates []aggregate
-		for i, e := range es {
+		for _, e := range es {
 			// Check if the aggregate needs to be inserted.
 			if e.Revision == 1 {
 				aggregates = append(aggregates, aggregate{
@@ -142,16 +150,9 @@ func (s *storage) SaveEvents(ctx context.Context, es []*es.Event) error {
 					Timestamp: e.Timestamp,
 				})
 			}
-
-			values[(i * 7)] = e.AggregateId
-			values[(i*7)+1] = e.AggregateType
-			values[(i*7)+2] = e.Revision
-			values[(i*7)+3] = e.Timestamp
-			values[(i*7)+4] = e.EventId
-			values[(i*7)+5] = e.EventType
-			values[(i*7)+6] = e.EventData
+			values = append(values, eventValues(e)...)
 		}
-		err := xsql.RunInTransaction(ctx, s.conn, func(tx *xsql.Tx) error {
+		err = xsql.RunInTransaction(ctx, s.conn, func(tx *xsql.Tx) error {
 			// Execute the query.
 			_, err := tx.ExecContext(ctx, query, values...)
 			if err != nil {
@@ -162,8 +163,10 @@ func (s *storage) SaveEvents(ctx context.Context, es []*es.Event) error {
 					return err
 				}
 			}
-
-			return err
+			if err = s.insertOutbox(ctx, tx, es); err != nil {
+				return err
+			}
+			return s.applyReservations(ctx, tx, reservations)
 		})
 		if err != nil {
 			xlog.Debugf("Saving events failed: %v", err)
@@ -173,7 +176,20 @@ func (s *storage) SaveEvents(ctx context.Context, es []*es.Event) error {
 	}
 }
 
-// ListEvents gets the event stream for provided aggregate.
+// insertOutbox inserts the outbox entries of the events, if the outbox table is configured.
+func (s *storage) insertOutbox(ctx context.Context, tx *xsql.Tx, events []*es.Event) error {
+	if s.cfg.OutboxTable == "" {
+		return nil
+	}
+	values := make([]interface{}, len(events))
+	for i, e := range events {
+		values[i] = e.EventId
+	}
+	_, err := tx.ExecContext(ctx, tx.Rebind(s.query.insertOutbox(len(events))), values...)
+	return err
+}
+
+// ListEvents gets the event stream for provided aggregate, including its archived events.
 // Implements eventsource.Storage interface.
 func (s *storage) ListEvents(ctx context.Context, aggId, aggType string) ([]*es.Event, error) {
 	rows, err := s.conn.QueryContext(ctx, s.query.getEventStream, aggId, aggType)
@@ -185,19 +201,17 @@ func (s *storage) ListEvents(ctx context.Context, aggId, aggType string) ([]*es.
 	var stream []*es.Event
 	for rows.Next() {
 		e := &es.Event{}
-		// aggregate_id, aggregate_type, revision, timestamp, event_id, event_type, event_data
-		if err = rows.Scan(&e.AggregateId, &e.AggregateType, &e.Revision, &e.Timestamp, &e.EventId, &e.EventType, &e.EventData); err != nil {
+		if err = rows.Scan(eventScanDest(e)...); err != nil {
 			return nil, cgerrors.ErrInternalf("scanning  event row failed: %v", err.Error())
 		}
 		stream = append(stream, e)
 	}
 	if err = rows.Err(); err != nil {
-		if cgerrors.Is(err, sql.ErrNoRows) {
-			return stream, nil
+		if !cgerrors.Is(err, sql.ErrNoRows) {
+			return nil, err
 		}
-		return nil, err
 	}
-	return stream, nil
+	return s.withArchived(ctx, aggId, aggType, 0, nil, stream)
 }
 
 // SaveSnapshot stores the snapshot in the database.
@@ -212,7 +226,41 @@ func (s *storage) SaveSnapshot(ctx context.Context, snap *es.Snapshot) error {
 // Implements eventsource.Storage interface.
 func (s *storage) GetSnapshot(ctx context.Context, aggId string, aggType string, aggVersion int64) (*es.Snapshot, error) {
 	// aggregate_id = ? AND aggregate_type = ? AND aggregate_version = ?
-	row := s.conn.QueryRowContext(ctx, s.query.getSnapshot, aggId, aggType, aggVersion)
+	snap, err := s.querySnapshot(ctx, s.query.getSnapshot, aggId, aggType, aggVersion)
+	if cgerrors.IsNotFound(err) {
+		return s.archivedSnapshot(ctx, aggId, aggType, func(snap *es.Snapshot) bool {
+			return snap.AggregateVersion == aggVersion
+		})
+	}
+	return snap, err
+}
+
+// GetSnapshotAtRevision gets the latest snapshot for given aggregate and its version with the revision lower or equal to provided.
+// Implements eventsource.Storage interface.
+func (s *storage) GetSnapshotAtRevision(ctx context.Context, aggId string, aggType string, aggVersion, revision int64) (*es.Snapshot, error) {
+	snap, err := s.querySnapshot(ctx, s.query.getSnapshotAtRevision, aggId, aggType, aggVersion, revision)
+	if cgerrors.IsNotFound(err) {
+		return s.archivedSnapshot(ctx, aggId, aggType, func(snap *es.Snapshot) bool {
+			return snap.AggregateVersion == aggVersion && snap.Revision <= revision
+		})
+	}
+	return snap, err
+}
+
+// GetSnapshotAtTimestamp gets the latest snapshot for given aggregate and its version with the timestamp lower or equal to provided.
+// Implements eventsource.Storage interface.
+func (s *storage) GetSnapshotAtTimestamp(ctx context.Context, aggId string, aggType string, aggVersion, timestamp int64) (*es.Snapshot, error) {
+	snap, err := s.querySnapshot(ctx, s.query.getSnapshotAtTimestamp, aggId, aggType, aggVersion, timestamp)
+	if cgerrors.IsNotFound(err) {
+		return s.archivedSnapshot(ctx, aggId, aggType, func(snap *es.Snapshot) bool {
+			return snap.AggregateVersion == aggVersion && snap.Timestamp <= timestamp
+		})
+	}
+	return snap, err
+}
+
+func (s *storage) querySnapshot(ctx context.Context, query string, args ...interface{}) (*es.Snapshot, error) {
+	row := s.conn.QueryRowContext(ctx, query, args...)
 	if err := row.Err(); err != nil {
 		return nil, err
 	}
@@ -228,6 +276,37 @@ func (s *storage) GetSnapshot(ctx context.Context, aggId string, aggType string,
 	return &snap, nil
 }
 
+// ListSnapshots lists all the snapshots of given aggregate, of all its versions, ordered by the revision.
+// The archived snapshots of the aggregate are listed first.
+// Implements eventsource.Storage interface.
+func (s *storage) ListSnapshots(ctx context.Context, aggId string, aggType string) ([]*es.Snapshot, error) {
+	snapshots, err := s.listSnapshots(ctx, aggId, aggType)
+	if err != nil {
+		return nil, err
+	}
+	seg, err := s.archivedSegment(ctx, aggId, aggType, 0)
+	if err != nil || seg == nil {
+		return snapshots, err
+	}
+	return append(seg.Snapshots, snapshots...), nil
+}
+
+// PruneSnapshots deletes the snapshots of given aggregate and its version, except the latest keep ones.
+// Implements eventsource.Storage interface.
+func (s *storage) PruneSnapshots(ctx context.Context, aggId string, aggType string, aggVersion int64, keep int) error {
+	// Find the revision of the latest snapshot that exceeds the retention.
+	var cutoff int64
+	row := s.conn.QueryRowContext(ctx, s.query.snapshotPruneCutoff, aggId, aggType, aggVersion, keep)
+	if err := row.Scan(&cutoff); err != nil {
+		if cgerrors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	_, err := s.conn.ExecContext(ctx, s.query.pruneSnapshots, aggId, aggType, aggVersion, cutoff)
+	return err
+}
+
 // ListEventsAfterRevision gets the event stream for given aggregate where the revision is subsequent from provided.
 func (s *storage) ListEventsAfterRevision(ctx context.Context, aggId string, aggType string, after int64) ([]*es.Event, error) {
 	rows, err := s.conn.QueryContext(ctx, s.query.getStreamAfterRevision, aggId, aggType, after)
@@ -239,8 +318,7 @@ func (s *storage) ListEventsAfterRevision(ctx context.Context, aggId string, agg
 	var stream []*es.Event
 	for rows.Next() {
 		e := &es.Event{}
-		// aggregate_id, aggregate_type, revision, timestamp, event_id, event_type, event_data
-		if err = rows.Scan(&e.AggregateId, &e.AggregateType, &e.Revision, &e.Timestamp, &e.EventId, &e.EventType, &e.EventData); err != nil {
+		if err = rows.Scan(eventScanDest(e)...); err != nil {
 			return nil, cgerrors.ErrInternalf("scanning  event row failed: %v", err.Error())
 		}
 		stream = append(stream, e)
@@ -254,6 +332,48 @@ func (s *storage) ListEventsAfterRevision(ctx context.Context, aggId string, agg
 		}
 		return nil, cgerrors.ErrInternal(err.Error())
 	}
+	return s.withArchived(ctx, aggId, aggType, after, nil, stream)
+}
+
+// ListEventsUntilRevision gets the event stream for given aggregate with the revision in the range (after, until].
+// Implements eventsource.Storage interface.
+func (s *storage) ListEventsUntilRevision(ctx context.Context, aggId string, aggType string, after, until int64) ([]*es.Event, error) {
+	events, err := s.queryEvents(ctx, s.query.getStreamUntilRevision, aggId, aggType, after, until)
+	if err != nil {
+		return nil, err
+	}
+	return s.withArchived(ctx, aggId, aggType, after, func(e *es.Event) bool { return e.Revision <= until }, events)
+}
+
+// ListEventsUntilTimestamp gets the event stream for given aggregate with the revision greater than after,
+// and the timestamp lower or equal to until.
+// Implements eventsource.Storage interface.
+func (s *storage) ListEventsUntilTimestamp(ctx context.Context, aggId string, aggType string, after, until int64) ([]*es.Event, error) {
+	events, err := s.queryEvents(ctx, s.query.getStreamUntilTimestamp, aggId, aggType, after, until)
+	if err != nil {
+		return nil, err
+	}
+	return s.withArchived(ctx, aggId, aggType, after, func(e *es.Event) bool { return e.Timestamp <= until }, events)
+}
+
+func (s *storage) queryEvents(ctx context.Context, query string, args ...interface{}) ([]*es.Event, error) {
+	rows, err := s.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, cgerrors.New("", err.Error(), s.conn.ErrorCode(err))
+	}
+	defer rows.Close()
+
+	var stream []*es.Event
+	for rows.Next() {
+		e := &es.Event{}
+		if err = rows.Scan(eventScanDest(e)...); err != nil {
+			return nil, cgerrors.ErrInternalf("scanning  event row failed: %v", err.Error())
+		}
+		stream = append(stream, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, cgerrors.New("", err.Error(), s.conn.ErrorCode(err))
+	}
 	return stream, nil
 }
 
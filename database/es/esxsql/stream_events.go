@@ -2,14 +2,23 @@ package esxsql
 
 import (
 	"context"
+	"fmt"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/kucjac/cleango/cgerrors"
 	"github.com/kucjac/cleango/database/es"
 	"github.com/kucjac/cleango/database/xsql"
 	"github.com/kucjac/cleango/pkg/xlog"
 )
 
+// defaultFollowInterval is the default interval between the queries for new events in follow mode.
+const defaultFollowInterval = time.Second
+
+// defaultStreamGapTimeout is the default timeout of the gaps in the event ids, after which the streams pass them.
+const defaultStreamGapTimeout = 5 * time.Second
+
 type streamEventsCursor struct {
 	ctx         context.Context
 	cancelFunc  context.CancelFunc
@@ -17,88 +26,182 @@ type streamEventsCursor struct {
 	conn        xsql.DB
 	s           *storage
 	req         *es.StreamEventsRequest
-	lastTakenID uint64
+	lastTakenID int64
 	query       queries
 	limit       int64
+	interval    time.Duration
+	// watermark is the event id up to which there are no gaps, which could still be filled by the pending transactions.
+	// It is used only if the gapTimeout is set.
+	watermark  int64
+	gapTimeout time.Duration
+	idsQuery   string
+	gapStart   int64
+	gapSeen    time.Time
+	// gapDeadline is the time after which the gap stopping the watermark is passed. It is zero if there is no such gap.
+	gapDeadline time.Time
 }
 
 func (s *storage) newStreamCursor(ctx context.Context, req *es.StreamEventsRequest) *streamEventsCursor {
 	ctx, cancelFunc := context.WithCancel(ctx)
+	limit := int64(req.BuffSize)
+	if limit == 0 {
+		limit = 100
+	}
+	interval := s.cfg.FollowInterval
+	if interval == 0 {
+		interval = defaultFollowInterval
+	}
 	return &streamEventsCursor{
-		ctx:        ctx,
-		cancelFunc: cancelFunc,
-		conn:       s.conn,
-		query:      s.query,
-		limit:      int64(req.BuffSize),
-		s:          s,
-		req:        req,
+		ctx:         ctx,
+		cancelFunc:  cancelFunc,
+		conn:        s.conn,
+		query:       s.query,
+		limit:       limit,
+		s:           s,
+		req:         req,
+		lastTakenID: req.FromPosition,
+		interval:    interval,
+		watermark:   req.FromPosition,
+		gapTimeout:  s.cfg.StreamGapTimeout,
+		idsQuery:    s.conn.Rebind(fmt.Sprintf(listEventIdsQuery, s.cfg.eventTableName())),
 	}
 }
 
 func (c *streamEventsCursor) openChannel() (<-chan *es.Event, error) {
-	ch := make(chan *es.Event, c.limit)
+	ch := make(chan *es.Event, c.req.BuffSize)
 	go c.startReadingEvents(ch)
 	return ch, nil
 }
 
 func (c *streamEventsCursor) startReadingEvents(ca chan *es.Event) {
-	var err error
+	defer close(ca)
+	defer c.cancelFunc()
 
 	q := c.buildQuery()
 	for {
-		select {
-		case <-c.ctx.Done():
-			err = c.ctx.Err()
-			break
-		default:
+		var advanced bool
+		if c.gapTimeout > 0 && c.lastTakenID >= c.watermark {
+			prev := c.watermark
+			if err := c.advanceWatermark(); err != nil {
+				if c.ctx.Err() == nil {
+					c.fail("reading event ids failed", err)
+				}
+				return
+			}
+			advanced = c.watermark > prev
 		}
-
-		var rows *xsql.Rows
-		rows, err = c.conn.QueryContext(c.ctx, q.query, append(q.args, c.lastTakenID, c.limit)...)
+		rowsCount, err := c.readBatch(q, ca)
 		if err != nil {
-			if c.conn.CanRetry(err) {
-				continue
+			if c.ctx.Err() == nil {
+				c.fail("reading events failed", err)
 			}
-			break
+			return
+		}
+		if c.gapTimeout > 0 && int64(rowsCount) < c.limit {
+			// All the matching events up to the watermark are read.
+			c.lastTakenID = c.watermark
+		}
+		if rowsCount != 0 || advanced {
+			continue
 		}
 
-		var rowsCount int
-		for rows.Next() {
-			var (
-				id uint64
-				e  es.Event
-			)
-			// id, aggregate_id, aggregate_type, revision, timestamp, event_id, event_type, event_data
-			if err = rows.Scan(&id, &e.AggregateId, &e.AggregateType, &e.Revision, &e.Timestamp, &e.EventId, &e.EventType, &e.EventData); err != nil {
-				break
+		// If there is no more rows to read either close the channel, or wait for new events in follow mode.
+		// The stream which doesn't follow, waits until the gap stopping the watermark times out, so that the events
+		// committed after it are not skipped.
+		wait := c.interval
+		if !c.req.Follow {
+			if c.gapDeadline.IsZero() {
+				return
 			}
+			wait = time.Until(c.gapDeadline)
+		}
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
 
-			c.lastTakenID = id
-			ca <- &e
-			rowsCount++
-			// Either error channel context or workers are finished.
-			select {
-			case <-c.ctx.Done():
-				err = c.ctx.Err()
+// fail logs the error stopping the stream and reports it to the request error handler.
+func (c *streamEventsCursor) fail(msg string, err error) {
+	xlog.Errorf("%s: %v", msg, err)
+	if c.req.OnError != nil {
+		c.req.OnError(cgerrors.New("", fmt.Sprintf("%s: %v", msg, err), c.s.conn.ErrorCode(err)))
+	}
+}
+
+// advanceWatermark moves the watermark over the event ids following it with no gaps. A gap could be left by a transaction,
+// which is not committed yet, thus the watermark stops before it until the gap is older than the gap timeout.
+func (c *streamEventsCursor) advanceWatermark() error {
+	rows, err := c.conn.QueryContext(c.ctx, c.idsQuery, c.watermark, c.limit)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	c.gapDeadline = time.Time{}
+	for rows.Next() {
+		var id, timestamp int64
+		if err = rows.Scan(&id, &timestamp); err != nil {
+			return err
+		}
+		if id != c.watermark+1 {
+			if c.gapStart != c.watermark+1 {
+				c.gapStart, c.gapSeen = c.watermark+1, now
+			}
+			if eventTime := time.Unix(0, timestamp); now.Sub(c.gapSeen) < c.gapTimeout && now.Sub(eventTime) < c.gapTimeout {
+				if eventTime.Before(c.gapSeen) {
+					c.gapDeadline = eventTime.Add(c.gapTimeout)
+				} else {
+					c.gapDeadline = c.gapSeen.Add(c.gapTimeout)
+				}
 				break
-			default:
 			}
 		}
-		rows.Close()
-		if err != nil {
-			break
-		}
+		c.watermark = id
+	}
+	return rows.Err()
+}
 
-		// If there is no more rows to read break the loop and close the channel.
-		if rowsCount == 0 {
+// readBatch reads the next batch of the events after the last taken position and sends them to the channel.
+func (c *streamEventsCursor) readBatch(q *streamEventsQuery, ca chan *es.Event) (int, error) {
+	var (
+		rows *xsql.Rows
+		err  error
+	)
+	for {
+		args := append(append([]interface{}{}, q.args...), c.lastTakenID)
+		if c.gapTimeout > 0 {
+			args = append(args, c.watermark)
+		}
+		rows, err = c.conn.QueryContext(c.ctx, q.query, append(args, c.limit)...)
+		if err == nil {
 			break
 		}
+		if !c.conn.CanRetry(err) || c.ctx.Err() != nil {
+			return 0, err
+		}
 	}
-	if err != nil {
-		xlog.Errorf("reading aggregates failed: %v", err)
-	}
+	defer rows.Close()
 
-	close(ca)
+	var rowsCount int
+	for rows.Next() {
+		e := &es.Event{}
+		// Scan the selectEventColumns.
+		if err = rows.Scan(eventScanDest(e)...); err != nil {
+			return rowsCount, err
+		}
+		select {
+		case <-c.ctx.Done():
+			return rowsCount, c.ctx.Err()
+		case ca <- e:
+		}
+		c.lastTakenID = e.Position
+		rowsCount++
+	}
+	return rowsCount, rows.Err()
 }
 
 type streamEventsQuery struct {
@@ -107,74 +210,50 @@ type streamEventsQuery struct {
 }
 
 func (c *streamEventsCursor) buildQuery() *streamEventsQuery {
-	sb := strings.Builder{}
-	sb.WriteString(c.query.listEventStreamQuery)
-	sb.WriteString("WHERE ")
-
 	q := streamEventsQuery{}
-	if len(c.req.AggregateIDs) != 0 {
-		sb.WriteString("aggregate_id IN (")
-		for i, id := range c.req.AggregateIDs {
-			sb.WriteRune('?')
-			q.args = append(q.args, id)
-			if i != len(c.req.AggregateIDs)-1 {
-				sb.WriteRune(',')
-			}
+	var conditions []string
+	inCondition := func(column string, not bool, values []string) {
+		if len(values) == 0 {
+			return
 		}
-		sb.WriteString(") ")
-
-	}
-
-	if len(c.req.AggregateTypes) != 0 {
-		sb.WriteString("aggregate_type IN (")
-		for i := range c.req.AggregateTypes {
-			sb.WriteRune('?')
-			if i != len(c.req.AggregateTypes)-1 {
-				sb.WriteRune(',')
-			}
+		sb := strings.Builder{}
+		sb.WriteString(column)
+		if not {
+			sb.WriteString(" NOT")
 		}
-		sb.WriteString(") ")
-	}
-
-	if len(c.req.AggregateTypes) != 0 {
-		sb.WriteString("aggregate_type IN (")
-		for i, tp := range c.req.AggregateTypes {
+		sb.WriteString(" IN (")
+		for i, v := range values {
 			sb.WriteRune('?')
-			q.args = append(q.args, tp)
-			if i != len(c.req.AggregateTypes)-1 {
+			q.args = append(q.args, v)
+			if i != len(values)-1 {
 				sb.WriteRune(',')
 			}
 		}
-		sb.WriteString(") ")
+		sb.WriteRune(')')
+		conditions = append(conditions, sb.String())
 	}
-
-	if len(c.req.EventTypes) != 0 {
-		sb.WriteString("event_type IN (")
-		for i, tp := range c.req.EventTypes {
-			sb.WriteRune('?')
-			q.args = append(q.args, tp)
-			if i != len(c.req.EventTypes)-1 {
-				sb.WriteRune(',')
-			}
-		}
-		sb.WriteString(") ")
+	inCondition("aggregate_id", false, c.req.AggregateIDs)
+	inCondition("aggregate_type", false, c.req.AggregateTypes)
+	inCondition("event_type", false, c.req.EventTypes)
+	inCondition("event_type", true, c.req.ExcludeEventTypes)
+	if c.req.FromTimestamp != 0 {
+		conditions = append(conditions, "timestamp >= ?")
+		q.args = append(q.args, c.req.FromTimestamp)
 	}
-
-	if len(c.req.ExcludeEventTypes) != 0 {
-		sb.WriteString("event_type NOT IN (")
-		for i, tp := range c.req.EventTypes {
-			sb.WriteRune('?')
-			q.args = append(q.args, tp)
-			if i != len(c.req.EventTypes)-1 {
-				sb.WriteRune(',')
-			}
-		}
-		sb.WriteString(") ")
+	if c.req.ExcludeDeleted {
+		conditions = append(conditions, c.query.excludeDeleted)
+		q.args = append(q.args, es.TombstoneEventType)
+	}
+	conditions = append(conditions, "id > ?")
+	if c.gapTimeout > 0 {
+		conditions = append(conditions, "id <= ?")
 	}
 
-	sb.WriteString("id > ? ")
-	sb.WriteString("ORDER BY id ")
-	sb.WriteString("LIMIT ?")
+	sb := strings.Builder{}
+	sb.WriteString(c.query.listEventStreamQuery)
+	sb.WriteString("WHERE ")
+	sb.WriteString(strings.Join(conditions, " AND "))
+	sb.WriteString(" ORDER BY id LIMIT ?")
 
 	q.query = c.conn.Rebind(sb.String())
 	return &q
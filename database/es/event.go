@@ -9,6 +9,21 @@ type EventMessage interface {
 	MessageType() string
 }
 
+// VersionedEventMessage is an optional interface of the event message that defines the schema version of the message.
+// Messages that doesn't implement it are stored with the version 0.
+type VersionedEventMessage interface {
+	EventMessage
+	MessageVersion() int32
+}
+
+// MessageVersion gets the schema version of given event message.
+func MessageVersion(msg EventMessage) int32 {
+	if vm, ok := msg.(VersionedEventMessage); ok {
+		return vm.MessageVersion()
+	}
+	return 0
+}
+
 // Copy creates a copy of given event.
 func (x *Event) Copy() *Event {
 	return &Event{
@@ -19,6 +34,14 @@ func (x *Event) Copy() *Event {
 		EventData:     x.EventData,
 		Timestamp:     x.Timestamp,
 		Revision:      x.Revision,
+		EventVersion:  x.EventVersion,
+		Position:      x.Position,
+		Metadata:      copyMetadata(x.Metadata),
+		CorrelationId: x.CorrelationId,
+		CausationId:   x.CausationId,
+		Actor:         x.Actor,
+		PreviousHash:  x.PreviousHash,
+		Hash:          x.Hash,
 	}
 }
 
@@ -0,0 +1,94 @@
+package es
+
+import (
+	"context"
+
+	"github.com/kucjac/cleango/pkg/xmeta"
+)
+
+type (
+	correlationIDCtxKey struct{}
+	causationIDCtxKey   struct{}
+	eventMetadataCtxKey struct{}
+)
+
+// WithCorrelationID sets the correlation id of the events created with the resulting context.
+// If not set, the correlation id is taken from the xmeta incoming request id.
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDCtxKey{}, correlationID)
+}
+
+// WithCausationID sets the identifier of the message (command or event) that causes the events
+// created with the resulting context.
+func WithCausationID(ctx context.Context, causationID string) context.Context {
+	return context.WithValue(ctx, causationIDCtxKey{}, causationID)
+}
+
+// WithCausingEvent sets up the context for the events caused by handling of given event.
+// The event becomes the cause of the new events, and its correlation id is passed on.
+func WithCausingEvent(ctx context.Context, e *Event) context.Context {
+	ctx = WithCausationID(ctx, e.EventId)
+	if e.CorrelationId != "" {
+		ctx = WithCorrelationID(ctx, e.CorrelationId)
+	}
+	return ctx
+}
+
+// WithEventMetadata adds the key-value metadata of the events created with the resulting context.
+func WithEventMetadata(ctx context.Context, md map[string]string) context.Context {
+	merged := copyMetadata(eventMetadataFromContext(ctx))
+	if merged == nil {
+		merged = make(map[string]string, len(md))
+	}
+	for k, v := range md {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, eventMetadataCtxKey{}, merged)
+}
+
+// SetContextMetadata fills the metadata of the event that is not set yet, with the values stored in the context.
+// The correlation id defaults to the xmeta incoming request id, and the actor to the xmeta incoming user id.
+func (x *Event) SetContextMetadata(ctx context.Context) {
+	if x.CorrelationId == "" {
+		if id, ok := ctx.Value(correlationIDCtxKey{}).(string); ok {
+			x.CorrelationId = id
+		} else if id, ok = xmeta.IncomingCtxRequestID(ctx); ok {
+			x.CorrelationId = id
+		}
+	}
+	if x.CausationId == "" {
+		if id, ok := ctx.Value(causationIDCtxKey{}).(string); ok {
+			x.CausationId = id
+		}
+	}
+	if x.Actor == "" {
+		if id, ok := xmeta.IncomingCtxUserID(ctx); ok {
+			x.Actor = id
+		}
+	}
+	for k, v := range eventMetadataFromContext(ctx) {
+		if _, ok := x.Metadata[k]; ok {
+			continue
+		}
+		if x.Metadata == nil {
+			x.Metadata = map[string]string{}
+		}
+		x.Metadata[k] = v
+	}
+}
+
+func eventMetadataFromContext(ctx context.Context) map[string]string {
+	md, _ := ctx.Value(eventMetadataCtxKey{}).(map[string]string)
+	return md
+}
+
+func copyMetadata(md map[string]string) map[string]string {
+	if md == nil {
+		return nil
+	}
+	cp := make(map[string]string, len(md))
+	for k, v := range md {
+		cp[k] = v
+	}
+	return cp
+}
@@ -0,0 +1,63 @@
+package es_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kucjac/cleango/codec"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esmem"
+	"github.com/kucjac/cleango/pkg/xmeta"
+)
+
+func TestEventMetadata(t *testing.T) {
+	const (
+		aggId     = "1f0cb1a5-5d4b-4b35-b2e5-7f2a3f7bb5c1"
+		requestID = "d1c5e2b3-9f0c-4a6b-8f6a-2c5d9f1b3e7a"
+		userID    = "user-1"
+	)
+	storage := esmem.New()
+	store, err := es.New(es.DefaultConfig(), codec.JSON(), codec.JSON(), storage)
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+
+	ctx := xmeta.IncomingCtxSetRequestID(context.Background(), requestID)
+	ctx = xmeta.IncomingCtxSetUserID(ctx, userID)
+
+	t.Run("SetEventCtx", func(t *testing.T) {
+		agg := getTestAggregate(store, aggId)
+		ctx := es.WithEventMetadata(ctx, map[string]string{"source": "test"})
+		if err := agg.Base.SetEventCtx(ctx, &aggregateCreated{}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		e := agg.Base.UncommittedEvents()[0]
+		if e.CorrelationId != requestID || e.Actor != userID || e.Metadata["source"] != "test" {
+			t.Errorf("unexpected event metadata: %v", e)
+		}
+
+		caused := &es.Event{}
+		caused.SetContextMetadata(es.WithCausingEvent(context.Background(), e))
+		if caused.CausationId != e.EventId || caused.CorrelationId != requestID {
+			t.Errorf("unexpected caused event metadata: %v", caused)
+		}
+	})
+
+	t.Run("Commit", func(t *testing.T) {
+		agg := getTestAggregate(store, aggId)
+		if err := agg.Base.SetEvent(&aggregateCreated{}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		ctx := es.WithCorrelationID(ctx, "correlation")
+		if err := store.Commit(ctx, agg); err != nil {
+			t.Fatalf("committing failed: %v", err)
+		}
+		events, err := storage.ListEvents(ctx, aggId, aggregateType)
+		if err != nil {
+			t.Fatalf("listing events failed: %v", err)
+		}
+		if len(events) != 1 || events[0].CorrelationId != "correlation" || events[0].Actor != userID {
+			t.Errorf("unexpected stored events: %v", events)
+		}
+	})
+}
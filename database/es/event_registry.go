@@ -0,0 +1,133 @@
+package es
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/kucjac/cleango/cgerrors"
+)
+
+// EventRegistry maps the event types of the aggregate A to the typed handlers of their messages.
+// It allows to implement the Aggregate.Apply method without the switch over the event types:
+//
+//	var registry = es.NewEventRegistry[*Order]("order")
+//
+//	func init() {
+//		es.MustRegister(es.RegisterHandler(registry, (*Order).applyCreated))
+//	}
+//
+//	func (o *Order) Apply(e *es.Event) error {
+//		return registry.Apply(o, e)
+//	}
+//
+// The event data is decoded with the event codec of the aggregate base.
+type EventRegistry[A Aggregate] struct {
+	aggType  string
+	l        sync.RWMutex
+	handlers map[string]func(agg A, e *Event) error
+}
+
+// NewEventRegistry creates a new event registry for the aggregate of given type.
+func NewEventRegistry[A Aggregate](aggType string) *EventRegistry[A] {
+	return &EventRegistry[A]{aggType: aggType, handlers: map[string]func(agg A, e *Event) error{}}
+}
+
+// RegisterHandler registers the handler of the event message M in the registry.
+// The event type is taken from the MessageType of the message.
+func RegisterHandler[A Aggregate, M any, PM interface {
+	*M
+	EventMessage
+}](r *EventRegistry[A], handler func(agg A, msg PM) error) error {
+	return RegisterHandlerWithEvent[A, M, PM](r, func(agg A, msg PM, _ *Event) error {
+		return handler(agg, msg)
+	})
+}
+
+// RegisterHandlerWithEvent registers the handler of the event message M in the registry.
+// The handler gets both the decoded message and the event it was decoded from.
+func RegisterHandlerWithEvent[A Aggregate, M any, PM interface {
+	*M
+	EventMessage
+}](r *EventRegistry[A], handler func(agg A, msg PM, e *Event) error) error {
+	if handler == nil {
+		return cgerrors.ErrInternal("provided nil event handler")
+	}
+	eventType := PM(new(M)).MessageType()
+	r.l.Lock()
+	defer r.l.Unlock()
+	if _, ok := r.handlers[eventType]; ok {
+		return cgerrors.ErrAlreadyExistsf("handler for event type: %s already registered", eventType)
+	}
+	r.handlers[eventType] = func(agg A, e *Event) error {
+		msg := PM(new(M))
+		if err := agg.AggBase().DecodeEventAs(e.EventData, msg); err != nil {
+			return cgerrors.ErrInternalf("decoding event: %s of type: %s failed: %v", e.EventId, e.EventType, err)
+		}
+		return handler(agg, msg, e)
+	}
+	return nil
+}
+
+// MustRegister panics if any of the registration errors is not nil.
+// It is meant to be used within the package init functions.
+func MustRegister(errs ...error) {
+	for _, err := range errs {
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Apply decodes the event and calls the handler registered for its type.
+// An *UnknownEventTypeError is returned if no handler is registered for the event type.
+func (r *EventRegistry[A]) Apply(agg A, e *Event) error {
+	if r.aggType != "" && e.AggregateType != r.aggType {
+		return cgerrors.ErrInternalf("event: %s aggregate type: %s doesn't match the aggregate type: %s", e.EventId, e.AggregateType, r.aggType)
+	}
+	r.l.RLock()
+	h, ok := r.handlers[e.EventType]
+	r.l.RUnlock()
+	if !ok {
+		return &UnknownEventTypeError{AggregateType: e.AggregateType, EventType: e.EventType}
+	}
+	return h(agg, e)
+}
+
+// EventTypes gets the sorted event types registered in the registry.
+func (r *EventRegistry[A]) EventTypes() []string {
+	r.l.RLock()
+	defer r.l.RUnlock()
+	eventTypes := make([]string, 0, len(r.handlers))
+	for eventType := range r.handlers {
+		eventTypes = append(eventTypes, eventType)
+	}
+	sort.Strings(eventTypes)
+	return eventTypes
+}
+
+// Compile time check if UnknownEventTypeError implements cgerrors.ErrorCoder.
+var _ cgerrors.ErrorCoder = (*UnknownEventTypeError)(nil)
+
+// UnknownEventTypeError is the error returned when an aggregate gets an event of the type it doesn't handle.
+type UnknownEventTypeError struct {
+	AggregateType string
+	EventType     string
+}
+
+// Error implements error interface.
+func (u *UnknownEventTypeError) Error() string {
+	return fmt.Sprintf("unknown event type: %s for aggregate: %s", u.EventType, u.AggregateType)
+}
+
+// ErrorCode implements cgerrors.ErrorCoder interface.
+func (u *UnknownEventTypeError) ErrorCode(error) cgerrors.ErrorCode {
+	return cgerrors.CodeInternal
+}
+
+// IsUnknownEventType checks if given error is an *UnknownEventTypeError.
+func IsUnknownEventType(err error) bool {
+	var target *UnknownEventTypeError
+	return errors.As(err, &target)
+}
@@ -0,0 +1,96 @@
+package es_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/codec"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esmem"
+)
+
+func TestEventRegistry(t *testing.T) {
+	r := es.NewEventRegistry[*testAggregate](aggregateType)
+	err := es.RegisterHandlerWithEvent(r, func(agg *testAggregate, _ *aggregateCreated, e *es.Event) error {
+		agg.CreatedAt = e.Time()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("registering created handler failed: %v", err)
+	}
+	err = es.RegisterHandler(r, func(agg *testAggregate, msg *aggregateNameChanged) error {
+		agg.Name = msg.Name
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("registering name changed handler failed: %v", err)
+	}
+
+	t.Run("Duplicated", func(t *testing.T) {
+		err := es.RegisterHandler(r, func(*testAggregate, *aggregateNameChanged) error { return nil })
+		if !cgerrors.IsAlreadyExists(err) {
+			t.Errorf("expected already exists error but got: %v", err)
+		}
+	})
+
+	t.Run("EventTypes", func(t *testing.T) {
+		eventTypes := r.EventTypes()
+		if len(eventTypes) != 2 || eventTypes[0] != aggregateCreatedType || eventTypes[1] != aggregateNameChangedType {
+			t.Errorf("unexpected event types: %v", eventTypes)
+		}
+	})
+
+	storage := esmem.New()
+	store, err := es.New(es.DefaultConfig(), codec.JSON(), codec.JSON(), storage)
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+
+	t.Run("Apply", func(t *testing.T) {
+		ctx := context.Background()
+		const aggId = "1b9d6bcd-bbfd-4b2d-9b5d-ab8dfbbd4bed"
+		agg := getTestAggregate(store, aggId)
+		if err := agg.Base.SetEvent(&aggregateCreated{}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		if err := agg.Base.SetEvent(&aggregateNameChanged{Name: "name"}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		if err := store.Commit(ctx, agg); err != nil {
+			t.Fatalf("committing failed: %v", err)
+		}
+
+		events, err := storage.ListEvents(ctx, aggId, aggregateType)
+		if err != nil {
+			t.Fatalf("listing events failed: %v", err)
+		}
+		loaded := getTestAggregate(store, aggId)
+		for _, e := range events {
+			if err := r.Apply(loaded, e); err != nil {
+				t.Fatalf("applying event: %s failed: %v", e.EventType, err)
+			}
+		}
+		if loaded.Name != "name" || loaded.CreatedAt.IsZero() {
+			t.Errorf("unexpected aggregate state: %+v", loaded)
+		}
+	})
+
+	t.Run("UnknownEventType", func(t *testing.T) {
+		agg := getTestAggregate(store, "8d2f0f3c-6c1e-4c52-9a44-3a1e7b1a2c33")
+		err := r.Apply(agg, &es.Event{EventType: "unknown", AggregateType: aggregateType})
+		if !es.IsUnknownEventType(err) {
+			t.Fatalf("expected unknown event type error but got: %v", err)
+		}
+		if cgerrors.Code(err) != cgerrors.CodeInternal {
+			t.Errorf("expected internal error code but is: %v", cgerrors.Code(err))
+		}
+	})
+
+	t.Run("AggregateTypeMismatch", func(t *testing.T) {
+		agg := getTestAggregate(store, "a4a1c7a5-3b8e-4f7e-8f36-2b8b1f0c9d27")
+		if err := r.Apply(agg, &es.Event{EventType: aggregateCreatedType, AggregateType: "other"}); err == nil {
+			t.Error("expected error on aggregate type mismatch")
+		}
+	})
+}
@@ -2,10 +2,12 @@ package es
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/kucjac/cleango/cgerrors"
 	"github.com/kucjac/cleango/codec"
+	"github.com/kucjac/cleango/pkg/xlog"
 )
 
 //go:generate mockgen -destination=mock/event_store_gen.go -package=mockes . EventStore
@@ -16,12 +18,30 @@ type EventStore interface {
 	LoadEvents(ctx context.Context, aggregate Aggregate) error
 	// LoadEventsWithSnapshot loads the latest snapshot with the events that happened after it.
 	LoadEventsWithSnapshot(ctx context.Context, aggregate Aggregate) error
+	// LoadMany loads the latest state of all given aggregates, fetching their snapshots and events in batches.
+	LoadMany(ctx context.Context, aggregates ...Aggregate) error
+	// LoadEventsAtRevision loads the aggregate state as of given revision.
+	LoadEventsAtRevision(ctx context.Context, aggregate Aggregate, revision int64) error
+	// LoadEventsAt loads the aggregate state as of given point in time.
+	LoadEventsAt(ctx context.Context, aggregate Aggregate, t time.Time) error
 	// Commit commits the event changes done in given aggregate.
 	Commit(ctx context.Context, aggregate Aggregate) error
+	// CommitAll atomically commits the event changes done in all given aggregates.
+	CommitAll(ctx context.Context, aggregates ...Aggregate) error
+	// Delete marks given aggregate as deleted with the tombstone event.
+	Delete(ctx context.Context, aggregate Aggregate) error
 	// SaveSnapshot saves the snapshot of given aggregate.
 	SaveSnapshot(ctx context.Context, aggregate Aggregate) error
 	// StreamEvents opens stream events that matches given request.
 	StreamEvents(ctx context.Context, req *StreamEventsRequest) (<-chan *Event, error)
+	// QueryEvents gets the page of the events that matches given request.
+	QueryEvents(ctx context.Context, req *QueryEventsRequest) (*QueryEventsResult, error)
+	// AggregateExists checks if the aggregate with given id and type is stored.
+	AggregateExists(ctx context.Context, aggId, aggType string) (bool, error)
+	// ListAggregates gets the page of the aggregates of given type.
+	ListAggregates(ctx context.Context, aggType, cursor string, limit int) (*ListAggregatesResult, error)
+	// CountAggregates counts the stored aggregates of given type.
+	CountAggregates(ctx context.Context, aggType string) (int64, error)
 	// SetAggregateBase sets the AggregateBase within an aggregate.
 	SetAggregateBase(agg Aggregate, aggId, aggType string, version int64)
 }
@@ -36,8 +56,24 @@ type StreamEventsRequest struct {
 	ExcludeEventTypes []string
 	// EventTypes is the filter that gets only selected event types.
 	EventTypes []string
+	// ExcludeDeleted excludes the streams of the aggregates deleted with the tombstone event.
+	// The aggregates are checked when their events are read, thus in the Follow mode the events
+	// streamed before the aggregate is deleted are not recalled.
+	ExcludeDeleted bool
+	// FromPosition streams the events with the global position greater than provided.
+	// It allows to resume the stream after the last processed event.
+	FromPosition int64
+	// FromTimestamp streams the events with the timestamp (unix nano) greater or equal to provided.
+	FromTimestamp int64
+	// Follow keeps the stream open when all stored events are streamed, and tails the newly stored events
+	// until the context is canceled.
+	Follow bool
 	// BuffSize defines the size of the stream channel buffer.
 	BuffSize int
+	// OnError is called with the error which stopped the stream before all the matching events were streamed.
+	// The channel is closed after it returns, thus the stream closed with no error call is complete.
+	// The storage might not report the errors on canceled context.
+	OnError func(err error)
 }
 
 // New creates new EventStore implementation.
@@ -46,30 +82,53 @@ func New(cfg *Config, eventCodec EventCodec, snapCodec SnapshotCodec, storage St
 		return nil, err
 	}
 
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+
+	setter := NewAggregateBaseSetter(eventCodec, snapCodec, UUIDGenerator{})
+	setter.hashChain = cfg.HashChain
 	return &Store{
-		AggregateBaseSetter: NewAggregateBaseSetter(eventCodec, snapCodec, UUIDGenerator{}),
+		AggregateBaseSetter: setter,
 		snapCodec:           snapCodec,
 		storage:             storage,
 		bufferSize:          cfg.BufferSize,
+		commitPolicy:        cfg.CommitPolicy,
+		snapshots:           cfg.Snapshot,
+		upcasters:           NewUpcasterRegistry(),
+		asyncSnapshots:      &sync.WaitGroup{},
 	}, nil
 }
 
 // Store is the default implementation for the EventStore interface.
 type Store struct {
 	*AggregateBaseSetter
-	snapCodec  codec.Codec
-	storage    StorageBase
-	bufferSize int
+	snapCodec      codec.Codec
+	storage        StorageBase
+	bufferSize     int
+	commitPolicy   CommitPolicy
+	snapshots      SnapshotConfig
+	upcasters      *UpcasterRegistry
+	asyncSnapshots *sync.WaitGroup
 }
 
 // WithStorage creates a copy of the event store with given storage base.
+// The store bound to the TxStorage stores the snapshots within the transaction, regardless of the snapshot mode.
 func (e *Store) WithStorage(base StorageBase) *Store {
-	return &Store{
-		AggregateBaseSetter: e.AggregateBaseSetter,
-		snapCodec:           e.snapCodec,
-		storage:             base,
-		bufferSize:          e.bufferSize,
-	}
+	cp := *e
+	cp.storage = base
+	return &cp
+}
+
+// RegisterUpcaster registers the upcaster for the stored events of given type and schema version.
+// Registered upcasters are applied on the events loaded by the LoadEvents, LoadEventsWithSnapshot and StreamEvents.
+func (e *Store) RegisterUpcaster(eventType string, version int32, u Upcaster) error {
+	return e.upcasters.Register(eventType, version, u)
+}
+
+// Upcasters gets the upcaster registry of the store.
+func (e *Store) Upcasters() *UpcasterRegistry {
+	return e.upcasters
 }
 
 // LoadEvents gets the event stream and applies on provided aggregate.
@@ -85,16 +144,7 @@ func (e *Store) LoadEvents(ctx context.Context, agg Aggregate) error {
 	if len(events) == 0 {
 		return cgerrors.ErrNotFoundf("aggregate: %s with id: %s not found", b.aggType, b.id)
 	}
-
-	// Apply all events from the stream on the aggregate.
-	for _, event := range events {
-		if err = agg.Apply(event); err != nil {
-			return err
-		}
-		b.revision = event.Revision
-		b.timestamp = event.Timestamp
-	}
-	return nil
+	return e.applyStream(agg, events)
 }
 
 // LoadEventsWithSnapshot gets the aggregate stream with the latest possible snapshot.
@@ -112,11 +162,9 @@ func (e *Store) LoadEventsWithSnapshot(ctx context.Context, agg Aggregate) error
 
 	var events []*Event
 	if !isNotFound {
-		if err = e.snapCodec.Unmarshal(snap.SnapshotData, agg); err != nil {
+		if err = e.restoreSnapshot(agg, snap); err != nil {
 			return err
 		}
-		b.timestamp = snap.Timestamp
-		b.revision = snap.Revision
 		// Get the event stream starting form the revision provided in the snapshot.
 		events, err = e.storage.ListEventsAfterRevision(ctx, b.id, b.aggType, b.revision)
 		if err != nil {
@@ -134,6 +182,35 @@ func (e *Store) LoadEventsWithSnapshot(ctx context.Context, agg Aggregate) error
 			return cgerrors.ErrNotFoundf("aggregate: %s with id %s not found", b.aggType, b.id)
 		}
 	}
+	return e.applyStream(agg, events)
+}
+
+// restoreSnapshot decodes the aggregate state from given snapshot.
+func (e *Store) restoreSnapshot(agg Aggregate, snap *Snapshot) error {
+	if err := e.snapCodec.Unmarshal(snap.SnapshotData, agg); err != nil {
+		return err
+	}
+	b := agg.AggBase()
+	b.timestamp = snap.Timestamp
+	b.revision = snap.Revision
+	b.snapshotTimestamp = snap.Timestamp
+	b.snapshotRevision = snap.Revision
+	return nil
+}
+
+// applyStream applies the stored events of the aggregate, following its current revision.
+func (e *Store) applyStream(agg Aggregate, events []*Event) error {
+	if err := checkTombstone(events); err != nil {
+		return err
+	}
+	b := agg.AggBase()
+	b.trackHash(events)
+
+	// Transform the stored events into their current shape.
+	events, err := e.upcasters.Upcast(events)
+	if err != nil {
+		return err
+	}
 
 	// Iterate over each event and apply them on given aggregate.
 	for _, event := range events {
@@ -146,43 +223,156 @@ func (e *Store) LoadEventsWithSnapshot(ctx context.Context, agg Aggregate) error
 	return nil
 }
 
+// LoadEventsAtRevision loads the aggregate state as of given revision.
+// The state is rebuilt from the nearest snapshot taken at or before the revision, and the events that followed it.
+// If the aggregate doesn't have any events up to given revision, the not found error is returned.
+func (e *Store) LoadEventsAtRevision(ctx context.Context, agg Aggregate, revision int64) error {
+	b := agg.AggBase()
+	return e.loadHistorical(ctx, agg,
+		func() (*Snapshot, error) {
+			return e.storage.GetSnapshotAtRevision(ctx, b.id, b.aggType, b.version, revision)
+		},
+		func(after int64) ([]*Event, error) {
+			return e.storage.ListEventsUntilRevision(ctx, b.id, b.aggType, after, revision)
+		},
+	)
+}
+
+// LoadEventsAt loads the aggregate state as of given point in time.
+// The state is rebuilt from the nearest snapshot taken at or before given time, and the events that followed it.
+// If the aggregate doesn't have any events up to given time, the not found error is returned.
+func (e *Store) LoadEventsAt(ctx context.Context, agg Aggregate, t time.Time) error {
+	b := agg.AggBase()
+	timestamp := t.UnixNano()
+	return e.loadHistorical(ctx, agg,
+		func() (*Snapshot, error) {
+			return e.storage.GetSnapshotAtTimestamp(ctx, b.id, b.aggType, b.version, timestamp)
+		},
+		func(after int64) ([]*Event, error) {
+			return e.storage.ListEventsUntilTimestamp(ctx, b.id, b.aggType, after, timestamp)
+		},
+	)
+}
+
+// loadHistorical loads the aggregate from the snapshot and the events listed after its revision.
+func (e *Store) loadHistorical(ctx context.Context, agg Aggregate, getSnapshot func() (*Snapshot, error), listEvents func(after int64) ([]*Event, error)) error {
+	b := agg.AggBase()
+	snap, err := getSnapshot()
+	if err != nil {
+		if e.storage.ErrorCode(err) != cgerrors.CodeNotFound {
+			return e.err("getting aggregate snapshot failed", err)
+		}
+		snap = nil
+	}
+	if snap != nil {
+		if err = e.restoreSnapshot(agg, snap); err != nil {
+			return err
+		}
+	}
+
+	events, err := listEvents(b.revision)
+	if err != nil {
+		return e.err("listing events failed", err)
+	}
+	if snap == nil && len(events) == 0 {
+		return cgerrors.ErrNotFoundf("aggregate: %s with id: %s not found", b.aggType, b.id)
+	}
+	return e.applyStream(agg, events)
+}
+
 // SaveSnapshot stores the snapshot
+// If the store has configured snapshot retention, older snapshots of the aggregate are pruned.
 func (e *Store) SaveSnapshot(ctx context.Context, agg Aggregate) error {
+	if err := checkDeleted(agg.AggBase()); err != nil {
+		return err
+	}
 	// Create a snapshot and store it in the storage.
-	data, err := e.snapCodec.Marshal(agg)
+	snap, err := e.newSnapshot(agg)
 	if err != nil {
 		return err
 	}
+	if err = e.storeSnapshot(ctx, e.storage, snap); err != nil {
+		return e.err("saving snapshot failed", err)
+	}
+	b := agg.AggBase()
+	b.snapshotRevision, b.snapshotTimestamp = snap.Revision, snap.Timestamp
+	return nil
+}
+
+// WaitSnapshots blocks until all the snapshots taken asynchronously on commit are stored.
+func (e *Store) WaitSnapshots() {
+	e.asyncSnapshots.Wait()
+}
+
+func (e *Store) newSnapshot(agg Aggregate) (*Snapshot, error) {
+	data, err := e.snapCodec.Marshal(agg)
+	if err != nil {
+		return nil, err
+	}
 	b := agg.AggBase()
-	snap := &Snapshot{
+	return &Snapshot{
 		AggregateId:      b.id,
 		AggregateType:    b.aggType,
 		AggregateVersion: b.version,
 		Revision:         b.revision,
 		Timestamp:        b.timestamp,
 		SnapshotData:     data,
+	}, nil
+}
+
+// storeSnapshot saves the snapshot in given storage and prunes the snapshots exceeding the retention.
+func (e *Store) storeSnapshot(ctx context.Context, s StorageBase, snap *Snapshot) error {
+	if err := s.SaveSnapshot(ctx, snap); err != nil {
+		return err
 	}
-	if err = e.storage.SaveSnapshot(ctx, snap); err != nil {
-		return e.err("saving snapshot failed", err)
+	if e.snapshots.Retention == 0 {
+		return nil
 	}
-	return nil
+	return s.PruneSnapshots(ctx, snap.AggregateId, snap.AggregateType, snap.AggregateVersion, e.snapshots.Retention)
 }
 
 // Commit commits all uncommitted events within given aggregate.
+// On the revision conflict the store follows the CommitPolicy stored in the context (WithCommitPolicy),
+// or the default one provided in the Config.
+// If the configured SnapshotPolicy decides so, the snapshot of the committed aggregate is stored
+// within the same transaction as the events, or asynchronously - depending on the SnapshotMode.
+// The event metadata not set yet is filled with the values stored in the context (see Event.SetContextMetadata).
 func (e *Store) Commit(ctx context.Context, agg Aggregate) error {
 	b := agg.AggBase()
 	events := b.uncommittedEvents
 	if len(events) == 0 {
 		return nil
 	}
-	for {
+	if err := checkDeleted(b); err != nil {
+		return err
+	}
+	for _, event := range events {
+		event.SetContextMetadata(ctx)
+	}
+	policy, err := e.policyFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	for retry := 0; ; retry++ {
+		if err = e.sealHashChain(ctx, agg); err != nil {
+			return err
+		}
 		// Try to save the events.
-		err := e.storage.SaveEvents(ctx, events)
+		snap, err := e.saveEvents(ctx, agg, events)
 		if err == nil {
 			b.committedEvents, b.uncommittedEvents = b.uncommittedEvents, nil
+			if snap != nil {
+				b.snapshotRevision, b.snapshotTimestamp = snap.Revision, snap.Timestamp
+			}
 			return nil
 		}
 
+		// The value reserved by another aggregate is not a revision conflict.
+		if IsReservationTaken(err) {
+			return err
+		}
+
 		// Everytime when the save fails due to the already exists error.
 		// It means that there already is an event with provided revision.
 		// In given case in order to apply the events
@@ -190,33 +380,363 @@ func (e *Store) Commit(ctx context.Context, agg Aggregate) error {
 			return e.err("saving events failed", err)
 		}
 
-		// Reset aggregate, and it's base.
-		agg.Reset()
-		b.reset()
-		agg.SetBase(b)
-		if err = e.LoadEventsWithSnapshot(ctx, agg); err != nil {
-			return e.err("loading events with snapshot failed", err)
+		if err = e.rebase(ctx, agg, policy, retry); err != nil {
+			return err
+		}
+	}
+}
+
+// CommitAll atomically commits the uncommitted events of all given aggregates within a single storage transaction.
+// Each aggregate follows the same conflict semantics as in the Commit - on the revision conflict the transaction
+// is rolled back, the conflicting aggregate is handled according to the CommitPolicy and the transaction is retried.
+// The snapshots taken by the SnapshotPolicy in the SnapshotInTransaction mode are stored in the same transaction.
+// The storage needs to implement the Storage interface.
+func (e *Store) CommitAll(ctx context.Context, aggs ...Aggregate) error {
+	return e.commitAll(ctx, nil, aggs)
+}
+
+// CommitTxFunc is the function called within the commit transaction of the CommitAllTx, after the aggregate events are saved.
+type CommitTxFunc func(ctx context.Context, tx TxStorage, aggs []Aggregate) error
+
+// CommitAllTx commits the aggregates in the same way as the CommitAll, but calls given function within the commit transaction
+// after the events of the aggregates with uncommitted events are saved. It allows to store the records that depend on
+// the committed events atomically with them. The function is called on each retry of the transaction, with the rebased aggregates.
+func (e *Store) CommitAllTx(ctx context.Context, fn CommitTxFunc, aggs ...Aggregate) error {
+	return e.commitAll(ctx, fn, aggs)
+}
+
+func (e *Store) commitAll(ctx context.Context, fn CommitTxFunc, aggs []Aggregate) error {
+	var pending []Aggregate
+	for _, agg := range aggs {
+		if len(agg.AggBase().uncommittedEvents) > 0 {
+			pending = append(pending, agg)
 		}
+	}
+	switch len(pending) {
+	case 0:
+		return nil
+	case 1:
+		if fn == nil {
+			return e.Commit(ctx, pending[0])
+		}
+	}
+	s, ok := e.storage.(Storage)
+	if !ok {
+		return cgerrors.ErrInternal("event storage doesn't support transactions")
+	}
+	for _, agg := range pending {
+		if err := checkDeleted(agg.AggBase()); err != nil {
+			return err
+		}
+		for _, event := range agg.AggBase().uncommittedEvents {
+			event.SetContextMetadata(ctx)
+		}
+	}
+	policy, err := e.policyFromContext(ctx)
+	if err != nil {
+		return err
+	}
 
-		for _, event := range events {
-			// Make a copy of given event.
-			b.revision++
-			event.Revision = b.revision
-			event.Timestamp = time.Now().UTC().UnixNano()
-			if err = agg.Apply(event); err != nil {
+	for retry := 0; ; retry++ {
+		for _, agg := range pending {
+			if err = e.sealHashChain(ctx, agg); err != nil {
 				return err
 			}
 		}
+		snaps, conflicted, err := e.saveAllEvents(ctx, s, pending, fn)
+		if err == nil {
+			for i, agg := range pending {
+				b := agg.AggBase()
+				b.committedEvents, b.uncommittedEvents = b.uncommittedEvents, nil
+				if snap := snaps[i]; snap != nil {
+					b.snapshotRevision, b.snapshotTimestamp = snap.Revision, snap.Timestamp
+					if e.snapshotMode() == SnapshotAsync {
+						e.asyncSnapshots.Add(1)
+						go e.storeSnapshotAsync(snap)
+					}
+				}
+			}
+			return nil
+		}
+		if IsReservationTaken(err) {
+			return err
+		}
+		if conflicted == nil || e.storage.ErrorCode(err) != cgerrors.CodeAlreadyExists {
+			return e.err("saving events failed", err)
+		}
+		if err = e.rebase(ctx, conflicted, policy, retry); err != nil {
+			return err
+		}
+	}
+}
+
+// saveAllEvents saves the events of all aggregates in a single transaction, along with their in-transaction snapshots,
+// and calls the commit function, if provided, before the transaction is committed.
+// If saving the events of an aggregate fails, the aggregate is returned along with the error.
+// Returned snapshots are the ones taken by the snapshot policy for the aggregates at corresponding indexes.
+func (e *Store) saveAllEvents(ctx context.Context, s Storage, aggs []Aggregate, fn CommitTxFunc) ([]*Snapshot, Aggregate, error) {
+	tx, err := s.BeginTx(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	rollback := func() {
+		if er := tx.Rollback(ctx); er != nil {
+			xlog.WithContext(ctx).Errorf("rolling back commit transaction failed: %v", er)
+		}
+	}
+
+	snaps := make([]*Snapshot, len(aggs))
+	for i, agg := range aggs {
+		events := agg.AggBase().uncommittedEvents
+		if err = tx.SaveEvents(ctx, events); err != nil {
+			rollback()
+			return nil, agg, err
+		}
+		if !e.snapshots.shouldSnapshot(agg, len(events)) {
+			continue
+		}
+		if snaps[i], err = e.newSnapshot(agg); err != nil {
+			rollback()
+			return nil, nil, err
+		}
+		if e.snapshotMode() == SnapshotInTransaction {
+			if err = e.storeSnapshot(ctx, tx, snaps[i]); err != nil {
+				rollback()
+				return nil, nil, err
+			}
+		}
+	}
+	if fn != nil {
+		if err = fn(ctx, tx, aggs); err != nil {
+			rollback()
+			return nil, nil, err
+		}
+	}
+	if err = tx.Commit(ctx); err != nil {
+		if s.ErrorCode(err) == cgerrors.CodeAlreadyExists {
+			// The conflicting events were committed concurrently, after they were saved within the transaction.
+			return nil, e.findConflicted(ctx, aggs), err
+		}
+		return nil, nil, err
+	}
+	return snaps, nil, nil
+}
+
+// findConflicted finds the aggregate that has the events committed after the revision its uncommitted events are based on.
+func (e *Store) findConflicted(ctx context.Context, aggs []Aggregate) Aggregate {
+	for _, agg := range aggs {
+		b := agg.AggBase()
+		concurrent, err := e.storage.ListEventsAfterRevision(ctx, b.id, b.aggType, b.uncommittedEvents[0].Revision-1)
+		if err != nil {
+			xlog.WithContext(ctx).Errorf("listing concurrent events failed: %v", err)
+			return nil
+		}
+		if len(concurrent) > 0 {
+			return agg
+		}
+	}
+	return nil
+}
+
+// policyFromContext gets the commit policy stored in the context, or the default one of the store.
+func (e *Store) policyFromContext(ctx context.Context) (CommitPolicy, error) {
+	policy, ok := CommitPolicyFromContext(ctx)
+	if !ok {
+		return e.commitPolicy, nil
+	}
+	if err := policy.Validate(); err != nil {
+		return CommitPolicy{}, err
+	}
+	return policy, nil
+}
+
+// rebase reloads the aggregate which commit failed on the revision conflict, and re-applies its uncommitted events
+// on top of its latest state, following given commit policy.
+func (e *Store) rebase(ctx context.Context, agg Aggregate, policy CommitPolicy, retry int) error {
+	b := agg.AggBase()
+	events := b.uncommittedEvents
+	expected := events[0].Revision - 1
+	var (
+		concurrent []*Event
+		err        error
+	)
+	switch {
+	case policy.Strategy == ConflictFail, policy.retriesExceeded(retry):
+		return e.conflictError(ctx, b, expected)
+	case policy.Strategy == ConflictResolve:
+		// Get the events committed after the expected revision, so that the resolver could inspect them.
+		concurrent, err = e.storage.ListEventsAfterRevision(ctx, b.id, b.aggType, expected)
+		if err != nil {
+			return e.err("listing concurrent events failed", err)
+		}
+		if concurrent, err = e.upcasters.Upcast(concurrent); err != nil {
+			return err
+		}
+	}
+
+	resetAggregate(agg)
+	if err = e.LoadEventsWithSnapshot(ctx, agg); err != nil {
+		return e.err("loading events with snapshot failed", err)
+	}
+
+	if policy.Strategy == ConflictResolve {
+		if err = policy.Resolver(ctx, agg, concurrent, events); err != nil {
+			return err
+		}
+	}
+
+	for _, event := range events {
+		// Make a copy of given event.
+		b.revision++
+		event.Revision = b.revision
+		event.Timestamp = time.Now().UTC().UnixNano()
+		if err = agg.Apply(event); err != nil {
+			return err
+		}
+		b.timestamp = event.Timestamp
+	}
+	return nil
+}
+
+// resetAggregate resets the aggregate state and its base, so that it could be loaded again.
+func resetAggregate(agg Aggregate) {
+	b := agg.AggBase()
+	agg.Reset()
+	b.reset()
+	agg.SetBase(b)
+}
+
+// saveEvents saves the events in the storage along with the snapshot, if the snapshot policy decides to take it.
+// Returned snapshot is the one stored, or scheduled to be stored asynchronously.
+func (e *Store) saveEvents(ctx context.Context, agg Aggregate, events []*Event) (*Snapshot, error) {
+	if !e.snapshots.shouldSnapshot(agg, len(events)) {
+		return nil, e.storage.SaveEvents(ctx, events)
+	}
+	snap, err := e.newSnapshot(agg)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.snapshotMode() == SnapshotAsync {
+		if err = e.storage.SaveEvents(ctx, events); err != nil {
+			return nil, err
+		}
+		e.asyncSnapshots.Add(1)
+		go e.storeSnapshotAsync(snap)
+		return snap, nil
+	}
+
+	s, ok := e.storage.(Storage)
+	if !ok {
+		// The storage is either already within a transaction or it is not able to begin one.
+		if err = e.storage.SaveEvents(ctx, events); err != nil {
+			return nil, err
+		}
+		return snap, e.storeSnapshot(ctx, e.storage, snap)
+	}
+
+	tx, err := s.BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.SaveEvents(ctx, events); err == nil {
+		err = e.storeSnapshot(ctx, tx, snap)
+	}
+	if err != nil {
+		if er := tx.Rollback(ctx); er != nil {
+			xlog.WithContext(ctx).Errorf("rolling back commit transaction failed: %v", er)
+		}
+		return nil, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// snapshotMode gets the mode the snapshots are stored in. The store bound to a transaction with the WithStorage stores
+// the snapshots within it, as the asynchronous write could outlive the transaction or store the snapshot of rolled back events.
+func (e *Store) snapshotMode() SnapshotMode {
+	if _, ok := e.storage.(TxStorage); ok {
+		return SnapshotInTransaction
+	}
+	return e.snapshots.Mode
+}
+
+func (e *Store) storeSnapshotAsync(snap *Snapshot) {
+	defer e.asyncSnapshots.Done()
+	// The snapshot should be stored even if the commit context gets canceled.
+	ctx := context.Background()
+	if err := e.storeSnapshot(ctx, e.storage, snap); err != nil {
+		xlog.Errorf("storing snapshot of the aggregate: %s with id: %s at revision: %d failed: %v", snap.AggregateType, snap.AggregateId, snap.Revision, err)
+	}
+}
+
+func (e *Store) conflictError(ctx context.Context, b *AggregateBase, expected int64) error {
+	concurrent, err := e.storage.ListEventsAfterRevision(ctx, b.id, b.aggType, expected)
+	if err != nil {
+		return e.err("listing concurrent events failed", err)
+	}
+	actual := expected
+	if len(concurrent) > 0 {
+		actual = concurrent[len(concurrent)-1].Revision
+	}
+	return &ConflictError{
+		AggregateID:      b.id,
+		AggregateType:    b.aggType,
+		ExpectedRevision: expected,
+		ActualRevision:   actual,
 	}
 }
 
 // StreamEvents opens an event stream that matches given request.
+// If the store has registered upcasters, the streamed events are transformed into their current shape.
+// If upcasting a streamed event fails, the stream is stopped and the error is reported to the request OnError function.
 func (e *Store) StreamEvents(ctx context.Context, req *StreamEventsRequest) (<-chan *Event, error) {
+	if e.upcasters.Len() == 0 {
+		c, err := e.storage.StreamEvents(ctx, req)
+		if err != nil {
+			return nil, e.err("opening storage stream events failed", err)
+		}
+		return c, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
 	c, err := e.storage.StreamEvents(ctx, req)
 	if err != nil {
+		cancel()
 		return nil, e.err("opening storage stream events failed", err)
 	}
-	return c, nil
+	out := make(chan *Event, req.BuffSize)
+	go e.upcastStream(ctx, cancel, req, c, out)
+	return out, nil
+}
+
+func (e *Store) upcastStream(ctx context.Context, cancel context.CancelFunc, req *StreamEventsRequest, in <-chan *Event, out chan<- *Event) {
+	defer func() {
+		// Cancel the storage stream and drain its channel, so that its reader could finish.
+		cancel()
+		for range in {
+		}
+		close(out)
+	}()
+	for event := range in {
+		events, err := e.upcasters.UpcastEvent(event)
+		if err != nil {
+			xlog.WithContext(ctx).Errorf("upcasting streamed event failed: %v", err)
+			if req.OnError != nil {
+				req.OnError(err)
+			}
+			return
+		}
+		for _, ue := range events {
+			select {
+			case out <- ue:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
 }
 
 func (e *Store) err(msg string, err error) error {
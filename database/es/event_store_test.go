@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 	"github.com/kucjac/cleango/cgerrors"
 	"github.com/kucjac/cleango/codec"
 	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esmem"
 	mockes "github.com/kucjac/cleango/database/es/mock"
 )
 
@@ -333,6 +335,155 @@ func TestStore(t *testing.T) {
 		})
 	})
 
+	t.Run("CommitPolicy", func(t *testing.T) {
+		// loadWithNameChange loads the aggregate with the first event and sets up a name changed event on revision 2.
+		loadWithNameChange := func(t *testing.T) *testAggregate {
+			agg := getTestAggregate(store, aggId)
+			storage.EXPECT().
+				ListEvents(ctx, aggId, aggregateType).
+				Return([]*es.Event{e1}, nil)
+
+			if err = store.LoadEvents(ctx, agg); err != nil {
+				t.Fatalf("loading events failed: %v", err)
+			}
+			if err = agg.Base.SetEvent(&aggregateNameChanged{Name: "SecondName"}); err != nil {
+				t.Fatalf("setting name changed message failed: %v", err)
+			}
+			return agg
+		}
+
+		t.Run("Fail", func(t *testing.T) {
+			agg := loadWithNameChange(t)
+			ctx := es.WithCommitPolicy(ctx, es.CommitPolicy{Strategy: es.ConflictFail})
+
+			storage.EXPECT().
+				SaveEvents(ctx, agg.Base.UncommittedEvents()).
+				Return(errors.New("event with given revision already exists"))
+			storage.EXPECT().ErrorCode(gomock.Any()).Return(cgerrors.CodeAlreadyExists)
+			storage.EXPECT().
+				ListEventsAfterRevision(ctx, aggId, aggregateType, int64(1)).
+				Return([]*es.Event{e2}, nil)
+
+			err = store.Commit(ctx, agg)
+			if err == nil {
+				t.Fatal("expected conflict error but got nil")
+			}
+
+			var ce *es.ConflictError
+			if !errors.As(err, &ce) {
+				t.Fatalf("expected error to be *es.ConflictError but is: %T", err)
+			}
+			if ce.ExpectedRevision != 1 {
+				t.Errorf("expected conflict expected revision to be '1' but is: '%d'", ce.ExpectedRevision)
+			}
+			if ce.ActualRevision != 2 {
+				t.Errorf("expected conflict actual revision to be '2' but is: '%d'", ce.ActualRevision)
+			}
+			if !cgerrors.IsAlreadyExists(err) {
+				t.Errorf("expected conflict error to have code AlreadyExists but is: %v", cgerrors.Code(err))
+			}
+			if len(agg.Base.UncommittedEvents()) != 1 {
+				t.Errorf("aggregate should keep its uncommitted events but have: %d", len(agg.Base.UncommittedEvents()))
+			}
+		})
+
+		t.Run("MaxRetries", func(t *testing.T) {
+			agg := loadWithNameChange(t)
+			ctx := es.WithCommitPolicy(ctx, es.CommitPolicy{Strategy: es.ConflictRetry, MaxRetries: 1})
+
+			// First save fails, the aggregate gets reloaded.
+			storage.EXPECT().
+				SaveEvents(ctx, gomock.Any()).
+				Return(errors.New("event with given revision already exists"))
+			storage.EXPECT().ErrorCode(gomock.Any()).Return(cgerrors.CodeAlreadyExists)
+			storage.EXPECT().ErrorCode(gomock.Any()).Return(cgerrors.CodeNotFound)
+			storage.EXPECT().
+				GetSnapshot(ctx, aggId, aggregateType, int64(1)).
+				Return(nil, errors.New("snapshot not found"))
+			storage.EXPECT().
+				ListEvents(ctx, aggId, aggregateType).
+				Return([]*es.Event{e1, e2}, nil)
+
+			// The retry fails again, and the retries limit is reached.
+			storage.EXPECT().
+				SaveEvents(ctx, gomock.Any()).
+				Return(errors.New("event with given revision already exists"))
+			storage.EXPECT().ErrorCode(gomock.Any()).Return(cgerrors.CodeAlreadyExists)
+			e3 := &es.Event{
+				EventId:       "a5a4b2b6-4b8b-4d07-8a5e-3a5a46d1b3a8",
+				EventType:     aggregateNameChangedType,
+				AggregateType: aggregateType,
+				AggregateId:   aggId,
+				EventData:     []byte(`{"name": "OtherName"}`),
+				Timestamp:     now(),
+				Revision:      3,
+			}
+			storage.EXPECT().
+				ListEventsAfterRevision(ctx, aggId, aggregateType, int64(2)).
+				Return([]*es.Event{e3}, nil)
+
+			err = store.Commit(ctx, agg)
+			if !es.IsConflict(err) {
+				t.Fatalf("expected conflict error but got: %v", err)
+			}
+
+			var ce *es.ConflictError
+			errors.As(err, &ce)
+			if ce.ExpectedRevision != 2 || ce.ActualRevision != 3 {
+				t.Errorf("expected conflict revisions: 2 -> 3, but got: %d -> %d", ce.ExpectedRevision, ce.ActualRevision)
+			}
+		})
+
+		t.Run("Resolve", func(t *testing.T) {
+			agg := loadWithNameChange(t)
+
+			rejectErr := cgerrors.ErrFailedPrecondition("name was already changed")
+			ctx := es.WithCommitPolicy(ctx, es.CommitPolicy{
+				Strategy: es.ConflictResolve,
+				Resolver: func(ctx context.Context, agg es.Aggregate, concurrent, pending []*es.Event) error {
+					if len(concurrent) != 1 || concurrent[0] != e2 {
+						t.Errorf("expected concurrent events to contain e2 event")
+					}
+					if len(pending) != 1 {
+						t.Errorf("expected a single pending event but got: %d", len(pending))
+					}
+					if agg.AggBase().Revision() != 2 {
+						t.Errorf("expected reloaded aggregate revision to be '2' but is: '%d'", agg.AggBase().Revision())
+					}
+					return rejectErr
+				},
+			})
+
+			storage.EXPECT().
+				SaveEvents(ctx, gomock.Any()).
+				Return(errors.New("event with given revision already exists"))
+			storage.EXPECT().ErrorCode(gomock.Any()).Return(cgerrors.CodeAlreadyExists)
+			storage.EXPECT().
+				ListEventsAfterRevision(ctx, aggId, aggregateType, int64(1)).
+				Return([]*es.Event{e2}, nil)
+			storage.EXPECT().ErrorCode(gomock.Any()).Return(cgerrors.CodeNotFound)
+			storage.EXPECT().
+				GetSnapshot(ctx, aggId, aggregateType, int64(1)).
+				Return(nil, errors.New("snapshot not found"))
+			storage.EXPECT().
+				ListEvents(ctx, aggId, aggregateType).
+				Return([]*es.Event{e1, e2}, nil)
+
+			if err = store.Commit(ctx, agg); err != rejectErr {
+				t.Errorf("expected resolver error but got: %v", err)
+			}
+		})
+
+		t.Run("InvalidPolicy", func(t *testing.T) {
+			agg := loadWithNameChange(t)
+
+			ctx := es.WithCommitPolicy(ctx, es.CommitPolicy{Strategy: es.ConflictResolve})
+			if err = store.Commit(ctx, agg); err == nil {
+				t.Error("expected error on resolve policy without resolver")
+			}
+		})
+	})
+
 	t.Run("StreamEvents", func(t *testing.T) {
 		req := &es.StreamEventsRequest{AggregateIDs: []string{aggId}, AggregateTypes: []string{aggregateType}}
 		ch := make(chan *es.Event, 2)
@@ -379,6 +530,200 @@ func validateTestAggregate(t *testing.T, agg *testAggregate, e1 *es.Event, name
 	}
 }
 
+func TestStoreCommitAll(t *testing.T) {
+	ctx := context.Background()
+	const (
+		aggId1 = "6f1c2b8e-2d4a-4b8e-9c1f-0a7d3e5b8c21"
+		aggId2 = "9a3e5d7c-1b2f-4c6a-8e0d-4f7b2a9c6e53"
+	)
+	storage := esmem.New()
+	store, err := es.New(es.DefaultConfig(), codec.JSON(), codec.JSON(), storage)
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+
+	// createAggregates sets up the created events on new aggregates with given ids.
+	createAggregates := func(t *testing.T, ids ...string) []es.Aggregate {
+		aggs := make([]es.Aggregate, len(ids))
+		for i, id := range ids {
+			agg := getTestAggregate(store, id)
+			if err := agg.Base.SetEvent(&aggregateCreated{}); err != nil {
+				t.Fatalf("setting event failed: %v", err)
+			}
+			aggs[i] = agg
+		}
+		return aggs
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		aggs := createAggregates(t, aggId1, aggId2)
+		if err := store.CommitAll(ctx, aggs...); err != nil {
+			t.Fatalf("committing aggregates failed: %v", err)
+		}
+		for _, agg := range aggs {
+			b := agg.AggBase()
+			if len(b.UncommittedEvents()) != 0 || len(b.CommittedEvents()) != 1 {
+				t.Errorf("aggregate: %s events should be committed", b.ID())
+			}
+			events, err := storage.ListEvents(ctx, b.ID(), aggregateType)
+			if err != nil {
+				t.Fatalf("listing events failed: %v", err)
+			}
+			if len(events) != 1 {
+				t.Errorf("expected aggregate: %s to have 1 event stored but has: %d", b.ID(), len(events))
+			}
+		}
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		first, second := getTestAggregate(store, aggId1), getTestAggregate(store, aggId2)
+		for _, agg := range []*testAggregate{first, second} {
+			if err := store.LoadEvents(ctx, agg); err != nil {
+				t.Fatalf("loading events failed: %v", err)
+			}
+			if err := agg.Base.SetEvent(&aggregateNameChanged{Name: "transfer"}); err != nil {
+				t.Fatalf("setting event failed: %v", err)
+			}
+		}
+
+		// Commit a concurrent change of the second aggregate.
+		concurrent := getTestAggregate(store, aggId2)
+		if err := store.LoadEvents(ctx, concurrent); err != nil {
+			t.Fatalf("loading events failed: %v", err)
+		}
+		if err := concurrent.Base.SetEvent(&aggregateNameChanged{Name: "concurrent"}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		if err := store.Commit(ctx, concurrent); err != nil {
+			t.Fatalf("committing concurrent change failed: %v", err)
+		}
+
+		failCtx := es.WithCommitPolicy(ctx, es.CommitPolicy{Strategy: es.ConflictFail})
+		if err := store.CommitAll(failCtx, first, second); !es.IsConflict(err) {
+			t.Fatalf("expected conflict error but got: %v", err)
+		}
+		// None of the aggregate events should be stored.
+		events, err := storage.ListEvents(ctx, aggId1, aggregateType)
+		if err != nil {
+			t.Fatalf("listing events failed: %v", err)
+		}
+		if len(events) != 1 {
+			t.Errorf("expected the first aggregate events to be rolled back, but it has: %d events", len(events))
+		}
+
+		// The default retry policy should re-apply the events on top of the concurrent change.
+		if err = store.CommitAll(ctx, first, second); err != nil {
+			t.Fatalf("committing aggregates failed: %v", err)
+		}
+		if first.Base.Revision() != 2 || second.Base.Revision() != 3 {
+			t.Errorf("unexpected aggregate revisions: %d, %d", first.Base.Revision(), second.Base.Revision())
+		}
+	})
+
+	t.Run("NoTransactions", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		nonTx := store.WithStorage(mockes.NewMockTxStorage(ctrl))
+		aggs := createAggregates(t, "1e6a8f0b-7c3d-4a2e-b5f9-8d0c2e4a6b17", "4d8b2f6e-0a9c-4e1b-a7d3-5c2e9f1b8a40")
+		if err := nonTx.CommitAll(ctx, aggs...); err == nil {
+			t.Error("expected error on storage without transactions")
+		}
+	})
+
+	t.Run("Tx", func(t *testing.T) {
+		const aggId = "2c7e9a1d-5b3f-4e8a-9d6c-1f0b4a7e3c58"
+		failed := createAggregates(t, aggId)
+		hookErr := cgerrors.ErrInternal("hook failed")
+		err := store.CommitAllTx(ctx, func(ctx context.Context, tx es.TxStorage, aggs []es.Aggregate) error {
+			return hookErr
+		}, failed...)
+		if err == nil || !strings.Contains(err.Error(), "hook failed") {
+			t.Fatalf("expected the hook error but got: %v", err)
+		}
+		if exists, _ := storage.AggregateExists(ctx, aggId, aggregateType); exists {
+			t.Error("expected the events rolled back on the hook error")
+		}
+
+		var called int
+		aggs := createAggregates(t, aggId)
+		err = store.CommitAllTx(ctx, func(ctx context.Context, tx es.TxStorage, aggs []es.Aggregate) error {
+			called++
+			events, err := tx.ListEvents(ctx, aggId, aggregateType)
+			if err != nil {
+				return err
+			}
+			if len(events) != 1 || len(aggs) != 1 {
+				t.Errorf("expected the aggregate events saved within the transaction")
+			}
+			return nil
+		}, aggs...)
+		if err != nil {
+			t.Fatalf("committing aggregates failed: %v", err)
+		}
+		if called != 1 {
+			t.Errorf("expected the hook called once but was: %d", called)
+		}
+	})
+}
+
+func TestStoreLoadEventsAt(t *testing.T) {
+	ctx := context.Background()
+	const aggId = "2c7e4a9b-5d1f-4e8a-b3c6-9f0d2a7e1b54"
+	cfg := es.DefaultConfig()
+	cfg.Snapshot = es.SnapshotConfig{Policy: es.EveryNEvents(2)}
+	store, err := es.New(cfg, codec.JSON(), codec.JSON(), esmem.New())
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+
+	// Commit the events one by one, so that the snapshot is taken at revision 2.
+	agg := getTestAggregate(store, aggId)
+	timestamps := map[int64]int64{}
+	for i, msg := range []es.EventMessage{&aggregateCreated{}, &aggregateNameChanged{Name: "First"}, &aggregateNameChanged{Name: "Second"}, &aggregateNameChanged{Name: "Third"}} {
+		if err = agg.Base.SetEvent(msg); err != nil {
+			t.Fatalf("setting event: %d failed: %v", i, err)
+		}
+		if err = store.Commit(ctx, agg); err != nil {
+			t.Fatalf("committing event: %d failed: %v", i, err)
+		}
+		timestamps[agg.Base.Revision()] = agg.Base.Timestamp()
+	}
+
+	t.Run("AtRevision", func(t *testing.T) {
+		for revision, name := range map[int64]string{1: "", 2: "First", 3: "Second", 4: "Third"} {
+			loaded := getTestAggregate(store, aggId)
+			if err := store.LoadEventsAtRevision(ctx, loaded, revision); err != nil {
+				t.Fatalf("loading aggregate at revision: %d failed: %v", revision, err)
+			}
+			if loaded.Name != name || loaded.Base.Revision() != revision {
+				t.Errorf("unexpected aggregate state at revision: %d - name: %s, revision: %d", revision, loaded.Name, loaded.Base.Revision())
+			}
+		}
+	})
+
+	t.Run("At", func(t *testing.T) {
+		loaded := getTestAggregate(store, aggId)
+		if err := store.LoadEventsAt(ctx, loaded, time.Unix(0, timestamps[3])); err != nil {
+			t.Fatalf("loading aggregate at time failed: %v", err)
+		}
+		if loaded.Name != "Second" || loaded.Base.Revision() != 3 {
+			t.Errorf("unexpected aggregate state - name: %s, revision: %d", loaded.Name, loaded.Base.Revision())
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		loaded := getTestAggregate(store, aggId)
+		if err := store.LoadEventsAt(ctx, loaded, time.Unix(0, timestamps[1]-1)); !cgerrors.IsNotFound(err) {
+			t.Errorf("expected not found error but got: %v", err)
+		}
+		loaded = getTestAggregate(store, aggId)
+		if err := store.LoadEventsAtRevision(ctx, loaded, 0); !cgerrors.IsNotFound(err) {
+			t.Errorf("expected not found error but got: %v", err)
+		}
+	})
+}
+
 func getTestAggregate(store *es.Store, aggId string) *testAggregate {
 	agg := &testAggregate{}
 	store.SetAggregateBase(agg, aggId, aggregateType, 1)
@@ -0,0 +1,281 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/kucjac/cleango/cgerrors"
+)
+
+// ComputeHash computes the SHA-256 hash of the event content and its previous hash.
+// The hash covers all the event fields, except the storage assigned position and the hash itself.
+func (x *Event) ComputeHash() []byte {
+	h := sha256.New()
+	var buf [binary.MaxVarintLen64]byte
+	writeBytes := func(b []byte) {
+		h.Write(buf[:binary.PutUvarint(buf[:], uint64(len(b)))])
+		h.Write(b)
+	}
+	writeString := func(s string) {
+		writeBytes([]byte(s))
+	}
+	writeInt := func(i int64) {
+		h.Write(buf[:binary.PutVarint(buf[:], i)])
+	}
+
+	writeString(x.EventId)
+	writeString(x.EventType)
+	writeString(x.AggregateType)
+	writeString(x.AggregateId)
+	writeBytes(x.EventData)
+	writeInt(x.Timestamp)
+	writeInt(x.Revision)
+	writeInt(int64(x.EventVersion))
+	writeString(x.CorrelationId)
+	writeString(x.CausationId)
+	writeString(x.Actor)
+	keys := make([]string, 0, len(x.Metadata))
+	for k := range x.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	writeInt(int64(len(keys)))
+	for _, k := range keys {
+		writeString(k)
+		writeString(x.Metadata[k])
+	}
+	writeBytes(x.PreviousHash)
+	return h.Sum(nil)
+}
+
+// chainEvent links given new event with the previous event of the aggregate, if the hash chain is enabled.
+func (a *AggregateBase) chainEvent(e *Event) {
+	if !a.hashChain {
+		return
+	}
+	e.PreviousHash, _ = a.eventHash(e.Revision - 1)
+	e.Hash = e.ComputeHash()
+}
+
+// eventHash gets the hash of the aggregate event with given revision, if the event was set, committed or loaded by the aggregate.
+func (a *AggregateBase) eventHash(revision int64) ([]byte, bool) {
+	if revision == 0 {
+		return nil, true
+	}
+	for _, events := range [][]*Event{a.uncommittedEvents, a.committedEvents} {
+		if n := len(events); n > 0 && events[0].Revision <= revision && revision <= events[n-1].Revision {
+			return events[revision-events[0].Revision].Hash, true
+		}
+	}
+	if a.hashRevision == revision {
+		return a.lastHash, true
+	}
+	return nil, false
+}
+
+// trackHash stores the hash of the latest loaded event, so that the new events could be linked with it.
+func (a *AggregateBase) trackHash(events []*Event) {
+	if n := len(events); n > 0 {
+		a.lastHash, a.hashRevision = events[n-1].Hash, events[n-1].Revision
+	}
+}
+
+// sealHashChain recomputes the hash chain of the aggregate uncommitted events, as their content might have changed
+// since they were set - by the context metadata or the conflict rebase.
+func (e *Store) sealHashChain(ctx context.Context, agg Aggregate) error {
+	if !e.hashChain {
+		return nil
+	}
+	b := agg.AggBase()
+	events := b.uncommittedEvents
+	prev, err := e.previousHash(ctx, b, events[0].Revision-1)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		event.PreviousHash = prev
+		event.Hash = event.ComputeHash()
+		prev = event.Hash
+	}
+	return nil
+}
+
+// previousHash gets the hash of the aggregate event with given revision.
+// If the event is not known to the aggregate, i.e. it was loaded from the snapshot, it is taken from the storage.
+func (e *Store) previousHash(ctx context.Context, b *AggregateBase, revision int64) ([]byte, error) {
+	if hash, ok := b.eventHash(revision); ok {
+		return hash, nil
+	}
+	events, err := e.storage.ListEventsUntilRevision(ctx, b.id, b.aggType, revision-1, revision)
+	if err != nil {
+		return nil, e.err("getting previous event failed", err)
+	}
+	if len(events) == 0 {
+		return nil, nil
+	}
+	return events[len(events)-1].Hash, nil
+}
+
+// VerifyAggregateHashChain verifies the hash chain of the stored events of given aggregate.
+// It returns the *HashChainError with the first broken link of the chain.
+func (e *Store) VerifyAggregateHashChain(ctx context.Context, aggId, aggType string) error {
+	events, err := e.storage.ListEvents(ctx, aggId, aggType)
+	if err != nil {
+		return e.err("listing aggregate events failed", err)
+	}
+	if len(events) == 0 {
+		return cgerrors.ErrNotFoundf("aggregate: %s with id: %s not found", aggType, aggId)
+	}
+	return VerifyHashChain(events)
+}
+
+// VerifyStoreHashChain walks all the stored events of given aggregate types, or of all the aggregates if none is provided,
+// and verifies the hash chains of their streams. It returns the *HashChainError with the first broken link found.
+// The events which are not streamed by the storage - i.e. archived, are verified from the aggregate event listing
+// when the stream of their aggregate doesn't start with the first revision.
+// If the storage stream stops on error, the error is returned, as the events following it are not verified.
+func (e *Store) VerifyStoreHashChain(ctx context.Context, aggTypes ...string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var streamErr error
+	c, err := e.storage.StreamEvents(ctx, &StreamEventsRequest{
+		AggregateTypes: aggTypes,
+		BuffSize:       e.bufferSize,
+		OnError:        func(err error) { streamErr = err },
+	})
+	if err != nil {
+		return e.err("opening storage stream events failed", err)
+	}
+	v := NewHashChainVerifier()
+	for event := range c {
+		if event.Revision > 1 && !v.started(event) {
+			prefix, err := e.storage.ListEventsUntilRevision(ctx, event.AggregateId, event.AggregateType, 0, event.Revision-1)
+			if err != nil {
+				return e.err("listing aggregate events failed", err)
+			}
+			for _, pe := range prefix {
+				if err = v.Verify(pe); err != nil {
+					return err
+				}
+			}
+		}
+		if err = v.Verify(event); err != nil {
+			return err
+		}
+	}
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	// The stream stopped on error, thus only a part of the stored events is verified.
+	if streamErr != nil {
+		return e.err("streaming events failed", streamErr)
+	}
+	return nil
+}
+
+// VerifyHashChain verifies the hash chain of given aggregate events, ordered by their revision.
+// It returns the *HashChainError with the first broken link of the chain.
+func VerifyHashChain(events []*Event) error {
+	v := NewHashChainVerifier()
+	for _, e := range events {
+		if err := v.Verify(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewHashChainVerifier creates a new hash chain verifier.
+func NewHashChainVerifier() *HashChainVerifier {
+	return &HashChainVerifier{heads: map[chainKey]chainHead{}}
+}
+
+// HashChainVerifier verifies the hash chains of the aggregate event streams.
+// The events of each aggregate are expected to be verified in the order of their revisions,
+// but the streams of different aggregates could be interleaved - i.e. ordered by their global position.
+// The events stored before the hash chain was enabled, which have no hash, are accepted only at the beginning of the stream.
+type HashChainVerifier struct {
+	heads map[chainKey]chainHead
+}
+
+type chainKey struct {
+	aggId, aggType string
+}
+
+type chainHead struct {
+	revision int64
+	hash     []byte
+}
+
+// Verify verifies if given event is properly linked with the previously verified events of its aggregate.
+func (v *HashChainVerifier) Verify(e *Event) error {
+	key := chainKey{aggId: e.AggregateId, aggType: e.AggregateType}
+	head := v.heads[key]
+	var reason string
+	switch {
+	case e.Revision != head.revision+1:
+		reason = fmt.Sprintf("expected revision: %d", head.revision+1)
+	case len(e.Hash) == 0:
+		if len(head.hash) != 0 {
+			reason = "event hash is missing"
+		}
+	case !bytes.Equal(e.PreviousHash, head.hash):
+		reason = "previous hash doesn't match the hash of the previous event"
+	case !bytes.Equal(e.Hash, e.ComputeHash()):
+		reason = "event hash doesn't match its content"
+	}
+	if reason != "" {
+		return &HashChainError{
+			AggregateID:   e.AggregateId,
+			AggregateType: e.AggregateType,
+			EventID:       e.EventId,
+			Revision:      e.Revision,
+			Reason:        reason,
+		}
+	}
+	v.heads[key] = chainHead{revision: e.Revision, hash: e.Hash}
+	return nil
+}
+
+// started checks if any event of the aggregate of given event was already verified.
+func (v *HashChainVerifier) started(e *Event) bool {
+	_, ok := v.heads[chainKey{aggId: e.AggregateId, aggType: e.AggregateType}]
+	return ok
+}
+
+// Compile time check if HashChainError implements cgerrors.ErrorCoder.
+var _ cgerrors.ErrorCoder = (*HashChainError)(nil)
+
+// HashChainError is the error returned by the hash chain verification, which points to the first broken link of the chain.
+type HashChainError struct {
+	AggregateID   string
+	AggregateType string
+	// EventID is the identifier of the event breaking the chain.
+	EventID string
+	// Revision is the revision of the event breaking the chain.
+	Revision int64
+	// Reason describes why the link is broken.
+	Reason string
+}
+
+// Error implements error interface.
+func (e *HashChainError) Error() string {
+	return fmt.Sprintf("aggregate: %s with id: %s hash chain broken at revision: %d, event: %s - %s",
+		e.AggregateType, e.AggregateID, e.Revision, e.EventID, e.Reason)
+}
+
+// ErrorCode implements cgerrors.ErrorCoder interface.
+func (e *HashChainError) ErrorCode(error) cgerrors.ErrorCode {
+	return cgerrors.CodeDataLoss
+}
+
+// IsHashChainBroken checks if given error is a *HashChainError.
+func IsHashChainBroken(err error) bool {
+	var he *HashChainError
+	return errors.As(err, &he)
+}
@@ -0,0 +1,236 @@
+package es_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/codec"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esmem"
+)
+
+func TestHashChain(t *testing.T) {
+	ctx := context.Background()
+	const (
+		aggId    = "5c2e8a4f-1b7d-4e9a-a3c6-7f0b2d4e6a81"
+		legacyId = "d8a1f3c5-7e9b-4a2d-b6f0-1c3e5a7b9d24"
+	)
+	storage := esmem.New()
+
+	// The events of the legacy aggregate are stored before the hash chain is enabled.
+	legacyStore, err := es.New(es.DefaultConfig(), codec.JSON(), codec.JSON(), storage)
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+	legacy := getTestAggregate(legacyStore, legacyId)
+	if err = legacy.Base.SetEvent(&aggregateCreated{}); err != nil {
+		t.Fatalf("setting event failed: %v", err)
+	}
+	if err = legacyStore.Commit(ctx, legacy); err != nil {
+		t.Fatalf("committing aggregate failed: %v", err)
+	}
+
+	cfg := es.DefaultConfig()
+	cfg.HashChain = true
+	store, err := es.New(cfg, codec.JSON(), codec.JSON(), storage)
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+
+	agg := getTestAggregate(store, aggId)
+	if err = agg.Base.SetEvent(&aggregateCreated{}); err != nil {
+		t.Fatalf("setting event failed: %v", err)
+	}
+	if err = agg.Base.SetEvent(&aggregateNameChanged{Name: "first"}); err != nil {
+		t.Fatalf("setting event failed: %v", err)
+	}
+	events := agg.Base.UncommittedEvents()
+	if len(events[0].Hash) == 0 || len(events[0].PreviousHash) != 0 {
+		t.Fatalf("expected the first event to be hashed without previous hash")
+	}
+	if string(events[1].PreviousHash) != string(events[0].Hash) {
+		t.Fatalf("expected the second event to be linked with the first one")
+	}
+	// The metadata set on commit changes the event content, thus the chain is resealed.
+	if err = store.Commit(es.WithCorrelationID(ctx, "corr-id"), agg); err != nil {
+		t.Fatalf("committing aggregate failed: %v", err)
+	}
+	if err = store.SaveSnapshot(ctx, agg); err != nil {
+		t.Fatalf("saving snapshot failed: %v", err)
+	}
+
+	// The aggregate loaded from the snapshot links the new events with the event stored in the storage.
+	loaded := getTestAggregate(store, aggId)
+	if err = store.LoadEventsWithSnapshot(ctx, loaded); err != nil {
+		t.Fatalf("loading aggregate failed: %v", err)
+	}
+	if err = loaded.Base.SetEvent(&aggregateNameChanged{Name: "second"}); err != nil {
+		t.Fatalf("setting event failed: %v", err)
+	}
+	if err = store.Commit(ctx, loaded); err != nil {
+		t.Fatalf("committing aggregate failed: %v", err)
+	}
+
+	// The stale aggregate is rebased on the conflict, and its event is relinked.
+	if err = agg.Base.SetEvent(&aggregateNameChanged{Name: "third"}); err != nil {
+		t.Fatalf("setting event failed: %v", err)
+	}
+	if err = store.Commit(ctx, agg); err != nil {
+		t.Fatalf("committing stale aggregate failed: %v", err)
+	}
+	if agg.Base.Revision() != 4 {
+		t.Fatalf("expected revision 4 but is: %d", agg.Base.Revision())
+	}
+
+	legacy = getTestAggregate(store, legacyId)
+	if err = store.LoadEvents(ctx, legacy); err != nil {
+		t.Fatalf("loading aggregate failed: %v", err)
+	}
+	if err = legacy.Base.SetEvent(&aggregateNameChanged{Name: "legacy"}); err != nil {
+		t.Fatalf("setting event failed: %v", err)
+	}
+	if err = store.Commit(ctx, legacy); err != nil {
+		t.Fatalf("committing aggregate failed: %v", err)
+	}
+
+	t.Run("Verify", func(t *testing.T) {
+		for _, id := range []string{aggId, legacyId} {
+			if err := store.VerifyAggregateHashChain(ctx, id, aggregateType); err != nil {
+				t.Errorf("verifying aggregate: %s failed: %v", id, err)
+			}
+		}
+		if err := store.VerifyStoreHashChain(ctx); err != nil {
+			t.Errorf("verifying store failed: %v", err)
+		}
+	})
+
+	t.Run("Archived", func(t *testing.T) {
+		archived, err := es.New(cfg, codec.JSON(), codec.JSON(), &archivedStorage{Storage: storage, revision: 2})
+		if err != nil {
+			t.Fatalf("creating store failed: %v", err)
+		}
+		if err = archived.VerifyStoreHashChain(ctx); err != nil {
+			t.Errorf("verifying store with archived events failed: %v", err)
+		}
+	})
+
+	t.Run("StreamError", func(t *testing.T) {
+		failing, err := es.New(cfg, codec.JSON(), codec.JSON(), &failingStreamStorage{Storage: storage, after: 1})
+		if err != nil {
+			t.Fatalf("creating store failed: %v", err)
+		}
+		if err = failing.VerifyStoreHashChain(ctx); cgerrors.Code(err) != cgerrors.CodeUnavailable {
+			t.Errorf("expected the stream error returned from the verification, but got: %v", err)
+		}
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		stored, err := storage.ListEvents(ctx, aggId, aggregateType)
+		if err != nil {
+			t.Fatalf("listing events failed: %v", err)
+		}
+		tests := []struct {
+			name     string
+			tamper   func(events []*es.Event) []*es.Event
+			revision int64
+		}{
+			{name: "Data", revision: 2, tamper: func(events []*es.Event) []*es.Event {
+				events[1].EventData = []byte(`{"name":"changed"}`)
+				return events
+			}},
+			{name: "Metadata", revision: 1, tamper: func(events []*es.Event) []*es.Event {
+				events[0].CorrelationId = ""
+				return events
+			}},
+			{name: "Removed", revision: 3, tamper: func(events []*es.Event) []*es.Event {
+				return append(events[:1:1], events[2:]...)
+			}},
+			{name: "Rehashed", revision: 3, tamper: func(events []*es.Event) []*es.Event {
+				events[1].EventData = []byte(`{"name":"changed"}`)
+				events[1].Hash = events[1].ComputeHash()
+				return events
+			}},
+			{name: "HashRemoved", revision: 4, tamper: func(events []*es.Event) []*es.Event {
+				events[3].Hash = nil
+				return events
+			}},
+		}
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				events := make([]*es.Event, len(stored))
+				for i, e := range stored {
+					events[i] = e.Copy()
+				}
+				err := es.VerifyHashChain(tc.tamper(events))
+				if !es.IsHashChainBroken(err) {
+					t.Fatalf("expected broken hash chain error but got: %v", err)
+				}
+				if he := err.(*es.HashChainError); he.Revision != tc.revision {
+					t.Errorf("expected broken link at revision: %d but is: %d", tc.revision, he.Revision)
+				}
+			})
+		}
+	})
+}
+
+// archivedStorage doesn't stream the events up to given revision, as the storages with archived events do.
+type archivedStorage struct {
+	*esmem.Storage
+	revision int64
+}
+
+func (s *archivedStorage) StreamEvents(ctx context.Context, req *es.StreamEventsRequest) (<-chan *es.Event, error) {
+	c, err := s.Storage.StreamEvents(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan *es.Event)
+	go func() {
+		defer close(out)
+		for e := range c {
+			if e.Revision <= s.revision {
+				continue
+			}
+			select {
+			case out <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// failingStreamStorage stops the event stream with an error after given number of events.
+type failingStreamStorage struct {
+	*esmem.Storage
+	after int
+}
+
+func (s *failingStreamStorage) StreamEvents(ctx context.Context, req *es.StreamEventsRequest) (<-chan *es.Event, error) {
+	c, err := s.Storage.StreamEvents(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan *es.Event)
+	go func() {
+		defer close(out)
+		var n int
+		for e := range c {
+			if n == s.after {
+				if req.OnError != nil {
+					req.OnError(cgerrors.ErrUnavailable("connection lost"))
+				}
+				return
+			}
+			n++
+			select {
+			case out <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,123 @@
+package es
+
+import (
+	"context"
+
+	"github.com/kucjac/cleango/cgerrors"
+)
+
+// LoadMany loads the latest state of all given aggregates, just like the LoadEventsWithSnapshot does for a single one.
+// The aggregates are grouped by their type and version, and for each group the latest snapshots and the events
+// following them are fetched with a single storage call each. If any of the aggregates is not found or deleted,
+// the error is returned, and the state of the aggregates is undefined.
+func (e *Store) LoadMany(ctx context.Context, aggs ...Aggregate) error {
+	return e.loadMany(ctx, aggs, nil)
+}
+
+type loadGroupKey struct {
+	aggType string
+	version int64
+}
+
+// loadMany loads given aggregates in groups. If the restore function is provided, it is called for each aggregate
+// before its snapshot is fetched - if it restores the aggregate state, only its last event and the events following it
+// are loaded. If the last event doesn't match the restored state, the aggregate is loaded from the storage.
+func (e *Store) loadMany(ctx context.Context, aggs []Aggregate, restore func(agg Aggregate) (bool, error)) error {
+	var keys []loadGroupKey
+	groups := map[loadGroupKey][]Aggregate{}
+	for _, agg := range aggs {
+		b := agg.AggBase()
+		key := loadGroupKey{aggType: b.aggType, version: b.version}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], agg)
+	}
+	for _, key := range keys {
+		if err := e.loadGroup(ctx, key, groups[key], restore); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Store) loadGroup(ctx context.Context, key loadGroupKey, aggs []Aggregate, restore func(agg Aggregate) (bool, error)) error {
+	after := make(map[string]int64, len(aggs))
+	restored := make(map[string]bool, len(aggs))
+	verify := map[string]bool{}
+	var ids []string
+	for _, agg := range aggs {
+		b := agg.AggBase()
+		if _, ok := after[b.id]; ok {
+			return cgerrors.ErrInvalidArgumentf("aggregate: %s with id: %s is loaded more than once", b.aggType, b.id)
+		}
+		after[b.id] = 0
+		if restore != nil {
+			ok, err := restore(agg)
+			if err != nil {
+				return err
+			}
+			if ok {
+				// The restored state is verified with its last event, loaded along with the following ones.
+				restored[b.id], verify[b.id] = true, true
+				after[b.id] = b.revision - 1
+				continue
+			}
+		}
+		ids = append(ids, b.id)
+	}
+
+	if len(ids) > 0 {
+		snapshots, err := e.storage.ListLatestSnapshots(ctx, key.aggType, key.version, ids)
+		if err != nil {
+			return e.err("listing aggregate snapshots failed", err)
+		}
+		byID := make(map[string]*Snapshot, len(snapshots))
+		for _, snap := range snapshots {
+			byID[snap.AggregateId] = snap
+		}
+		for _, agg := range aggs {
+			b := agg.AggBase()
+			snap, ok := byID[b.id]
+			if !ok || restored[b.id] {
+				continue
+			}
+			if err = e.restoreSnapshot(agg, snap); err != nil {
+				return err
+			}
+			restored[b.id] = true
+			after[b.id] = snap.Revision
+		}
+	}
+
+	events, err := e.storage.ListEventsAfterRevisions(ctx, key.aggType, after)
+	if err != nil {
+		return e.err("listing aggregate events failed", err)
+	}
+	streams := make(map[string][]*Event, len(aggs))
+	for _, event := range events {
+		streams[event.AggregateId] = append(streams[event.AggregateId], event)
+	}
+	for _, agg := range aggs {
+		b := agg.AggBase()
+		stream := streams[b.id]
+		if verify[b.id] {
+			if !b.restoredFrom(stream) {
+				// The aggregate was purged or re-created since its state was restored.
+				resetAggregate(agg)
+				if err = e.LoadEventsWithSnapshot(ctx, agg); err != nil {
+					return err
+				}
+				continue
+			}
+			stream = stream[1:]
+		}
+		if len(stream) == 0 && !restored[b.id] {
+			return cgerrors.ErrNotFoundf("aggregate: %s with id %s not found", b.aggType, b.id)
+		}
+		if err = e.applyStream(agg, stream); err != nil {
+			return err
+		}
+	}
+	return nil
+}
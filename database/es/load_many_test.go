@@ -0,0 +1,125 @@
+package es_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/codec"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esmem"
+)
+
+func TestLoadMany(t *testing.T) {
+	ctx := context.Background()
+	ids := []string{
+		"3f8b2a6c-1d4e-4c9a-8e7b-5a0f2d6c9b14",
+		"9e1c7d3a-6b5f-4a2e-b8c0-2f4d6a8e1c73",
+		"b5d2f8e1-4a7c-4e3b-9f6d-8c1a3e5b7d20",
+	}
+	const missingId = "e7a4c1b9-2f6d-4b8e-a3c5-9d0f7b2e4a61"
+
+	store, err := es.New(es.DefaultConfig(), codec.JSON(), codec.JSON(), esmem.New())
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+	for i, id := range ids {
+		agg := getTestAggregate(store, id)
+		if err = agg.Base.SetEvent(&aggregateCreated{}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		if err = agg.Base.SetEvent(&aggregateNameChanged{Name: id}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		if err = store.Commit(ctx, agg); err != nil {
+			t.Fatalf("committing aggregate failed: %v", err)
+		}
+		// The first aggregate has a snapshot followed by an event.
+		if i == 0 {
+			if err = store.SaveSnapshot(ctx, agg); err != nil {
+				t.Fatalf("saving snapshot failed: %v", err)
+			}
+			if err = agg.Base.SetEvent(&aggregateNameChanged{Name: "after snapshot"}); err != nil {
+				t.Fatalf("setting event failed: %v", err)
+			}
+			if err = store.Commit(ctx, agg); err != nil {
+				t.Fatalf("committing aggregate failed: %v", err)
+			}
+		}
+	}
+
+	loadAll := func(t *testing.T, s es.EventStore) []*testAggregate {
+		aggs := make([]*testAggregate, len(ids))
+		list := make([]es.Aggregate, len(ids))
+		for i, id := range ids {
+			aggs[i] = getTestAggregate(store, id)
+			list[i] = aggs[i]
+		}
+		if err := s.LoadMany(ctx, list...); err != nil {
+			t.Fatalf("loading many aggregates failed: %v", err)
+		}
+		return aggs
+	}
+	checkLoaded := func(t *testing.T, aggs []*testAggregate) {
+		for i, agg := range aggs {
+			expected := getTestAggregate(store, ids[i])
+			if err := store.LoadEvents(ctx, expected); err != nil {
+				t.Fatalf("loading aggregate failed: %v", err)
+			}
+			if agg.Name != expected.Name || agg.Base.Revision() != expected.Base.Revision() {
+				t.Errorf("aggregate: %s loaded as: %s at revision: %d, expected: %s at revision: %d",
+					ids[i], agg.Name, agg.Base.Revision(), expected.Name, expected.Base.Revision())
+			}
+		}
+	}
+
+	t.Run("Store", func(t *testing.T) {
+		checkLoaded(t, loadAll(t, store))
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		err := store.LoadMany(ctx, getTestAggregate(store, ids[0]), getTestAggregate(store, missingId))
+		if !cgerrors.IsNotFound(err) {
+			t.Errorf("expected not found error, but got: %v", err)
+		}
+	})
+
+	t.Run("Duplicated", func(t *testing.T) {
+		err := store.LoadMany(ctx, getTestAggregate(store, ids[0]), getTestAggregate(store, ids[0]))
+		if cgerrors.Code(err) != cgerrors.CodeInvalidArgument {
+			t.Errorf("expected invalid argument error, but got: %v", err)
+		}
+	})
+
+	t.Run("Cached", func(t *testing.T) {
+		cached, err := es.NewCachingStore(store, nil)
+		if err != nil {
+			t.Fatalf("creating caching store failed: %v", err)
+		}
+		checkLoaded(t, loadAll(t, cached))
+		if s := cached.Stats(); s.Misses != 3 || s.Hits != 0 {
+			t.Fatalf("expected 3 cache misses, but got: %+v", s)
+		}
+
+		// The second aggregate is changed bypassing the cache.
+		agg := getTestAggregate(store, ids[1])
+		if err = store.LoadEvents(ctx, agg); err != nil {
+			t.Fatalf("loading aggregate failed: %v", err)
+		}
+		if err = agg.Base.SetEvent(&aggregateNameChanged{Name: "changed"}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		if err = store.Commit(ctx, agg); err != nil {
+			t.Fatalf("committing aggregate failed: %v", err)
+		}
+
+		aggs := loadAll(t, cached)
+		checkLoaded(t, aggs)
+		if aggs[1].Name != "changed" {
+			t.Errorf("expected the cached aggregate to catch up, but is: %s", aggs[1].Name)
+		}
+		if s := cached.Stats(); s.Hits != 2 || s.Stale != 1 {
+			t.Fatalf("expected 2 cache hits and a single stale load, but got: %+v", s)
+		}
+	})
+}
@@ -7,6 +7,7 @@ package mockes
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	es "github.com/kucjac/cleango/database/es"
@@ -35,6 +36,21 @@ func (m *MockEventStore) EXPECT() *MockEventStoreMockRecorder {
 	return m.recorder
 }
 
+// AggregateExists mocks base method.
+func (m *MockEventStore) AggregateExists(arg0 context.Context, arg1, arg2 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AggregateExists", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AggregateExists indicates an expected call of AggregateExists.
+func (mr *MockEventStoreMockRecorder) AggregateExists(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AggregateExists", reflect.TypeOf((*MockEventStore)(nil).AggregateExists), arg0, arg1, arg2)
+}
+
 // Commit mocks base method.
 func (m *MockEventStore) Commit(arg0 context.Context, arg1 es.Aggregate) error {
 	m.ctrl.T.Helper()
@@ -49,6 +65,69 @@ func (mr *MockEventStoreMockRecorder) Commit(arg0, arg1 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Commit", reflect.TypeOf((*MockEventStore)(nil).Commit), arg0, arg1)
 }
 
+// CommitAll mocks base method.
+func (m *MockEventStore) CommitAll(arg0 context.Context, arg1 ...es.Aggregate) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "CommitAll", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CommitAll indicates an expected call of CommitAll.
+func (mr *MockEventStoreMockRecorder) CommitAll(arg0 interface{}, arg1 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CommitAll", reflect.TypeOf((*MockEventStore)(nil).CommitAll), varargs...)
+}
+
+// CountAggregates mocks base method.
+func (m *MockEventStore) CountAggregates(arg0 context.Context, arg1 string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountAggregates", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountAggregates indicates an expected call of CountAggregates.
+func (mr *MockEventStoreMockRecorder) CountAggregates(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountAggregates", reflect.TypeOf((*MockEventStore)(nil).CountAggregates), arg0, arg1)
+}
+
+// Delete mocks base method.
+func (m *MockEventStore) Delete(arg0 context.Context, arg1 es.Aggregate) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockEventStoreMockRecorder) Delete(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockEventStore)(nil).Delete), arg0, arg1)
+}
+
+// ListAggregates mocks base method.
+func (m *MockEventStore) ListAggregates(arg0 context.Context, arg1, arg2 string, arg3 int) (*es.ListAggregatesResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAggregates", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(*es.ListAggregatesResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAggregates indicates an expected call of ListAggregates.
+func (mr *MockEventStoreMockRecorder) ListAggregates(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAggregates", reflect.TypeOf((*MockEventStore)(nil).ListAggregates), arg0, arg1, arg2, arg3)
+}
+
 // LoadEvents mocks base method.
 func (m *MockEventStore) LoadEvents(arg0 context.Context, arg1 es.Aggregate) error {
 	m.ctrl.T.Helper()
@@ -63,6 +142,34 @@ func (mr *MockEventStoreMockRecorder) LoadEvents(arg0, arg1 interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadEvents", reflect.TypeOf((*MockEventStore)(nil).LoadEvents), arg0, arg1)
 }
 
+// LoadEventsAt mocks base method.
+func (m *MockEventStore) LoadEventsAt(arg0 context.Context, arg1 es.Aggregate, arg2 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LoadEventsAt", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LoadEventsAt indicates an expected call of LoadEventsAt.
+func (mr *MockEventStoreMockRecorder) LoadEventsAt(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadEventsAt", reflect.TypeOf((*MockEventStore)(nil).LoadEventsAt), arg0, arg1, arg2)
+}
+
+// LoadEventsAtRevision mocks base method.
+func (m *MockEventStore) LoadEventsAtRevision(arg0 context.Context, arg1 es.Aggregate, arg2 int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LoadEventsAtRevision", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LoadEventsAtRevision indicates an expected call of LoadEventsAtRevision.
+func (mr *MockEventStoreMockRecorder) LoadEventsAtRevision(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadEventsAtRevision", reflect.TypeOf((*MockEventStore)(nil).LoadEventsAtRevision), arg0, arg1, arg2)
+}
+
 // LoadEventsWithSnapshot mocks base method.
 func (m *MockEventStore) LoadEventsWithSnapshot(arg0 context.Context, arg1 es.Aggregate) error {
 	m.ctrl.T.Helper()
@@ -77,6 +184,40 @@ func (mr *MockEventStoreMockRecorder) LoadEventsWithSnapshot(arg0, arg1 interfac
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadEventsWithSnapshot", reflect.TypeOf((*MockEventStore)(nil).LoadEventsWithSnapshot), arg0, arg1)
 }
 
+// LoadMany mocks base method.
+func (m *MockEventStore) LoadMany(arg0 context.Context, arg1 ...es.Aggregate) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "LoadMany", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LoadMany indicates an expected call of LoadMany.
+func (mr *MockEventStoreMockRecorder) LoadMany(arg0 interface{}, arg1 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadMany", reflect.TypeOf((*MockEventStore)(nil).LoadMany), varargs...)
+}
+
+// QueryEvents mocks base method.
+func (m *MockEventStore) QueryEvents(arg0 context.Context, arg1 *es.QueryEventsRequest) (*es.QueryEventsResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QueryEvents", arg0, arg1)
+	ret0, _ := ret[0].(*es.QueryEventsResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryEvents indicates an expected call of QueryEvents.
+func (mr *MockEventStoreMockRecorder) QueryEvents(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryEvents", reflect.TypeOf((*MockEventStore)(nil).QueryEvents), arg0, arg1)
+}
+
 // SaveSnapshot mocks base method.
 func (m *MockEventStore) SaveSnapshot(arg0 context.Context, arg1 es.Aggregate) error {
 	m.ctrl.T.Helper()
@@ -36,6 +36,21 @@ func (m *MockStorage) EXPECT() *MockStorageMockRecorder {
 	return m.recorder
 }
 
+// AggregateExists mocks base method.
+func (m *MockStorage) AggregateExists(arg0 context.Context, arg1, arg2 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AggregateExists", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AggregateExists indicates an expected call of AggregateExists.
+func (mr *MockStorageMockRecorder) AggregateExists(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AggregateExists", reflect.TypeOf((*MockStorage)(nil).AggregateExists), arg0, arg1, arg2)
+}
+
 // As mocks base method.
 func (m *MockStorage) As(arg0 interface{}) error {
 	m.ctrl.T.Helper()
@@ -65,6 +80,21 @@ func (mr *MockStorageMockRecorder) BeginTx(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BeginTx", reflect.TypeOf((*MockStorage)(nil).BeginTx), arg0)
 }
 
+// CountAggregates mocks base method.
+func (m *MockStorage) CountAggregates(arg0 context.Context, arg1 string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountAggregates", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountAggregates indicates an expected call of CountAggregates.
+func (mr *MockStorageMockRecorder) CountAggregates(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountAggregates", reflect.TypeOf((*MockStorage)(nil).CountAggregates), arg0, arg1)
+}
+
 // ErrorCode mocks base method.
 func (m *MockStorage) ErrorCode(arg0 error) cgerrors.ErrorCode {
 	m.ctrl.T.Helper()
@@ -94,6 +124,51 @@ func (mr *MockStorageMockRecorder) GetSnapshot(arg0, arg1, arg2, arg3 interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSnapshot", reflect.TypeOf((*MockStorage)(nil).GetSnapshot), arg0, arg1, arg2, arg3)
 }
 
+// GetSnapshotAtRevision mocks base method.
+func (m *MockStorage) GetSnapshotAtRevision(arg0 context.Context, arg1, arg2 string, arg3, arg4 int64) (*es.Snapshot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSnapshotAtRevision", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(*es.Snapshot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSnapshotAtRevision indicates an expected call of GetSnapshotAtRevision.
+func (mr *MockStorageMockRecorder) GetSnapshotAtRevision(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSnapshotAtRevision", reflect.TypeOf((*MockStorage)(nil).GetSnapshotAtRevision), arg0, arg1, arg2, arg3, arg4)
+}
+
+// GetSnapshotAtTimestamp mocks base method.
+func (m *MockStorage) GetSnapshotAtTimestamp(arg0 context.Context, arg1, arg2 string, arg3, arg4 int64) (*es.Snapshot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSnapshotAtTimestamp", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(*es.Snapshot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSnapshotAtTimestamp indicates an expected call of GetSnapshotAtTimestamp.
+func (mr *MockStorageMockRecorder) GetSnapshotAtTimestamp(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSnapshotAtTimestamp", reflect.TypeOf((*MockStorage)(nil).GetSnapshotAtTimestamp), arg0, arg1, arg2, arg3, arg4)
+}
+
+// ListAggregates mocks base method.
+func (m *MockStorage) ListAggregates(arg0 context.Context, arg1 string, arg2 int64, arg3 int) ([]*es.AggregateRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAggregates", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]*es.AggregateRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAggregates indicates an expected call of ListAggregates.
+func (mr *MockStorageMockRecorder) ListAggregates(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAggregates", reflect.TypeOf((*MockStorage)(nil).ListAggregates), arg0, arg1, arg2, arg3)
+}
+
 // ListEvents mocks base method.
 func (m *MockStorage) ListEvents(arg0 context.Context, arg1, arg2 string) ([]*es.Event, error) {
 	m.ctrl.T.Helper()
@@ -124,6 +199,110 @@ func (mr *MockStorageMockRecorder) ListEventsAfterRevision(arg0, arg1, arg2, arg
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListEventsAfterRevision", reflect.TypeOf((*MockStorage)(nil).ListEventsAfterRevision), arg0, arg1, arg2, arg3)
 }
 
+// ListEventsAfterRevisions mocks base method.
+func (m *MockStorage) ListEventsAfterRevisions(arg0 context.Context, arg1 string, arg2 map[string]int64) ([]*es.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListEventsAfterRevisions", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]*es.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListEventsAfterRevisions indicates an expected call of ListEventsAfterRevisions.
+func (mr *MockStorageMockRecorder) ListEventsAfterRevisions(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListEventsAfterRevisions", reflect.TypeOf((*MockStorage)(nil).ListEventsAfterRevisions), arg0, arg1, arg2)
+}
+
+// ListEventsUntilRevision mocks base method.
+func (m *MockStorage) ListEventsUntilRevision(arg0 context.Context, arg1, arg2 string, arg3, arg4 int64) ([]*es.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListEventsUntilRevision", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].([]*es.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListEventsUntilRevision indicates an expected call of ListEventsUntilRevision.
+func (mr *MockStorageMockRecorder) ListEventsUntilRevision(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListEventsUntilRevision", reflect.TypeOf((*MockStorage)(nil).ListEventsUntilRevision), arg0, arg1, arg2, arg3, arg4)
+}
+
+// ListEventsUntilTimestamp mocks base method.
+func (m *MockStorage) ListEventsUntilTimestamp(arg0 context.Context, arg1, arg2 string, arg3, arg4 int64) ([]*es.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListEventsUntilTimestamp", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].([]*es.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListEventsUntilTimestamp indicates an expected call of ListEventsUntilTimestamp.
+func (mr *MockStorageMockRecorder) ListEventsUntilTimestamp(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListEventsUntilTimestamp", reflect.TypeOf((*MockStorage)(nil).ListEventsUntilTimestamp), arg0, arg1, arg2, arg3, arg4)
+}
+
+// ListLatestSnapshots mocks base method.
+func (m *MockStorage) ListLatestSnapshots(arg0 context.Context, arg1 string, arg2 int64, arg3 []string) ([]*es.Snapshot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListLatestSnapshots", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]*es.Snapshot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListLatestSnapshots indicates an expected call of ListLatestSnapshots.
+func (mr *MockStorageMockRecorder) ListLatestSnapshots(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListLatestSnapshots", reflect.TypeOf((*MockStorage)(nil).ListLatestSnapshots), arg0, arg1, arg2, arg3)
+}
+
+// ListSnapshots mocks base method.
+func (m *MockStorage) ListSnapshots(arg0 context.Context, arg1, arg2 string) ([]*es.Snapshot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListSnapshots", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]*es.Snapshot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListSnapshots indicates an expected call of ListSnapshots.
+func (mr *MockStorageMockRecorder) ListSnapshots(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListSnapshots", reflect.TypeOf((*MockStorage)(nil).ListSnapshots), arg0, arg1, arg2)
+}
+
+// PruneSnapshots mocks base method.
+func (m *MockStorage) PruneSnapshots(arg0 context.Context, arg1, arg2 string, arg3 int64, arg4 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PruneSnapshots", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PruneSnapshots indicates an expected call of PruneSnapshots.
+func (mr *MockStorageMockRecorder) PruneSnapshots(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PruneSnapshots", reflect.TypeOf((*MockStorage)(nil).PruneSnapshots), arg0, arg1, arg2, arg3, arg4)
+}
+
+// QueryEvents mocks base method.
+func (m *MockStorage) QueryEvents(arg0 context.Context, arg1 *es.EventQuery) ([]*es.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QueryEvents", arg0, arg1)
+	ret0, _ := ret[0].([]*es.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryEvents indicates an expected call of QueryEvents.
+func (mr *MockStorageMockRecorder) QueryEvents(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryEvents", reflect.TypeOf((*MockStorage)(nil).QueryEvents), arg0, arg1)
+}
+
 // SaveEvents mocks base method.
 func (m *MockStorage) SaveEvents(arg0 context.Context, arg1 []*es.Event) error {
 	m.ctrl.T.Helper()
@@ -190,6 +369,21 @@ func (m *MockTxStorage) EXPECT() *MockTxStorageMockRecorder {
 	return m.recorder
 }
 
+// AggregateExists mocks base method.
+func (m *MockTxStorage) AggregateExists(arg0 context.Context, arg1, arg2 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AggregateExists", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AggregateExists indicates an expected call of AggregateExists.
+func (mr *MockTxStorageMockRecorder) AggregateExists(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AggregateExists", reflect.TypeOf((*MockTxStorage)(nil).AggregateExists), arg0, arg1, arg2)
+}
+
 // As mocks base method.
 func (m *MockTxStorage) As(arg0 interface{}) error {
 	m.ctrl.T.Helper()
@@ -218,6 +412,21 @@ func (mr *MockTxStorageMockRecorder) Commit(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Commit", reflect.TypeOf((*MockTxStorage)(nil).Commit), arg0)
 }
 
+// CountAggregates mocks base method.
+func (m *MockTxStorage) CountAggregates(arg0 context.Context, arg1 string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountAggregates", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountAggregates indicates an expected call of CountAggregates.
+func (mr *MockTxStorageMockRecorder) CountAggregates(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountAggregates", reflect.TypeOf((*MockTxStorage)(nil).CountAggregates), arg0, arg1)
+}
+
 // ErrorCode mocks base method.
 func (m *MockTxStorage) ErrorCode(arg0 error) cgerrors.ErrorCode {
 	m.ctrl.T.Helper()
@@ -247,6 +456,51 @@ func (mr *MockTxStorageMockRecorder) GetSnapshot(arg0, arg1, arg2, arg3 interfac
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSnapshot", reflect.TypeOf((*MockTxStorage)(nil).GetSnapshot), arg0, arg1, arg2, arg3)
 }
 
+// GetSnapshotAtRevision mocks base method.
+func (m *MockTxStorage) GetSnapshotAtRevision(arg0 context.Context, arg1, arg2 string, arg3, arg4 int64) (*es.Snapshot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSnapshotAtRevision", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(*es.Snapshot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSnapshotAtRevision indicates an expected call of GetSnapshotAtRevision.
+func (mr *MockTxStorageMockRecorder) GetSnapshotAtRevision(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSnapshotAtRevision", reflect.TypeOf((*MockTxStorage)(nil).GetSnapshotAtRevision), arg0, arg1, arg2, arg3, arg4)
+}
+
+// GetSnapshotAtTimestamp mocks base method.
+func (m *MockTxStorage) GetSnapshotAtTimestamp(arg0 context.Context, arg1, arg2 string, arg3, arg4 int64) (*es.Snapshot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSnapshotAtTimestamp", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(*es.Snapshot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSnapshotAtTimestamp indicates an expected call of GetSnapshotAtTimestamp.
+func (mr *MockTxStorageMockRecorder) GetSnapshotAtTimestamp(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSnapshotAtTimestamp", reflect.TypeOf((*MockTxStorage)(nil).GetSnapshotAtTimestamp), arg0, arg1, arg2, arg3, arg4)
+}
+
+// ListAggregates mocks base method.
+func (m *MockTxStorage) ListAggregates(arg0 context.Context, arg1 string, arg2 int64, arg3 int) ([]*es.AggregateRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAggregates", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]*es.AggregateRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAggregates indicates an expected call of ListAggregates.
+func (mr *MockTxStorageMockRecorder) ListAggregates(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAggregates", reflect.TypeOf((*MockTxStorage)(nil).ListAggregates), arg0, arg1, arg2, arg3)
+}
+
 // ListEvents mocks base method.
 func (m *MockTxStorage) ListEvents(arg0 context.Context, arg1, arg2 string) ([]*es.Event, error) {
 	m.ctrl.T.Helper()
@@ -277,6 +531,110 @@ func (mr *MockTxStorageMockRecorder) ListEventsAfterRevision(arg0, arg1, arg2, a
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListEventsAfterRevision", reflect.TypeOf((*MockTxStorage)(nil).ListEventsAfterRevision), arg0, arg1, arg2, arg3)
 }
 
+// ListEventsAfterRevisions mocks base method.
+func (m *MockTxStorage) ListEventsAfterRevisions(arg0 context.Context, arg1 string, arg2 map[string]int64) ([]*es.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListEventsAfterRevisions", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]*es.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListEventsAfterRevisions indicates an expected call of ListEventsAfterRevisions.
+func (mr *MockTxStorageMockRecorder) ListEventsAfterRevisions(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListEventsAfterRevisions", reflect.TypeOf((*MockTxStorage)(nil).ListEventsAfterRevisions), arg0, arg1, arg2)
+}
+
+// ListEventsUntilRevision mocks base method.
+func (m *MockTxStorage) ListEventsUntilRevision(arg0 context.Context, arg1, arg2 string, arg3, arg4 int64) ([]*es.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListEventsUntilRevision", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].([]*es.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListEventsUntilRevision indicates an expected call of ListEventsUntilRevision.
+func (mr *MockTxStorageMockRecorder) ListEventsUntilRevision(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListEventsUntilRevision", reflect.TypeOf((*MockTxStorage)(nil).ListEventsUntilRevision), arg0, arg1, arg2, arg3, arg4)
+}
+
+// ListEventsUntilTimestamp mocks base method.
+func (m *MockTxStorage) ListEventsUntilTimestamp(arg0 context.Context, arg1, arg2 string, arg3, arg4 int64) ([]*es.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListEventsUntilTimestamp", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].([]*es.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListEventsUntilTimestamp indicates an expected call of ListEventsUntilTimestamp.
+func (mr *MockTxStorageMockRecorder) ListEventsUntilTimestamp(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListEventsUntilTimestamp", reflect.TypeOf((*MockTxStorage)(nil).ListEventsUntilTimestamp), arg0, arg1, arg2, arg3, arg4)
+}
+
+// ListLatestSnapshots mocks base method.
+func (m *MockTxStorage) ListLatestSnapshots(arg0 context.Context, arg1 string, arg2 int64, arg3 []string) ([]*es.Snapshot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListLatestSnapshots", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]*es.Snapshot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListLatestSnapshots indicates an expected call of ListLatestSnapshots.
+func (mr *MockTxStorageMockRecorder) ListLatestSnapshots(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListLatestSnapshots", reflect.TypeOf((*MockTxStorage)(nil).ListLatestSnapshots), arg0, arg1, arg2, arg3)
+}
+
+// ListSnapshots mocks base method.
+func (m *MockTxStorage) ListSnapshots(arg0 context.Context, arg1, arg2 string) ([]*es.Snapshot, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListSnapshots", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]*es.Snapshot)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListSnapshots indicates an expected call of ListSnapshots.
+func (mr *MockTxStorageMockRecorder) ListSnapshots(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListSnapshots", reflect.TypeOf((*MockTxStorage)(nil).ListSnapshots), arg0, arg1, arg2)
+}
+
+// PruneSnapshots mocks base method.
+func (m *MockTxStorage) PruneSnapshots(arg0 context.Context, arg1, arg2 string, arg3 int64, arg4 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PruneSnapshots", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PruneSnapshots indicates an expected call of PruneSnapshots.
+func (mr *MockTxStorageMockRecorder) PruneSnapshots(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PruneSnapshots", reflect.TypeOf((*MockTxStorage)(nil).PruneSnapshots), arg0, arg1, arg2, arg3, arg4)
+}
+
+// QueryEvents mocks base method.
+func (m *MockTxStorage) QueryEvents(arg0 context.Context, arg1 *es.EventQuery) ([]*es.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QueryEvents", arg0, arg1)
+	ret0, _ := ret[0].([]*es.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryEvents indicates an expected call of QueryEvents.
+func (mr *MockTxStorageMockRecorder) QueryEvents(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryEvents", reflect.TypeOf((*MockTxStorage)(nil).QueryEvents), arg0, arg1)
+}
+
 // Rollback mocks base method.
 func (m *MockTxStorage) Rollback(arg0 context.Context) error {
 	m.ctrl.T.Helper()
@@ -0,0 +1,217 @@
+package es
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/xservice/xquery"
+)
+
+// SortOrder is the order of the queried events by their global position.
+type SortOrder int
+
+// Enumerated sort orders.
+const (
+	SortAscending SortOrder = iota
+	SortDescending
+)
+
+// EventQuery is the storage query of the events, ordered by their global position.
+type EventQuery struct {
+	// AggregateTypes gets the events of selected aggregate types.
+	AggregateTypes []string
+	// AggregateIDs gets the events of selected aggregate ids.
+	AggregateIDs []string
+	// EventTypes gets only selected event types.
+	EventTypes []string
+	// FromTimestamp gets the events with the timestamp (unix nano) greater or equal to provided.
+	FromTimestamp int64
+	// ToTimestamp gets the events with the timestamp (unix nano) lower or equal to provided.
+	ToTimestamp int64
+	// AfterPosition gets the events with the global position greater than provided.
+	AfterPosition int64
+	// BeforePosition gets the events with the global position lower than provided.
+	BeforePosition int64
+	// Descending orders the events by the global position descending.
+	Descending bool
+	// Limit is the maximum number of the events taken. If zero, all matching events are taken.
+	Limit int
+}
+
+// QueryEventsRequest is a request for the page of the events matching its filters.
+// The zero value filters and timestamps match all the events.
+type QueryEventsRequest struct {
+	// AggregateTypes gets the events of selected aggregate types.
+	AggregateTypes []string
+	// AggregateIDs gets the events of selected aggregate ids.
+	AggregateIDs []string
+	// EventTypes gets only selected event types.
+	EventTypes []string
+	// FromTimestamp gets the events with the timestamp (unix nano) greater or equal to provided.
+	FromTimestamp int64
+	// ToTimestamp gets the events with the timestamp (unix nano) lower or equal to provided.
+	ToTimestamp int64
+	// Order is the order of the events by their global position.
+	Order SortOrder
+	// Limit is the maximum number of the events in the page.
+	Limit int
+	// Cursor is one of the xquery.Cursors returned by the previous query with the same filters.
+	// If empty, the first page is returned.
+	Cursor string
+}
+
+// QueryEventsResult is a page of the queried events along with the cursors of the surrounding pages.
+type QueryEventsResult struct {
+	Events  []*Event
+	Cursors xquery.Cursors
+}
+
+// QueryEvents gets the page of the events matching given request.
+// The pages are taken by the global position of the events, thus the events stored in the meantime don't shift them.
+// If the store has registered upcasters, the events are transformed into their current shape.
+func (e *Store) QueryEvents(ctx context.Context, req *QueryEventsRequest) (*QueryEventsResult, error) {
+	if req.Limit <= 0 {
+		return nil, cgerrors.ErrInvalidArgument("query events limit needs to be greater than 0")
+	}
+	if req.Order != SortAscending && req.Order != SortDescending {
+		return nil, cgerrors.ErrInvalidArgumentf("invalid query events sort order: %d", req.Order)
+	}
+	cursor := xquery.CursorEntry{Type: xquery.CursorTypeFirst}
+	if req.Cursor != "" {
+		if err := xquery.DecodeCursor(req.Cursor, &cursor); err != nil {
+			return nil, err
+		}
+	}
+	q, backward, err := eventQueryPage(req, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := e.storage.QueryEvents(ctx, q)
+	if err != nil {
+		return nil, e.err("querying events failed", err)
+	}
+	hasMore := len(events) > req.Limit
+	if hasMore {
+		events = events[:req.Limit]
+	}
+	if backward {
+		for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+			events[i], events[j] = events[j], events[i]
+		}
+	}
+
+	res := &QueryEventsResult{}
+	if res.Cursors, err = queryEventsCursors(cursor, events, hasMore, backward); err != nil {
+		return nil, err
+	}
+	if e.upcasters.Len() > 0 {
+		if events, err = e.upcasters.Upcast(events); err != nil {
+			return nil, err
+		}
+	}
+	res.Events = events
+	return res, nil
+}
+
+// eventQueryPage creates the storage query of the page pointed by the cursor.
+// One more event than the limit is queried, to check if there is a following page.
+// The backward query takes the events in the reversed order, i.e. the previous and the last page.
+func eventQueryPage(req *QueryEventsRequest, cursor xquery.CursorEntry) (q *EventQuery, backward bool, err error) {
+	q = &EventQuery{
+		AggregateTypes: req.AggregateTypes,
+		AggregateIDs:   req.AggregateIDs,
+		EventTypes:     req.EventTypes,
+		FromTimestamp:  req.FromTimestamp,
+		ToTimestamp:    req.ToTimestamp,
+		Limit:          req.Limit + 1,
+	}
+	var position int64
+	switch cursor.Type {
+	case xquery.CursorTypeThis, xquery.CursorTypePrev, xquery.CursorTypeNext:
+		position, err = strconv.ParseInt(cursor.Value, 10, 64)
+		if err != nil || position <= 0 {
+			return nil, false, cgerrors.ErrInvalidArgument("invalid cursor")
+		}
+	}
+
+	descending := req.Order == SortDescending
+	// after sets the bound of the events following the position in the requested order.
+	after := func(position int64) {
+		if descending {
+			q.BeforePosition = position
+		} else {
+			q.AfterPosition = position
+		}
+	}
+	// before sets the bound of the events preceding the position in the requested order.
+	before := func(position int64) {
+		if descending {
+			q.AfterPosition = position
+		} else {
+			q.BeforePosition = position
+		}
+	}
+	switch cursor.Type {
+	case xquery.CursorTypeFirst:
+	case xquery.CursorTypeThis:
+		// The page starts with the event at given position.
+		if descending {
+			after(position + 1)
+		} else {
+			after(position - 1)
+		}
+	case xquery.CursorTypeNext:
+		after(position)
+	case xquery.CursorTypePrev:
+		before(position)
+		backward = true
+	case xquery.CursorTypeLast:
+		backward = true
+	default:
+		return nil, false, cgerrors.ErrInvalidArgument("invalid cursor")
+	}
+	q.Descending = descending != backward
+	return q, backward, nil
+}
+
+// queryEventsCursors creates the cursors of the page with given events, taken by the cursor.
+// The hasMore flag marks that there are more events in the query direction.
+func queryEventsCursors(cursor xquery.CursorEntry, events []*Event, hasMore, backward bool) (cursors xquery.Cursors, err error) {
+	encode := func(tp xquery.CursorType, position int64) string {
+		if err != nil {
+			return ""
+		}
+		entry := xquery.CursorEntry{Type: tp}
+		if position > 0 {
+			entry.Value = strconv.FormatInt(position, 10)
+		}
+		var s string
+		s, err = xquery.EncodeCursor(entry)
+		return s
+	}
+	cursors.First = encode(xquery.CursorTypeFirst, 0)
+	cursors.Last = encode(xquery.CursorTypeLast, 0)
+	if len(events) == 0 {
+		return cursors, err
+	}
+	first, last := events[0].Position, events[len(events)-1].Position
+	cursors.This = encode(xquery.CursorTypeThis, first)
+
+	var hasPrev, hasNext bool
+	if backward {
+		hasPrev = hasMore
+		hasNext = cursor.Type == xquery.CursorTypePrev
+	} else {
+		hasNext = hasMore
+		hasPrev = cursor.Type == xquery.CursorTypeNext || cursor.Type == xquery.CursorTypeThis
+	}
+	if hasPrev {
+		cursors.Prev = encode(xquery.CursorTypePrev, first)
+	}
+	if hasNext {
+		cursors.Next = encode(xquery.CursorTypeNext, last)
+	}
+	return cursors, err
+}
@@ -0,0 +1,120 @@
+package es_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/codec"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esmem"
+)
+
+func TestStoreQueryEvents(t *testing.T) {
+	ctx := context.Background()
+	store, err := es.New(es.DefaultConfig(), codec.JSON(), codec.JSON(), esmem.New())
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+
+	// Store five aggregates with a single event each, so that the events take the positions 1 to 5.
+	aggIds := make([]string, 5)
+	for i := range aggIds {
+		aggIds[i] = fmt.Sprintf("5e3f8a2c-1d4b-4c6e-9f7a-0b2d4e6f8a1%d", i)
+		agg := getTestAggregate(store, aggIds[i])
+		if err = agg.Base.SetEvent(&aggregateCreated{}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		if err = store.Commit(ctx, agg); err != nil {
+			t.Fatalf("committing aggregate failed: %v", err)
+		}
+	}
+
+	query := func(t *testing.T, req *es.QueryEventsRequest, positions ...int64) *es.QueryEventsResult {
+		t.Helper()
+		res, err := store.QueryEvents(ctx, req)
+		if err != nil {
+			t.Fatalf("querying events failed: %v", err)
+		}
+		if len(res.Events) != len(positions) {
+			t.Fatalf("expected %d events but got: %d", len(positions), len(res.Events))
+		}
+		for i, e := range res.Events {
+			if e.Position != positions[i] {
+				t.Errorf("expected event at index: %d to be at position: %d but is: %d", i, positions[i], e.Position)
+			}
+		}
+		return res
+	}
+
+	t.Run("Ascending", func(t *testing.T) {
+		req := &es.QueryEventsRequest{Limit: 2}
+		res := query(t, req, 1, 2)
+		if res.Cursors.Prev != "" || res.Cursors.Next == "" {
+			t.Fatalf("unexpected first page cursors: %+v", res.Cursors)
+		}
+
+		req.Cursor = res.Cursors.Next
+		res = query(t, req, 3, 4)
+		if res.Cursors.Prev == "" || res.Cursors.Next == "" {
+			t.Fatalf("unexpected second page cursors: %+v", res.Cursors)
+		}
+
+		req.Cursor = res.Cursors.Next
+		res = query(t, req, 5)
+		if res.Cursors.Next != "" {
+			t.Errorf("expected no next cursor on the last page but got: %s", res.Cursors.Next)
+		}
+
+		req.Cursor = res.Cursors.Prev
+		res = query(t, req, 3, 4)
+
+		req.Cursor = res.Cursors.This
+		res = query(t, req, 3, 4)
+
+		req.Cursor = res.Cursors.Prev
+		res = query(t, req, 1, 2)
+		if res.Cursors.Prev != "" {
+			t.Errorf("expected no prev cursor on the first page but got: %s", res.Cursors.Prev)
+		}
+
+		req.Cursor = res.Cursors.Last
+		res = query(t, req, 4, 5)
+		if res.Cursors.Prev == "" || res.Cursors.Next != "" {
+			t.Errorf("unexpected last page cursors: %+v", res.Cursors)
+		}
+	})
+
+	t.Run("Descending", func(t *testing.T) {
+		req := &es.QueryEventsRequest{Limit: 2, Order: es.SortDescending}
+		res := query(t, req, 5, 4)
+
+		req.Cursor = res.Cursors.Next
+		res = query(t, req, 3, 2)
+
+		req.Cursor = res.Cursors.Prev
+		query(t, req, 5, 4)
+
+		req.Cursor = res.Cursors.Last
+		query(t, req, 2, 1)
+	})
+
+	t.Run("Filtered", func(t *testing.T) {
+		req := &es.QueryEventsRequest{Limit: 10, AggregateIDs: []string{aggIds[1], aggIds[3]}, EventTypes: []string{aggregateCreatedType}}
+		res := query(t, req, 2, 4)
+		if res.Cursors.Next != "" || res.Cursors.Prev != "" {
+			t.Errorf("unexpected single page cursors: %+v", res.Cursors)
+		}
+		query(t, &es.QueryEventsRequest{Limit: 10, EventTypes: []string{aggregateNameChangedType}})
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		if _, err := store.QueryEvents(ctx, &es.QueryEventsRequest{}); !cgerrors.IsInvalidArgument(err) {
+			t.Errorf("expected invalid argument error on no limit but got: %v", err)
+		}
+		if _, err := store.QueryEvents(ctx, &es.QueryEventsRequest{Limit: 1, Cursor: "invalid"}); !cgerrors.IsInvalidArgument(err) {
+			t.Errorf("expected invalid argument error on invalid cursor but got: %v", err)
+		}
+	})
+}
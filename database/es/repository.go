@@ -0,0 +1,160 @@
+package es
+
+import (
+	"context"
+
+	"github.com/kucjac/cleango/cgerrors"
+)
+
+// RepositoryConfig is the configuration of the Repository.
+type RepositoryConfig struct {
+	// UseSnapshots loads the aggregates with their latest snapshot, instead of the full event stream.
+	UseSnapshots bool
+	// MaxUpdateRetries is the maximum number of the Repository.Update retries on the revision conflict.
+	MaxUpdateRetries int
+}
+
+// DefaultRepositoryConfig creates the default repository config.
+func DefaultRepositoryConfig() *RepositoryConfig {
+	return &RepositoryConfig{
+		UseSnapshots:     true,
+		MaxUpdateRetries: 3,
+	}
+}
+
+// Validate checks if the config is valid to use.
+func (c *RepositoryConfig) Validate() error {
+	if c.MaxUpdateRetries < 0 {
+		return cgerrors.ErrInternal("repository max update retries is lower than 0")
+	}
+	return nil
+}
+
+// Repository loads, creates and saves the aggregates of type T, bound to the aggregate type and version.
+// The PT type parameter is the pointer to T, which implements the Aggregate interface, i.e.:
+//
+//	orders, err := es.NewRepository[Order](store, "order", 1, nil)
+type Repository[T any, PT interface {
+	*T
+	Aggregate
+}] struct {
+	store   EventStore
+	aggType string
+	version int64
+	cfg     RepositoryConfig
+}
+
+// NewRepository creates a new repository of the aggregates with given type and version.
+// If the config is nil, the DefaultRepositoryConfig is used.
+func NewRepository[T any, PT interface {
+	*T
+	Aggregate
+}](store EventStore, aggType string, version int64, cfg *RepositoryConfig) (*Repository[T, PT], error) {
+	if cfg == nil {
+		cfg = DefaultRepositoryConfig()
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if aggType == "" {
+		return nil, cgerrors.ErrInternal("no aggregate type provided for the repository")
+	}
+	return &Repository[T, PT]{store: store, aggType: aggType, version: version, cfg: *cfg}, nil
+}
+
+// AggregateType gets the aggregate type the repository is bound to.
+func (r *Repository[T, PT]) AggregateType() string {
+	return r.aggType
+}
+
+// Version gets the aggregate version the repository is bound to.
+func (r *Repository[T, PT]) Version() int64 {
+	return r.version
+}
+
+// Create creates a new aggregate with given id and its base set.
+// The aggregate is stored once its events are saved.
+func (r *Repository[T, PT]) Create(_ context.Context, id string) (PT, error) {
+	if id == "" {
+		return nil, cgerrors.ErrInvalidArgument("no aggregate id provided")
+	}
+	return r.newAggregate(id), nil
+}
+
+// Get loads the aggregate with given id.
+// If the aggregate doesn't exist an error with the cgerrors.CodeNotFound is returned.
+func (r *Repository[T, PT]) Get(ctx context.Context, id string) (PT, error) {
+	agg := r.newAggregate(id)
+	var err error
+	if r.cfg.UseSnapshots {
+		err = r.store.LoadEventsWithSnapshot(ctx, agg)
+	} else {
+		err = r.store.LoadEvents(ctx, agg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return agg, nil
+}
+
+// Save commits the uncommitted events of given aggregate.
+func (r *Repository[T, PT]) Save(ctx context.Context, agg PT) error {
+	if err := r.checkAggregate(agg); err != nil {
+		return err
+	}
+	return r.store.Commit(ctx, agg)
+}
+
+// Update loads the aggregate with given id, calls the function on it and commits its events.
+// On the revision conflict the aggregate is reloaded and the function is called again on its latest state,
+// up to the configured MaxUpdateRetries. Once the retries are exceeded the *ConflictError is returned.
+// The function needs to be safe to be called multiple times.
+func (r *Repository[T, PT]) Update(ctx context.Context, id string, fn func(agg PT) error) (PT, error) {
+	// Conflicts are handled by calling the function on the reloaded aggregate,
+	// instead of re-applying already created events.
+	commitCtx := WithCommitPolicy(ctx, CommitPolicy{Strategy: ConflictFail})
+	for retry := 0; ; retry++ {
+		agg, err := r.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err = fn(agg); err != nil {
+			return nil, err
+		}
+		err = r.store.Commit(commitCtx, agg)
+		if err == nil {
+			return agg, nil
+		}
+		if !IsConflict(err) || retry >= r.cfg.MaxUpdateRetries {
+			return nil, err
+		}
+	}
+}
+
+// Delete loads the aggregate with given id and marks it as deleted with the tombstone event.
+// Once deleted, getting the aggregate returns the *DeletedError.
+func (r *Repository[T, PT]) Delete(ctx context.Context, id string) error {
+	agg, err := r.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return r.store.Delete(ctx, agg)
+}
+
+func (r *Repository[T, PT]) newAggregate(id string) PT {
+	agg := PT(new(T))
+	r.store.SetAggregateBase(agg, id, r.aggType, r.version)
+	return agg
+}
+
+func (r *Repository[T, PT]) checkAggregate(agg PT) error {
+	b := agg.AggBase()
+	if b == nil {
+		return cgerrors.ErrInvalidArgument("aggregate base not set")
+	}
+	if b.aggType != r.aggType || b.version != r.version {
+		return cgerrors.ErrInvalidArgumentf("aggregate: %s in version: %d doesn't match the repository aggregate: %s in version: %d",
+			b.aggType, b.version, r.aggType, r.version)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package es_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/codec"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esmem"
+)
+
+func TestRepository(t *testing.T) {
+	ctx := context.Background()
+	store, err := es.New(es.DefaultConfig(), codec.JSON(), codec.JSON(), esmem.New())
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+	repo, err := es.NewRepository[testAggregate](store, aggregateType, 1, nil)
+	if err != nil {
+		t.Fatalf("creating repository failed: %v", err)
+	}
+
+	const aggId = "0c5e0f7e-3f0b-4d3c-a4c8-5d2b1e6f9a10"
+	agg, err := repo.Create(ctx, aggId)
+	if err != nil {
+		t.Fatalf("creating aggregate failed: %v", err)
+	}
+	if err = agg.Base.SetEvent(&aggregateCreated{}); err != nil {
+		t.Fatalf("setting event failed: %v", err)
+	}
+	if err = repo.Save(ctx, agg); err != nil {
+		t.Fatalf("saving aggregate failed: %v", err)
+	}
+
+	t.Run("Get", func(t *testing.T) {
+		loaded, err := repo.Get(ctx, aggId)
+		if err != nil {
+			t.Fatalf("getting aggregate failed: %v", err)
+		}
+		if loaded.Base.Revision() != 1 || loaded.CreatedAt.IsZero() {
+			t.Errorf("unexpected aggregate state: %+v", loaded)
+		}
+		if _, err = repo.Get(ctx, "c3a5b1e2-9b7d-4f0e-8a1c-6e2d4f8b0a93"); !cgerrors.IsNotFound(err) {
+			t.Errorf("expected not found error but got: %v", err)
+		}
+	})
+
+	t.Run("SaveMismatch", func(t *testing.T) {
+		other := &testAggregate{}
+		store.SetAggregateBase(other, aggId, aggregateType, 2)
+		if err := repo.Save(ctx, other); cgerrors.Code(err) != cgerrors.CodeInvalidArgument {
+			t.Errorf("expected invalid argument error but got: %v", err)
+		}
+	})
+
+	t.Run("UpdateConflict", func(t *testing.T) {
+		var calls int
+		updated, err := repo.Update(ctx, aggId, func(agg *testAggregate) error {
+			calls++
+			if calls == 1 {
+				// Commit a concurrent change, so that the first commit fails on the revision conflict.
+				concurrent, err := repo.Get(ctx, aggId)
+				if err != nil {
+					return err
+				}
+				if err = concurrent.Base.SetEvent(&aggregateNameChanged{Name: "concurrent"}); err != nil {
+					return err
+				}
+				if err = repo.Save(ctx, concurrent); err != nil {
+					return err
+				}
+			}
+			if calls == 2 && agg.Name != "concurrent" {
+				t.Errorf("expected the update to be called on the latest state, but name is: %s", agg.Name)
+			}
+			return agg.Base.SetEvent(&aggregateNameChanged{Name: "updated"})
+		})
+		if err != nil {
+			t.Fatalf("updating aggregate failed: %v", err)
+		}
+		if calls != 2 {
+			t.Errorf("expected update function to be called twice, but was: %d", calls)
+		}
+		if updated.Name != "updated" || updated.Base.Revision() != 3 {
+			t.Errorf("unexpected aggregate state: name: %s, revision: %d", updated.Name, updated.Base.Revision())
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		const deletedId = "e2b8c4a6-1f3d-4b5e-9a7c-8d0f2e4a6c19"
+		agg, err := repo.Create(ctx, deletedId)
+		if err != nil {
+			t.Fatalf("creating aggregate failed: %v", err)
+		}
+		if err = agg.Base.SetEvent(&aggregateCreated{}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		if err = repo.Save(ctx, agg); err != nil {
+			t.Fatalf("saving aggregate failed: %v", err)
+		}
+		if err = repo.Delete(ctx, deletedId); err != nil {
+			t.Fatalf("deleting aggregate failed: %v", err)
+		}
+		if _, err = repo.Get(ctx, deletedId); !es.IsDeleted(err) {
+			t.Errorf("expected deleted error but got: %v", err)
+		}
+	})
+
+	t.Run("UpdateRetriesExceeded", func(t *testing.T) {
+		noRetries, err := es.NewRepository[testAggregate](store, aggregateType, 1, &es.RepositoryConfig{})
+		if err != nil {
+			t.Fatalf("creating repository failed: %v", err)
+		}
+		_, err = noRetries.Update(ctx, aggId, func(agg *testAggregate) error {
+			concurrent, err := repo.Get(ctx, aggId)
+			if err != nil {
+				return err
+			}
+			if err = concurrent.Base.SetEvent(&aggregateNameChanged{Name: "concurrent"}); err != nil {
+				return err
+			}
+			if err = repo.Save(ctx, concurrent); err != nil {
+				return err
+			}
+			return agg.Base.SetEvent(&aggregateNameChanged{Name: "updated"})
+		})
+		if !es.IsConflict(err) {
+			t.Errorf("expected conflict error but got: %v", err)
+		}
+	})
+}
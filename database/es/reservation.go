@@ -0,0 +1,207 @@
+package es
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/kucjac/cleango/cgerrors"
+)
+
+// ReservationsMetadataKey is the event metadata key, which holds the JSON encoded reservation changes of the event.
+const ReservationsMetadataKey = "es-reservations"
+
+// ReservationOp is the operation on the unique value reservation.
+type ReservationOp string
+
+// Enumerated reservation operations.
+const (
+	// ReservationReserve reserves the value for the aggregate. It fails if the value is reserved by another aggregate.
+	ReservationReserve ReservationOp = "reserve"
+	// ReservationRelease releases the value reserved by the aggregate. Releasing the value not reserved by the aggregate is a no-op.
+	ReservationRelease ReservationOp = "release"
+	// ReservationTransfer takes over the value reserved by the other aggregate. If the value is not reserved, it is reserved
+	// for the aggregate. It fails if the value is reserved by neither of these aggregates.
+	ReservationTransfer ReservationOp = "transfer"
+)
+
+// Reservation is the unique value reserved by the aggregate within the scope, i.e. the email of the user.
+type Reservation struct {
+	Scope         string
+	Value         string
+	AggregateID   string
+	AggregateType string
+	// ReservedAt is the timestamp (unix nano) of the event that reserved the value.
+	ReservedAt int64
+}
+
+// ReservationChange is the change of the reservation carried by the event.
+type ReservationChange struct {
+	Op    ReservationOp `json:"op"`
+	Scope string        `json:"scope"`
+	Value string        `json:"value"`
+	// FromAggregateID and FromAggregateType are the current owner of the value taken over by the transfer.
+	FromAggregateID   string `json:"from_aggregate_id,omitempty"`
+	FromAggregateType string `json:"from_aggregate_type,omitempty"`
+
+	// The fields below are taken from the event carrying the change.
+	AggregateID   string `json:"-"`
+	AggregateType string `json:"-"`
+	Timestamp     int64  `json:"-"`
+}
+
+// ReservationStorage is the optional interface of the StorageBase, which stores the unique value reservations.
+// The storage applies the reservation changes of the saved events within the same transaction as the events,
+// and returns the *ReservationTakenError if the value is reserved by another aggregate.
+type ReservationStorage interface {
+	// GetReservation gets the reservation of the value within the scope. If it is not found a cgerrors.ErrNotFound is returned.
+	GetReservation(ctx context.Context, scope, value string) (*Reservation, error)
+	// ListReservations lists the reservations of given aggregate, ordered by the scope and value.
+	ListReservations(ctx context.Context, aggId, aggType string) ([]*Reservation, error)
+}
+
+// Reserve reserves the unique value within the scope for the aggregate. The reservation is carried by the latest
+// uncommitted event of the aggregate, and it is stored in the same transaction as the event on Commit.
+// If the value is reserved by another aggregate, the commit fails with the *ReservationTakenError.
+func (a *AggregateBase) Reserve(scope, value string) error {
+	return a.addReservationChange(ReservationChange{Op: ReservationReserve, Scope: scope, Value: value})
+}
+
+// Release releases the unique value within the scope reserved by the aggregate. The release is carried by the latest
+// uncommitted event of the aggregate.
+func (a *AggregateBase) Release(scope, value string) error {
+	return a.addReservationChange(ReservationChange{Op: ReservationRelease, Scope: scope, Value: value})
+}
+
+// TransferReservation takes over the unique value within the scope reserved by the aggregate with given id and type.
+// The transfer is carried by the latest uncommitted event of the aggregate.
+func (a *AggregateBase) TransferReservation(scope, value, fromAggId, fromAggType string) error {
+	if fromAggId == "" || fromAggType == "" {
+		return cgerrors.ErrInvalidArgument("reservation transfer requires the aggregate id and type it is taken from")
+	}
+	return a.addReservationChange(ReservationChange{
+		Op:                ReservationTransfer,
+		Scope:             scope,
+		Value:             value,
+		FromAggregateID:   fromAggId,
+		FromAggregateType: fromAggType,
+	})
+}
+
+func (a *AggregateBase) addReservationChange(change ReservationChange) error {
+	if change.Scope == "" || change.Value == "" {
+		return cgerrors.ErrInvalidArgument("reservation scope and value are required")
+	}
+	if len(a.uncommittedEvents) == 0 {
+		return cgerrors.ErrFailedPrecondition("reservation needs to be carried by an uncommitted event - set the event first")
+	}
+	e := a.uncommittedEvents[len(a.uncommittedEvents)-1]
+	changes, err := eventReservationChanges(e)
+	if err != nil {
+		return err
+	}
+	changes = append(changes, change)
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return cgerrors.ErrInternalf("encoding reservation changes failed: %v", err)
+	}
+	if e.Metadata == nil {
+		e.Metadata = map[string]string{}
+	}
+	e.Metadata[ReservationsMetadataKey] = string(data)
+	// The metadata is a part of the hashed content.
+	a.chainEvent(e)
+	return nil
+}
+
+// EventReservationChanges gets the reservation changes carried by given events, in the order they need to be applied.
+func EventReservationChanges(events []*Event) ([]*ReservationChange, error) {
+	var changes []*ReservationChange
+	for _, e := range events {
+		ec, err := eventReservationChanges(e)
+		if err != nil {
+			return nil, err
+		}
+		for i := range ec {
+			c := ec[i]
+			c.AggregateID, c.AggregateType, c.Timestamp = e.AggregateId, e.AggregateType, e.Timestamp
+			changes = append(changes, &c)
+		}
+	}
+	return changes, nil
+}
+
+func eventReservationChanges(e *Event) ([]ReservationChange, error) {
+	data, ok := e.Metadata[ReservationsMetadataKey]
+	if !ok {
+		return nil, nil
+	}
+	var changes []ReservationChange
+	if err := json.Unmarshal([]byte(data), &changes); err != nil {
+		return nil, cgerrors.ErrInternalf("decoding reservation changes of the event: %s failed: %v", e.EventId, err)
+	}
+	return changes, nil
+}
+
+// GetReservation gets the reservation of the unique value within the scope.
+// If the value is not reserved a cgerrors.ErrNotFound is returned.
+// The storage needs to implement the ReservationStorage interface.
+func (e *Store) GetReservation(ctx context.Context, scope, value string) (*Reservation, error) {
+	rs, err := e.reservationStorage()
+	if err != nil {
+		return nil, err
+	}
+	r, err := rs.GetReservation(ctx, scope, value)
+	if err != nil {
+		return nil, e.err("getting reservation failed", err)
+	}
+	return r, nil
+}
+
+// ListReservations lists the unique values reserved by given aggregate.
+// The storage needs to implement the ReservationStorage interface.
+func (e *Store) ListReservations(ctx context.Context, aggId, aggType string) ([]*Reservation, error) {
+	rs, err := e.reservationStorage()
+	if err != nil {
+		return nil, err
+	}
+	reservations, err := rs.ListReservations(ctx, aggId, aggType)
+	if err != nil {
+		return nil, e.err("listing reservations failed", err)
+	}
+	return reservations, nil
+}
+
+func (e *Store) reservationStorage() (ReservationStorage, error) {
+	rs, ok := e.storage.(ReservationStorage)
+	if !ok {
+		return nil, cgerrors.ErrUnimplemented("event storage doesn't support reservations")
+	}
+	return rs, nil
+}
+
+// Compile time check if ReservationTakenError implements cgerrors.ErrorCoder.
+var _ cgerrors.ErrorCoder = (*ReservationTakenError)(nil)
+
+// ReservationTakenError is the error returned on commit when the value is already reserved by another aggregate.
+type ReservationTakenError struct {
+	Scope string
+	Value string
+}
+
+// Error implements error interface.
+func (e *ReservationTakenError) Error() string {
+	return fmt.Sprintf("value: '%s' within the scope: %s is already reserved", e.Value, e.Scope)
+}
+
+// ErrorCode implements cgerrors.ErrorCoder interface.
+func (e *ReservationTakenError) ErrorCode(error) cgerrors.ErrorCode {
+	return cgerrors.CodeAlreadyExists
+}
+
+// IsReservationTaken checks if given error is a *ReservationTakenError.
+func IsReservationTaken(err error) bool {
+	var re *ReservationTakenError
+	return errors.As(err, &re)
+}
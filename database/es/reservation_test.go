@@ -0,0 +1,119 @@
+package es_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/codec"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esmem"
+)
+
+func TestReservations(t *testing.T) {
+	ctx := context.Background()
+	const (
+		firstId  = "b3d7f1a9-5c2e-4a8b-9e6d-0f4a2c8e6b15"
+		secondId = "e6a2c8f4-1b9d-4e7a-a5c3-7d1f9b3e5a62"
+		scope    = "email"
+		email    = "john@example.com"
+	)
+	cfg := es.DefaultConfig()
+	cfg.HashChain = true
+	store, err := es.New(cfg, codec.JSON(), codec.JSON(), esmem.New())
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+
+	first := getTestAggregate(store, firstId)
+	if err = first.Base.Reserve(scope, email); cgerrors.Code(err) != cgerrors.CodeFailedPrecondition {
+		t.Fatalf("expected failed precondition error without uncommitted event but got: %v", err)
+	}
+	if err = first.Base.SetEvent(&aggregateCreated{}); err != nil {
+		t.Fatalf("setting event failed: %v", err)
+	}
+	if err = first.Base.Reserve(scope, email); err != nil {
+		t.Fatalf("reserving value failed: %v", err)
+	}
+	if err = store.Commit(ctx, first); err != nil {
+		t.Fatalf("committing aggregate failed: %v", err)
+	}
+	r, err := store.GetReservation(ctx, scope, email)
+	if err != nil {
+		t.Fatalf("getting reservation failed: %v", err)
+	}
+	if r.AggregateID != firstId || r.AggregateType != aggregateType {
+		t.Errorf("expected value to be reserved by the first aggregate, but is: %s", r.AggregateID)
+	}
+
+	second := getTestAggregate(store, secondId)
+	if err = second.Base.SetEvent(&aggregateCreated{}); err != nil {
+		t.Fatalf("setting event failed: %v", err)
+	}
+	if err = second.Base.Reserve(scope, email); err != nil {
+		t.Fatalf("reserving value failed: %v", err)
+	}
+	err = store.Commit(ctx, second)
+	if !es.IsReservationTaken(err) {
+		t.Fatalf("expected reservation taken error but got: %v", err)
+	}
+	if cgerrors.Code(err) != cgerrors.CodeAlreadyExists {
+		t.Errorf("expected already exists code but got: %v", cgerrors.Code(err))
+	}
+	if exists, _ := store.AggregateExists(ctx, secondId, aggregateType); exists {
+		t.Errorf("expected the events of the failed reservation not to be stored")
+	}
+
+	t.Run("Transfer", func(t *testing.T) {
+		// The value is released by the first aggregate and taken over by the second within a single transaction.
+		second := getTestAggregate(store, secondId)
+		if err := second.Base.SetEvent(&aggregateCreated{}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		if err := second.Base.TransferReservation(scope, email, firstId, aggregateType); err != nil {
+			t.Fatalf("transferring value failed: %v", err)
+		}
+		if err := store.Commit(ctx, second); err != nil {
+			t.Fatalf("committing aggregate failed: %v", err)
+		}
+		r, err := store.GetReservation(ctx, scope, email)
+		if err != nil {
+			t.Fatalf("getting reservation failed: %v", err)
+		}
+		if r.AggregateID != secondId {
+			t.Errorf("expected value to be reserved by the second aggregate, but is: %s", r.AggregateID)
+		}
+		if err = store.VerifyAggregateHashChain(ctx, secondId, aggregateType); err != nil {
+			t.Errorf("verifying hash chain failed: %v", err)
+		}
+	})
+
+	t.Run("Release", func(t *testing.T) {
+		second := getTestAggregate(store, secondId)
+		if err := store.LoadEvents(ctx, second); err != nil {
+			t.Fatalf("loading aggregate failed: %v", err)
+		}
+		if err := second.Base.SetEvent(&aggregateNameChanged{Name: "released"}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		if err := second.Base.Release(scope, email); err != nil {
+			t.Fatalf("releasing value failed: %v", err)
+		}
+		if err := second.Base.Reserve("username", "john"); err != nil {
+			t.Fatalf("reserving value failed: %v", err)
+		}
+		if err := store.Commit(ctx, second); err != nil {
+			t.Fatalf("committing aggregate failed: %v", err)
+		}
+		if _, err := store.GetReservation(ctx, scope, email); !cgerrors.IsNotFound(err) {
+			t.Errorf("expected released value not to be found, but got: %v", err)
+		}
+		reservations, err := store.ListReservations(ctx, secondId, aggregateType)
+		if err != nil {
+			t.Fatalf("listing reservations failed: %v", err)
+		}
+		if len(reservations) != 1 || reservations[0].Scope != "username" {
+			t.Errorf("expected single username reservation but got: %d", len(reservations))
+		}
+	})
+}
@@ -0,0 +1,159 @@
+package es
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kucjac/cleango/cgerrors"
+)
+
+// SnapshotPolicy decides if the snapshot of the aggregate should be taken when its events are committed.
+type SnapshotPolicy interface {
+	ShouldSnapshot(info SnapshotInfo) bool
+}
+
+// SnapshotPolicyFunc is a function that implements SnapshotPolicy interface.
+type SnapshotPolicyFunc func(info SnapshotInfo) bool
+
+// ShouldSnapshot implements SnapshotPolicy interface.
+func (f SnapshotPolicyFunc) ShouldSnapshot(info SnapshotInfo) bool {
+	return f(info)
+}
+
+// SnapshotInfo is the state of the committed aggregate used by the SnapshotPolicy.
+type SnapshotInfo struct {
+	// Aggregate is the committed aggregate.
+	Aggregate Aggregate
+	// Revision is the aggregate revision with the committed events applied.
+	Revision int64
+	// Timestamp is the aggregate timestamp with the committed events applied.
+	Timestamp int64
+	// CommittedEvents is the number of the events being committed.
+	CommittedEvents int
+	// SnapshotRevision is the revision of the latest known aggregate snapshot.
+	// It is zero if the aggregate has no snapshot, or it was loaded without it.
+	SnapshotRevision int64
+	// SnapshotTimestamp is the timestamp of the latest known aggregate snapshot.
+	SnapshotTimestamp int64
+}
+
+// EveryNEvents creates a policy that takes a snapshot each time the aggregate revision crosses a multiple of n.
+func EveryNEvents(n int64) SnapshotPolicy {
+	return SnapshotPolicyFunc(func(info SnapshotInfo) bool {
+		if n <= 0 {
+			return false
+		}
+		return info.Revision/n > (info.Revision-int64(info.CommittedEvents))/n
+	})
+}
+
+// RevisionGap creates a policy that takes a snapshot when the aggregate revision is at least threshold
+// revisions ahead of its latest known snapshot.
+func RevisionGap(threshold int64) SnapshotPolicy {
+	return SnapshotPolicyFunc(func(info SnapshotInfo) bool {
+		return info.Revision-info.SnapshotRevision >= threshold
+	})
+}
+
+// TimeSinceSnapshot creates a policy that takes a snapshot when given duration passed between the latest known
+// snapshot and the aggregate timestamp. An aggregate without a known snapshot is snapshotted on its first commit.
+func TimeSinceSnapshot(d time.Duration) SnapshotPolicy {
+	return SnapshotPolicyFunc(func(info SnapshotInfo) bool {
+		if info.SnapshotRevision == 0 {
+			return true
+		}
+		return time.Duration(info.Timestamp-info.SnapshotTimestamp) >= d
+	})
+}
+
+// AnyOf creates a policy that takes a snapshot if any of given policies decides so.
+func AnyOf(policies ...SnapshotPolicy) SnapshotPolicy {
+	return SnapshotPolicyFunc(func(info SnapshotInfo) bool {
+		for _, p := range policies {
+			if p.ShouldSnapshot(info) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// AllOf creates a policy that takes a snapshot only if all given policies decide so.
+func AllOf(policies ...SnapshotPolicy) SnapshotPolicy {
+	return SnapshotPolicyFunc(func(info SnapshotInfo) bool {
+		for _, p := range policies {
+			if !p.ShouldSnapshot(info) {
+				return false
+			}
+		}
+		return len(policies) > 0
+	})
+}
+
+// SnapshotMode defines how the snapshots taken by the SnapshotPolicy are stored.
+type SnapshotMode int
+
+const (
+	// SnapshotInTransaction stores the snapshot in the same transaction as the committed events.
+	// This is the default mode.
+	SnapshotInTransaction SnapshotMode = iota
+	// SnapshotAsync stores the snapshot in the background after the events are committed.
+	// Failures are only logged, as the snapshot could always be rebuilt from the events.
+	// The store bound to a transaction stores the snapshots within it, as in the SnapshotInTransaction mode.
+	SnapshotAsync
+)
+
+// String implements fmt.Stringer interface.
+func (m SnapshotMode) String() string {
+	switch m {
+	case SnapshotInTransaction:
+		return "in_transaction"
+	case SnapshotAsync:
+		return "async"
+	default:
+		return fmt.Sprintf("SnapshotMode(%d)", int(m))
+	}
+}
+
+// SnapshotConfig is the configuration of the automatic aggregate snapshots.
+type SnapshotConfig struct {
+	// Policy decides when the snapshot is taken on commit. If nil, snapshots are only taken by the SaveSnapshot.
+	Policy SnapshotPolicy
+	// Mode defines how the snapshots taken on commit are stored.
+	Mode SnapshotMode
+	// Retention is the number of the latest snapshots kept for each aggregate version.
+	// Older snapshots are pruned once a new one is stored. A zero value keeps all snapshots.
+	Retention int
+}
+
+// Validate checks if the snapshot config is valid.
+func (c *SnapshotConfig) Validate() error {
+	switch c.Mode {
+	case SnapshotInTransaction, SnapshotAsync:
+	default:
+		return cgerrors.ErrInternalf("unknown snapshot mode: %s", c.Mode)
+	}
+	if c.Retention < 0 {
+		return cgerrors.ErrInternal("snapshot retention is lower than 0")
+	}
+	return nil
+}
+
+func (c *SnapshotConfig) shouldSnapshot(agg Aggregate, committed int) bool {
+	if c.Policy == nil {
+		return false
+	}
+	b := agg.AggBase()
+	// The deleted aggregate is never snapshotted, so that its tombstone is always loaded.
+	if n := len(b.uncommittedEvents); n > 0 && IsTombstone(b.uncommittedEvents[n-1]) {
+		return false
+	}
+	return c.Policy.ShouldSnapshot(SnapshotInfo{
+		Aggregate:         agg,
+		Revision:          b.revision,
+		Timestamp:         b.timestamp,
+		CommittedEvents:   committed,
+		SnapshotRevision:  b.snapshotRevision,
+		SnapshotTimestamp: b.snapshotTimestamp,
+	})
+}
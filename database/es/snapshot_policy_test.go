@@ -0,0 +1,160 @@
+package es_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kucjac/cleango/codec"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esmem"
+)
+
+func TestSnapshotPolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   es.SnapshotPolicy
+		info     es.SnapshotInfo
+		expected bool
+	}{
+		{name: "EveryNEvents/Crossed", policy: es.EveryNEvents(5), info: es.SnapshotInfo{Revision: 6, CommittedEvents: 2}, expected: true},
+		{name: "EveryNEvents/NotCrossed", policy: es.EveryNEvents(5), info: es.SnapshotInfo{Revision: 4, CommittedEvents: 2}},
+		{name: "RevisionGap/Reached", policy: es.RevisionGap(3), info: es.SnapshotInfo{Revision: 8, SnapshotRevision: 5}, expected: true},
+		{name: "RevisionGap/NotReached", policy: es.RevisionGap(3), info: es.SnapshotInfo{Revision: 7, SnapshotRevision: 5}},
+		{name: "TimeSinceSnapshot/NoSnapshot", policy: es.TimeSinceSnapshot(time.Hour), info: es.SnapshotInfo{Revision: 1, Timestamp: 10}, expected: true},
+		{name: "TimeSinceSnapshot/Passed", policy: es.TimeSinceSnapshot(time.Second), info: es.SnapshotInfo{Revision: 3, SnapshotRevision: 1, Timestamp: int64(2 * time.Second)}, expected: true},
+		{name: "TimeSinceSnapshot/NotPassed", policy: es.TimeSinceSnapshot(time.Hour), info: es.SnapshotInfo{Revision: 3, SnapshotRevision: 1, Timestamp: int64(2 * time.Second)}},
+		{name: "AnyOf", policy: es.AnyOf(es.EveryNEvents(100), es.RevisionGap(2)), info: es.SnapshotInfo{Revision: 2, CommittedEvents: 1}, expected: true},
+		{name: "AllOf", policy: es.AllOf(es.EveryNEvents(100), es.RevisionGap(2)), info: es.SnapshotInfo{Revision: 2, CommittedEvents: 1}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if result := tc.policy.ShouldSnapshot(tc.info); result != tc.expected {
+				t.Errorf("expected: %v but is: %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestStoreSnapshotPolicy(t *testing.T) {
+	ctx := context.Background()
+	const aggId = "5b0c6a53-6f6c-4f3e-8d8c-2f3a0e2c9d11"
+
+	for _, mode := range []es.SnapshotMode{es.SnapshotInTransaction, es.SnapshotAsync} {
+		t.Run(mode.String(), func(t *testing.T) {
+			storage := esmem.New()
+			cfg := es.DefaultConfig()
+			cfg.Snapshot = es.SnapshotConfig{Policy: es.EveryNEvents(2), Mode: mode, Retention: 1}
+			store, err := es.New(cfg, codec.JSON(), codec.JSON(), storage)
+			if err != nil {
+				t.Fatalf("creating store failed: %v", err)
+			}
+
+			agg := getTestAggregate(store, aggId)
+			if err = agg.Base.SetEvent(&aggregateCreated{}); err != nil {
+				t.Fatalf("setting event failed: %v", err)
+			}
+			if err = store.Commit(ctx, agg); err != nil {
+				t.Fatalf("committing failed: %v", err)
+			}
+			store.WaitSnapshots()
+			if _, err = storage.GetSnapshot(ctx, aggId, aggregateType, 1); err == nil {
+				t.Error("no snapshot expected before the policy threshold")
+			}
+
+			for i, name := range []string{"First", "Second", "Third"} {
+				if err = agg.Base.SetEvent(&aggregateNameChanged{Name: name}); err != nil {
+					t.Fatalf("setting event failed: %v", err)
+				}
+				if err = store.Commit(ctx, agg); err != nil {
+					t.Fatalf("committing event: %d failed: %v", i, err)
+				}
+			}
+			store.WaitSnapshots()
+
+			snap, err := storage.GetSnapshot(ctx, aggId, aggregateType, 1)
+			if err != nil {
+				t.Fatalf("getting snapshot failed: %v", err)
+			}
+			if snap.Revision != 4 {
+				t.Errorf("expected snapshot at revision: 4 but is: %d", snap.Revision)
+			}
+
+			// The snapshot at revision 2 should be pruned due to the retention, so that it could be saved again.
+			if err = storage.SaveSnapshot(ctx, &es.Snapshot{AggregateId: aggId, AggregateType: aggregateType, AggregateVersion: 1, Revision: 2}); err != nil {
+				t.Errorf("snapshot at revision: 2 should be pruned, but saving it failed: %v", err)
+			}
+
+			loaded := getTestAggregate(store, aggId)
+			if err = store.LoadEventsWithSnapshot(ctx, loaded); err != nil {
+				t.Fatalf("loading aggregate failed: %v", err)
+			}
+			if loaded.Name != "Third" || loaded.Base.Revision() != 4 {
+				t.Errorf("unexpected aggregate state: name: %s, revision: %d", loaded.Name, loaded.Base.Revision())
+			}
+		})
+	}
+}
+
+func TestStoreSnapshotAsyncInTransaction(t *testing.T) {
+	ctx := context.Background()
+	const aggId = "0f0b5f2e-7f7e-4f3b-9a51-4a8c9f7d2b13"
+
+	storage := esmem.New()
+	cfg := es.DefaultConfig()
+	cfg.Snapshot = es.SnapshotConfig{Policy: es.EveryNEvents(2), Mode: es.SnapshotAsync}
+	store, err := es.New(cfg, codec.JSON(), codec.JSON(), storage)
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+
+	commitTx := func(t *testing.T, agg *testAggregate, commit bool) {
+		tx, err := storage.BeginTx(ctx)
+		if err != nil {
+			t.Fatalf("beginning transaction failed: %v", err)
+		}
+		if err = store.WithStorage(tx).Commit(ctx, agg); err != nil {
+			t.Fatalf("committing failed: %v", err)
+		}
+		if commit {
+			err = tx.Commit(ctx)
+		} else {
+			err = tx.Rollback(ctx)
+		}
+		if err != nil {
+			t.Fatalf("finishing transaction failed: %v", err)
+		}
+		store.WaitSnapshots()
+	}
+
+	agg := getTestAggregate(store, aggId)
+	if err = agg.Base.SetEvent(&aggregateCreated{}); err != nil {
+		t.Fatalf("setting event failed: %v", err)
+	}
+	if err = agg.Base.SetEvent(&aggregateNameChanged{Name: "First"}); err != nil {
+		t.Fatalf("setting event failed: %v", err)
+	}
+	commitTx(t, agg, true)
+
+	snap, err := storage.GetSnapshot(ctx, aggId, aggregateType, 1)
+	if err != nil {
+		t.Fatalf("getting snapshot committed with the transaction failed: %v", err)
+	}
+	if snap.Revision != 2 {
+		t.Errorf("expected snapshot at revision: 2 but is: %d", snap.Revision)
+	}
+
+	for _, name := range []string{"Second", "Third"} {
+		if err = agg.Base.SetEvent(&aggregateNameChanged{Name: name}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+	}
+	commitTx(t, agg, false)
+
+	if snap, err = storage.GetSnapshot(ctx, aggId, aggregateType, 1); err != nil {
+		t.Fatalf("getting snapshot failed: %v", err)
+	}
+	if snap.Revision != 2 {
+		t.Errorf("expected the snapshot of rolled back events not stored, but got snapshot at revision: %d", snap.Revision)
+	}
+}
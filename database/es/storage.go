@@ -18,10 +18,39 @@ type StorageBase interface {
 	SaveSnapshot(ctx context.Context, snap *Snapshot) error
 	// GetSnapshot gets the snapshot of the aggregate with it's id, type and version.
 	GetSnapshot(ctx context.Context, aggId string, aggType string, aggVersion int64) (*Snapshot, error)
+	// ListSnapshots lists all the snapshots of given aggregate, of all its versions, ordered by the revision.
+	ListSnapshots(ctx context.Context, aggId string, aggType string) ([]*Snapshot, error)
+	// PruneSnapshots deletes the snapshots of the aggregate with given version, except the latest keep ones.
+	PruneSnapshots(ctx context.Context, aggId string, aggType string, aggVersion int64, keep int) error
 	// ListEventsAfterRevision gets the event stream for given aggregate id, type starting after given revision.
 	ListEventsAfterRevision(ctx context.Context, aggId string, aggType string, from int64) ([]*Event, error)
+	// ListEventsUntilRevision gets the event stream for given aggregate id, type with the revision greater than after,
+	// and lower or equal to until.
+	ListEventsUntilRevision(ctx context.Context, aggId string, aggType string, after, until int64) ([]*Event, error)
+	// ListEventsUntilTimestamp gets the event stream for given aggregate id, type with the revision greater than after,
+	// and the timestamp (unix nano) lower or equal to until.
+	ListEventsUntilTimestamp(ctx context.Context, aggId string, aggType string, after, until int64) ([]*Event, error)
+	// ListLatestSnapshots gets the latest snapshots of the aggregates of given type and version with given ids.
+	// The aggregates without any snapshot are omitted.
+	ListLatestSnapshots(ctx context.Context, aggType string, aggVersion int64, aggIds []string) ([]*Snapshot, error)
+	// ListEventsAfterRevisions lists the events of the aggregates of given type, which ids are the keys of the after map,
+	// with the revision greater than the map value. The events are ordered by the aggregate id and revision.
+	ListEventsAfterRevisions(ctx context.Context, aggType string, after map[string]int64) ([]*Event, error)
+	// GetSnapshotAtRevision gets the latest snapshot of the aggregate with the revision lower or equal to given one.
+	GetSnapshotAtRevision(ctx context.Context, aggId string, aggType string, aggVersion, revision int64) (*Snapshot, error)
+	// GetSnapshotAtTimestamp gets the latest snapshot of the aggregate with the timestamp (unix nano) lower or equal to given one.
+	GetSnapshotAtTimestamp(ctx context.Context, aggId string, aggType string, aggVersion, timestamp int64) (*Snapshot, error)
 	// StreamEvents streams the events that matching given request.
 	StreamEvents(ctx context.Context, req *StreamEventsRequest) (<-chan *Event, error)
+	// QueryEvents gets the events matching given query, ordered by their global position.
+	QueryEvents(ctx context.Context, query *EventQuery) ([]*Event, error)
+	// AggregateExists checks if the aggregate with given id and type is stored.
+	AggregateExists(ctx context.Context, aggId string, aggType string) (bool, error)
+	// ListAggregates lists the aggregates of given type with the catalog position greater than after,
+	// ordered by the position. If the limit is zero, all the aggregates are listed.
+	ListAggregates(ctx context.Context, aggType string, after int64, limit int) ([]*AggregateRecord, error)
+	// CountAggregates counts the aggregates of given type.
+	CountAggregates(ctx context.Context, aggType string) (int64, error)
 	// As allows drivers to expose driver-specific types.
 	As(dst interface{}) error
 	// ErrorCode gets the error code from the storage.
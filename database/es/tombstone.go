@@ -0,0 +1,102 @@
+package es
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kucjac/cleango/cgerrors"
+)
+
+// TombstoneEventType is the event type of the tombstone event, which marks the aggregate as deleted.
+// The tombstone event has no data, and it is never applied on the aggregate.
+const TombstoneEventType = "es.tombstone"
+
+// IsTombstone checks if given event is the tombstone event.
+func IsTombstone(e *Event) bool {
+	return e.EventType == TombstoneEventType
+}
+
+// Delete marks given aggregate as deleted by committing the tombstone event after its uncommitted events.
+// Once deleted, loading the aggregate returns the *DeletedError, and no more events can be committed to it.
+// The deletion fails with the *ConflictError if the aggregate events were concurrently committed.
+// The deleted aggregate events are kept in the storage until they are purged by the storage specific means.
+func (e *Store) Delete(ctx context.Context, agg Aggregate) error {
+	b := agg.AggBase()
+	if b.revision == 0 {
+		return cgerrors.ErrInvalidArgumentf("aggregate: %s with id: %s has no events to delete", b.aggType, b.id)
+	}
+	if err := checkDeleted(b); err != nil {
+		return err
+	}
+	tombstone := &Event{
+		EventId:       b.idGen.GenerateId(),
+		EventType:     TombstoneEventType,
+		AggregateType: b.aggType,
+		AggregateId:   b.id,
+		Timestamp:     time.Now().UTC().UnixNano(),
+		Revision:      b.revision + 1,
+	}
+	b.revision++
+	b.timestamp = tombstone.Timestamp
+	b.uncommittedEvents = append(b.uncommittedEvents, tombstone)
+
+	// The tombstone can't be applied on the reloaded aggregate, thus the conflicts are never retried.
+	return e.Commit(WithCommitPolicy(ctx, CommitPolicy{Strategy: ConflictFail}), agg)
+}
+
+// checkDeleted returns the *DeletedError if the aggregate was deleted with its latest committed events.
+func checkDeleted(b *AggregateBase) error {
+	if n := len(b.committedEvents); n > 0 && IsTombstone(b.committedEvents[n-1]) {
+		return newDeletedError(b.committedEvents[n-1])
+	}
+	return nil
+}
+
+// checkTombstone returns the *DeletedError if the last of the loaded events is the tombstone.
+func checkTombstone(events []*Event) error {
+	if n := len(events); n > 0 && IsTombstone(events[n-1]) {
+		return newDeletedError(events[n-1])
+	}
+	return nil
+}
+
+func newDeletedError(tombstone *Event) *DeletedError {
+	return &DeletedError{
+		AggregateID:   tombstone.AggregateId,
+		AggregateType: tombstone.AggregateType,
+		Revision:      tombstone.Revision,
+		DeletedAt:     tombstone.Time(),
+	}
+}
+
+// Compile time check if DeletedError implements cgerrors.ErrorCoder.
+var _ cgerrors.ErrorCoder = (*DeletedError)(nil)
+
+// DeletedError is the error returned when loading or committing the aggregate deleted with the tombstone event.
+// It has the cgerrors.CodeNotFound code, so that the deleted aggregates are treated as not existing ones.
+type DeletedError struct {
+	AggregateID   string
+	AggregateType string
+	// Revision is the revision of the tombstone event.
+	Revision int64
+	// DeletedAt is the time of the tombstone event.
+	DeletedAt time.Time
+}
+
+// Error implements error interface.
+func (e *DeletedError) Error() string {
+	return fmt.Sprintf("aggregate: %s with id: %s was deleted at revision: %d", e.AggregateType, e.AggregateID, e.Revision)
+}
+
+// ErrorCode implements cgerrors.ErrorCoder interface.
+func (e *DeletedError) ErrorCode(error) cgerrors.ErrorCode {
+	return cgerrors.CodeNotFound
+}
+
+// IsDeleted checks if given error is a *DeletedError.
+func IsDeleted(err error) bool {
+	var de *DeletedError
+	return errors.As(err, &de)
+}
@@ -0,0 +1,112 @@
+package es_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/codec"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esmem"
+)
+
+func TestStoreDelete(t *testing.T) {
+	ctx := context.Background()
+	const (
+		aggId    = "9f4b2d6e-8a1c-4e3f-b5d7-2c6e0a8f4b13"
+		otherId  = "3e7a1c5f-9d2b-4f6a-8c0e-4b8d2f6a0c57"
+		snapshot = 2
+	)
+	cfg := es.DefaultConfig()
+	cfg.Snapshot = es.SnapshotConfig{Policy: es.EveryNEvents(snapshot)}
+	store, err := es.New(cfg, codec.JSON(), codec.JSON(), esmem.New())
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+	for _, id := range []string{aggId, otherId} {
+		agg := getTestAggregate(store, id)
+		if err = agg.Base.SetEvent(&aggregateCreated{}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		if err = store.Commit(ctx, agg); err != nil {
+			t.Fatalf("committing aggregate failed: %v", err)
+		}
+	}
+
+	agg := getTestAggregate(store, aggId)
+	if err = store.LoadEvents(ctx, agg); err != nil {
+		t.Fatalf("loading aggregate failed: %v", err)
+	}
+	// The tombstone is committed at the revision matching the snapshot policy, but it is never snapshotted.
+	if err = store.Delete(ctx, agg); err != nil {
+		t.Fatalf("deleting aggregate failed: %v", err)
+	}
+
+	t.Run("Load", func(t *testing.T) {
+		loaded := getTestAggregate(store, aggId)
+		err := store.LoadEvents(ctx, loaded)
+		if !es.IsDeleted(err) {
+			t.Fatalf("expected deleted error but got: %v", err)
+		}
+		if !cgerrors.IsNotFound(err) {
+			t.Errorf("expected deleted error to have not found code")
+		}
+		loaded = getTestAggregate(store, aggId)
+		if err = store.LoadEventsWithSnapshot(ctx, loaded); !es.IsDeleted(err) {
+			t.Errorf("expected deleted error on loading with snapshot but got: %v", err)
+		}
+		loaded = getTestAggregate(store, aggId)
+		if err = store.LoadEventsAtRevision(ctx, loaded, 1); err != nil {
+			t.Errorf("loading aggregate before deletion failed: %v", err)
+		}
+	})
+
+	t.Run("Commit", func(t *testing.T) {
+		if err := agg.Base.SetEvent(&aggregateNameChanged{Name: "name"}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		if err := store.Commit(ctx, agg); !es.IsDeleted(err) {
+			t.Errorf("expected deleted error on commit but got: %v", err)
+		}
+		if err := store.Delete(ctx, agg); !es.IsDeleted(err) {
+			t.Errorf("expected deleted error on repeated delete but got: %v", err)
+		}
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		stale := getTestAggregate(store, otherId)
+		if err := store.LoadEvents(ctx, stale); err != nil {
+			t.Fatalf("loading aggregate failed: %v", err)
+		}
+		concurrent := getTestAggregate(store, otherId)
+		if err := store.LoadEvents(ctx, concurrent); err != nil {
+			t.Fatalf("loading aggregate failed: %v", err)
+		}
+		if err := concurrent.Base.SetEvent(&aggregateNameChanged{Name: "concurrent"}); err != nil {
+			t.Fatalf("setting event failed: %v", err)
+		}
+		if err := store.Commit(ctx, concurrent); err != nil {
+			t.Fatalf("committing aggregate failed: %v", err)
+		}
+		if err := store.Delete(ctx, stale); !es.IsConflict(err) {
+			t.Errorf("expected conflict error but got: %v", err)
+		}
+	})
+
+	t.Run("StreamExcludeDeleted", func(t *testing.T) {
+		stream, err := store.StreamEvents(ctx, &es.StreamEventsRequest{ExcludeDeleted: true})
+		if err != nil {
+			t.Fatalf("opening stream failed: %v", err)
+		}
+		var count int
+		for e := range stream {
+			if e.AggregateId == aggId {
+				t.Errorf("unexpected event: %s of the deleted aggregate", e.EventType)
+			}
+			count++
+		}
+		if count != 2 {
+			t.Errorf("expected 2 events of the other aggregate but got: %d", count)
+		}
+	})
+}
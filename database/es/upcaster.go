@@ -0,0 +1,132 @@
+package es
+
+import (
+	"sync"
+
+	"github.com/kucjac/cleango/cgerrors"
+)
+
+// Upcaster transforms a stored event of given type and schema version into its newer shape.
+// An upcaster could rename an event, change its data or split it into multiple events.
+// Each resulting event needs to have an EventVersion greater than the input event, so that the chain of the upcasters is finite.
+// The resulting events keep the revision of the stored event.
+type Upcaster interface {
+	Upcast(e *Event) ([]*Event, error)
+}
+
+// UpcasterFunc is a function that implements Upcaster interface.
+type UpcasterFunc func(e *Event) ([]*Event, error)
+
+// Upcast implements Upcaster interface.
+func (u UpcasterFunc) Upcast(e *Event) ([]*Event, error) {
+	return u(e)
+}
+
+// RenameUpcaster creates an upcaster that changes the type of the event to newType, and increases its version.
+func RenameUpcaster(newType string) Upcaster {
+	return UpcasterFunc(func(e *Event) ([]*Event, error) {
+		e.EventType = newType
+		e.EventVersion++
+		return []*Event{e}, nil
+	})
+}
+
+// DataUpcaster creates an upcaster that transforms the event data into the shape of the next version.
+func DataUpcaster(fn func(data []byte) ([]byte, error)) Upcaster {
+	return UpcasterFunc(func(e *Event) ([]*Event, error) {
+		data, err := fn(e.EventData)
+		if err != nil {
+			return nil, err
+		}
+		e.EventData = data
+		e.EventVersion++
+		return []*Event{e}, nil
+	})
+}
+
+type upcasterKey struct {
+	eventType string
+	version   int32
+}
+
+// UpcasterRegistry is a registry of the event upcasters keyed by the event type and its schema version.
+type UpcasterRegistry struct {
+	l         sync.RWMutex
+	upcasters map[upcasterKey]Upcaster
+}
+
+// NewUpcasterRegistry creates a new empty upcaster registry.
+func NewUpcasterRegistry() *UpcasterRegistry {
+	return &UpcasterRegistry{upcasters: map[upcasterKey]Upcaster{}}
+}
+
+// Register registers the upcaster for the events of given type stored with given schema version.
+func (r *UpcasterRegistry) Register(eventType string, version int32, u Upcaster) error {
+	if u == nil {
+		return cgerrors.ErrInternal("provided nil upcaster")
+	}
+	r.l.Lock()
+	defer r.l.Unlock()
+	k := upcasterKey{eventType: eventType, version: version}
+	if _, ok := r.upcasters[k]; ok {
+		return cgerrors.ErrAlreadyExistsf("upcaster for event type: %s with version: %d already registered", eventType, version)
+	}
+	r.upcasters[k] = u
+	return nil
+}
+
+// Len gets the number of registered upcasters.
+func (r *UpcasterRegistry) Len() int {
+	r.l.RLock()
+	defer r.l.RUnlock()
+	return len(r.upcasters)
+}
+
+// Upcast transforms input events into their current shape.
+// Events without a matching upcaster are returned as they are.
+func (r *UpcasterRegistry) Upcast(events []*Event) ([]*Event, error) {
+	if r.Len() == 0 {
+		return events, nil
+	}
+	result := make([]*Event, 0, len(events))
+	for _, e := range events {
+		upcasted, err := r.UpcastEvent(e)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, upcasted...)
+	}
+	return result, nil
+}
+
+// UpcastEvent transforms a single event into its current shape, by applying the chain of the matching upcasters.
+func (r *UpcasterRegistry) UpcastEvent(e *Event) ([]*Event, error) {
+	u, ok := r.get(e)
+	if !ok {
+		return []*Event{e}, nil
+	}
+	upcasted, err := u.Upcast(e.Copy())
+	if err != nil {
+		return nil, cgerrors.Wrapf(err, cgerrors.Code(err), "upcasting event: %s of type: %s with version: %d failed", e.EventId, e.EventType, e.EventVersion)
+	}
+
+	var result []*Event
+	for _, ue := range upcasted {
+		if ue.EventVersion <= e.EventVersion {
+			return nil, cgerrors.ErrInternalf("upcasted event: %s of type: %s has not increased its version: %d", e.EventId, ue.EventType, ue.EventVersion)
+		}
+		next, err := r.UpcastEvent(ue)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, next...)
+	}
+	return result, nil
+}
+
+func (r *UpcasterRegistry) get(e *Event) (Upcaster, bool) {
+	r.l.RLock()
+	defer r.l.RUnlock()
+	u, ok := r.upcasters[upcasterKey{eventType: e.EventType, version: e.EventVersion}]
+	return u, ok
+}
@@ -0,0 +1,181 @@
+package es_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kucjac/cleango/cgerrors"
+	"github.com/kucjac/cleango/codec"
+	"github.com/kucjac/cleango/database/es"
+	"github.com/kucjac/cleango/database/es/esmem"
+)
+
+const (
+	legacyNameSetType = "aggregate:name_set"
+	legacyRenamedType = "aggregate:renamed"
+)
+
+func TestUpcasterRegistry(t *testing.T) {
+	t.Run("Rename", func(t *testing.T) {
+		r := es.NewUpcasterRegistry()
+		if err := r.Register(legacyNameSetType, 0, es.RenameUpcaster(aggregateNameChangedType)); err != nil {
+			t.Fatalf("registering upcaster failed: %v", err)
+		}
+		if err := r.Register(legacyNameSetType, 0, es.RenameUpcaster(aggregateNameChangedType)); err == nil {
+			t.Error("expected error on duplicated upcaster registration")
+		}
+
+		stored := &es.Event{EventId: "1", EventType: legacyNameSetType, Revision: 1}
+		events, err := r.Upcast([]*es.Event{stored})
+		if err != nil {
+			t.Fatalf("upcasting failed: %v", err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("expected single event but got: %d", len(events))
+		}
+		if events[0].EventType != aggregateNameChangedType || events[0].EventVersion != 1 {
+			t.Errorf("unexpected upcasted event: %v", events[0])
+		}
+		if stored.EventType != legacyNameSetType {
+			t.Error("upcasting should not modify the input event")
+		}
+	})
+
+	t.Run("Chain", func(t *testing.T) {
+		r := es.NewUpcasterRegistry()
+		_ = r.Register(legacyRenamedType, 0, es.RenameUpcaster(legacyNameSetType))
+		_ = r.Register(legacyNameSetType, 1, es.DataUpcaster(func(data []byte) ([]byte, error) {
+			return bytes.ReplaceAll(data, []byte("title"), []byte("name")), nil
+		}))
+
+		events, err := r.Upcast([]*es.Event{{EventType: legacyRenamedType, EventData: []byte(`{"title":"N"}`)}})
+		if err != nil {
+			t.Fatalf("upcasting failed: %v", err)
+		}
+		if len(events) != 1 || events[0].EventVersion != 2 || string(events[0].EventData) != `{"name":"N"}` {
+			t.Errorf("unexpected upcasted events: %v", events)
+		}
+	})
+
+	t.Run("Split", func(t *testing.T) {
+		r := es.NewUpcasterRegistry()
+		_ = r.Register(legacyNameSetType, 0, es.UpcasterFunc(func(e *es.Event) ([]*es.Event, error) {
+			created := e.Copy()
+			created.EventType, created.EventData, created.EventVersion = aggregateCreatedType, []byte(`{}`), 1
+			e.EventType, e.EventVersion = aggregateNameChangedType, 1
+			return []*es.Event{created, e}, nil
+		}))
+
+		events, err := r.Upcast([]*es.Event{{EventType: legacyNameSetType, Revision: 1}})
+		if err != nil {
+			t.Fatalf("upcasting failed: %v", err)
+		}
+		if len(events) != 2 || events[0].EventType != aggregateCreatedType || events[1].EventType != aggregateNameChangedType {
+			t.Errorf("unexpected split events: %v", events)
+		}
+	})
+
+	t.Run("VersionNotIncreased", func(t *testing.T) {
+		r := es.NewUpcasterRegistry()
+		_ = r.Register(legacyNameSetType, 0, es.UpcasterFunc(func(e *es.Event) ([]*es.Event, error) {
+			return []*es.Event{e}, nil
+		}))
+		if _, err := r.Upcast([]*es.Event{{EventType: legacyNameSetType}}); err == nil {
+			t.Error("expected error on upcaster that doesn't increase event version")
+		}
+	})
+}
+
+func TestStoreUpcasting(t *testing.T) {
+	ctx := context.Background()
+	storage := esmem.New()
+	store, err := es.New(es.DefaultConfig(), codec.JSON(), codec.JSON(), storage)
+	if err != nil {
+		t.Fatalf("creating store failed: %v", err)
+	}
+
+	const aggId = "2c8ed0c6-6e0e-4a53-9b7a-0a2b1f3b62e1"
+	err = storage.SaveEvents(ctx, []*es.Event{
+		{EventId: "1", EventType: aggregateCreatedType, AggregateType: aggregateType, AggregateId: aggId, EventData: []byte(`{}`), Timestamp: now(), Revision: 1},
+		{EventId: "2", EventType: legacyNameSetType, AggregateType: aggregateType, AggregateId: aggId, EventData: []byte(`{"title":"Legacy"}`), Timestamp: now(), Revision: 2},
+	})
+	if err != nil {
+		t.Fatalf("saving legacy events failed: %v", err)
+	}
+
+	err = store.RegisterUpcaster(legacyNameSetType, 0, es.UpcasterFunc(func(e *es.Event) ([]*es.Event, error) {
+		e.EventType = aggregateNameChangedType
+		e.EventData = bytes.ReplaceAll(e.EventData, []byte("title"), []byte("name"))
+		e.EventVersion = 1
+		return []*es.Event{e}, nil
+	}))
+	if err != nil {
+		t.Fatalf("registering upcaster failed: %v", err)
+	}
+
+	t.Run("LoadEvents", func(t *testing.T) {
+		agg := getTestAggregate(store, aggId)
+		if err := store.LoadEvents(ctx, agg); err != nil {
+			t.Fatalf("loading events failed: %v", err)
+		}
+		if agg.Name != "Legacy" || agg.Base.Revision() != 2 {
+			t.Errorf("unexpected aggregate state: name: %s, revision: %d", agg.Name, agg.Base.Revision())
+		}
+	})
+
+	t.Run("LoadEventsWithSnapshot", func(t *testing.T) {
+		agg := getTestAggregate(store, aggId)
+		if err := store.LoadEventsWithSnapshot(ctx, agg); err != nil {
+			t.Fatalf("loading events failed: %v", err)
+		}
+		if agg.Name != "Legacy" {
+			t.Errorf("unexpected aggregate name: %s", agg.Name)
+		}
+	})
+
+	t.Run("StreamEvents", func(t *testing.T) {
+		stream, err := store.StreamEvents(ctx, &es.StreamEventsRequest{})
+		if err != nil {
+			t.Fatalf("streaming events failed: %v", err)
+		}
+		var types []string
+		for e := range stream {
+			types = append(types, e.EventType)
+		}
+		if len(types) != 2 || types[1] != aggregateNameChangedType {
+			t.Errorf("unexpected streamed event types: %v", types)
+		}
+	})
+
+	t.Run("StreamEventsFailed", func(t *testing.T) {
+		failing, err := es.New(es.DefaultConfig(), codec.JSON(), codec.JSON(), storage)
+		if err != nil {
+			t.Fatalf("creating store failed: %v", err)
+		}
+		upcastErr := cgerrors.ErrInternal("upcasting failed")
+		err = failing.RegisterUpcaster(legacyNameSetType, 0, es.UpcasterFunc(func(e *es.Event) ([]*es.Event, error) {
+			return nil, upcastErr
+		}))
+		if err != nil {
+			t.Fatalf("registering upcaster failed: %v", err)
+		}
+
+		var streamErr error
+		stream, err := failing.StreamEvents(ctx, &es.StreamEventsRequest{OnError: func(err error) { streamErr = err }})
+		if err != nil {
+			t.Fatalf("streaming events failed: %v", err)
+		}
+		var count int
+		for range stream {
+			count++
+		}
+		if count != 1 {
+			t.Errorf("expected the stream stopped at the failed event, but streamed: %d", count)
+		}
+		if streamErr == nil || !strings.Contains(streamErr.Error(), "upcasting failed") {
+			t.Errorf("expected the upcasting error reported, but got: %v", streamErr)
+		}
+	})
+}